@@ -4,10 +4,20 @@ import (
 	"fmt"
 	flag "github.com/spf13/pflag"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dave1010/jorin/internal/app"
+	"github.com/dave1010/jorin/internal/config"
+	"github.com/dave1010/jorin/internal/mcp"
+	"github.com/dave1010/jorin/internal/openai"
+	"github.com/dave1010/jorin/internal/overlay"
 	"github.com/dave1010/jorin/internal/prompt"
+	"github.com/dave1010/jorin/internal/shell"
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
 	"github.com/dave1010/jorin/internal/version"
 )
 
@@ -16,6 +26,9 @@ type Config struct {
 	repl            bool
 	readonly        bool
 	dryShell        bool
+	persistentShell bool
+	pty             bool
+	ptyIdleTimeout  time.Duration
 	allow           []string
 	deny            []string
 	cwd             string
@@ -25,22 +38,65 @@ type Config struct {
 	ralphMaxTries   int
 	versionFlag     bool
 	useResponsesAPI bool
+	toolTimeout     time.Duration
+	llmTimeout      time.Duration
+	baseURL         string
+	provider        string
+	disabledTools   []string
+	sessionID       string
+	resume          bool
+	noMCP           bool
+	approve         string
+	sandbox         string
+	sandboxNetwork  bool
+	writableDirs    []string
+	roots           []string
+	denyRead        []string
+	denyWrite       []string
+	patchFuzz       int
+	overlay         bool
+	httpAllow       []string
+	httpDeny        []string
+	httpPrivate     bool
 }
 
 func parseFlags() Config {
-	model := flag.String("model", "gpt-5-mini", "Model ID")
+	model := flag.String("model", config.DefaultModel, "Model ID")
 	repl := flag.Bool("repl", false, "Interactive REPL")
-	readonly := flag.Bool("readonly", false, "Disallow write_file")
+	readonly := flag.Bool("readonly", false, "Disallow write_file, edit_file and apply_patch")
 	dry := flag.Bool("dry-shell", false, "Do not execute shell commands")
-	allow := multi("allow", "Allowlist substring for shell (repeatable)")
-	deny := multi("deny", "Denylist substring for shell (repeatable)")
+	persistentShell := flag.Bool("persistent-shell", false, "Run shell commands in one long-lived bash, keeping cd and exported variables between calls")
+	pty := flag.Bool("pty", false, "Run shell commands on a pseudo-terminal, killing them when they wait for input")
+	ptyIdleTimeout := flag.Duration("pty-idle-timeout", config.DefaultPTYIdleTimeout, "With --pty, kill a command after this long without output (0 = no limit)")
+	allow := multi("allow", "Allow rule for shell commands (repeatable)")
+	deny := multi("deny", "Deny rule for shell commands (repeatable)")
 	cwd := flag.String("cwd", "", "Working directory for tools")
 	promptFlag := flag.Bool("prompt", false, "Treat first argument as prompt text")
 	promptFileFlag := flag.Bool("prompt-file", false, "Treat first argument as a prompt file")
 	ralph := flag.Bool("ralph", false, "Enable Ralph Wiggum loop instructions")
-	ralphMaxTries := flag.Int("ralph-max-tries", 8, "Maximum Ralph Wiggum loop iterations")
+	ralphMaxTries := flag.Int("ralph-max-tries", config.DefaultRalphMaxTries, "Maximum Ralph Wiggum loop iterations")
 	versionFlag := flag.Bool("version", false, "Print version and exit")
 	useResponsesAPI := flag.Bool("use-responses-api", false, "Use the new OpenAI Responses API instead of Chat Completions")
+	toolTimeout := flag.Duration("tool-timeout", 0, "Maximum duration of a single tool call (0 = no limit)")
+	llmTimeout := flag.Duration("llm-timeout", 0, "Maximum duration of a single model request (0 = no limit)")
+	baseURL := flag.String("base-url", config.DefaultBaseURL, "API base URL")
+	provider := flag.String("provider", "", "LLM provider: openai, anthropic or ollama (default: from model prefix, else openai)")
+	disabledTools := multi("disable-tool", "Hide a tool from the model (repeatable)")
+	sessionID := flag.String("session", "", "Continue (or create) the saved session with this ID")
+	resume := flag.Bool("resume", false, "Continue the most recent saved session")
+	noMCP := flag.Bool("no-mcp", false, "Do not start MCP servers from mcp.json")
+	approve := flag.String("approve", config.DefaultApprove, "Ask before tool calls: always, writes (file writes and shell), shell or never")
+	sandbox := flag.String("sandbox", config.DefaultSandbox, "Run shell commands in a sandbox: auto, bwrap, nsjail, firejail or none")
+	sandboxNetwork := flag.Bool("sandbox-network", true, "Allow network access inside the sandbox")
+	writableDirs := multi("writable-dir", "Extra directory writable inside the sandbox (repeatable)")
+	roots := multi("root", "Workspace root the file tools are confined to (repeatable; default: git root or working directory)")
+	denyRead := multi("deny-read", "Glob of paths the file tools may not read or write (repeatable)")
+	denyWrite := multi("deny-write", "Glob of paths the file tools may not write (repeatable)")
+	patchFuzz := flag.Int("patch-fuzz", config.DefaultPatchFuzz, "How loosely apply_patch context may match: 0 exact, 1 ignore trailing whitespace, 2 also ignore indentation")
+	overlay := flag.Bool("overlay", false, "Keep file changes in an overlay and ask before applying them to the workspace at the end")
+	httpAllow := multi("http-allow", "Host glob the HTTP tools may reach (repeatable; default: any public host)")
+	httpDeny := multi("http-deny", "Host glob the HTTP tools may not reach (repeatable)")
+	httpPrivate := flag.Bool("http-private", false, "Let the HTTP tools reach loopback, private and link-local addresses")
 	flag.Parse()
 
 	return Config{
@@ -48,6 +104,9 @@ func parseFlags() Config {
 		repl:            *repl,
 		readonly:        *readonly,
 		dryShell:        *dry,
+		persistentShell: *persistentShell,
+		pty:             *pty,
+		ptyIdleTimeout:  *ptyIdleTimeout,
 		allow:           *allow,
 		deny:            *deny,
 		cwd:             *cwd,
@@ -57,6 +116,26 @@ func parseFlags() Config {
 		ralphMaxTries:   *ralphMaxTries,
 		versionFlag:     *versionFlag,
 		useResponsesAPI: *useResponsesAPI,
+		toolTimeout:     *toolTimeout,
+		llmTimeout:      *llmTimeout,
+		baseURL:         *baseURL,
+		provider:        *provider,
+		disabledTools:   *disabledTools,
+		sessionID:       *sessionID,
+		resume:          *resume,
+		noMCP:           *noMCP,
+		approve:         *approve,
+		sandbox:         *sandbox,
+		sandboxNetwork:  *sandboxNetwork,
+		writableDirs:    *writableDirs,
+		roots:           *roots,
+		denyRead:        *denyRead,
+		denyWrite:       *denyWrite,
+		patchFuzz:       *patchFuzz,
+		overlay:         *overlay,
+		httpAllow:       *httpAllow,
+		httpDeny:        *httpDeny,
+		httpPrivate:     *httpPrivate,
 	}
 }
 
@@ -69,13 +148,175 @@ func handlePreflight(cli Config) {
 		fmt.Fprintln(os.Stderr, "ERR: flag --prompt and --prompt-file cannot be used together")
 		os.Exit(2)
 	}
-	if cli.ralph {
+	if cli.sessionID != "" && cli.resume {
+		fmt.Fprintln(os.Stderr, "ERR: flag --session and --resume cannot be used together")
+		os.Exit(2)
+	}
+}
+
+// loadSettings merges, from lowest to highest precedence: built-in defaults,
+// the user config file, the nearest project .jorin/config, environment
+// variables and explicitly set flags.
+func loadSettings(cli Config) (*config.Config, configPaths, error) {
+	var paths configPaths
+	paths.user, _ = config.UserPath()
+	if wd, err := os.Getwd(); err == nil {
+		paths.project = config.FindProjectPath(wd)
+	}
+	user, err := config.FileLayer(config.SourceUser, paths.user)
+	if err != nil {
+		return nil, paths, err
+	}
+	project, err := config.FileLayer(config.SourceProject, paths.project)
+	if err != nil {
+		return nil, paths, err
+	}
+	settings, err := config.Load(user, project, config.EnvLayer(os.Getenv), flagLayer(cli))
+	return settings, paths, err
+}
+
+// loadMCPServers reads the MCP server definitions for this run.
+func loadMCPServers(cli Config) ([]mcp.ServerConfig, error) {
+	if cli.noMCP {
+		return nil, nil
+	}
+	dir := cli.cwd
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	return mcp.LoadConfig(mcp.ConfigPaths(dir)...)
+}
+
+// flagLayer returns the config values of flags set on the command line.
+func flagLayer(cli Config) config.Layer {
+	l := config.Layer{Kind: config.SourceFlag, Values: map[string][]string{}, Details: map[string]string{}}
+	add := func(name, key string, vals ...string) {
+		if flag.CommandLine.Changed(name) {
+			l.Values[key] = vals
+			l.Details[key] = "--" + name
+		}
+	}
+	apiMode := config.APIModeChat
+	if cli.useResponsesAPI {
+		apiMode = config.APIModeResponses
+	}
+	add("model", "model", cli.model)
+	add("provider", "provider", cli.provider)
+	add("base-url", "base_url", cli.baseURL)
+	add("use-responses-api", "api_mode", apiMode)
+	add("readonly", "readonly", strconv.FormatBool(cli.readonly))
+	add("dry-shell", "dry_shell", strconv.FormatBool(cli.dryShell))
+	add("persistent-shell", "persistent_shell", strconv.FormatBool(cli.persistentShell))
+	add("pty", "pty", strconv.FormatBool(cli.pty))
+	add("pty-idle-timeout", "pty_idle_timeout", cli.ptyIdleTimeout.String())
+	add("allow", "allow", cli.allow...)
+	add("deny", "deny", cli.deny...)
+	add("disable-tool", "disabled_tools", cli.disabledTools...)
+	add("ralph", "ralph", strconv.FormatBool(cli.ralph))
+	add("ralph-max-tries", "ralph_max_tries", strconv.Itoa(cli.ralphMaxTries))
+	add("tool-timeout", "tool_timeout", cli.toolTimeout.String())
+	add("llm-timeout", "llm_timeout", cli.llmTimeout.String())
+	add("approve", "approve", cli.approve)
+	add("sandbox", "sandbox", cli.sandbox)
+	add("sandbox-network", "sandbox_network", strconv.FormatBool(cli.sandboxNetwork))
+	add("writable-dir", "writable_dirs", cli.writableDirs...)
+	add("root", "roots", cli.roots...)
+	add("deny-read", "deny_read", cli.denyRead...)
+	add("deny-write", "deny_write", cli.denyWrite...)
+	add("patch-fuzz", "patch_fuzz", strconv.Itoa(cli.patchFuzz))
+	add("http-allow", "http_allow", cli.httpAllow...)
+	add("http-deny", "http_deny", cli.httpDeny...)
+	add("http-private", "http_private", strconv.FormatBool(cli.httpPrivate))
+	return l
+}
+
+// applySettings configures package-level state from the merged settings.
+func applySettings(s *config.Config) {
+	if s.Ralph {
 		prompt.EnableRalph()
 	}
-	if cli.ralphMaxTries < 1 {
-		fmt.Fprintln(os.Stderr, "ERR: flag --ralph-max-tries must be at least 1")
-		os.Exit(2)
+	openai.BaseURL = s.BaseURL
+	openai.RequestTimeout = s.LLMTimeout
+	tools.PatchFuzz = s.PatchFuzz
+}
+
+// configureSandbox installs the shell runner selected by the settings.
+// Commands may write to workDir, the working directory or the overlay's
+// scratch copy, plus writable_dirs.
+func configureSandbox(s *config.Config, workDir string) error {
+	if workDir == "" {
+		workDir, _ = os.Getwd()
+	}
+	r, err := shell.NewRunner(shell.SandboxConfig{
+		Kind:      s.Sandbox,
+		Writable:  append([]string{workDir}, s.WritableDirs...),
+		NoNetwork: !s.SandboxNetwork,
+		Limits: shell.Limits{
+			CPU:      s.SandboxCPU,
+			MemoryMB: s.SandboxMemory,
+			Procs:    s.SandboxProcs,
+		},
+	})
+	if err != nil {
+		return err
 	}
+	shell.DefaultRunner = r
+	return nil
+}
+
+// openOverlay puts the workspace root under an overlay, so the run's file
+// changes stay out of it until they are applied.
+func openOverlay(pol *types.Policy) (*overlay.FS, error) {
+	if len(pol.Roots) != 1 {
+		return nil, fmt.Errorf("--overlay needs a single workspace root, got %d", len(pol.Roots))
+	}
+	ov, err := overlay.New(pol.Roots[0])
+	if err != nil {
+		return nil, err
+	}
+	pol.FS = ov
+	return ov, nil
+}
+
+// workspaceRoots returns the directories the file tools are confined to:
+// the roots setting, relative to cwd, or else the git root of cwd, or cwd.
+func workspaceRoots(s *config.Config, cwd string) []string {
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	cwd, _ = filepath.Abs(cwd)
+	if len(s.Roots) == 0 {
+		return []string{gitRoot(cwd)}
+	}
+	roots := make([]string, 0, len(s.Roots))
+	for _, r := range s.Roots {
+		if !filepath.IsAbs(r) {
+			r = filepath.Join(cwd, r)
+		}
+		roots = append(roots, filepath.Clean(r))
+	}
+	return roots
+}
+
+// gitRoot returns the nearest directory at or above dir containing .git, or
+// dir if there is none.
+func gitRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// explicit reports whether key was set for this run (by environment or flag)
+// rather than by a default or config file.
+func explicit(s *config.Config, key string) bool {
+	return s.Source(key).Kind >= config.SourceEnv
 }
 
 func resolvePromptMode(promptFlag bool, promptFileFlag bool) promptMode {
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dave1010/jorin/internal/config"
+)
+
+const configUsage = `usage: jorin config <command>
+
+commands:
+  show    Print the effective settings and where each value came from`
+
+// configPaths records the config files considered for this run.
+type configPaths struct {
+	user    string
+	project string
+}
+
+func runConfigCommand(settings *config.Config, paths configPaths, args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "show" {
+		return errors.New(configUsage)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "user config:\t%s\n", describeConfigPath(paths.user))
+	fmt.Fprintf(tw, "project config:\t%s\n", describeConfigPath(paths.project))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(out); err != nil {
+		return err
+	}
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, key := range config.Keys {
+		var srcs []string
+		for _, s := range settings.Sources(key) {
+			srcs = append(srcs, s.String())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", key, settings.Value(key), strings.Join(srcs, " + "))
+	}
+	return tw.Flush()
+}
+
+func describeConfigPath(p string) string {
+	if p == "" {
+		return "(none)"
+	}
+	if _, err := os.Stat(p); err != nil {
+		return p + " (not found)"
+	}
+	return p
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/config"
+)
+
+func TestRunConfigCommandShowsSources(t *testing.T) {
+	settings, err := config.Load(
+		config.Layer{Kind: config.SourceProject, Detail: "/repo/.jorin/config", Values: map[string][]string{"readonly": {"true"}, "deny": {"sudo"}}},
+		config.Layer{Kind: config.SourceFlag, Values: map[string][]string{"deny": {"curl"}}, Details: map[string]string{"deny": "--deny"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := configPaths{user: filepath.Join(t.TempDir(), "missing"), project: ""}
+
+	var out bytes.Buffer
+	if err := runConfigCommand(settings, paths, []string{"show"}, &out); err != nil {
+		t.Fatalf("config show: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"(not found)",
+		"project config:  (none)",
+		"readonly          true",
+		"project config /repo/.jorin/config",
+		"[sudo, curl]",
+		"project config /repo/.jorin/config + flag --deny",
+		"model             " + config.DefaultModel,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+
+	if err := runConfigCommand(settings, paths, []string{"edit"}, &out); err == nil {
+		t.Fatalf("expected usage error for unknown subcommand")
+	}
+}
@@ -7,43 +7,153 @@ import (
 	"os"
 
 	"github.com/dave1010/jorin/internal/app"
-	"github.com/dave1010/jorin/internal/types"
+	"github.com/dave1010/jorin/internal/checkpoint"
+	"github.com/dave1010/jorin/internal/config"
+	"github.com/dave1010/jorin/internal/overlay"
+	"github.com/dave1010/jorin/internal/shell"
 )
 
 func main() {
 	cli := parseFlags()
 	handlePreflight(cli)
+	settings, paths, err := loadSettings(cli)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERR: config:", err)
+		os.Exit(2)
+	}
+	for _, w := range settings.Warnings() {
+		fmt.Fprintln(os.Stderr, "WARN: config:", w)
+	}
+	applySettings(settings)
+	pol, err := newPolicy(settings, cli.cwd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERR: policy:", err)
+		os.Exit(2)
+	}
 
+	store := openSessionStore()
+	checkpoints, _ := checkpoint.DefaultDir()
 	promptMode := resolvePromptMode(cli.promptFlag, cli.promptFileFlag)
+	args := flag.Args()
+	if promptMode == promptModeAuto && len(args) > 0 && args[0] == "config" {
+		if err := runConfigCommand(settings, paths, args[1:], os.Stdout); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+	if promptMode == promptModeAuto && len(args) > 0 && args[0] == "policy" {
+		if err := runPolicyCommand(&pol, args[1:], os.Stdout); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+	if promptMode == promptModeAuto && len(args) > 0 && args[0] == "undo" {
+		if err := runUndoCommand(checkpoints, pol.CWD, args[1:], os.Stdout); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+	if promptMode == promptModeAuto && len(args) > 0 && args[0] == "sessions" {
+		id, err := runSessionsCommand(store, args[1:], os.Stdout)
+		if err != nil {
+			exitWithError(err)
+		}
+		if id == "" {
+			return
+		}
+		cli.sessionID = id
+		cli.repl = true
+		args = nil
+	}
+	serveMCP := false
+	if promptMode == promptModeAuto && len(args) > 0 && args[0] == "mcp" {
+		if err := parseMCPCommand(args[1:]); err != nil {
+			exitWithError(err)
+		}
+		// a server must not start MCP servers of its own
+		serveMCP = true
+		cli.noMCP = true
+		args = nil
+	}
+
+	if settings.PTY && settings.PersistentShell {
+		fmt.Fprintln(os.Stderr, "ERR: config: pty cannot be used with persistent_shell")
+		os.Exit(2)
+	}
+	if settings.PTY && !shell.PTYSupported {
+		fmt.Fprintln(os.Stderr, "ERR: config: pty is only supported on Linux")
+		os.Exit(2)
+	}
+
 	stdinIsTTY := isTTY(os.Stdin)
-	promptText, scriptArgs, err := resolvePrompt(flag.Args(), promptMode)
+	promptText, scriptArgs, err := resolvePrompt(args, promptMode)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "ERR:", err)
 		os.Exit(1)
 	}
-	noArgs := len(flag.Args()) == 0 && stdinIsTTY
+	noArgs := len(args) == 0 && stdinIsTTY
+	mcpServers, err := loadMCPServers(cli)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERR: mcp config:", err)
+		os.Exit(2)
+	}
+
+	workDir := cli.cwd
+	var ov *overlay.FS
+	if cli.overlay {
+		if serveMCP {
+			fmt.Fprintln(os.Stderr, "ERR: --overlay cannot be used with mcp serve")
+			os.Exit(2)
+		}
+		if ov, err = openOverlay(&pol); err != nil {
+			fmt.Fprintln(os.Stderr, "ERR: overlay:", err)
+			os.Exit(2)
+		}
+		workDir = ov.Dir()
+	}
+	if err := configureSandbox(settings, workDir); err != nil {
+		if ov != nil {
+			_ = ov.Close()
+		}
+		fmt.Fprintln(os.Stderr, "ERR: sandbox:", err)
+		os.Exit(2)
+	}
 
 	cfg := app.Config{
-		Model:           cli.model,
+		Model:           settings.Model,
 		Prompt:          promptText,
 		Repl:            cli.repl,
 		NoArgs:          noArgs,
 		ScriptArgs:      scriptArgs,
-		RalphMaxTries:   cli.ralphMaxTries,
-		UseResponsesAPI: cli.useResponsesAPI,
-		Policy: types.Policy{
-			Readonly: cli.readonly,
-			DryShell: cli.dryShell,
-			Allow:    cli.allow,
-			Deny:     cli.deny,
-			CWD:      cli.cwd,
-		},
-		Stdin:      os.Stdin,
-		StdinIsTTY: stdinIsTTY,
-		Stdout:     os.Stdout,
-		Stderr:     os.Stderr,
-	}
-	if err := app.NewApp(&cfg).Run(context.Background()); err != nil {
+		RalphMaxTries:   settings.RalphMaxTries,
+		UseResponsesAPI: settings.APIMode == config.APIModeResponses,
+		Provider:        settings.Provider,
+		Policy:          pol,
+		PersistentShell: settings.PersistentShell,
+		PTY:             settings.PTY,
+
+		Stdin:       os.Stdin,
+		StdinIsTTY:  stdinIsTTY,
+		Stdout:      os.Stdout,
+		StdoutIsTTY: isTTY(os.Stdout),
+		Stderr:      os.Stderr,
+		Sessions:    store,
+		SessionID:   cli.sessionID,
+		Resume:      cli.resume,
+		ModelSet:    explicit(settings, "model"),
+		APIModeSet:  explicit(settings, "api_mode"),
+		ProviderSet: explicit(settings, "provider"),
+		MCPServers:  mcpServers,
+		Checkpoints: checkpoints,
+		Overlay:     ov,
+	}
+	a := app.NewApp(&cfg)
+	if serveMCP {
+		err = a.ServeMCP(context.Background())
+	} else {
+		err = a.Run(context.Background())
+	}
+	if err != nil {
 		exitWithError(err)
 	}
 }
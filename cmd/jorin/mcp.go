@@ -0,0 +1,17 @@
+package main
+
+import "errors"
+
+const mcpUsage = `usage: jorin mcp <command>
+
+commands:
+  serve   Serve Jorin's tools and a run_agent tool to an MCP client over stdio`
+
+// parseMCPCommand validates the arguments of `jorin mcp`. serve is the only
+// command; the run itself is started by main once the app is configured.
+func parseMCPCommand(args []string) error {
+	if len(args) != 1 || args[0] != "serve" {
+		return errors.New(mcpUsage)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dave1010/jorin/internal/config"
+	"github.com/dave1010/jorin/internal/policy"
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+const policyUsage = `usage: jorin policy <command>
+
+commands:
+  test <tool> ['<json args>']  Show which rules decide a tool call`
+
+// newPolicy builds the session policy from the settings and the policy
+// files that apply in cwd.
+func newPolicy(settings *config.Config, cwd string) (types.Policy, error) {
+	dir := cwd
+	if dir == "" {
+		dir = "."
+	}
+	files, err := policy.Load(policy.Paths(dir)...)
+	if err != nil {
+		return types.Policy{}, err
+	}
+	return types.Policy{
+		Readonly:        settings.Readonly,
+		DryShell:        settings.DryShell,
+		Allow:           settings.Allow,
+		Deny:            settings.Deny,
+		DisabledTools:   settings.DisabledTools,
+		CWD:             cwd,
+		Roots:           workspaceRoots(settings, cwd),
+		DenyRead:        settings.DenyRead,
+		DenyWrite:       settings.DenyWrite,
+		HTTPAllow:       settings.HTTPAllow,
+		HTTPDeny:        settings.HTTPDeny,
+		HTTPPrivate:     settings.HTTPPrivate,
+		HTTPCredentials: expandCredentials(settings.HTTPCredentials),
+		ToolTimeout:     settings.ToolTimeout,
+		PTYIdleTimeout:  ptyIdleTimeout(settings.PTYIdleTimeout),
+		Approve:         settings.Approve,
+		RuleFiles:       files,
+	}, nil
+}
+
+// ptyIdleTimeout converts the pty_idle_timeout setting, where 0 means no
+// limit, to types.Policy.PTYIdleTimeout, where that is negative.
+func ptyIdleTimeout(d time.Duration) time.Duration {
+	if d == 0 {
+		return -1
+	}
+	return d
+}
+
+// expandCredentials returns creds with $NAME and ${NAME} in their values
+// replaced by environment variables.
+func expandCredentials(creds []types.HTTPCredential) []types.HTTPCredential {
+	out := make([]types.HTTPCredential, len(creds))
+	for i, c := range creds {
+		c.Value = os.ExpandEnv(c.Value)
+		out[i] = c
+	}
+	return out
+}
+
+func runPolicyCommand(p *types.Policy, args []string, out io.Writer) error {
+	if len(args) < 2 || len(args) > 3 || args[0] != "test" {
+		return errors.New(policyUsage)
+	}
+	callArgs := map[string]any{}
+	if len(args) == 3 {
+		if err := json.Unmarshal([]byte(args[2]), &callArgs); err != nil {
+			return fmt.Errorf("json args: %w", err)
+		}
+	}
+	calls := tools.PolicyCalls(args[1], callArgs)
+	names := []string{policy.SettingsSource}
+	for _, f := range p.RuleFiles {
+		names = append(names, f.Path)
+	}
+	for i, call := range calls {
+		if len(calls) > 1 {
+			// one table for each file a patch touches
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "path: %s\n", call.Path)
+		}
+		_, sources := policy.Explain(p, call)
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SOURCE\tDECISION\tRULE")
+		for i, r := range sources {
+			if !r.Matched() {
+				fmt.Fprintf(tw, "%s\t%s\t(no rule matched)\n", names[i], r.Decision)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Where(), r.Decision, r.Rule)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	res := policy.CheckAll(p, calls)
+	if res.Message != "" {
+		_, err := fmt.Fprintf(out, "\ndecision: %s (%s)\n", res.Decision, res.Message)
+		return err
+	}
+	_, err := fmt.Fprintf(out, "\ndecision: %s\n", res.Decision)
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestRunPolicyCommandExplainsDecision(t *testing.T) {
+	p := &types.Policy{
+		Approve: types.ApproveShell,
+		RuleFiles: []types.PolicyFile{{Path: "/repo/.jorin/policy.yaml", Rules: []types.PolicyRule{
+			{Tools: []string{"shell"}, Commands: []string{"git push"}, Decision: types.DecisionDeny, Message: "no pushing", Line: 2},
+		}}},
+	}
+	var out bytes.Buffer
+	if err := runPolicyCommand(p, []string{"test", "shell", `{"cmd":"git push origin"}`}, &out); err != nil {
+		t.Fatalf("policy test: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"settings                    ask       tool: shell, decision: ask",
+		"/repo/.jorin/policy.yaml:2  deny      tool: shell, command: git push, decision: deny",
+		"decision: deny (no pushing)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+
+	out.Reset()
+	if err := runPolicyCommand(p, []string{"test", "read_file"}, &out); err != nil {
+		t.Fatalf("policy test: %v", err)
+	}
+	if !strings.Contains(out.String(), "(no rule matched)") || !strings.HasSuffix(out.String(), "decision: allow\n") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	if err := runPolicyCommand(p, []string{"test", "shell", "{"}, &out); err == nil {
+		t.Fatalf("expected an error for invalid JSON args")
+	}
+	if err := runPolicyCommand(p, []string{"check"}, &out); err == nil || !strings.HasPrefix(err.Error(), "usage: jorin policy") {
+		t.Fatalf("expected usage, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,7 +13,7 @@ import (
 func TestRegistryReadWriteAndShell(t *testing.T) {
 	r := registry()
 	// read_file missing path
-	if _, err := r["read_file"](map[string]any{}, &types.Policy{}); err == nil {
+	if _, err := r["read_file"](context.Background(), map[string]any{}, &types.Policy{}); err == nil {
 		t.Fatalf("expected error for missing path")
 	}
 
@@ -22,7 +23,7 @@ func TestRegistryReadWriteAndShell(t *testing.T) {
 	if err := os.WriteFile(fpath, []byte("hello world"), 0o644); err != nil {
 		t.Fatalf("write temp file: %v", err)
 	}
-	out, err := r["read_file"](map[string]any{"path": fpath}, &types.Policy{})
+	out, err := r["read_file"](context.Background(), map[string]any{"path": fpath}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("read_file failed: %v", err)
 	}
@@ -33,7 +34,7 @@ func TestRegistryReadWriteAndShell(t *testing.T) {
 	// write_file readonly
 	wf := r["write_file"]
 	ro := &types.Policy{Readonly: true}
-	outw, err := wf(map[string]any{"path": filepath.Join(tmpDir, "x.txt"), "text": "ok"}, ro)
+	outw, err := wf(context.Background(), map[string]any{"path": filepath.Join(tmpDir, "x.txt"), "text": "ok"}, ro)
 	if err != nil {
 		t.Fatalf("write_file returned err: %v", err)
 	}
@@ -42,7 +43,7 @@ func TestRegistryReadWriteAndShell(t *testing.T) {
 	}
 
 	// write_file success
-	outw, err = wf(map[string]any{"path": filepath.Join(tmpDir, "x.txt"), "text": "ok"}, &types.Policy{})
+	outw, err = wf(context.Background(), map[string]any{"path": filepath.Join(tmpDir, "x.txt"), "text": "ok"}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("write_file failed: %v", err)
 	}
@@ -54,36 +55,36 @@ func TestRegistryReadWriteAndShell(t *testing.T) {
 	}
 
 	// shell missing cmd
-	if _, err := r["shell"](map[string]any{}, &types.Policy{}); err == nil {
+	if _, err := r["shell"](context.Background(), map[string]any{}, &types.Policy{}); err == nil {
 		t.Fatalf("expected error for missing shell cmd")
 	}
 
 	// shell deny
 	polD := &types.Policy{Deny: []string{"forbidden"}}
-	outS, _ := r["shell"](map[string]any{"cmd": "do something forbidden now"}, polD)
-	if outS["error"] != "denied by policy" {
+	outS, _ := r["shell"](context.Background(), map[string]any{"cmd": "do something forbidden now"}, polD)
+	if e, _ := outS["error"].(string); !strings.HasPrefix(e, "denied by policy: ") {
 		t.Fatalf("expected denied by policy, got: %#v", outS)
 	}
 
 	// shell allow when allow list present
 	polA := &types.Policy{Allow: []string{"ALLOW_ME"}}
-	outS, _ = r["shell"](map[string]any{"cmd": "run ALLOW_ME command"}, polA)
+	outS, _ = r["shell"](context.Background(), map[string]any{"cmd": "ALLOW_ME command"}, polA)
 	// not expecting a dry_run here; just ensure it returned without error
 	_ = outS
 	// command not allowed
-	outS, _ = r["shell"](map[string]any{"cmd": "nope"}, polA)
-	if outS["error"] != "not allowed by policy" {
+	outS, _ = r["shell"](context.Background(), map[string]any{"cmd": "nope"}, polA)
+	if e, _ := outS["error"].(string); !strings.HasPrefix(e, "not allowed by policy: ") {
 		t.Fatalf("expected not allowed by policy, got: %#v", outS)
 	}
 
 	// dry shell
-	outS, _ = r["shell"](map[string]any{"cmd": "echo hi"}, &types.Policy{DryShell: true})
+	outS, _ = r["shell"](context.Background(), map[string]any{"cmd": "echo hi"}, &types.Policy{DryShell: true})
 	if outS["dry_run"] != true || outS["cmd"] != "echo hi" {
 		t.Fatalf("dry shell unexpected: %#v", outS)
 	}
 
 	// actual shell run (simple echo)
-	outS, err = r["shell"](map[string]any{"cmd": "echo hello"}, &types.Policy{})
+	outS, err = r["shell"](context.Background(), map[string]any{"cmd": "echo hello"}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("shell run failed: %v", err)
 	}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dave1010/jorin/internal/session"
+)
+
+const sessionsUsage = `usage: jorin sessions <command>
+
+commands:
+  list            List saved sessions, most recent first
+  show <id>       Print a session's metadata and transcript
+  resume <id>     Continue a session in the REPL
+  delete <id>     Delete a saved session
+
+<id> may be a full session ID or a unique prefix.`
+
+// openSessionStore returns the default session store, or nil if no state
+// directory can be determined.
+func openSessionStore() session.Store {
+	dir, err := session.DefaultDir()
+	if err != nil {
+		return nil
+	}
+	return session.NewFileStore(dir)
+}
+
+// runSessionsCommand handles `jorin sessions ...`. When the command resumes a
+// session it returns that session's ID for the caller to start the REPL with.
+func runSessionsCommand(store session.Store, args []string, out io.Writer) (string, error) {
+	if store == nil {
+		return "", errors.New("session storage is not available")
+	}
+	if len(args) == 0 {
+		return "", errors.New(sessionsUsage)
+	}
+	sub, rest := args[0], args[1:]
+	if sub == "list" || sub == "ls" {
+		return "", listSessions(store, out)
+	}
+	if sub != "show" && sub != "resume" && sub != "delete" && sub != "rm" {
+		return "", fmt.Errorf("unknown sessions command %q\n\n%s", sub, sessionsUsage)
+	}
+	if len(rest) != 1 {
+		return "", fmt.Errorf("sessions %s requires exactly one session id", sub)
+	}
+	id, err := session.Resolve(store, rest[0])
+	if err != nil {
+		return "", err
+	}
+	switch sub {
+	case "show":
+		s, err := store.Load(id)
+		if err != nil {
+			return "", err
+		}
+		return "", showSession(s, out)
+	case "resume":
+		return id, nil
+	default:
+		if err := store.Delete(id); err != nil {
+			return "", err
+		}
+		_, err := fmt.Fprintln(out, "Deleted session", id)
+		return "", err
+	}
+}
+
+func listSessions(store session.Store, out io.Writer) error {
+	list, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		_, err := fmt.Fprintln(out, "No saved sessions.")
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUPDATED\tMODEL\tMSGS\tCWD\tTITLE")
+	for _, m := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", m.ID, m.Updated.Local().Format(time.DateTime), m.Model, m.MessageCount, m.CWD, m.Title)
+	}
+	return tw.Flush()
+}
+
+func showSession(s *session.Session, out io.Writer) error {
+	m := s.Meta
+	var b strings.Builder
+	fmt.Fprintf(&b, "ID:       %s\n", m.ID)
+	fmt.Fprintf(&b, "Model:    %s\n", m.Model)
+	fmt.Fprintf(&b, "API mode: %s\n", m.APIMode)
+	fmt.Fprintf(&b, "CWD:      %s\n", m.CWD)
+	fmt.Fprintf(&b, "Created:  %s\n", m.Created.Local().Format(time.DateTime))
+	fmt.Fprintf(&b, "Updated:  %s\n", m.Updated.Local().Format(time.DateTime))
+	fmt.Fprintf(&b, "Policy:   %s\n", describePolicy(s))
+	for _, msg := range s.Messages {
+		if msg.Role == "system" {
+			continue
+		}
+		b.WriteString("\n")
+		switch {
+		case msg.Role == "tool":
+			fmt.Fprintf(&b, "[tool %s] %s\n", msg.ToolCallID, preview(msg.Content, 200))
+		case len(msg.ToolCalls) > 0:
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "[%s] %s\n", msg.Role, msg.Content)
+			}
+			for _, tc := range msg.ToolCalls {
+				fmt.Fprintf(&b, "[%s -> %s] %s\n", msg.Role, tc.Function.Name, preview(string(tc.Function.Args), 200))
+			}
+		default:
+			fmt.Fprintf(&b, "[%s] %s\n", msg.Role, msg.Content)
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func describePolicy(s *session.Session) string {
+	p := s.Meta.Policy
+	var parts []string
+	if p.Readonly {
+		parts = append(parts, "readonly")
+	}
+	if p.DryShell {
+		parts = append(parts, "dry-shell")
+	}
+	if len(p.Allow) > 0 {
+		parts = append(parts, "allow="+strings.Join(p.Allow, ","))
+	}
+	if len(p.Deny) > 0 {
+		parts = append(parts, "deny="+strings.Join(p.Deny, ","))
+	}
+	if p.CWD != "" {
+		parts = append(parts, "cwd="+p.CWD)
+	}
+	if p.ToolTimeout > 0 {
+		parts = append(parts, "tool-timeout="+p.ToolTimeout.String())
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/session"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestRunSessionsCommand(t *testing.T) {
+	store := session.NewFileStore(t.TempDir())
+	s := session.New()
+	s.Meta.ID = "20240101-120000-abcd"
+	s.Meta.Model = "gpt-test"
+	s.Messages = []types.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "why is CI red?"},
+		{Role: "assistant", Content: "a flaky test"},
+	}
+	if err := store.Save(s); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := runSessionsCommand(store, []string{"list"}, &out); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(out.String(), s.Meta.ID) || !strings.Contains(out.String(), "why is CI red?") {
+		t.Fatalf("unexpected list output: %q", out.String())
+	}
+
+	out.Reset()
+	if _, err := runSessionsCommand(store, []string{"show", "20240101"}, &out); err != nil {
+		t.Fatalf("show: %v", err)
+	}
+	if !strings.Contains(out.String(), "Model:    gpt-test") || !strings.Contains(out.String(), "[assistant] a flaky test") {
+		t.Fatalf("unexpected show output: %q", out.String())
+	}
+
+	id, err := runSessionsCommand(store, []string{"resume", "2024"}, &out)
+	if err != nil || id != s.Meta.ID {
+		t.Fatalf("resume: %q %v", id, err)
+	}
+
+	out.Reset()
+	if _, err := runSessionsCommand(store, []string{"delete", s.Meta.ID}, &out); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := runSessionsCommand(store, []string{"show", s.Meta.ID}, &out); err == nil {
+		t.Fatalf("expected deleted session to be gone")
+	}
+
+	if _, err := runSessionsCommand(store, []string{"bogus"}, &out); err == nil {
+		t.Fatalf("expected error for unknown command")
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -50,7 +52,7 @@ func TestReadFileLargeAndWriteFileBytes(t *testing.T) {
 	if err := os.WriteFile(f, b, 0o644); err != nil {
 		t.Fatalf("write big file: %v", err)
 	}
-	out, err := r["read_file"](map[string]any{"path": f}, &types.Policy{})
+	out, err := r["read_file"](context.Background(), map[string]any{"path": f}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("read_file failed: %v", err)
 	}
@@ -67,7 +69,7 @@ func TestReadFileLargeAndWriteFileBytes(t *testing.T) {
 	wf := r["write_file"]
 	d := filepath.Join(tmp, "sub")
 	p := filepath.Join(d, "out.txt")
-	outw, err := wf(map[string]any{"path": p, "text": "hello bytes"}, &types.Policy{})
+	outw, err := wf(context.Background(), map[string]any{"path": p, "text": "hello bytes"}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("write_file failed: %v", err)
 	}
@@ -93,7 +95,7 @@ func TestHttpGetTool(t *testing.T) {
 	defer srv.Close()
 
 	r := registry()
-	out, err := r["http_get"](map[string]any{"url": srv.URL}, &types.Policy{})
+	out, err := r["http_get"](context.Background(), map[string]any{"url": srv.URL}, &types.Policy{HTTPPrivate: true})
 	if err != nil {
 		t.Fatalf("http_get failed: %v", err)
 	}
@@ -115,25 +117,25 @@ func TestShellPolicyAllowDenyDryAndCWD(t *testing.T) {
 	shell := r["shell"]
 
 	// missing cmd
-	if _, err := shell(map[string]any{}, &types.Policy{}); err == nil {
+	if _, err := shell(context.Background(), map[string]any{}, &types.Policy{}); err == nil {
 		t.Fatalf("expected error for missing cmd")
 	}
 
 	// deny should block
-	out, _ := shell(map[string]any{"cmd": "do forbidden stuff"}, &types.Policy{Deny: []string{"forbidden"}})
-	if out["error"] != "denied by policy" {
+	out, _ := shell(context.Background(), map[string]any{"cmd": "do forbidden stuff"}, &types.Policy{Deny: []string{"forbidden"}})
+	if e, _ := out["error"].(string); !strings.HasPrefix(e, "denied by policy: ") {
 		t.Fatalf("expected denied by policy, got %#v", out)
 	}
 
-	// allow list present requires allowed substring
-	_, _ = shell(map[string]any{"cmd": "run ALLOW_ME now"}, &types.Policy{Allow: []string{"ALLOW_ME"}})
-	out, _ = shell(map[string]any{"cmd": "nope"}, &types.Policy{Allow: []string{"ALLOW_ME"}})
-	if out["error"] != "not allowed by policy" {
+	// allow list present requires a matching rule
+	_, _ = shell(context.Background(), map[string]any{"cmd": "ALLOW_ME now"}, &types.Policy{Allow: []string{"ALLOW_ME"}})
+	out, _ = shell(context.Background(), map[string]any{"cmd": "nope"}, &types.Policy{Allow: []string{"ALLOW_ME"}})
+	if e, _ := out["error"].(string); !strings.HasPrefix(e, "not allowed by policy: ") {
 		t.Fatalf("expected not allowed by policy, got %#v", out)
 	}
 
 	// dry run
-	out, _ = shell(map[string]any{"cmd": "echo hi"}, &types.Policy{DryShell: true})
+	out, _ = shell(context.Background(), map[string]any{"cmd": "echo hi"}, &types.Policy{DryShell: true})
 	if dr, _ := out["dry_run"].(bool); !dr {
 		t.Fatalf("expected dry_run true, got %#v", out)
 	}
@@ -142,7 +144,7 @@ func TestShellPolicyAllowDenyDryAndCWD(t *testing.T) {
 	}
 
 	// actual execution: echo and exit code
-	out, err := shell(map[string]any{"cmd": "echo -n DONE; exit 0"}, &types.Policy{})
+	out, err := shell(context.Background(), map[string]any{"cmd": "echo -n DONE; exit 0"}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("shell execution failed: %v", err)
 	}
@@ -169,7 +171,7 @@ func TestShellPolicyAllowDenyDryAndCWD(t *testing.T) {
 		t.Fatalf("write script: %v", err)
 	}
 	// run from tmp dir
-	if _, err = shell(map[string]any{"cmd": "./writecwd.sh"}, &types.Policy{CWD: tmp}); err != nil {
+	if _, err = shell(context.Background(), map[string]any{"cmd": "./writecwd.sh"}, &types.Policy{CWD: tmp}); err != nil {
 		t.Fatalf("shell CWD exec failed: %v", err)
 	}
 	// read out file
@@ -194,7 +196,7 @@ func TestHttpGetTimeout(t *testing.T) {
 
 	r := registry()
 	start := time.Now()
-	out, err := r["http_get"](map[string]any{"url": srv.URL}, &types.Policy{})
+	out, err := r["http_get"](context.Background(), map[string]any{"url": srv.URL}, &types.Policy{HTTPPrivate: true})
 	dur := time.Since(start)
 	if err != nil {
 		t.Fatalf("http_get delayed failed: %v", err)
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+)
+
+const undoUsage = `usage: jorin undo
+
+Reverts the files changed by the latest checkpoint recorded in the working
+directory: the last turn of a REPL session or the last prompt run. Run it
+again to step further back.`
+
+// runUndoCommand handles `jorin undo`, restoring the latest checkpoint under
+// dir that was recorded in cwd.
+func runUndoCommand(dir, cwd string, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return errors.New(undoUsage)
+	}
+	if dir == "" {
+		return errors.New("checkpoint storage is not available")
+	}
+	if cwd == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		cwd = wd
+	}
+	if abs, err := filepath.Abs(cwd); err == nil {
+		cwd = abs
+	}
+	s, err := checkpoint.Latest(dir, cwd)
+	if err != nil {
+		return err
+	}
+	cp, err := s.Undo()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, "Undid checkpoint", cp.Describe(cwd))
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+)
+
+func TestRunUndoCommand(t *testing.T) {
+	dir, work := t.TempDir(), t.TempDir()
+	file := filepath.Join(work, "a.txt")
+	if err := os.WriteFile(file, []byte("before"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := checkpoint.Open(dir, "run", work)
+	s.Begin("fix it")
+	if err := s.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("after"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runUndoCommand(dir, work, nil, &out); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != "before" {
+		t.Fatalf("file = %q, want it restored", got)
+	}
+	if !strings.Contains(out.String(), `Undid checkpoint 1`) || !strings.Contains(out.String(), `"fix it"  a.txt`) {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if err := runUndoCommand(dir, work, nil, &out); err == nil || !strings.Contains(err.Error(), "no checkpoints") {
+		t.Fatalf("expected no checkpoints left, got %v", err)
+	}
+}
@@ -1,10 +1,22 @@
 package agent
 
-import "github.com/dave1010/jorin/internal/types"
+import (
+	"context"
+	"io"
+
+	"github.com/dave1010/jorin/internal/types"
+)
 
 // Agent is a minimal interface for an LLM backend used by the REPL.
 // Implementations should provide ChatSession similar to the previous
 // package-level function.
 type Agent interface {
-	ChatSession(model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error)
+	ChatSession(ctx context.Context, model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error)
+}
+
+// StreamingAgent is an Agent that can also write assistant text to out as it
+// is generated. Callers should not print the returned output again.
+type StreamingAgent interface {
+	Agent
+	ChatSessionStream(ctx context.Context, model string, msgs []types.Message, pol *types.Policy, out io.Writer) ([]types.Message, string, error)
 }
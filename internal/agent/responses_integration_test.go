@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"strings"
@@ -88,7 +89,7 @@ func TestResponsesAPIIntegration(t *testing.T) {
 	defer func() { _ = os.Remove("test.txt") }()
 
 	pol := &types.Policy{}
-	out, err := RunAgent("test-model", "read test.txt", "you are jorin", pol)
+	out, err := RunAgent(context.Background(), "test-model", "read test.txt", "you are jorin", pol)
 	if err != nil {
 		t.Fatalf("RunAgent failed: %v", err)
 	}
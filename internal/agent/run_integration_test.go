@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -122,8 +123,9 @@ func TestRunWithSystemPromptIntegrationFlow(t *testing.T) {
 	t.Setenv("OPENAI_BASE_URL", openAIServer.URL())
 	t.Setenv("OPENAI_API_KEY", "test-key")
 
-	pol := &types.Policy{}
-	out, err := RunWithSystemPrompt("test-model", "read and fetch", pol)
+	// the test server listens on loopback
+	pol := &types.Policy{HTTPPrivate: true}
+	out, err := RunWithSystemPrompt(context.Background(), "test-model", "read and fetch", pol)
 	if err != nil {
 		t.Fatalf("RunWithSystemPrompt failed: %v", err)
 	}
@@ -209,7 +211,7 @@ func TestRunWithSystemPromptIntegrationStringArgsFallback(t *testing.T) {
 	t.Setenv("OPENAI_API_KEY", "test-key")
 
 	pol := &types.Policy{}
-	out, err := RunWithSystemPrompt("test-model", "read file", pol)
+	out, err := RunWithSystemPrompt(context.Background(), "test-model", "read file", pol)
 	if err != nil {
 		t.Fatalf("RunWithSystemPrompt failed: %v", err)
 	}
@@ -292,7 +294,7 @@ func TestRunWithSystemPromptIntegrationUnknownTool(t *testing.T) {
 	t.Setenv("OPENAI_API_KEY", "test-key")
 
 	pol := &types.Policy{}
-	out, err := RunWithSystemPrompt("test-model", "unknown tool", pol)
+	out, err := RunWithSystemPrompt(context.Background(), "test-model", "unknown tool", pol)
 	if err != nil {
 		t.Fatalf("RunWithSystemPrompt failed: %v", err)
 	}
@@ -381,7 +383,7 @@ func TestRunWithSystemPrompt(t *testing.T) {
 	}()
 
 	pol := &types.Policy{}
-	out, err := RunWithSystemPrompt("test-model", "read the file test.txt", pol)
+	out, err := RunWithSystemPrompt(context.Background(), "test-model", "read the file test.txt", pol)
 	if err != nil {
 		t.Fatalf("RunWithSystemPrompt failed: %v", err)
 	}
@@ -5,15 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/dave1010/jorin/internal/agent"
+	"github.com/dave1010/jorin/internal/approval"
+	"github.com/dave1010/jorin/internal/checkpoint"
+	"github.com/dave1010/jorin/internal/mcp"
 	"github.com/dave1010/jorin/internal/openai"
+	"github.com/dave1010/jorin/internal/overlay"
 	"github.com/dave1010/jorin/internal/plugins"
 	"github.com/dave1010/jorin/internal/prompt"
 	"github.com/dave1010/jorin/internal/ralph"
 	"github.com/dave1010/jorin/internal/repl"
 	"github.com/dave1010/jorin/internal/repl/commands"
+	"github.com/dave1010/jorin/internal/session"
+	"github.com/dave1010/jorin/internal/shell"
 	"github.com/dave1010/jorin/internal/types"
 )
 
@@ -32,8 +40,41 @@ type Config struct {
 	Stdin           io.Reader
 	StdinIsTTY      bool
 	Stdout          io.Writer
+	StdoutIsTTY     bool
 	Stderr          io.Writer
 	UseResponsesAPI bool
+	// Provider selects the LLM backend; empty means OpenAI unless the model
+	// name carries a provider prefix.
+	Provider string
+	// Sessions persists conversations. Nil disables persistence.
+	Sessions session.Store
+	// SessionID selects a saved session to continue (full ID or unique
+	// prefix). If none matches, a new session with this ID is started.
+	SessionID string
+	// Resume continues the most recent session when SessionID is empty.
+	Resume bool
+	// ModelSet, APIModeSet and ProviderSet report whether Model,
+	// UseResponsesAPI and Provider were given explicitly. A resumed session
+	// otherwise keeps its own settings.
+	ModelSet    bool
+	APIModeSet  bool
+	ProviderSet bool
+	// MCPServers are connected at startup and their tools offered to the
+	// model alongside the built-in tools.
+	MCPServers []mcp.ServerConfig
+	// Checkpoints is the directory checkpoint stores are kept in (see
+	// checkpoint.DefaultDir). Empty disables checkpoints.
+	Checkpoints string
+	// Overlay, if set, holds the run's file changes; Policy.FS should be
+	// it. At the end the changes are shown as a diff and applied to the
+	// workspace if the user agrees.
+	Overlay *overlay.FS
+	// PersistentShell runs the shell tool's commands in one long-lived bash
+	// for the whole run (see shell.Session).
+	PersistentShell bool
+	// PTY runs the shell tool's commands on a pseudo-terminal (see
+	// shell.RunPTY). It cannot be combined with PersistentShell.
+	PTY bool
 }
 
 // App holds the application's dependencies.
@@ -49,23 +90,117 @@ func NewApp(cfg *Config) *App {
 
 	return &App{
 		cfg:     cfg,
-		agent:   openai.NewDefaultAgent(cfg.UseResponsesAPI),
+		agent:   newAgent(cfg),
 		history: repl.NewMemHistory(200),
 	}
 }
 
+func newAgent(cfg *Config) agent.Agent {
+	ag := openai.NewDefaultAgent(cfg.UseResponsesAPI)
+	ag.Provider = cfg.Provider
+	return ag
+}
+
 // Run wires core dependencies and starts either the REPL or a single prompt run.
 func (a *App) Run(ctx context.Context) error {
-	if a.cfg.NoArgs || a.cfg.Repl {
-		return a.runRepl(ctx)
+	interactive := a.cfg.NoArgs || a.cfg.Repl
+	if a.cfg.Overlay != nil {
+		defer func() { _ = a.cfg.Overlay.Close() }()
+	}
+	if len(a.cfg.MCPServers) > 0 {
+		m := a.startMCP(ctx)
+		defer m.Close()
+	}
+	defer a.startShell()()
+	procs := shell.NewSupervisor()
+	a.cfg.Policy.Processes = procs
+	plugins.SetProcesses(procs)
+	defer func() {
+		if n := procs.Close(); n > 0 {
+			_, _ = fmt.Fprintf(a.cfg.Stderr, "Stopped %d background process(es)\n", n)
+		}
+	}()
+	if a.cfg.Policy.AsksApproval() && !a.cfg.StdinIsTTY {
+		_, _ = fmt.Fprintf(a.cfg.Stderr, "WARN: --approve=%s needs a terminal; tool calls that need approval will be refused\n", a.cfg.Policy.Approve)
+	}
+	sess, err := a.openSession(interactive)
+	if err != nil {
+		return err
+	}
+	cps := a.openCheckpoints(sess)
+	if a.cfg.Overlay == nil {
+		if interactive {
+			return a.runRepl(ctx, sess, cps)
+		}
+		return a.runPrompt(ctx, sess, cps)
+	}
+	// the tools write to the overlay; only applying it changes the
+	// workspace, and only that is checkpointed
+	if interactive {
+		err = a.runRepl(ctx, sess, nil)
+	} else {
+		err = a.runPrompt(ctx, sess, nil)
+	}
+	if oerr := a.finishOverlay(cps); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+// startShell applies the PersistentShell and PTY settings to the policy and
+// returns a function that closes the persistent shell, if one was opened.
+func (a *App) startShell() func() {
+	a.cfg.Policy.PTY = a.cfg.PTY
+	if !a.cfg.PersistentShell {
+		return func() {}
+	}
+	sh := shell.NewSession(shell.DefaultRunner)
+	a.cfg.Policy.Shell = sh
+	return sh.Close
+}
+
+// startMCP connects the configured MCP servers and registers their tools.
+// Servers that fail to start are reported but do not stop the run.
+func (a *App) startMCP(ctx context.Context) *mcp.Manager {
+	m := mcp.Start(ctx, a.cfg.MCPServers)
+	for _, err := range m.Errors() {
+		_, _ = fmt.Fprintln(a.cfg.Stderr, "WARN:", err)
 	}
-	return a.runPrompt()
+	m.Register()
+	plugins.SetMCPProvider(func() []plugins.MCPServer {
+		var out []plugins.MCPServer
+		for _, s := range m.Status() {
+			ps := plugins.MCPServer{Name: s.Name, Transport: s.Transport, Target: s.Target}
+			if s.Err != nil {
+				ps.Error = s.Err.Error()
+			}
+			for _, t := range s.Tools {
+				ps.Tools = append(ps.Tools, plugins.MCPTool{Name: t.Name, Description: t.Description, ReadOnly: t.ReadOnly})
+			}
+			out = append(out, ps)
+		}
+		return out
+	})
+	return m
 }
 
-func (a *App) runRepl(ctx context.Context) error {
+func (a *App) runRepl(ctx context.Context, sess *session.Session, cps *checkpoint.Store) error {
 	cfg := repl.DefaultConfig()
 	handler := commands.NewDefaultHandler(a.cfg.Stdout, a.cfg.Stderr, a.history, prompt.SystemPrompt)
 
+	var msgs []types.Message
+	var onTurn func([]types.Message)
+	if sess != nil {
+		msgs = sessionMessages(sess)
+		if len(sess.Messages) > 0 {
+			if _, err := fmt.Fprintf(a.cfg.Stderr, "Resumed session %s (%d messages)\n", sess.Meta.ID, len(sess.Messages)); err != nil {
+				return err
+			}
+		}
+		onTurn = func(m []types.Message) { a.saveSession(sess, m) }
+		defer a.reportSession(sess)
+	}
+
 	return repl.StartREPL(repl.StartOptions{
 		Ctx:     ctx,
 		Agent:   a.agent,
@@ -77,10 +212,21 @@ func (a *App) runRepl(ctx context.Context) error {
 		Config:  cfg,
 		Handler: handler,
 		History: a.history,
+		Stream:  a.cfg.StdoutIsTTY,
+		// Ctrl-C cancels the running turn instead of exiting.
+		CatchInterrupts: a.cfg.StdinIsTTY,
+		Messages:        msgs,
+		OnTurn:          onTurn,
+		AskApproval:     a.cfg.StdinIsTTY,
+		Checkpoints:     cps,
 	})
 }
 
-func (a *App) runPrompt() error {
+func (a *App) runPrompt(ctx context.Context, sess *session.Session, cps *checkpoint.Store) error {
+	// Ctrl-C cancels the run so child process groups are killed on the way out.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
 	stdinText, err := readPromptStdin(a.cfg)
 	if err != nil {
 		return err
@@ -90,19 +236,48 @@ func (a *App) runPrompt() error {
 		return ErrMissingPrompt
 	}
 
+	pol := &a.cfg.Policy
+	if a.cfg.StdinIsTTY && pol.AsksApproval() {
+		lr := repl.NewLineReader(a.cfg.Stdin, a.cfg.Stderr)
+		defer func() { _ = lr.Close() }()
+		p := *pol
+		p.Approver = approval.NewTerminal(lr.ReadLineWithText, a.cfg.Stderr)
+		pol = &p
+	}
+
+	if cps != nil {
+		cps.Begin(fullPrompt)
+		defer func() {
+			if err := cps.End(); err != nil {
+				_, _ = fmt.Fprintln(a.cfg.Stderr, "WARN: checkpoint:", err)
+			}
+		}()
+	}
+
 	systemPrompt := prompt.SystemPrompt()
 	if prompt.RalphEnabled() {
-		if err := ralph.Run(a.agent, a.cfg.Model, fullPrompt, systemPrompt, &a.cfg.Policy, a.cfg.RalphMaxTries, a.cfg.Stdout, a.cfg.Stderr); err != nil {
+		if err := ralph.Run(ctx, a.agent, a.cfg.Model, fullPrompt, systemPrompt, pol, a.cfg.RalphMaxTries, a.cfg.Stdout, a.cfg.Stderr); err != nil {
 			return err
 		}
 		return nil
 	}
 
-	msgs := []types.Message{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: fullPrompt},
+	msgs := []types.Message{{Role: "system", Content: systemPrompt}}
+	if sess != nil {
+		msgs = sessionMessages(sess)
+	}
+	msgs = append(msgs, types.Message{Role: "user", Content: fullPrompt})
+	if sa, ok := a.agent.(agent.StreamingAgent); ok && a.cfg.StdoutIsTTY {
+		msgs, _, err := sa.ChatSessionStream(ctx, a.cfg.Model, msgs, pol, a.cfg.Stdout)
+		if sess != nil {
+			a.saveSession(sess, msgs)
+		}
+		return err
+	}
+	msgs, out, err := a.agent.ChatSession(ctx, a.cfg.Model, msgs, pol)
+	if sess != nil {
+		a.saveSession(sess, msgs)
 	}
-	_, out, err := a.agent.ChatSession(a.cfg.Model, msgs, &a.cfg.Policy)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// writeFileLLM asks for one write_file call per turn, then answers "ok".
+func writeFileLLM(path, text string) *recordingLLM {
+	return &recordingLLM{response: func(msgs []types.Message) types.ChatResponse {
+		if last := msgs[len(msgs)-1]; last.Role == "tool" {
+			return types.ChatResponse{Choices: []types.Choice{{Message: types.Message{Role: "assistant", Content: "ok"}, FinishReason: "stop"}}}
+		}
+		call := types.ToolCall{ID: "call_write", Type: "function"}
+		call.Function.Name = "write_file"
+		args, _ := json.Marshal(map[string]string{"path": path, "text": text})
+		call.Function.Args = args
+		return types.ChatResponse{Choices: []types.Choice{{Message: types.Message{Role: "assistant", ToolCalls: []types.ToolCall{call}}, FinishReason: "tool_calls"}}}
+	}}
+}
+
+func TestREPLUndoRevertsTheLastTurn(t *testing.T) {
+	work := t.TempDir()
+	file := filepath.Join(work, "notes.txt")
+	if err := os.WriteFile(file, []byte("mine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withTestLLM(t, writeFileLLM("notes.txt", "agent\n"))
+
+	var stdout, stderr bytes.Buffer
+	cfg := Config{
+		Model:       "m",
+		Repl:        true,
+		Policy:      types.Policy{CWD: work},
+		Stdin:       strings.NewReader("rewrite the notes\n/checkpoints\n/undo\n"),
+		Stdout:      &stdout,
+		Stderr:      &stderr,
+		Checkpoints: t.TempDir(),
+	}
+	if err := NewApp(&cfg).Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != "mine\n" {
+		t.Fatalf("/undo left %q, stderr %q", got, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `1  `) || !strings.Contains(stdout.String(), `"rewrite the notes"  notes.txt`) {
+		t.Fatalf("expected the checkpoint to be listed, got %q", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "Undid checkpoint 1") {
+		t.Fatalf("expected /undo to report the checkpoint, got %q", stdout.String())
+	}
+}
+
+func TestPromptRunRecordsACheckpoint(t *testing.T) {
+	work := t.TempDir()
+	dir := t.TempDir()
+	withTestLLM(t, writeFileLLM("new.txt", "hello\n"))
+
+	cfg := Config{
+		Model:       "m",
+		Prompt:      "create a file",
+		Policy:      types.Policy{CWD: work},
+		Stdin:       strings.NewReader(""),
+		Stdout:      &bytes.Buffer{},
+		Stderr:      &bytes.Buffer{},
+		Checkpoints: dir,
+	}
+	if err := NewApp(&cfg).Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	s, err := checkpoint.Latest(dir, work)
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	cp, err := s.Undo()
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if cp.Label != "create a file" || len(cp.Files) != 1 || cp.Files[0].Existed {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+	if _, err := os.Stat(filepath.Join(work, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("undo should remove the file the run created, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"sync"
 	"testing"
 
@@ -15,7 +16,7 @@ type recordingLLM struct {
 	response func(msgs []types.Message) types.ChatResponse
 }
 
-func (r *recordingLLM) ChatOnce(model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+func (r *recordingLLM) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
 	r.mu.Lock()
 	r.calls++
 	snapshot := append([]types.Message(nil), msgs...)
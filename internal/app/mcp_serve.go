@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dave1010/jorin/internal/agent"
+	"github.com/dave1010/jorin/internal/mcp"
+	"github.com/dave1010/jorin/internal/openai"
+	"github.com/dave1010/jorin/internal/prompt"
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
+	"github.com/dave1010/jorin/internal/version"
+)
+
+const mcpInstructions = "Jorin's tools run under the policy Jorin was started with " +
+	"(readonly, dry-shell, allow/deny lists). Refusals are returned as tool errors. " +
+	"run_agent hands a whole task to a Jorin agent that can use the same tools."
+
+// servedTools lists the built-in tools exposed by `jorin mcp serve` with
+// their MCP annotations.
+var servedTools = []struct {
+	name        string
+	readOnly    bool
+	destructive bool
+}{
+	{"shell", false, true},
+	{"read_file", true, false},
+	{"list_dir", true, false},
+	{"glob", true, false},
+	{"search", true, false},
+	{"write_file", false, true},
+	{"edit_file", false, true},
+	{"apply_patch", false, true},
+	{"http_get", true, false},
+	{"http_request", false, true},
+}
+
+// ServeMCP runs Jorin as an MCP server on stdin/stdout until the client
+// disconnects. The built-in tools and run_agent are offered, all subject to
+// cfg.Policy, and shell runs as PersistentShell and PTY ask.
+func (a *App) ServeMCP(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if a.cfg.UseResponsesAPI {
+		openai.UseResponsesAPI()
+	}
+	openai.DefaultProvider = a.cfg.Provider
+	defer a.startShell()()
+
+	srv := &mcp.Server{
+		Name:         "jorin",
+		Version:      version.Version,
+		Instructions: mcpInstructions,
+		Tools:        a.mcpServerTools(),
+		Policy:       &a.cfg.Policy,
+	}
+	err := srv.Serve(ctx, a.cfg.Stdin, a.cfg.Stdout)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func (a *App) mcpServerTools() []mcp.ServerTool {
+	manifest := map[string]types.Tool{}
+	for _, t := range tools.ToolsManifest() {
+		manifest[t.Function.Name] = t
+	}
+	// the enabled tools as the policy runs them, such as shell on a terminal
+	for _, t := range tools.EnabledTools(tools.ToolsManifest(), &a.cfg.Policy) {
+		manifest[t.Function.Name] = t
+	}
+	reg := tools.Registry()
+	var out []mcp.ServerTool
+	for _, st := range servedTools {
+		out = append(out, mcp.ServerTool{
+			Tool:        manifest[st.name],
+			Exec:        reg[st.name],
+			ReadOnly:    st.readOnly,
+			Destructive: st.destructive,
+		})
+	}
+	return append(out, mcp.ServerTool{Tool: runAgentTool, Exec: tools.Guard("run_agent", a.runAgentExec)})
+}
+
+var runAgentTool = types.Tool{Type: "function", Function: types.ToolFunction{
+	Name:        "run_agent",
+	Description: "Run a Jorin agent on a task. The agent can use shell, files and HTTP under the same policy and returns its final answer.",
+	Parameters:  []byte(`{"type":"object","properties":{"prompt":{"type":"string","description":"Task for the agent"},"model":{"type":"string","description":"Model override"}},"required":["prompt"]}`),
+}}
+
+func (a *App) runAgentExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	task, _ := args["prompt"].(string)
+	if task == "" {
+		return nil, errors.New("missing prompt")
+	}
+	model, _ := args["model"].(string)
+	if model == "" {
+		model = a.cfg.Model
+	}
+	out, err := agent.RunAgent(ctx, model, task, prompt.SystemPrompt(), p)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	return map[string]any{"text": out}, nil
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestServeMCPExposesPolicyGuardedTools(t *testing.T) {
+	llm := &recordingLLM{}
+	withTestLLM(t, llm)
+
+	target := filepath.Join(t.TempDir(), "out.txt")
+	writeArgs, _ := json.Marshal(map[string]any{"path": target, "text": "x"})
+	requests := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"write_file","arguments":` + string(writeArgs) + `}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"run_agent","arguments":{"prompt":"do it"}}}`,
+	}, "\n") + "\n"
+
+	var stdout, stderr bytes.Buffer
+	cfg := Config{
+		Model:  "test-model",
+		Policy: types.Policy{Readonly: true},
+		Stdin:  strings.NewReader(requests),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	if err := NewApp(&cfg).ServeMCP(context.Background()); err != nil {
+		t.Fatalf("ServeMCP: %v", err)
+	}
+
+	replies := map[string]json.RawMessage{}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		var m struct {
+			ID     json.RawMessage
+			Result json.RawMessage
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("stdout must only carry JSON-RPC, got %q", scanner.Text())
+		}
+		replies[string(m.ID)] = m.Result
+	}
+
+	var list struct{ Tools []struct{ Name string } }
+	_ = json.Unmarshal(replies["2"], &list)
+	var names []string
+	for _, tl := range list.Tools {
+		names = append(names, tl.Name)
+	}
+	if strings.Join(names, ",") != "shell,read_file,list_dir,glob,search,write_file,edit_file,apply_patch,http_get,http_request,run_agent" {
+		t.Fatalf("unexpected tools: %v", names)
+	}
+
+	if !strings.Contains(string(replies["3"]), "readonly session") || !strings.Contains(string(replies["3"]), `"isError":true`) {
+		t.Fatalf("write_file should be refused in a readonly session, got %s", replies["3"])
+	}
+	if _, err := os.Stat(target); err == nil {
+		t.Fatalf("write_file wrote despite readonly policy")
+	}
+
+	if !strings.Contains(string(replies["4"]), `"text":"ok"`) || llm.Calls() != 1 {
+		t.Fatalf("run_agent should return the agent's answer, got %s (calls=%d)", replies["4"], llm.Calls())
+	}
+	msgs := llm.Messages()[0]
+	if msgs[0].Role != "system" || msgs[1].Content != "do it" {
+		t.Fatalf("unexpected agent messages: %+v", msgs)
+	}
+}
+
+func TestServeMCPUsesThePersistentShell(t *testing.T) {
+	requests := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"shell","arguments":{"cmd":"export JORIN_SERVE_TEST=kept"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"shell","arguments":{"cmd":"echo $JORIN_SERVE_TEST"}}}`,
+	}, "\n") + "\n"
+
+	var stdout, stderr bytes.Buffer
+	cfg := Config{
+		Model:           "test-model",
+		Policy:          types.Policy{CWD: t.TempDir()},
+		PersistentShell: true,
+		Stdin:           strings.NewReader(requests),
+		Stdout:          &stdout,
+		Stderr:          &stderr,
+	}
+	if err := NewApp(&cfg).ServeMCP(context.Background()); err != nil {
+		t.Fatalf("ServeMCP: %v", err)
+	}
+	if cfg.Policy.Shell == nil {
+		t.Fatalf("persistent_shell was not applied to the served policy")
+	}
+	if !strings.Contains(stdout.String(), `kept\\n`) {
+		t.Fatalf("the second call should see the first call's export, got %s", stdout.String())
+	}
+}
+
+// slowLLM answers after a delay unless the context ends first.
+type slowLLM struct {
+	recordingLLM
+	delay time.Duration
+}
+
+func (s *slowLLM) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.recordingLLM.ChatOnce(ctx, model, msgs, toolsList)
+}
+
+func TestServeMCPRunAgentIgnoresToolTimeout(t *testing.T) {
+	withTestLLM(t, &slowLLM{delay: 50 * time.Millisecond})
+	cfg := Config{Model: "test-model", Policy: types.Policy{ToolTimeout: time.Millisecond}}
+	a := NewApp(&cfg)
+	for _, st := range a.mcpServerTools() {
+		if st.Tool.Function.Name != "run_agent" {
+			continue
+		}
+		out, err := st.Exec(context.Background(), map[string]any{"prompt": "do it"}, &a.cfg.Policy)
+		if err != nil || out["text"] != "ok" {
+			t.Fatalf("run_agent should outlast the per-tool timeout, got %v %v", out, err)
+		}
+		return
+	}
+	t.Fatal("run_agent not served")
+}
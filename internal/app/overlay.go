@@ -0,0 +1,66 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+	"github.com/dave1010/jorin/internal/overlay"
+	"github.com/dave1010/jorin/internal/repl"
+)
+
+// finishOverlay prints the files the run changed in the overlay as a diff
+// and applies them to the workspace if the user agrees. Without a terminal
+// to ask nothing is applied; the diff on stdout can be applied later with
+// git apply. cps, if set, records the apply so jorin undo can revert it.
+func (a *App) finishOverlay(cps *checkpoint.Store) error {
+	ov := a.cfg.Overlay
+	changes, err := ov.Changes()
+	if err != nil {
+		return fmt.Errorf("overlay: %w", err)
+	}
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(a.cfg.Stderr, "Overlay: no files changed")
+		return err
+	}
+	if _, err := fmt.Fprint(a.cfg.Stdout, overlay.Diff(changes)); err != nil {
+		return err
+	}
+	files := fmt.Sprintf("%d changed files", len(changes))
+	if len(changes) == 1 {
+		files = "1 changed file"
+	}
+	if !a.cfg.StdinIsTTY {
+		_, err := fmt.Fprintf(a.cfg.Stderr, "Overlay: %s not applied to %s; there is no terminal to confirm\n", files, ov.Root())
+		return err
+	}
+
+	lr := repl.NewLineReader(a.cfg.Stdin, a.cfg.Stderr)
+	defer func() { _ = lr.Close() }()
+	answer, err := lr.ReadLine(fmt.Sprintf("Apply %s to %s? [y/N] ", files, ov.Root()))
+	if answer = strings.ToLower(strings.TrimSpace(answer)); err != nil || answer != "y" && answer != "yes" {
+		_, err := fmt.Fprintln(a.cfg.Stderr, "Overlay: changes discarded")
+		return err
+	}
+
+	var save func(paths ...string) error
+	if cps != nil {
+		cps.Begin("apply overlay")
+		save = cps.Save
+	}
+	err = ov.Apply(changes, save)
+	if cps != nil {
+		if cerr := cps.End(); cerr != nil {
+			_, _ = fmt.Fprintln(a.cfg.Stderr, "WARN: checkpoint:", cerr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("overlay: %w", err)
+	}
+	undo := ""
+	if cps != nil {
+		undo = " (undo with: jorin undo)"
+	}
+	_, err = fmt.Fprintf(a.cfg.Stderr, "Applied %s to %s%s\n", files, ov.Root(), undo)
+	return err
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+	"github.com/dave1010/jorin/internal/overlay"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// overlayRun runs a prompt that rewrites notes.txt under --overlay, with
+// stdin as the answer to the apply question.
+func overlayRun(t *testing.T, stdin string, tty bool) (work, checkpoints, stdout, stderr string) {
+	t.Helper()
+	work, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "notes.txt"), []byte("mine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ov, err := overlay.New(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTestLLM(t, writeFileLLM("notes.txt", "agent\n"))
+
+	var out, errOut bytes.Buffer
+	checkpoints = t.TempDir()
+	cfg := Config{
+		Model:       "m",
+		Prompt:      "rewrite the notes",
+		Policy:      types.Policy{CWD: work, Roots: []string{work}, FS: ov},
+		Stdin:       strings.NewReader(stdin),
+		StdinIsTTY:  tty,
+		Stdout:      &out,
+		Stderr:      &errOut,
+		Checkpoints: checkpoints,
+		Overlay:     ov,
+	}
+	if err := NewApp(&cfg).Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := os.Stat(ov.Dir()); !os.IsNotExist(err) {
+		t.Fatalf("the overlay should be removed after the run, got %v", err)
+	}
+	return work, checkpoints, out.String(), errOut.String()
+}
+
+func TestOverlayAppliesWhenConfirmed(t *testing.T) {
+	work, checkpoints, stdout, stderr := overlayRun(t, "y\n", true)
+	if !strings.Contains(stdout, "--- a/notes.txt\n+++ b/notes.txt\n@@ -1 +1 @@\n-mine\n+agent\n") {
+		t.Fatalf("expected the diff on stdout, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "Apply 1 changed file to "+work+"? [y/N]") || !strings.Contains(stderr, "Applied 1 changed file") {
+		t.Fatalf("unexpected stderr %q", stderr)
+	}
+	if got, _ := os.ReadFile(filepath.Join(work, "notes.txt")); string(got) != "agent\n" {
+		t.Fatalf("notes.txt = %q, want the change applied", got)
+	}
+
+	// applying is checkpointed
+	s, err := checkpoint.Latest(checkpoints, work)
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if _, err := s.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(work, "notes.txt")); string(got) != "mine\n" {
+		t.Fatalf("notes.txt after undo = %q", got)
+	}
+}
+
+func TestOverlayKeepsTheWorkspaceUnlessConfirmed(t *testing.T) {
+	for _, c := range []struct {
+		name, stdin, note string
+		tty               bool
+	}{
+		{"declined", "n\n", "changes discarded", true},
+		{"no terminal", "", "not applied", false},
+	} {
+		work, _, stdout, stderr := overlayRun(t, c.stdin, c.tty)
+		if got, _ := os.ReadFile(filepath.Join(work, "notes.txt")); string(got) != "mine\n" {
+			t.Fatalf("%s: notes.txt = %q", c.name, got)
+		}
+		if !strings.Contains(stdout, "+agent\n") || !strings.Contains(stderr, c.note) {
+			t.Fatalf("%s: stdout %q, stderr %q", c.name, stdout, stderr)
+		}
+	}
+}
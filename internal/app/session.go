@@ -0,0 +1,157 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+	"github.com/dave1010/jorin/internal/plugins"
+	"github.com/dave1010/jorin/internal/prompt"
+	"github.com/dave1010/jorin/internal/session"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// openSession returns the session this run should record into, or nil when
+// nothing is persisted. REPL runs always get a session when a store is
+// configured; single prompts only when one was asked for explicitly.
+func (a *App) openSession(interactive bool) (*session.Session, error) {
+	explicit := a.cfg.SessionID != "" || a.cfg.Resume
+	store := a.cfg.Sessions
+	if store == nil {
+		if explicit {
+			return nil, errors.New("session storage is not available")
+		}
+		return nil, nil
+	}
+	switch {
+	case a.cfg.SessionID != "":
+		id, err := session.Resolve(store, a.cfg.SessionID)
+		if errors.Is(err, session.ErrNotFound) {
+			sess := session.New()
+			sess.Meta.ID = a.cfg.SessionID
+			return sess, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sess, err := store.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		a.adoptSession(sess)
+		return sess, nil
+	case a.cfg.Resume:
+		sess, err := session.Latest(store, a.workDir())
+		if errors.Is(err, session.ErrNotFound) {
+			return nil, errors.New("no saved sessions to resume")
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.adoptSession(sess)
+		return sess, nil
+	case interactive:
+		return session.New(), nil
+	}
+	return nil, nil
+}
+
+// adoptSession continues a resumed session with the model, provider and API
+// mode it was recorded with, unless they were set explicitly for this run.
+func (a *App) adoptSession(sess *session.Session) {
+	if !a.cfg.ModelSet && sess.Meta.Model != "" {
+		a.cfg.Model = sess.Meta.Model
+	}
+	changed := false
+	if !a.cfg.ProviderSet && sess.Meta.Provider != a.cfg.Provider {
+		a.cfg.Provider = sess.Meta.Provider
+		changed = true
+	}
+	if !a.cfg.APIModeSet && sess.Meta.APIMode != "" {
+		useResponses := sess.Meta.APIMode == session.APIModeResponses
+		if useResponses != a.cfg.UseResponsesAPI {
+			a.cfg.UseResponsesAPI = useResponses
+			changed = true
+		}
+	}
+	if changed {
+		a.agent = newAgent(a.cfg)
+	}
+}
+
+// sessionMessages returns the stored conversation with its system prompt
+// rebuilt, so AGENTS.md, skills and situations reflect the current state.
+func sessionMessages(sess *session.Session) []types.Message {
+	sys := types.Message{Role: "system", Content: prompt.SystemPrompt()}
+	msgs := append([]types.Message(nil), sess.Messages...)
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		msgs[0] = sys
+		return msgs
+	}
+	return append([]types.Message{sys}, msgs...)
+}
+
+// saveSession records msgs and a snapshot of the run settings. Failures are
+// reported but never interrupt the conversation.
+func (a *App) saveSession(sess *session.Session, msgs []types.Message) {
+	sess.Messages = msgs
+	sess.Meta.Model = a.cfg.Model
+	sess.Meta.Provider = a.cfg.Provider
+	sess.Meta.APIMode = session.APIModeChat
+	if a.cfg.UseResponsesAPI {
+		sess.Meta.APIMode = session.APIModeResponses
+	}
+	sess.Meta.CWD = a.workDir()
+	sess.Meta.Policy = a.cfg.Policy
+	if err := a.cfg.Sessions.Save(sess); err != nil {
+		_, _ = fmt.Fprintln(a.cfg.Stderr, "WARN: saving session:", err)
+	}
+}
+
+// openCheckpoints returns the checkpoint store of this run, named after the
+// session or, without one, a fresh ID, and makes the file tools save into
+// it unless they write to an overlay. It returns nil when checkpoints are
+// disabled.
+func (a *App) openCheckpoints(sess *session.Session) *checkpoint.Store {
+	if a.cfg.Checkpoints == "" {
+		return nil
+	}
+	id := session.NewID(time.Now())
+	if sess != nil {
+		id = sess.Meta.ID
+	}
+	cwd := a.workDir()
+	s := checkpoint.Open(a.cfg.Checkpoints, id, cwd)
+	if a.cfg.Overlay != nil {
+		return s
+	}
+	a.cfg.Policy.Checkpoints = s
+	plugins.SetCheckpoints(s, cwd)
+	return s
+}
+
+// reportSession tells the user how to pick the session up again.
+func (a *App) reportSession(sess *session.Session) {
+	if sess.Meta.MessageCount == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(a.cfg.Stderr, "Session %s saved. Resume with: jorin sessions resume %s\n", sess.Meta.ID, sess.Meta.ID)
+}
+
+func (a *App) workDir() string {
+	dir := a.cfg.Policy.CWD
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		dir = wd
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/session"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestREPLSavesAndResumesSession(t *testing.T) {
+	llm := &recordingLLM{}
+	withTestLLM(t, llm)
+	store := session.NewFileStore(t.TempDir())
+
+	var stderr bytes.Buffer
+	cfg := Config{
+		Model:    "first-model",
+		Repl:     true,
+		Policy:   types.Policy{Readonly: true},
+		Stdin:    strings.NewReader("remember the bug\n"),
+		Stdout:   &bytes.Buffer{},
+		Stderr:   &stderr,
+		Sessions: store,
+	}
+	if err := NewApp(&cfg).Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	list, err := store.List()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one saved session, got %+v %v", list, err)
+	}
+	meta := list[0]
+	if meta.Model != "first-model" || meta.APIMode != session.APIModeChat || !meta.Policy.Readonly || meta.MessageCount != 3 {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+	if !strings.Contains(stderr.String(), "jorin sessions resume "+meta.ID) {
+		t.Fatalf("expected resume hint, got %q", stderr.String())
+	}
+
+	cfg = Config{
+		Model:     "default-model",
+		Prompt:    "what was the bug?",
+		Stdin:     strings.NewReader(""),
+		Stdout:    &bytes.Buffer{},
+		Stderr:    &bytes.Buffer{},
+		Sessions:  store,
+		SessionID: meta.ID[:10],
+	}
+	if err := NewApp(&cfg).Run(context.Background()); err != nil {
+		t.Fatalf("resumed Run failed: %v", err)
+	}
+
+	calls := llm.Messages()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 LLM calls, got %d", len(calls))
+	}
+	resumed := calls[1]
+	if len(resumed) != 4 || resumed[1].Content != "remember the bug" || resumed[3].Content != "what was the bug?" {
+		t.Fatalf("expected resumed history, got %#v", resumed)
+	}
+	if cfg.Model != "first-model" {
+		t.Fatalf("expected resumed session to keep its model, got %q", cfg.Model)
+	}
+
+	s, err := store.Load(meta.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(s.Messages) != 5 {
+		t.Fatalf("expected resumed turn to be saved, got %d messages", len(s.Messages))
+	}
+}
+
+func TestResumeWithoutSessionsFails(t *testing.T) {
+	cfg := Config{
+		Prompt:   "hi",
+		Stdin:    strings.NewReader(""),
+		Stdout:   &bytes.Buffer{},
+		Stderr:   &bytes.Buffer{},
+		Sessions: session.NewFileStore(t.TempDir()),
+		Resume:   true,
+	}
+	err := NewApp(&cfg).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no saved sessions") {
+		t.Fatalf("expected no saved sessions error, got %v", err)
+	}
+}
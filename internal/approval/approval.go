@@ -0,0 +1,260 @@
+// Package approval asks the user on a terminal before tool calls run.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dave1010/jorin/internal/diff"
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// maxShownLines bounds the diff or arguments printed for one call.
+const maxShownLines = 200
+
+// AskFunc reads one answer from the user. text pre-fills the line when the
+// reader supports editing.
+type AskFunc func(prompt, text string) (string, error)
+
+// Terminal is a types.Approver that shows each call (the command, a diff of
+// the file change or the arguments) on out and reads the decision with ask.
+// Prefixes the user chooses to always allow are remembered for the lifetime
+// of the Terminal.
+type Terminal struct {
+	ask AskFunc
+	out io.Writer
+
+	mu    sync.Mutex
+	rules []rule
+}
+
+// rule allows calls to tool whose subject starts with prefix. An empty
+// prefix allows every call to tool.
+type rule struct {
+	tool   string
+	prefix string
+}
+
+// NewTerminal returns a Terminal that writes to out and reads with ask.
+func NewTerminal(ask AskFunc, out io.Writer) *Terminal {
+	return &Terminal{ask: ask, out: out}
+}
+
+// Approve implements types.Approver. Concurrent calls, e.g. from sibling
+// sub-agents, are asked about one at a time.
+func (t *Terminal) Approve(ctx context.Context, req types.ApprovalRequest) types.ApprovalDecision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ctx.Err() != nil {
+		return types.ApprovalDecision{Reason: "cancelled"}
+	}
+	subject := Subject(req)
+	if t.allowed(req.Tool, subject) {
+		return types.ApprovalDecision{Allow: true}
+	}
+	t.show(req)
+	for {
+		ans, err := t.ask(fmt.Sprintf("Allow %s? [y]es, [n]o, [e]dit, [a]lways: ", req.Tool), "")
+		if err != nil {
+			return types.ApprovalDecision{Reason: "no answer"}
+		}
+		switch strings.ToLower(strings.TrimSpace(ans)) {
+		case "y", "yes":
+			return types.ApprovalDecision{Allow: true}
+		case "n", "no":
+			reason, _ := t.ask("Reason (sent to the model, optional): ", "")
+			return types.ApprovalDecision{Reason: strings.TrimSpace(reason)}
+		case "e", "edit":
+			if !runsCommand(req.Tool) {
+				fmt.Fprintln(t.out, "Only shell commands can be edited.")
+				continue
+			}
+			cmd, err := t.ask("$ ", subject)
+			if err != nil || strings.TrimSpace(cmd) == "" {
+				continue
+			}
+			args := map[string]any{}
+			for k, v := range req.Args {
+				args[k] = v
+			}
+			args["cmd"] = cmd
+			return types.ApprovalDecision{Allow: true, Args: args}
+		case "a", "always":
+			if subject == "" {
+				t.rules = append(t.rules, rule{tool: req.Tool})
+				return types.ApprovalDecision{Allow: true}
+			}
+			prefix, err := t.ask(fmt.Sprintf("Always allow %s starting with: ", req.Tool), suggestPrefix(req.Tool, subject))
+			if err != nil || strings.TrimSpace(prefix) == "" {
+				continue
+			}
+			r := rule{tool: req.Tool, prefix: strings.TrimSpace(prefix)}
+			if !r.matches(req.Tool, subject) {
+				fmt.Fprintf(t.out, "%q does not match this call.\n", r.prefix)
+				continue
+			}
+			t.rules = append(t.rules, r)
+			return types.ApprovalDecision{Allow: true}
+		default:
+			fmt.Fprintln(t.out, "Answer y, n, e or a.")
+		}
+	}
+}
+
+func (t *Terminal) allowed(tool, subject string) bool {
+	for _, r := range t.rules {
+		if r.matches(tool, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rule) matches(tool, subject string) bool {
+	if r.tool != tool {
+		return false
+	}
+	if r.prefix == "" {
+		return true
+	}
+	if !runsCommand(tool) {
+		// a patch's subject lists each file it touches
+		for _, path := range strings.Split(subject, "\n") {
+			if !strings.HasPrefix(filepath.Clean(path), r.prefix) {
+				return false
+			}
+		}
+		return true
+	}
+	// A prefix never covers a compound command: "git status; rm -rf ~"
+	// starts with "git status" too.
+	if strings.ContainsAny(subject, ";&|<>`$\n") {
+		return false
+	}
+	if !strings.HasPrefix(subject, r.prefix) {
+		return false
+	}
+	rest := subject[len(r.prefix):]
+	return rest == "" || strings.HasSuffix(r.prefix, " ") || strings.HasPrefix(rest, " ")
+}
+
+// Subject returns what an "always allow" prefix of the call is matched
+// against: the command for shell and process_start, the file path for write_file and
+// edit_file, the paths apply_patch touches, one per line, and "" for other
+// tools.
+func Subject(req types.ApprovalRequest) string {
+	switch req.Tool {
+	case "shell", "process_start":
+		cmd, _ := req.Args["cmd"].(string)
+		return strings.TrimSpace(cmd)
+	case "write_file", "edit_file":
+		path, _ := req.Args["path"].(string)
+		return path
+	case "apply_patch":
+		patch, _ := req.Args["patch"].(string)
+		paths, _ := tools.PatchPaths(patch)
+		return strings.Join(paths, "\n")
+	}
+	return ""
+}
+
+// runsCommand reports whether tool runs its "cmd" argument in the shell.
+func runsCommand(tool string) bool {
+	return tool == "shell" || tool == "process_start"
+}
+
+// suggestPrefix proposes the command name plus its subcommand for shell
+// ("go test ./..." gives "go test") and the directory for files.
+func suggestPrefix(tool, subject string) string {
+	if !runsCommand(tool) {
+		subject, _, _ = strings.Cut(subject, "\n")
+		dir := filepath.Dir(filepath.Clean(subject))
+		if dir == "." {
+			return subject
+		}
+		return dir + string(filepath.Separator)
+	}
+	fields := strings.Fields(subject)
+	if len(fields) > 1 && !strings.HasPrefix(fields[1], "-") && !strings.ContainsAny(fields[1], "/.=") {
+		return fields[0] + " " + fields[1]
+	}
+	return fields[0]
+}
+
+func (t *Terminal) show(req types.ApprovalRequest) {
+	var lines []string
+	switch req.Tool {
+	case "shell":
+		lines = []string{"$ " + Subject(req)}
+		if stdin, _ := req.Args["stdin"].(string); stdin != "" {
+			lines = append(lines, prefixLines("< ", stdin)...)
+		}
+	case "process_start":
+		lines = []string{"$ " + Subject(req) + " &"}
+	case "write_file":
+		path, _ := req.Args["path"].(string)
+		text, _ := req.Args["text"].(string)
+		old, err := readFile(req, path)
+		if err != nil {
+			lines = append([]string{"new file " + path}, prefixLines("+", text)...)
+		} else {
+			lines = append([]string{"--- " + path, "+++ " + path}, diff.Lines(string(old), text)...)
+		}
+	case "edit_file":
+		path, _ := req.Args["path"].(string)
+		oldString, _ := req.Args["old_string"].(string)
+		newString, _ := req.Args["new_string"].(string)
+		replaceAll, _ := req.Args["replace_all"].(bool)
+		lines = []string{"--- " + path, "+++ " + path}
+		old, err := readFile(req, path)
+		text, _, editErr := tools.EditText(string(old), oldString, newString, replaceAll)
+		if err != nil || editErr != nil {
+			// the call will fail; show what it asked for
+			lines = append(append(lines, prefixLines("-", oldString)...), prefixLines("+", newString)...)
+		} else {
+			lines = append(lines, diff.Lines(string(old), text)...)
+		}
+	case "apply_patch":
+		patch, _ := req.Args["patch"].(string)
+		lines = strings.Split(strings.TrimRight(patch, "\n"), "\n")
+	default:
+		b, _ := json.MarshalIndent(req.Args, "", "  ")
+		lines = append([]string{req.Tool}, strings.Split(string(b), "\n")...)
+	}
+	if len(lines) > maxShownLines {
+		more := len(lines) - maxShownLines
+		lines = append(lines[:maxShownLines], fmt.Sprintf("... (%d more lines)", more))
+	}
+	if req.Reason != "" && !strings.HasPrefix(req.Reason, "approve=") {
+		// a policy rule's message; the approve setting needs no explanation
+		lines = append(lines, "("+req.Reason+")")
+	}
+	fmt.Fprintln(t.out, strings.Join(lines, "\n"))
+}
+
+// readFile reads path as the tool will, through the policy's file system
+// when it has one.
+func readFile(req types.ApprovalRequest, path string) ([]byte, error) {
+	if req.FS != nil {
+		return req.FS.ReadFile(path)
+	}
+	return os.ReadFile(path)
+}
+
+func prefixLines(prefix, text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+	return lines
+}
@@ -0,0 +1,142 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// scripted answers prompts in order and records the pre-filled texts.
+type scripted struct {
+	answers []string
+	texts   []string
+}
+
+func (s *scripted) ask(prompt, text string) (string, error) {
+	s.texts = append(s.texts, text)
+	if len(s.answers) == 0 {
+		return "", errors.New("no more answers")
+	}
+	a := s.answers[0]
+	s.answers = s.answers[1:]
+	return a, nil
+}
+
+func shellReq(cmd string) types.ApprovalRequest {
+	return types.ApprovalRequest{Tool: "shell", Args: map[string]any{"cmd": cmd}}
+}
+
+func TestTerminalDecisions(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	s := &scripted{}
+	term := NewTerminal(s.ask, &out)
+
+	s.answers = []string{"maybe", "y"}
+	if d := term.Approve(ctx, shellReq("ls")); !d.Allow {
+		t.Fatalf("expected approval: %+v", d)
+	}
+	if !strings.Contains(out.String(), "$ ls") || !strings.Contains(out.String(), "Answer y, n, e or a.") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+
+	s.answers = []string{"n", "too risky"}
+	if d := term.Approve(ctx, shellReq("rm x")); d.Allow || d.Reason != "too risky" {
+		t.Fatalf("expected denial with reason: %+v", d)
+	}
+
+	s.answers = []string{"e", "go test ./internal/..."}
+	d := term.Approve(ctx, shellReq("go test ./..."))
+	if !d.Allow || d.Args["cmd"] != "go test ./internal/..." || s.texts[len(s.texts)-1] != "go test ./..." {
+		t.Fatalf("expected edited command: %+v (prefilled %q)", d, s.texts)
+	}
+
+	s.answers = []string{"a", "go test"}
+	if d := term.Approve(ctx, shellReq("go test ./...")); !d.Allow || s.texts[len(s.texts)-1] != "go test" {
+		t.Fatalf("expected always-allow with suggested prefix: %+v (prefilled %q)", d, s.texts)
+	}
+	s.answers = nil
+	if d := term.Approve(ctx, shellReq("go test -run X ./tools")); !d.Allow {
+		t.Fatalf("a remembered prefix should approve without asking: %+v", d)
+	}
+	for _, cmd := range []string{"go testing", "go test ./... && rm -rf ~", "go vet"} {
+		if d := term.Approve(ctx, shellReq(cmd)); d.Allow {
+			t.Fatalf("%q must not be covered by the go test prefix", cmd)
+		}
+	}
+}
+
+func TestTerminalBackgroundProcess(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	s := &scripted{answers: []string{"a", "go run"}}
+	term := NewTerminal(s.ask, &out)
+	req := types.ApprovalRequest{Tool: "process_start", Args: map[string]any{"cmd": "go run ./server"}}
+	if d := term.Approve(ctx, req); !d.Allow || s.texts[len(s.texts)-1] != "go run" {
+		t.Fatalf("expected always-allow with suggested prefix: %+v (prefilled %q)", d, s.texts)
+	}
+	if !strings.Contains(out.String(), "$ go run ./server &") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+	if d := term.Approve(ctx, shellReq("go run ./server")); d.Allow {
+		t.Fatalf("a process_start rule must not approve shell calls")
+	}
+}
+
+func TestTerminalShowsFileDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	dir := filepath.Dir(path) + string(filepath.Separator)
+	s := &scripted{answers: []string{"a", dir}}
+	term := NewTerminal(s.ask, &out)
+	req := types.ApprovalRequest{Tool: "write_file", Args: map[string]any{"path": path, "text": "a\nB\nc\n"}}
+	if d := term.Approve(context.Background(), req); !d.Allow {
+		t.Fatalf("expected approval: %+v", d)
+	}
+	if !strings.Contains(out.String(), " a\n-b\n+B\n c") {
+		t.Fatalf("expected a diff, got %q", out.String())
+	}
+	if s.texts[len(s.texts)-1] != dir {
+		t.Fatalf("expected the directory as suggested prefix, got %q", s.texts)
+	}
+	req.Args["path"] = filepath.Join(filepath.Dir(path), "other.txt")
+	if d := term.Approve(context.Background(), req); !d.Allow {
+		t.Fatalf("files in an always-allowed directory should be approved: %+v", d)
+	}
+}
+
+func TestTerminalShowsEditDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s := &scripted{answers: []string{"y", "y"}}
+	term := NewTerminal(s.ask, &out)
+	req := types.ApprovalRequest{Tool: "edit_file", Args: map[string]any{"path": path, "old_string": "b", "new_string": "B"}}
+	if d := term.Approve(context.Background(), req); !d.Allow {
+		t.Fatalf("expected approval: %+v", d)
+	}
+	if !strings.Contains(out.String(), " a\n-b\n+B\n c") {
+		t.Fatalf("expected the file's diff, got %q", out.String())
+	}
+
+	// an edit that will not apply shows the strings it asked for
+	out.Reset()
+	req.Args["old_string"] = "x\ny"
+	if d := term.Approve(context.Background(), req); !d.Allow {
+		t.Fatalf("expected approval: %+v", d)
+	}
+	if !strings.Contains(out.String(), "+++ "+path+"\n-x\n-y\n+B\n") {
+		t.Fatalf("expected old_string and new_string, got %q", out.String())
+	}
+}
@@ -0,0 +1,430 @@
+// Package checkpoint records the files agent tools change so the changes
+// can be undone. Each turn of a session that changes files becomes a
+// numbered checkpoint holding the contents the files had before the turn,
+// or the fact that they did not exist. Only files recorded this way are
+// ever restored.
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	manifestName = "checkpoint.json"
+	maxLabelLen  = 60
+)
+
+// ErrNone is returned when there is no checkpoint to restore.
+var ErrNone = errors.New("no checkpoints")
+
+// Checkpoint is the record of one turn's file changes.
+type Checkpoint struct {
+	N       int       `json:"n"`
+	Label   string    `json:"label,omitempty"`
+	CWD     string    `json:"cwd,omitempty"`
+	Created time.Time `json:"created"`
+	// Complete is set when the turn ended and each file's After hash was
+	// recorded. A run that was killed leaves an incomplete checkpoint.
+	Complete bool   `json:"complete,omitempty"`
+	Files    []File `json:"files"`
+}
+
+// File is a changed file as it was before the turn.
+type File struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	// Blob names the saved content in the checkpoint directory.
+	Blob string `json:"blob,omitempty"`
+	// After is the SHA-256 of the content the turn left, or empty if it
+	// left no file.
+	After string `json:"after,omitempty"`
+}
+
+// Store holds the checkpoints of one session under a directory. It is safe
+// for concurrent use, as sub-agents save into their parent's store.
+type Store struct {
+	dir string
+	cwd string
+
+	mu    sync.Mutex
+	label string
+	cur   *Checkpoint
+}
+
+// DefaultDir returns the directory checkpoint stores are kept in:
+// $XDG_STATE_HOME/jorin/checkpoints, falling back to ~/.local/state.
+func DefaultDir() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "jorin", "checkpoints"), nil
+}
+
+// Open returns the store of session id under dir. Checkpoints record cwd so
+// Latest can find the stores of a directory. Nothing is written until a
+// file is saved.
+func Open(dir, id, cwd string) *Store {
+	return &Store{dir: filepath.Join(dir, id), cwd: cwd}
+}
+
+// Dir returns the directory the store writes to.
+func (s *Store) Dir() string { return s.dir }
+
+// Begin starts the checkpoint of a turn. The checkpoint is only created
+// when the turn saves a file; label describes the turn, typically the
+// user's prompt.
+func (s *Store) Begin(label string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	label = strings.Join(strings.Fields(label), " ")
+	if len(label) > maxLabelLen {
+		n := maxLabelLen
+		for n > 0 && !utf8.RuneStart(label[n]) {
+			n--
+		}
+		label = label[:n] + "..."
+	}
+	s.label, s.cur = label, nil
+}
+
+// Save records the current state of each absolute path before a tool
+// changes it, unless the current checkpoint already holds it. It
+// implements types.Checkpointer.
+func (s *Store) Save(paths ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil {
+		list, err := s.list()
+		if err != nil {
+			return err
+		}
+		n := 1
+		if len(list) > 0 {
+			n = list[len(list)-1].N + 1
+		}
+		s.cur = &Checkpoint{N: n, Label: s.label, CWD: s.cwd, Created: time.Now().UTC()}
+		if err := os.MkdirAll(s.checkpointDir(n), 0o700); err != nil {
+			return err
+		}
+	}
+	for _, path := range paths {
+		if s.cur.has(path) {
+			continue
+		}
+		f := File{Path: path}
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		case info.IsDir():
+			return fmt.Errorf("%s is a directory", path)
+		default:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			f.Existed, f.Mode = true, info.Mode().Perm()
+			f.Blob = strconv.Itoa(len(s.cur.Files))
+			if err := os.WriteFile(filepath.Join(s.checkpointDir(s.cur.N), f.Blob), data, 0o600); err != nil {
+				return err
+			}
+		}
+		s.cur.Files = append(s.cur.Files, f)
+	}
+	return s.write(s.cur)
+}
+
+// End finishes the current turn's checkpoint, recording what the turn left
+// in each file so a later restore can tell whether someone else changed it
+// since.
+func (s *Store) End() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := s.cur
+	s.cur = nil
+	if cp == nil {
+		return nil
+	}
+	var err error
+	for i := range cp.Files {
+		if cp.Files[i].After, err = hashFile(cp.Files[i].Path); err != nil {
+			return err
+		}
+	}
+	cp.Complete = true
+	return s.write(cp)
+}
+
+// List returns the store's checkpoints, oldest first.
+func (s *Store) List() ([]Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *Store) list() ([]Checkpoint, error) {
+	ents, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Checkpoint
+	for _, e := range ents {
+		n, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.checkpointDir(n), manifestName))
+		if err != nil {
+			// a checkpoint whose first file was never recorded
+			continue
+		}
+		var cp Checkpoint
+		if err := json.Unmarshal(b, &cp); err != nil {
+			return nil, fmt.Errorf("checkpoint %d: %w", n, err)
+		}
+		cp.N = n
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].N < out[j].N })
+	return out, nil
+}
+
+// Undo restores the latest checkpoint (see Restore).
+func (s *Store) Undo() (Checkpoint, error) {
+	list, err := s.List()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if len(list) == 0 {
+		return Checkpoint{}, ErrNone
+	}
+	n := list[len(list)-1].N
+	restored, err := s.Restore(n)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	return restored[0], nil
+}
+
+// Restore returns the files to their state before checkpoint n, undoing it
+// and every later checkpoint, and removes those checkpoints. It returns the
+// checkpoints undone, latest first. If a file was changed after the turn
+// that last changed it, by the user or another program, nothing is restored.
+func (s *Store) Restore(n int) ([]Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	var undo []Checkpoint
+	for i := len(list) - 1; i >= 0 && list[i].N >= n; i-- {
+		undo = append(undo, list[i])
+	}
+	if len(undo) == 0 || undo[len(undo)-1].N != n {
+		if len(list) == 0 {
+			return nil, ErrNone
+		}
+		return nil, fmt.Errorf("no checkpoint %d", n)
+	}
+
+	// each file must still hold what the latest turn left in it
+	checked := map[string]bool{}
+	var conflicts []string
+	for _, cp := range undo {
+		for _, f := range cp.Files {
+			if checked[f.Path] {
+				continue
+			}
+			checked[f.Path] = true
+			if !cp.Complete {
+				continue
+			}
+			if sum, err := hashFile(f.Path); err != nil {
+				return nil, err
+			} else if sum != f.After {
+				conflicts = append(conflicts, f.Path)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%s changed after the agent's last edit; nothing was restored", strings.Join(conflicts, ", "))
+	}
+	if s.cur != nil && s.cur.N >= n {
+		s.cur = nil
+	}
+
+	for _, cp := range undo {
+		for _, f := range cp.Files {
+			if err := s.restoreFile(cp.N, f); err != nil {
+				return nil, fmt.Errorf("checkpoint %d: %w", cp.N, err)
+			}
+		}
+		if err := os.RemoveAll(s.checkpointDir(cp.N)); err != nil {
+			return nil, err
+		}
+	}
+	return undo, nil
+}
+
+func (s *Store) restoreFile(n int, f File) error {
+	if !f.Existed {
+		err := os.Remove(f.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(s.checkpointDir(n), f.Blob))
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(f.Path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), f.Mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.Path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *Store) checkpointDir(n int) string {
+	return filepath.Join(s.dir, strconv.Itoa(n))
+}
+
+// write saves cp's manifest. Checkpoints hold file contents, so they are
+// private to the user.
+func (s *Store) write(cp *Checkpoint) error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := s.checkpointDir(cp.N)
+	tmp, err := os.CreateTemp(dir, "."+manifestName+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, manifestName))
+}
+
+func (cp *Checkpoint) has(path string) bool {
+	for _, f := range cp.Files {
+		if f.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Latest returns the store under dir whose newest checkpoint is the most
+// recent one recorded in cwd.
+func Latest(dir, cwd string) (*Store, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var best *Store
+	var bestTime time.Time
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		s := Open(dir, e.Name(), cwd)
+		list, err := s.list()
+		if err != nil || len(list) == 0 {
+			continue
+		}
+		last := list[len(list)-1]
+		if last.CWD == cwd && (best == nil || last.Created.After(bestTime)) {
+			best, bestTime = s, last.Created
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w in %s", ErrNone, cwd)
+	}
+	return best, nil
+}
+
+// hashFile returns the SHA-256 of the file at path, or "" if it does not
+// exist.
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Describe returns a one-line summary of cp, with paths relative to cwd
+// where they lie inside it and files the turn created marked "(new)".
+func (cp Checkpoint) Describe(cwd string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d  %s  ", cp.N, cp.Created.Local().Format(time.DateTime))
+	if cp.Label != "" {
+		fmt.Fprintf(&b, "%q  ", cp.Label)
+	}
+	for i, f := range cp.Files {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		path := f.Path
+		if rel, err := filepath.Rel(cwd, path); err == nil && cwd != "" && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		b.WriteString(path)
+		if !f.Existed {
+			b.WriteString(" (new)")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func write(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "<none>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// turn runs one checkpointed turn that writes each path's text.
+func turn(t *testing.T, s *Store, label string, files map[string]string) {
+	t.Helper()
+	s.Begin(label)
+	for path, text := range files {
+		if err := s.Save(path); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		write(t, path, text)
+	}
+	if err := s.End(); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+}
+
+func TestUndoAndRestore(t *testing.T) {
+	work := t.TempDir()
+	a, b, other := filepath.Join(work, "a.txt"), filepath.Join(work, "b.txt"), filepath.Join(work, "other.txt")
+	write(t, a, "a0")
+	write(t, other, "untouched")
+	s := Open(t.TempDir(), "sess", work)
+
+	s.Begin("a turn that changes nothing")
+	if err := s.End(); err != nil {
+		t.Fatal(err)
+	}
+	turn(t, s, "first", map[string]string{a: "a1"})
+	turn(t, s, "second", map[string]string{a: "a2", b: "b2"})
+	turn(t, s, "third", map[string]string{b: "b3"})
+
+	list, err := s.List()
+	if err != nil || len(list) != 3 || list[0].N != 1 || list[2].Label != "third" {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+	if got := list[1].Describe(work); !strings.Contains(got, `"second"  a.txt, b.txt (new)`) {
+		t.Fatalf("Describe = %q", got)
+	}
+
+	cp, err := s.Undo()
+	if err != nil || cp.N != 3 {
+		t.Fatalf("Undo = %+v, %v", cp, err)
+	}
+	if read(t, b) != "b2" || read(t, a) != "a2" {
+		t.Fatalf("after undo: a=%q b=%q", read(t, a), read(t, b))
+	}
+
+	undone, err := s.Restore(1)
+	if err != nil || len(undone) != 2 || undone[0].N != 2 {
+		t.Fatalf("Restore = %+v, %v", undone, err)
+	}
+	if read(t, a) != "a0" || read(t, b) != "<none>" || read(t, other) != "untouched" {
+		t.Fatalf("after restore: a=%q b=%q other=%q", read(t, a), read(t, b), read(t, other))
+	}
+	if _, err := s.Undo(); !errors.Is(err, ErrNone) {
+		t.Fatalf("expected ErrNone, got %v", err)
+	}
+
+	// numbering continues in a reopened store
+	turn(t, s, "fourth", map[string]string{a: "a4"})
+	if list, _ := Open(filepath.Dir(s.Dir()), "sess", work).List(); len(list) != 1 || list[0].N != 1 {
+		t.Fatalf("List = %+v", list)
+	}
+}
+
+func TestRestoreRefusesFilesChangedSince(t *testing.T) {
+	work := t.TempDir()
+	a, b := filepath.Join(work, "a.txt"), filepath.Join(work, "b.txt")
+	write(t, a, "a0")
+	write(t, b, "b0")
+	s := Open(t.TempDir(), "sess", work)
+	turn(t, s, "edit", map[string]string{a: "a1", b: "b1"})
+
+	write(t, b, "the user's change")
+	if _, err := s.Undo(); err == nil || !strings.Contains(err.Error(), b+" changed after the agent's last edit") {
+		t.Fatalf("expected a conflict naming %s, got %v", b, err)
+	}
+	if read(t, a) != "a1" || read(t, b) != "the user's change" {
+		t.Fatalf("a refused restore must change nothing: a=%q b=%q", read(t, a), read(t, b))
+	}
+	if _, err := s.Restore(7); err == nil || !strings.Contains(err.Error(), "no checkpoint 7") {
+		t.Fatalf("expected an unknown checkpoint error, got %v", err)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	dir := t.TempDir()
+	work, elsewhere := t.TempDir(), t.TempDir()
+	turn(t, Open(dir, "old", work), "old", map[string]string{filepath.Join(work, "x"): "1"})
+	turn(t, Open(dir, "new", work), "new", map[string]string{filepath.Join(work, "y"): "1"})
+	turn(t, Open(dir, "other", elsewhere), "other", map[string]string{filepath.Join(elsewhere, "z"): "1"})
+
+	s, err := Latest(dir, work)
+	if err != nil || filepath.Base(s.Dir()) != "new" {
+		t.Fatalf("Latest = %v, %v", s, err)
+	}
+	if _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Latest(dir, work); err != nil || filepath.Base(s.Dir()) != "old" {
+		t.Fatalf("after undo Latest = %v, %v", s, err)
+	}
+	if _, err := Latest(dir, t.TempDir()); !errors.Is(err, ErrNone) {
+		t.Fatalf("expected ErrNone for a directory without checkpoints, got %v", err)
+	}
+}
+
+func TestLongLabelsAreCutAtACharacter(t *testing.T) {
+	work := t.TempDir()
+	for _, pad := range []string{"", "a"} {
+		s := Open(t.TempDir(), "sess", work)
+		turn(t, s, pad+strings.Repeat("é", maxLabelLen), map[string]string{filepath.Join(work, "x"): pad})
+		list, err := s.List()
+		if err != nil || len(list) != 1 {
+			t.Fatalf("List = %v, %v", list, err)
+		}
+		label := list[0].Label
+		if !utf8.ValidString(label) || strings.ContainsRune(label, utf8.RuneError) || !strings.HasSuffix(label, "...") || len(label) > maxLabelLen+len("...") {
+			t.Fatalf("label %q should be valid UTF-8 cut to %d bytes", label, maxLabelLen)
+		}
+	}
+}
@@ -1,25 +1,615 @@
 package config
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dave1010/jorin/internal/shell"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// Defaults for values that are not set by any layer.
+const (
+	DefaultModel         = "gpt-5-mini"
+	DefaultBaseURL       = "https://api.openai.com"
+	DefaultAPIMode       = APIModeChat
+	DefaultRalphMaxTries = 8
+	DefaultApprove       = types.ApproveNever
+	DefaultSandbox       = shell.SandboxNone
+	DefaultPatchFuzz     = 1
+	// DefaultPTYIdleTimeout is shell.DefaultIdleTimeout; 0 disables it.
+	DefaultPTYIdleTimeout = shell.DefaultIdleTimeout
+)
+
+// Default protected paths for the file tools (see types.MatchPathGlob).
+var (
+	DefaultDenyRead  = []string{".env*", "*.pem"}
+	DefaultDenyWrite = []string{".git/**"}
+)
+
+// API modes accepted by the api_mode key.
+const (
+	APIModeChat      = "chat"
+	APIModeResponses = "responses"
+)
+
+// Providers accepted by the provider key. An empty provider lets a model
+// prefix such as "anthropic/" choose the backend.
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
 )
 
-// Config holds basic configuration values for the application. This is a
-// minimal starter implementation used during the Phase 1 refactor. It is
-// intentionally simple: callers can extend fields as needed and wiring is
-// done from cmd/jorin.
+// SourceKind identifies the layer a value came from. Later kinds take
+// precedence over earlier ones.
+type SourceKind int
+
+const (
+	SourceDefault SourceKind = iota
+	SourceUser
+	SourceProject
+	SourceEnv
+	SourceFlag
+)
+
+// Source records where an effective value came from.
+type Source struct {
+	Kind SourceKind
+	// Detail names the file, environment variable or flag.
+	Detail string
+}
+
+func (s Source) String() string {
+	switch s.Kind {
+	case SourceUser:
+		return "user config " + s.Detail
+	case SourceProject:
+		return "project config " + s.Detail
+	case SourceEnv:
+		return "env " + s.Detail
+	case SourceFlag:
+		return "flag " + s.Detail
+	}
+	return "default"
+}
+
+// Layer is one set of raw settings, e.g. a config file or the command line.
+// Values maps a key to its value; scalar keys use the first element.
+type Layer struct {
+	Kind   SourceKind
+	Detail string
+	Values map[string][]string
+	// Details optionally names the origin of individual keys (such as the
+	// environment variable or flag), overriding Detail.
+	Details map[string]string
+}
+
+// Config holds the effective settings after all layers are merged.
 type Config struct {
-	Model string
-	// More fields (paths, timeouts, policy defaults) can be added later.
+	Model    string
+	Provider string
+	BaseURL  string
+	APIMode  string
+	Readonly bool
+	DryShell bool
+	// PersistentShell runs shell commands in one long-lived bash (see
+	// shell.Session), PTY each on a pseudo-terminal (see shell.RunPTY).
+	PersistentShell bool
+	PTY             bool
+	// PTYIdleTimeout kills a terminal command after that long without
+	// output; 0 means no limit.
+	PTYIdleTimeout time.Duration
+	Allow          []string
+	Deny           []string
+	DisabledTools  []string
+	Ralph          bool
+	RalphMaxTries  int
+	ToolTimeout    time.Duration
+	LLMTimeout     time.Duration
+	Approve        string
+	// Sandbox settings configure the shell runner (see shell.SandboxConfig).
+	// SandboxMemory is in MiB.
+	Sandbox        string
+	SandboxNetwork bool
+	WritableDirs   []string
+	SandboxCPU     time.Duration
+	SandboxMemory  int
+	SandboxProcs   int
+	// Roots confine the file tools; empty means the git root of the working
+	// directory, or the working directory itself.
+	Roots     []string
+	DenyRead  []string
+	DenyWrite []string
+	// PatchFuzz is how loosely apply_patch context may match (see
+	// tools.PatchFuzz).
+	PatchFuzz int
+	// HTTP settings are the HTTP tools' egress policy (see
+	// types.Policy.HTTPAllow). Credential values may name environment
+	// variables as ${NAME}, expanded when the policy is built.
+	HTTPAllow       []string
+	HTTPDeny        []string
+	HTTPPrivate     bool
+	HTTPCredentials []types.HTTPCredential
+
+	sources  map[string][]Source
+	warnings []string
 }
 
-// Load loads a configuration from environment variables and returns a
-// Config with sensible defaults. It does not attempt to read XDG files in
-// this initial implementation; that will be added in Phase 3.
-func Load() *Config {
-	c := &Config{Model: "gpt-5-mini"}
-	if m := os.Getenv("JORIN_MODEL"); m != "" {
-		c.Model = m
+// Keys lists every supported key in display order.
+var Keys = []string{
+	"model",
+	"provider",
+	"base_url",
+	"api_mode",
+	"readonly",
+	"dry_shell",
+	"persistent_shell",
+	"pty",
+	"pty_idle_timeout",
+	"allow",
+	"deny",
+	"disabled_tools",
+	"ralph",
+	"ralph_max_tries",
+	"tool_timeout",
+	"llm_timeout",
+	"approve",
+	"sandbox",
+	"sandbox_network",
+	"writable_dirs",
+	"sandbox_cpu",
+	"sandbox_memory",
+	"sandbox_procs",
+	"roots",
+	"deny_read",
+	"deny_write",
+	"patch_fuzz",
+	"http_allow",
+	"http_deny",
+	"http_private",
+	"http_credentials",
+}
+
+// accumulating keys merge across layers instead of being replaced, so a
+// higher-precedence layer can add restrictions but never drop them.
+var accumulating = map[string]bool{"deny": true, "disabled_tools": true, "deny_read": true, "deny_write": true, "http_deny": true}
+
+// Default returns the built-in configuration.
+func Default() *Config {
+	c := &Config{
+		Model:          DefaultModel,
+		BaseURL:        DefaultBaseURL,
+		APIMode:        DefaultAPIMode,
+		RalphMaxTries:  DefaultRalphMaxTries,
+		Approve:        DefaultApprove,
+		Sandbox:        DefaultSandbox,
+		SandboxNetwork: true,
+		DenyRead:       append([]string(nil), DefaultDenyRead...),
+		DenyWrite:      append([]string(nil), DefaultDenyWrite...),
+		PatchFuzz:      DefaultPatchFuzz,
+		PTYIdleTimeout: DefaultPTYIdleTimeout,
+		sources:        map[string][]Source{},
+	}
+	for _, k := range Keys {
+		c.sources[k] = []Source{{Kind: SourceDefault}}
 	}
 	return c
 }
+
+// Load merges layers on top of the defaults. Layers are applied in the order
+// given, so callers pass them from lowest to highest precedence.
+func Load(layers ...Layer) (*Config, error) {
+	c := Default()
+	for _, l := range layers {
+		keys := make([]string, 0, len(l.Values))
+		for k := range l.Values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			src := Source{Kind: l.Kind, Detail: l.Detail}
+			if d, ok := l.Details[k]; ok {
+				src.Detail = d
+			}
+			if err := c.set(k, l.Values[k], src); err != nil {
+				return nil, fmt.Errorf("%s: %w", src, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Source reports the highest-precedence layer that set key.
+func (c *Config) Source(key string) Source {
+	srcs := c.sources[key]
+	if len(srcs) == 0 {
+		return Source{}
+	}
+	return srcs[len(srcs)-1]
+}
+
+// Sources reports every layer that contributed to key. Only the keys that
+// accumulate across layers (deny, disabled_tools, deny_read, deny_write and
+// http_deny) can have more than one.
+func (c *Config) Sources(key string) []Source {
+	return c.sources[key]
+}
+
+// Warnings lists the values a project config tried to relax and that were
+// ignored, each naming the key and the file.
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+// Value formats the effective value of key for display.
+func (c *Config) Value(key string) string {
+	switch key {
+	case "model":
+		return c.Model
+	case "provider":
+		return c.Provider
+	case "base_url":
+		return c.BaseURL
+	case "api_mode":
+		return c.APIMode
+	case "readonly":
+		return strconv.FormatBool(c.Readonly)
+	case "dry_shell":
+		return strconv.FormatBool(c.DryShell)
+	case "persistent_shell":
+		return strconv.FormatBool(c.PersistentShell)
+	case "pty":
+		return strconv.FormatBool(c.PTY)
+	case "pty_idle_timeout":
+		return c.PTYIdleTimeout.String()
+	case "allow":
+		return formatList(c.Allow)
+	case "deny":
+		return formatList(c.Deny)
+	case "disabled_tools":
+		return formatList(c.DisabledTools)
+	case "ralph":
+		return strconv.FormatBool(c.Ralph)
+	case "ralph_max_tries":
+		return strconv.Itoa(c.RalphMaxTries)
+	case "tool_timeout":
+		return c.ToolTimeout.String()
+	case "llm_timeout":
+		return c.LLMTimeout.String()
+	case "approve":
+		return c.Approve
+	case "sandbox":
+		return c.Sandbox
+	case "sandbox_network":
+		return strconv.FormatBool(c.SandboxNetwork)
+	case "writable_dirs":
+		return formatList(c.WritableDirs)
+	case "sandbox_cpu":
+		return c.SandboxCPU.String()
+	case "sandbox_memory":
+		return strconv.Itoa(c.SandboxMemory)
+	case "sandbox_procs":
+		return strconv.Itoa(c.SandboxProcs)
+	case "roots":
+		return formatList(c.Roots)
+	case "deny_read":
+		return formatList(c.DenyRead)
+	case "deny_write":
+		return formatList(c.DenyWrite)
+	case "patch_fuzz":
+		return strconv.Itoa(c.PatchFuzz)
+	case "http_allow":
+		return formatList(c.HTTPAllow)
+	case "http_deny":
+		return formatList(c.HTTPDeny)
+	case "http_private":
+		return strconv.FormatBool(c.HTTPPrivate)
+	case "http_credentials":
+		// the values are secrets
+		var hosts []string
+		for _, cr := range c.HTTPCredentials {
+			hosts = append(hosts, cr.Host+" "+cr.Header+": ***")
+		}
+		return formatList(hosts)
+	}
+	return ""
+}
+
+func formatList(v []string) string {
+	if len(v) == 0 {
+		return "[]"
+	}
+	return "[" + strings.Join(v, ", ") + "]"
+}
+
+func (c *Config) set(key string, vals []string, src Source) error {
+	key = normalizeKey(key)
+	var one string
+	if len(vals) > 0 {
+		one = vals[0]
+	} else if !isList(key) {
+		return fmt.Errorf("missing value for %q", key)
+	}
+	var err error
+	switch key {
+	case "model":
+		c.Model = one
+	case "provider":
+		switch one {
+		case ProviderOpenAI, ProviderAnthropic, ProviderOllama:
+		default:
+			return fmt.Errorf("provider must be one of %s, %s or %s, got %q", ProviderOpenAI, ProviderAnthropic, ProviderOllama, one)
+		}
+		if src.Kind == SourceProject {
+			return c.ignore(key, src, "a project config cannot choose where the API key is sent")
+		}
+		c.Provider = one
+	case "base_url":
+		if src.Kind == SourceProject {
+			// the API key is sent to whatever host this names
+			return c.ignore(key, src, "a project config cannot choose where the API key is sent")
+		}
+		c.BaseURL = strings.TrimRight(one, "/")
+	case "api_mode":
+		switch one {
+		case APIModeChat, "chat_completions", "completions":
+			c.APIMode = APIModeChat
+		case APIModeResponses:
+			c.APIMode = APIModeResponses
+		default:
+			return fmt.Errorf("api_mode must be %q or %q, got %q", APIModeChat, APIModeResponses, one)
+		}
+	case "readonly", "dry_shell":
+		cur := &c.Readonly
+		if key == "dry_shell" {
+			cur = &c.DryShell
+		}
+		var on bool
+		if on, err = parseBool(key, one); err != nil {
+			break
+		}
+		if src.Kind == SourceProject && *cur && !on {
+			return c.ignore(key, src, "a project config can turn it on but not off")
+		}
+		*cur = on
+	case "persistent_shell":
+		c.PersistentShell, err = parseBool(key, one)
+	case "pty":
+		c.PTY, err = parseBool(key, one)
+	case "pty_idle_timeout":
+		c.PTYIdleTimeout, err = time.ParseDuration(one)
+		if err == nil && c.PTYIdleTimeout < 0 {
+			err = errors.New("pty_idle_timeout must not be negative")
+		}
+	case "ralph":
+		c.Ralph, err = parseBool(key, one)
+	case "allow":
+		if src.Kind == SourceProject && len(c.Allow) > 0 {
+			// a project can only narrow the allow list it inherits
+			for _, v := range vals {
+				if !ruleCovered(v, c.Allow) {
+					return c.ignore(key, src, fmt.Sprintf("%q is wider than the allow list it inherits", v))
+				}
+			}
+			if len(vals) == 0 {
+				return c.ignore(key, src, "a project config cannot clear the allow list")
+			}
+		}
+		c.Allow = append([]string(nil), vals...)
+	case "deny":
+		c.Deny = appendUnique(c.Deny, vals)
+	case "disabled_tools":
+		c.DisabledTools = appendUnique(c.DisabledTools, vals)
+	case "ralph_max_tries":
+		c.RalphMaxTries, err = strconv.Atoi(one)
+		if err == nil && c.RalphMaxTries < 1 {
+			err = errors.New("ralph_max_tries must be at least 1")
+		}
+	case "patch_fuzz":
+		c.PatchFuzz, err = strconv.Atoi(one)
+		if err == nil && (c.PatchFuzz < 0 || c.PatchFuzz > 2) {
+			err = errors.New("patch_fuzz must be 0, 1 or 2")
+		}
+	case "tool_timeout":
+		c.ToolTimeout, err = time.ParseDuration(one)
+	case "llm_timeout":
+		c.LLMTimeout, err = time.ParseDuration(one)
+	case "approve":
+		switch one {
+		case types.ApproveNever, types.ApproveShell, types.ApproveWrites, types.ApproveAlways:
+		default:
+			return fmt.Errorf("approve must be one of %s, %s, %s or %s, got %q", types.ApproveAlways, types.ApproveWrites, types.ApproveShell, types.ApproveNever, one)
+		}
+		if src.Kind == SourceProject && approveRank(one) < approveRank(c.Approve) {
+			// a checked-out repository must not relax the user's approvals
+			// or sandbox
+			return c.ignore(key, src, fmt.Sprintf("a project config cannot lower it below %q", c.Approve))
+		}
+		c.Approve = one
+	case "sandbox":
+		switch one {
+		case shell.SandboxNone, shell.SandboxAuto, shell.SandboxBwrap, shell.SandboxNsjail, shell.SandboxFirejail:
+		default:
+			return fmt.Errorf("sandbox must be one of %s, %s, %s, %s or %s, got %q", shell.SandboxAuto, shell.SandboxBwrap, shell.SandboxNsjail, shell.SandboxFirejail, shell.SandboxNone, one)
+		}
+		if src.Kind == SourceProject && one == shell.SandboxNone && c.Sandbox != shell.SandboxNone {
+			return c.ignore(key, src, "a project config cannot turn the sandbox off")
+		}
+		c.Sandbox = one
+	case "sandbox_network":
+		var on bool
+		if on, err = parseBool(key, one); err != nil {
+			break
+		}
+		if src.Kind == SourceProject && on && !c.SandboxNetwork {
+			return c.ignore(key, src, "a project config cannot re-enable the network")
+		}
+		c.SandboxNetwork = on
+	case "writable_dirs":
+		if src.Kind == SourceProject {
+			return c.ignore(key, src, "a project config cannot set it")
+		}
+		c.WritableDirs = append([]string(nil), vals...)
+	case "sandbox_cpu":
+		var d time.Duration
+		if d, err = time.ParseDuration(one); err != nil {
+			break
+		}
+		if src.Kind == SourceProject && !tighterLimit(int64(d), int64(c.SandboxCPU)) {
+			return c.ignore(key, src, "a project config can only lower the limit")
+		}
+		c.SandboxCPU = d
+	case "sandbox_memory", "sandbox_procs":
+		cur := &c.SandboxMemory
+		if key == "sandbox_procs" {
+			cur = &c.SandboxProcs
+		}
+		var n int
+		if n, err = parseCount(key, one); err != nil {
+			break
+		}
+		if src.Kind == SourceProject && !tighterLimit(int64(n), int64(*cur)) {
+			return c.ignore(key, src, "a project config can only lower the limit")
+		}
+		*cur = n
+	case "roots":
+		if src.Kind == SourceProject {
+			return c.ignore(key, src, "a project config cannot set it")
+		}
+		c.Roots = append([]string(nil), vals...)
+	case "deny_read":
+		c.DenyRead = appendUnique(c.DenyRead, vals)
+	case "deny_write":
+		c.DenyWrite = appendUnique(c.DenyWrite, vals)
+	case "http_allow":
+		if src.Kind == SourceProject {
+			return c.ignore(key, src, "a project config cannot set it")
+		}
+		c.HTTPAllow = append([]string(nil), vals...)
+	case "http_deny":
+		c.HTTPDeny = appendUnique(c.HTTPDeny, vals)
+	case "http_private":
+		var on bool
+		if on, err = parseBool(key, one); err != nil {
+			break
+		}
+		if src.Kind == SourceProject && on {
+			return c.ignore(key, src, "a project config cannot enable it")
+		}
+		c.HTTPPrivate = on
+	case "http_credentials":
+		if src.Kind == SourceProject {
+			// a repository could send the user's tokens anywhere
+			return c.ignore(key, src, "a project config cannot set it")
+		}
+		c.HTTPCredentials = nil
+		for _, v := range vals {
+			cr, err := ParseHTTPCredential(v)
+			if err != nil {
+				return err
+			}
+			c.HTTPCredentials = append(c.HTTPCredentials, cr)
+		}
+	default:
+		return fmt.Errorf("unknown config key %q", key)
+	}
+	if err != nil {
+		return err
+	}
+	if prev := c.sources[key]; accumulating[key] && prev[0].Kind != SourceDefault {
+		c.sources[key] = append(prev, src)
+		return nil
+	}
+	c.sources[key] = []Source{src}
+	return nil
+}
+
+// ParseHTTPCredential parses an http_credentials entry, a host glob and a
+// header: "api.github.com Authorization: Bearer ${GITHUB_TOKEN}".
+func ParseHTTPCredential(v string) (types.HTTPCredential, error) {
+	host, header, ok := strings.Cut(strings.TrimSpace(v), " ")
+	name, value, ok2 := strings.Cut(header, ":")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !ok || !ok2 || host == "" || name == "" || value == "" || strings.ContainsAny(name, " \t") {
+		return types.HTTPCredential{}, fmt.Errorf("http_credentials entries must look like \"<host> <Header>: <value>\", got %q", v)
+	}
+	return types.HTTPCredential{Host: strings.ToLower(host), Header: name, Value: value}, nil
+}
+
+// ignore records that src, a project config, tried to relax key, and leaves
+// the value as it was.
+func (c *Config) ignore(key string, src Source, why string) error {
+	c.warnings = append(c.warnings, fmt.Sprintf("%s: ignoring %s: %s", src, key, why))
+	return nil
+}
+
+// tighterLimit reports whether the resource limit v is at least as strict as
+// cur, where zero means no limit.
+func tighterLimit(v, cur int64) bool {
+	return cur == 0 || v > 0 && v <= cur
+}
+
+// ruleCovered reports whether every command rule allows is allowed by one
+// of the rules in list.
+func ruleCovered(rule string, list []string) bool {
+	for _, l := range list {
+		if shell.RuleCovers(l, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// approveRank orders approval modes from least to most prompting.
+func approveRank(mode string) int {
+	switch mode {
+	case types.ApproveShell:
+		return 1
+	case types.ApproveWrites:
+		return 2
+	case types.ApproveAlways:
+		return 3
+	}
+	return 0
+}
+
+func parseCount(key, v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a whole number, got %q", key, v)
+	}
+	return n, nil
+}
+
+func parseBool(key, v string) (bool, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", key, v)
+	}
+	return b, nil
+}
+
+func appendUnique(dst []string, vals []string) []string {
+	for _, v := range vals {
+		dup := false
+		for _, d := range dst {
+			if d == v {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+func normalizeKey(k string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(k)), "-", "_")
+}
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestParse(t *testing.T) {
+	src := `# shared team policy
+model: gpt-5
+api_mode: "responses"   # or: chat
+readonly: true
+deny: [rm -rf, 'sudo']
+allow:
+  - go test ./...
+  # a comment between items
+  - "git status # not a comment"
+  - echo#1
+disabled-tools:
+`
+	vals, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := map[string][]string{
+		"model":          {"gpt-5"},
+		"api_mode":       {"responses"},
+		"readonly":       {"true"},
+		"deny":           {"rm -rf", "sudo"},
+		"allow":          {"go test ./...", "git status # not a comment", "echo#1"},
+		"disabled_tools": {},
+	}
+	if !reflect.DeepEqual(vals, want) {
+		t.Fatalf("unexpected values:\n got %#v\nwant %#v", vals, want)
+	}
+
+	if _, err := Parse(strings.NewReader("- orphan\n")); err == nil {
+		t.Fatalf("expected error for list item without key")
+	}
+	if _, err := Parse(strings.NewReader("just text\n")); err == nil {
+		t.Fatalf("expected error for line without colon")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	userPath := filepath.Join(dir, "user")
+	projectPath := filepath.Join(dir, "project")
+	writeFile(t, userPath, "model: user-model\nralph_max_tries: 3\ndeny: [sudo]\nallow: [ls]\n")
+	writeFile(t, projectPath, "model: project-model\nreadonly: true\ndeny: [rm -rf]\ndisabled_tools: [http_get]\n")
+
+	user, err := FileLayer(SourceUser, userPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := FileLayer(SourceProject, projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := EnvLayer(func(k string) string {
+		return map[string]string{
+			"JORIN_MODEL":     "env-model",
+			"OPENAI_BASE_URL": "http://localhost:8080/",
+			"JORIN_ALLOW":     "git status, go test",
+		}[k]
+	})
+	flags := Layer{Kind: SourceFlag, Values: map[string][]string{"deny": {"curl"}}, Details: map[string]string{"deny": "--deny"}}
+
+	c, err := Load(user, project, env, flags)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.Model != "env-model" || c.Source("model").String() != "env JORIN_MODEL" {
+		t.Fatalf("model: %q from %s", c.Model, c.Source("model"))
+	}
+	if c.BaseURL != "http://localhost:8080" {
+		t.Fatalf("base url: %q", c.BaseURL)
+	}
+	if !c.Readonly || c.Source("readonly").Kind != SourceProject {
+		t.Fatalf("readonly: %v from %s", c.Readonly, c.Source("readonly"))
+	}
+	if c.RalphMaxTries != 3 || c.Source("ralph_max_tries").Detail != userPath {
+		t.Fatalf("ralph_max_tries: %d from %s", c.RalphMaxTries, c.Source("ralph_max_tries"))
+	}
+	if !reflect.DeepEqual(c.Allow, []string{"git status", "go test"}) {
+		t.Fatalf("allow should be replaced by env, got %q", c.Allow)
+	}
+	if !reflect.DeepEqual(c.Deny, []string{"sudo", "rm -rf", "curl"}) {
+		t.Fatalf("deny should accumulate, got %q", c.Deny)
+	}
+	if n := len(c.Sources("deny")); n != 3 {
+		t.Fatalf("expected 3 deny sources, got %d", n)
+	}
+	if !reflect.DeepEqual(c.DisabledTools, []string{"http_get"}) {
+		t.Fatalf("disabled tools: %q", c.DisabledTools)
+	}
+	if c.APIMode != APIModeChat || c.Source("api_mode").Kind != SourceDefault {
+		t.Fatalf("api mode: %q from %s", c.APIMode, c.Source("api_mode"))
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	cases := map[string]string{
+		"unknown key":    "modle",
+		"bad bool":       "readonly",
+		"bad api mode":   "api_mode",
+		"bad tries":      "ralph_max_tries",
+		"bad duration":   "tool_timeout",
+		"bad approve":    "approve",
+		"bad fuzz":       "patch_fuzz",
+		"negative idle":  "pty_idle_timeout",
+		"missing scalar": "model",
+	}
+	vals := map[string][]string{
+		"modle":            {"x"},
+		"readonly":         {"yes please"},
+		"api_mode":         {"grpc"},
+		"ralph_max_tries":  {"0"},
+		"tool_timeout":     {"soon"},
+		"approve":          {"sometimes"},
+		"patch_fuzz":       {"3"},
+		"pty_idle_timeout": {"-1s"},
+		"model":            {},
+	}
+	for name, key := range cases {
+		l := Layer{Kind: SourceProject, Detail: ".jorin/config", Values: map[string][]string{key: vals[key]}}
+		if _, err := Load(l); err == nil {
+			t.Errorf("%s: expected error", name)
+		} else if !strings.Contains(err.Error(), ".jorin/config") {
+			t.Errorf("%s: error should name the source, got %v", name, err)
+		}
+	}
+}
+
+func TestDefaultsAndDurations(t *testing.T) {
+	c, err := Load(Layer{Kind: SourceEnv, Values: map[string][]string{"tool_timeout": {"90s"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Model != DefaultModel || c.RalphMaxTries != DefaultRalphMaxTries || c.ToolTimeout != 90*time.Second || c.PatchFuzz != DefaultPatchFuzz || c.PTYIdleTimeout != DefaultPTYIdleTimeout {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+	if c.Value("tool_timeout") != "1m30s" || c.Value("deny") != "[]" {
+		t.Fatalf("unexpected display values: %q %q", c.Value("tool_timeout"), c.Value("deny"))
+	}
+}
+
+func TestProjectConfigRelaxationsAreIgnored(t *testing.T) {
+	user := Layer{Kind: SourceUser, Detail: "user", Values: map[string][]string{
+		"readonly": {"true"}, "dry_shell": {"true"}, "allow": {"git", "go test"}, "approve": {"writes"},
+		"sandbox": {"bwrap"}, "sandbox_network": {"false"}, "sandbox_cpu": {"1m"}, "sandbox_memory": {"512"}, "sandbox_procs": {"64"},
+		"http_credentials": {"api.example.com Authorization: Bearer ${TOKEN}"},
+	}}
+	cases := []struct {
+		key  string
+		vals []string
+	}{
+		{"provider", []string{"ollama"}},
+		{"base_url", []string{"https://attacker.example"}},
+		{"readonly", []string{"false"}},
+		{"dry_shell", []string{"false"}},
+		{"allow", []string{"*"}},
+		{"allow", []string{}},
+		{"approve", []string{"never"}},
+		{"sandbox", []string{"none"}},
+		{"sandbox_network", []string{"true"}},
+		{"writable_dirs", []string{"/"}},
+		{"sandbox_cpu", []string{"1h"}},
+		{"sandbox_cpu", []string{"0s"}},
+		{"sandbox_memory", []string{"4096"}},
+		{"sandbox_memory", []string{"0"}},
+		{"sandbox_procs", []string{"0"}},
+		{"roots", []string{"/"}},
+		{"http_allow", []string{"*"}},
+		{"http_private", []string{"true"}},
+		{"http_credentials", []string{"example.org X-Key: k"}},
+	}
+	base, err := Load(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range cases {
+		project := Layer{Kind: SourceProject, Detail: ".jorin/config", Values: map[string][]string{tc.key: tc.vals}}
+		c, err := Load(user, project)
+		if err != nil {
+			t.Errorf("%s %q: %v", tc.key, tc.vals, err)
+			continue
+		}
+		if c.Value(tc.key) != base.Value(tc.key) || c.Source(tc.key).Kind == SourceProject {
+			t.Errorf("%s %q: project config relaxed it to %s", tc.key, tc.vals, c.Value(tc.key))
+		}
+		if w := c.Warnings(); len(w) != 1 || !strings.Contains(w[0], "ignoring "+tc.key) || !strings.Contains(w[0], ".jorin/config") {
+			t.Errorf("%s %q: warnings = %q", tc.key, tc.vals, w)
+		}
+	}
+	if _, err := Load(user, Layer{Kind: SourceProject, Values: map[string][]string{"provider": {"nope"}}}); err == nil {
+		t.Errorf("an invalid project value should still be an error")
+	}
+
+	project := Layer{Kind: SourceProject, Values: map[string][]string{
+		"allow": {"git status", "go test ./..."}, "readonly": {"true"}, "approve": {"always"},
+		"sandbox_network": {"false"}, "sandbox_cpu": {"30s"}, "sandbox_memory": {"256"}, "sandbox_procs": {"32"},
+	}}
+	c, err := Load(user, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Warnings()) != 0 {
+		t.Fatalf("tightening should not warn: %q", c.Warnings())
+	}
+	if !reflect.DeepEqual(c.Allow, []string{"git status", "go test ./..."}) || c.Source("allow").Kind != SourceProject {
+		t.Fatalf("a project config should narrow allow, got %q from %s", c.Allow, c.Source("allow"))
+	}
+	if c.Approve != "always" || c.SandboxCPU != 30*time.Second || c.SandboxMemory != 256 || c.SandboxProcs != 32 {
+		t.Fatalf("a project config should tighten the user config: %+v", c)
+	}
+	c, err = Load(project)
+	if err != nil || !c.Readonly || len(c.Allow) != 2 || c.SandboxProcs != 32 {
+		t.Fatalf("a project config should tighten the defaults: %+v %v", c, err)
+	}
+	flags := Layer{Kind: SourceFlag, Values: map[string][]string{"readonly": {"false"}, "allow": {"*"}, "approve": {"shell"}}}
+	if c, err = Load(user, project, flags); err != nil || c.Readonly || c.Allow[0] != "*" || c.Approve != "shell" {
+		t.Fatalf("flags should override the project config: %+v %v", c, err)
+	}
+	env := Layer{Kind: SourceEnv, Values: map[string][]string{"writable_dirs": {"/cache"}, "sandbox_procs": {"0"}}}
+	if c, err = Load(user, env); err != nil || c.WritableDirs[0] != "/cache" || c.SandboxProcs != 0 {
+		t.Fatalf("unexpected sandbox settings: %+v %v", c, err)
+	}
+}
+
+func TestWorkspaceSettings(t *testing.T) {
+	project := Layer{Kind: SourceProject, Values: map[string][]string{"deny_read": {"secrets/**"}, "deny_write": {"go.sum"}}}
+	c, err := Load(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Value("deny_read") != "[.env*, *.pem, secrets/**]" || c.Value("deny_write") != "[.git/**, go.sum]" {
+		t.Fatalf("protected globs should extend the defaults: %s / %s", c.Value("deny_read"), c.Value("deny_write"))
+	}
+	user := Layer{Kind: SourceUser, Values: map[string][]string{"roots": {".", "../shared"}}}
+	if c, err = Load(user); err != nil || len(c.Roots) != 2 {
+		t.Fatalf("unexpected roots: %+v %v", c.Roots, err)
+	}
+}
+
+func TestHTTPSettings(t *testing.T) {
+	user := Layer{Kind: SourceUser, Values: map[string][]string{
+		"http_deny":        {"*.internal"},
+		"http_credentials": {"API.example.com Authorization: Bearer ${TOKEN}"},
+	}}
+	project := Layer{Kind: SourceProject, Values: map[string][]string{"http_deny": {"example.org"}, "http_private": {"false"}}}
+	c, err := Load(user, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Value("http_deny") != "[*.internal, example.org]" || c.HTTPPrivate {
+		t.Fatalf("unexpected http settings: %s private=%v", c.Value("http_deny"), c.HTTPPrivate)
+	}
+	want := types.HTTPCredential{Host: "api.example.com", Header: "Authorization", Value: "Bearer ${TOKEN}"}
+	if len(c.HTTPCredentials) != 1 || c.HTTPCredentials[0] != want {
+		t.Fatalf("credentials = %+v", c.HTTPCredentials)
+	}
+	if v := c.Value("http_credentials"); v != "[api.example.com Authorization: ***]" {
+		t.Fatalf("credentials should be masked, got %s", v)
+	}
+
+	for _, bad := range []string{"api.example.com", "api.example.com Authorization", "api.example.com Bad Header: x", "api.example.com X-Key:"} {
+		if _, err := ParseHTTPCredential(bad); err == nil {
+			t.Errorf("ParseHTTPCredential(%q) should fail", bad)
+		}
+	}
+}
+
+func TestFindProjectPath(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".jorin", "config"), "model: x\n")
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindProjectPath(sub); got != filepath.Join(root, ".jorin", "config") {
+		t.Fatalf("expected project config from parent, got %q", got)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
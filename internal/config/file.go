@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/dave1010/jorin/internal/miniyaml"
+)
+
+// envVars maps environment variables to config keys. List values are
+// comma-separated.
+var envVars = []struct{ name, key string }{
+	{"JORIN_MODEL", "model"},
+	{"JORIN_PROVIDER", "provider"},
+	{"OPENAI_BASE_URL", "base_url"},
+	{"JORIN_API_MODE", "api_mode"},
+	{"JORIN_READONLY", "readonly"},
+	{"JORIN_DRY_SHELL", "dry_shell"},
+	{"JORIN_PERSISTENT_SHELL", "persistent_shell"},
+	{"JORIN_PTY", "pty"},
+	{"JORIN_PTY_IDLE_TIMEOUT", "pty_idle_timeout"},
+	{"JORIN_ALLOW", "allow"},
+	{"JORIN_DENY", "deny"},
+	{"JORIN_DISABLED_TOOLS", "disabled_tools"},
+	{"JORIN_RALPH", "ralph"},
+	{"JORIN_RALPH_MAX_TRIES", "ralph_max_tries"},
+	{"JORIN_TOOL_TIMEOUT", "tool_timeout"},
+	{"JORIN_LLM_TIMEOUT", "llm_timeout"},
+	{"JORIN_APPROVE", "approve"},
+	{"JORIN_SANDBOX", "sandbox"},
+	{"JORIN_SANDBOX_NETWORK", "sandbox_network"},
+	{"JORIN_WRITABLE_DIRS", "writable_dirs"},
+	{"JORIN_SANDBOX_CPU", "sandbox_cpu"},
+	{"JORIN_SANDBOX_MEMORY", "sandbox_memory"},
+	{"JORIN_SANDBOX_PROCS", "sandbox_procs"},
+	{"JORIN_ROOTS", "roots"},
+	{"JORIN_DENY_READ", "deny_read"},
+	{"JORIN_DENY_WRITE", "deny_write"},
+	{"JORIN_PATCH_FUZZ", "patch_fuzz"},
+	{"JORIN_HTTP_ALLOW", "http_allow"},
+	{"JORIN_HTTP_DENY", "http_deny"},
+	{"JORIN_HTTP_PRIVATE", "http_private"},
+}
+
+// UserPath returns $XDG_CONFIG_HOME/jorin/config, falling back to
+// ~/.config/jorin/config.
+func UserPath() (string, error) {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "jorin", "config"), nil
+}
+
+// FindProjectPath looks for .jorin/config in dir and its parents and returns
+// the nearest one, or "" if there is none.
+func FindProjectPath(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		p := filepath.Join(dir, ".jorin", "config")
+		if st, err := os.Stat(p); err == nil && !st.IsDir() {
+			return p
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// FileLayer reads a config file. A missing file yields an empty layer.
+func FileLayer(kind SourceKind, path string) (Layer, error) {
+	l := Layer{Kind: kind, Detail: path, Values: map[string][]string{}}
+	if path == "" {
+		return l, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return l, nil
+		}
+		return l, err
+	}
+	defer func() { _ = f.Close() }()
+	vals, err := Parse(f)
+	if err != nil {
+		return l, fmt.Errorf("%s: %w", path, err)
+	}
+	l.Values = vals
+	return l, nil
+}
+
+// EnvLayer collects settings from environment variables using getenv.
+func EnvLayer(getenv func(string) string) Layer {
+	l := Layer{Kind: SourceEnv, Values: map[string][]string{}, Details: map[string]string{}}
+	for _, e := range envVars {
+		v := getenv(e.name)
+		if v == "" {
+			continue
+		}
+		if isList(e.key) {
+			l.Values[e.key] = miniyaml.SplitList(v)
+		} else {
+			l.Values[e.key] = []string{v}
+		}
+		l.Details[e.key] = e.name
+	}
+	return l
+}
+
+func isList(key string) bool {
+	switch key {
+	case "allow", "deny", "disabled_tools", "writable_dirs", "roots", "deny_read", "deny_write", "http_allow", "http_deny", "http_credentials":
+		return true
+	}
+	return false
+}
+
+// Parse reads the config file format (see miniyaml): one `key: value` pair
+// per line, with lists written inline as `key: [a, b]` or as indented
+// `- item` lines below `key:`.
+func Parse(r io.Reader) (map[string][]string, error) {
+	lines, err := miniyaml.Lines(r)
+	if err != nil {
+		return nil, err
+	}
+	vals := map[string][]string{}
+	var listKey string
+	for _, l := range lines {
+		if item, ok := miniyaml.Item(l.Text); ok {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", l.N)
+			}
+			vals[listKey] = append(vals[listKey], miniyaml.Unquote(item))
+			continue
+		}
+		key, value, ok := miniyaml.KeyValue(l.Text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value, got %q", l.N, l.Text)
+		}
+		key = normalizeKey(key)
+		listKey = ""
+		v, block := miniyaml.Value(value)
+		if block {
+			// a block list follows, or the key is explicitly empty
+			listKey = key
+		}
+		vals[key] = v
+	}
+	return vals, nil
+}
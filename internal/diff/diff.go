@@ -0,0 +1,208 @@
+// Package diff compares texts line by line, for showing users what a change
+// does.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContext = 3
+	// maxDiffCells bounds the line-matching table; larger files are shown as
+	// a full replacement.
+	maxDiffCells = 4_000_000
+)
+
+// Lines returns the changed lines between old and new text in a
+// unified-diff style: "-" and "+" lines with up to three lines of context,
+// and "@@" lines separating distant changes.
+func Lines(old, new string) []string {
+	ops := diffOps(splitLines(old), splitLines(new))
+	show := visible(ops)
+	var out []string
+	oldLine, newLine := 0, 0
+	for i, op := range ops {
+		if show[i] {
+			if i > 0 && !show[i-1] {
+				line := newLine
+				if op.kind == '-' {
+					line = oldLine
+				}
+				out = append(out, fmt.Sprintf("@@ line %d @@", line+1))
+			}
+			out = append(out, string(op.kind)+op.text)
+		}
+		oldLine, newLine = advance(op, oldLine, newLine)
+	}
+	return out
+}
+
+// Unified returns the unified diff of old and new text, as diff -u and git
+// diff print it, under "---" and "+++" headers naming oldName and newName.
+// A final line without a newline is marked "\ No newline at end of file".
+// Equal texts give "".
+func Unified(oldName, newName, old, new string) string {
+	ops := diffOps(splitAfter(old), splitAfter(new))
+	show := visible(ops)
+	var b strings.Builder
+	oldLine, newLine := 0, 0
+	for i := 0; i < len(ops); {
+		if !show[i] {
+			oldLine, newLine = advance(ops[i], oldLine, newLine)
+			i++
+			continue
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		end := i
+		oldLen, newLen := 0, 0
+		for ; end < len(ops) && show[end]; end++ {
+			o, n := advance(ops[end], 0, 0)
+			oldLen, newLen = oldLen+o, newLen+n
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldLine, oldLen), hunkRange(newLine, newLen))
+		for ; i < end; i++ {
+			text := ops[i].text
+			b.WriteByte(ops[i].kind)
+			b.WriteString(text)
+			if !strings.HasSuffix(text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+			oldLine, newLine = advance(ops[i], oldLine, newLine)
+		}
+	}
+	return b.String()
+}
+
+// hunkRange formats one side of a hunk header: the first line and the
+// count, which is left out when it is one. An empty range names the line
+// before it.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// advance moves the old and new line numbers past op.
+func advance(op diffOp, oldLine, newLine int) (int, int) {
+	switch op.kind {
+	case '-':
+		return oldLine + 1, newLine
+	case '+':
+		return oldLine, newLine + 1
+	}
+	return oldLine + 1, newLine + 1
+}
+
+// visible marks the ops to show: the changes and the context around them.
+func visible(ops []diffOp) []bool {
+	show := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for j := i - diffContext; j <= i+diffContext; j++ {
+			if j >= 0 && j < len(ops) {
+				show[j] = true
+			}
+		}
+	}
+	return show
+}
+
+// diffOps aligns a and b using their longest common subsequence.
+func diffOps(a, b []string) []diffOp {
+	// trim the common prefix and suffix to keep the table small
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var ops []diffOp
+	for i := 0; i < pre; i++ {
+		ops = append(ops, diffOp{' ', a[i]})
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, l := range ma {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range mb {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		ops = append(ops, lcsOps(ma, mb)...)
+	}
+	for i := len(b) - suf; i < len(b); i++ {
+		ops = append(ops, diffOp{' ', b[i]})
+	}
+	return ops
+}
+
+func lcsOps(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', b[j]})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// splitAfter splits s into lines that keep their newline, so a last line
+// without one differs from the same line with one.
+func splitAfter(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,165 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dave1010/jorin/internal/version"
+)
+
+// ProtocolVersion is the MCP revision this client asks for.
+const ProtocolVersion = "2025-06-18"
+
+// Tool is a tool advertised by a server through tools/list.
+type Tool struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+	Annotations *ToolAnnotation `json:"annotations,omitempty"`
+}
+
+// ToolAnnotation carries the server's hints about a tool's behaviour.
+type ToolAnnotation struct {
+	ReadOnlyHint    bool `json:"readOnlyHint,omitempty"`
+	DestructiveHint bool `json:"destructiveHint,omitempty"`
+}
+
+// ReadOnly reports whether the server marked the tool as free of side effects.
+func (t Tool) ReadOnly() bool { return t.Annotations != nil && t.Annotations.ReadOnlyHint }
+
+// Content is one item of a tool result.
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Resource is set for embedded resources.
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+// CallResult is the result of tools/call.
+type CallResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// Text flattens the result into text for the model. Text items are joined
+// with newlines; other content is summarised by type.
+func (r *CallResult) Text() string {
+	var parts []string
+	for _, c := range r.Content {
+		switch {
+		case c.Type == "text":
+			parts = append(parts, c.Text)
+		case c.Type == "resource" && c.Resource != nil && c.Resource.Text != "":
+			parts = append(parts, c.Resource.Text)
+		case c.MimeType != "":
+			parts = append(parts, fmt.Sprintf("[%s content: %s]", c.Type, c.MimeType))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content]", c.Type))
+		}
+	}
+	if len(parts) == 0 && len(r.StructuredContent) > 0 {
+		return string(r.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Client is an initialized connection to one MCP server.
+type Client struct {
+	Config     ServerConfig
+	ServerName string
+	// Instructions are optional usage notes returned by the server.
+	Instructions string
+	t            transport
+}
+
+// Connect starts or dials the server described by cfg and performs the
+// initialize handshake.
+func Connect(ctx context.Context, cfg ServerConfig) (*Client, error) {
+	var t transport
+	var ht *httpTransport
+	if cfg.Transport() == "http" {
+		ht = newHTTPTransport(cfg)
+		t = ht
+	} else {
+		st, err := startStdio(cfg)
+		if err != nil {
+			return nil, err
+		}
+		t = st
+	}
+	c := &Client{Config: cfg, t: t}
+	var res struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+		Instructions string `json:"instructions"`
+	}
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "jorin", "version": version.Version},
+	}
+	if err := t.call(ctx, "initialize", params, &res); err != nil {
+		_ = t.close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	if ht != nil {
+		ht.setProtocolVersion(res.ProtocolVersion)
+	}
+	c.ServerName = res.ServerInfo.Name
+	c.Instructions = res.Instructions
+	if err := t.notify(ctx, "notifications/initialized", nil); err != nil {
+		_ = t.close()
+		return nil, fmt.Errorf("initialized: %w", err)
+	}
+	return c, nil
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var all []Tool
+	cursor := ""
+	for {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		var res struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.t.call(ctx, "tools/list", params, &res); err != nil {
+			return nil, err
+		}
+		all = append(all, res.Tools...)
+		if res.NextCursor == "" || res.NextCursor == cursor {
+			return all, nil
+		}
+		cursor = res.NextCursor
+	}
+}
+
+// CallTool invokes a tool by its server-side name.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallResult, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	var res CallResult
+	if err := c.t.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Close shuts the connection down, stopping stdio servers.
+func (c *Client) Close() error { return c.t.close() }
@@ -0,0 +1,147 @@
+// Package mcp implements a Model Context Protocol client so tools exposed by
+// MCP servers can be offered to the model next to the built-in tools.
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dave1010/jorin/internal/config"
+)
+
+// ServerConfig describes one MCP server. Exactly one of Command (a stdio
+// server started as a child process) or URL (a streamable HTTP server) must
+// be set. The format matches the widely used mcp.json layout.
+type ServerConfig struct {
+	Name     string            `json:"-"`
+	Type     string            `json:"type,omitempty"`
+	Command  string            `json:"command,omitempty"`
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	URL      string            `json:"url,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Disabled bool              `json:"disabled,omitempty"`
+	// Source is the file the server was loaded from.
+	Source string `json:"-"`
+}
+
+// Transport reports "stdio" or "http".
+func (c ServerConfig) Transport() string {
+	if c.URL != "" {
+		return "http"
+	}
+	return "stdio"
+}
+
+type configFile struct {
+	Servers map[string]ServerConfig `json:"mcpServers"`
+}
+
+// ConfigPaths returns the files servers are loaded from, lowest precedence
+// first: mcp.json next to the user config file, then the nearest
+// .jorin/mcp.json in dir or its parents.
+func ConfigPaths(dir string) []string {
+	var paths []string
+	if p, err := config.UserPath(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(p), "mcp.json"))
+	}
+	if dir == "" {
+		return paths
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return paths
+	}
+	for {
+		p := filepath.Join(dir, ".jorin", "mcp.json")
+		if st, err := os.Stat(p); err == nil && !st.IsDir() {
+			return append(paths, p)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return paths
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads servers from paths. A server defined in a later file
+// replaces one with the same name from an earlier file. Missing files are
+// skipped; disabled servers are dropped. ${VAR} references in commands,
+// arguments, env values, URLs and headers are expanded from the environment.
+func LoadConfig(paths ...string) ([]ServerConfig, error) {
+	byName := map[string]ServerConfig{}
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		var f configFile
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		for name, sc := range f.Servers {
+			sc.Name = name
+			sc.Source = p
+			if err := sc.validate(); err != nil {
+				return nil, fmt.Errorf("%s: server %q: %w", p, name, err)
+			}
+			byName[name] = sc.expand()
+		}
+	}
+	out := make([]ServerConfig, 0, len(byName))
+	for _, sc := range byName {
+		if !sc.Disabled {
+			out = append(out, sc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (c ServerConfig) validate() error {
+	switch {
+	case c.Command != "" && c.URL != "":
+		return errors.New("set either command or url, not both")
+	case c.Command == "" && c.URL == "":
+		return errors.New("missing command or url")
+	}
+	switch c.Type {
+	case "", "stdio", "http", "streamable-http", "streamableHttp":
+	default:
+		return fmt.Errorf("unsupported type %q", c.Type)
+	}
+	return nil
+}
+
+func (c ServerConfig) expand() ServerConfig {
+	c.Command = os.ExpandEnv(c.Command)
+	c.URL = os.ExpandEnv(c.URL)
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = os.ExpandEnv(a)
+	}
+	c.Args = args
+	c.Env = expandMap(c.Env)
+	c.Headers = expandMap(c.Headers)
+	return c
+}
+
+func expandMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = os.ExpandEnv(v)
+	}
+	return out
+}
@@ -0,0 +1,174 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/dave1010/jorin/internal/sse"
+)
+
+// httpTransport talks to a server using the streamable HTTP transport: each
+// message is POSTed to one endpoint, and responses come back either as a
+// JSON body or as a server-sent event stream.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	nextID    int64
+	sessionID string
+	protocol  string
+}
+
+func newHTTPTransport(cfg ServerConfig) *httpTransport {
+	return &httpTransport{url: cfg.URL, headers: cfg.Headers, client: http.DefaultClient}
+}
+
+// setProtocolVersion records the negotiated version, which must be sent
+// with every later request.
+func (t *httpTransport) setProtocolVersion(v string) {
+	t.mu.Lock()
+	t.protocol = v
+	t.mu.Unlock()
+}
+
+func (t *httpTransport) post(ctx context.Context, m message) (*http.Response, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocol != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocol)
+	}
+	t.mu.Unlock()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params any, out any) error {
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.mu.Unlock()
+	req, err := newRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mt != "text/event-stream" {
+		var m message
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		return decodeResult(&m, out)
+	}
+
+	errFound := errors.New("found")
+	var result *message
+	err = sse.Read(resp.Body, func(_ string, data string) error {
+		var m message
+		if json.Unmarshal([]byte(data), &m) != nil {
+			return nil
+		}
+		switch {
+		case m.isResponse() && string(m.ID) == string(req.ID):
+			result = &m
+			return errFound
+		case len(m.ID) > 0 && m.Method != "":
+			t.reply(ctx, replyTo(&m))
+		}
+		return nil
+	})
+	if result != nil {
+		return decodeResult(result, out)
+	}
+	if err == nil {
+		err = errors.New("event stream ended without a response")
+	}
+	return err
+}
+
+// reply sends the client's answer to a request the server made mid-stream.
+func (t *httpTransport) reply(ctx context.Context, m message) {
+	resp, err := t.post(ctx, m)
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+}
+
+func (t *httpTransport) notify(ctx context.Context, method string, params any) error {
+	m, err := newRequest(0, method, params)
+	if err != nil {
+		return err
+	}
+	resp, err := t.post(ctx, m)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// close ends the server-side session when one was issued.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	id := t.sessionID
+	t.mu.Unlock()
+	if id == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeGrace)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", id)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC error codes used by this client.
+const (
+	codeMethodNotFound = -32601
+)
+
+// message is a JSON-RPC 2.0 request, notification or response. Requests
+// have a Method and an ID, notifications only a Method, responses only an
+// ID with a Result or Error.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func (m *message) isResponse() bool { return m.Method == "" && len(m.ID) > 0 }
+
+// RPCError is an error returned by an MCP server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// transport carries JSON-RPC messages to one server.
+type transport interface {
+	// call sends a request and decodes the result into out (if non-nil).
+	call(ctx context.Context, method string, params any, out any) error
+	// notify sends a notification, which has no response.
+	notify(ctx context.Context, method string, params any) error
+	close() error
+}
+
+func newRequest(id int64, method string, params any) (message, error) {
+	m := message{JSONRPC: jsonrpcVersion, Method: method}
+	if id != 0 {
+		m.ID = json.RawMessage(fmt.Sprint(id))
+	}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return m, err
+		}
+		m.Params = b
+	}
+	return m, nil
+}
+
+// decodeResult turns a response into out or its error.
+func decodeResult(m *message, out any) error {
+	if m.Error != nil {
+		return m.Error
+	}
+	if out == nil || len(m.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(m.Result, out)
+}
+
+// replyTo answers a request the server sent to the client. Only ping is
+// supported; anything else is reported as an unknown method.
+func replyTo(req *message) message {
+	resp := message{JSONRPC: jsonrpcVersion, ID: req.ID}
+	if req.Method == "ping" {
+		resp.Result = json.RawMessage(`{}`)
+	} else {
+		resp.Error = &RPCError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	return resp
+}
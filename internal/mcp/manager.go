@@ -0,0 +1,228 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+const (
+	// ConnectTimeout bounds starting a server and listing its tools.
+	ConnectTimeout = 20 * time.Second
+	// maxResultBytes bounds the text of a tool result passed to the model.
+	maxResultBytes = 100_000
+	// maxToolName is the longest function name the model APIs accept.
+	maxToolName = 64
+)
+
+// ServerStatus describes a configured server for display.
+type ServerStatus struct {
+	Name      string
+	Transport string
+	Target    string
+	Err       error
+	Tools     []ToolStatus
+}
+
+// ToolStatus describes one tool as exposed to the model.
+type ToolStatus struct {
+	Name        string // namespaced name seen by the model
+	Remote      string // name on the server
+	Description string
+	ReadOnly    bool
+}
+
+type server struct {
+	cfg    ServerConfig
+	client *Client
+	defs   []Tool
+	tools  []ToolStatus
+	err    error
+}
+
+// Manager owns the connections to all configured servers and the tools
+// registered for them.
+type Manager struct {
+	mu         sync.Mutex
+	servers    []*server
+	registered []string
+}
+
+// Start connects to every server in parallel. A server that fails to start
+// is recorded with its error rather than failing the whole run.
+func Start(ctx context.Context, cfgs []ServerConfig) *Manager {
+	m := &Manager{servers: make([]*server, len(cfgs))}
+	var wg sync.WaitGroup
+	for i, cfg := range cfgs {
+		i, cfg := i, cfg
+		m.servers[i] = &server{cfg: cfg}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.servers[i].connect(ctx)
+		}()
+	}
+	wg.Wait()
+	return m
+}
+
+func (s *server) connect(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, ConnectTimeout)
+	defer cancel()
+	c, err := Connect(ctx, s.cfg)
+	if err != nil {
+		s.err = err
+		return
+	}
+	list, err := c.ListTools(ctx)
+	if err != nil {
+		_ = c.Close()
+		s.err = fmt.Errorf("tools/list: %w", err)
+		return
+	}
+	s.client = c
+	for _, t := range list {
+		s.tools = append(s.tools, ToolStatus{
+			Name:        ToolName(s.cfg.Name, t.Name),
+			Remote:      t.Name,
+			Description: t.Description,
+			ReadOnly:    t.ReadOnly(),
+		})
+	}
+	s.defs = list
+}
+
+// Errors returns a message for every server that could not be started.
+func (m *Manager) Errors() []error {
+	var errs []error
+	for _, s := range m.servers {
+		if s.err != nil {
+			errs = append(errs, fmt.Errorf("mcp server %s: %w", s.cfg.Name, s.err))
+		}
+	}
+	return errs
+}
+
+// Register adds the tools of every connected server to the tool registry
+// under namespaced names.
+func (m *Manager) Register() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := map[string]bool{}
+	for _, s := range m.servers {
+		if s.client == nil {
+			continue
+		}
+		for i, def := range s.defs {
+			name := s.tools[i].Name
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			tools.Register(types.Tool{Type: "function", Function: types.ToolFunction{
+				Name:        name,
+				Description: fmt.Sprintf("[mcp:%s] %s", s.cfg.Name, def.Description),
+				Parameters:  inputSchema(def.InputSchema),
+			}}, s.exec(def))
+			m.registered = append(m.registered, name)
+		}
+	}
+}
+
+// Status reports every configured server and its tools.
+func (m *Manager) Status() []ServerStatus {
+	out := make([]ServerStatus, 0, len(m.servers))
+	for _, s := range m.servers {
+		target := s.cfg.URL
+		if target == "" {
+			target = strings.TrimSpace(s.cfg.Command + " " + strings.Join(s.cfg.Args, " "))
+		}
+		out = append(out, ServerStatus{
+			Name:      s.cfg.Name,
+			Transport: s.cfg.Transport(),
+			Target:    target,
+			Err:       s.err,
+			Tools:     append([]ToolStatus(nil), s.tools...),
+		})
+	}
+	return out
+}
+
+// Close unregisters the tools and disconnects from every server.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	for _, name := range m.registered {
+		tools.Unregister(name)
+	}
+	m.registered = nil
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, s := range m.servers {
+		if s.client == nil {
+			continue
+		}
+		c := s.client
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *server) exec(def Tool) tools.ToolExec {
+	return func(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+		if p != nil && p.Readonly && !def.ReadOnly() {
+			return map[string]any{"error": "readonly session: tool is not marked read-only by its server"}, nil
+		}
+		res, err := s.client.CallTool(ctx, def.Name, args)
+		if err != nil {
+			if ctx.Err() != nil {
+				return map[string]any{"error": tools.CancelReason(ctx.Err())}, nil
+			}
+			return map[string]any{"error": err.Error()}, nil
+		}
+		text := res.Text()
+		out := map[string]any{}
+		if len(text) > maxResultBytes {
+			text = text[:maxResultBytes]
+			out["truncated"] = true
+		}
+		if res.IsError {
+			out["error"] = text
+		} else {
+			out["text"] = text
+		}
+		return out, nil
+	}
+}
+
+// inputSchema returns the tool's schema, or an empty object schema when the
+// server did not send one.
+func inputSchema(s json.RawMessage) json.RawMessage {
+	if len(s) == 0 || string(s) == "null" {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return s
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ToolName returns the name a server's tool is exposed under:
+// mcp__<server>__<tool>, limited to the characters and length the model APIs
+// accept.
+func ToolName(server, tool string) string {
+	name := "mcp__" + unsafeNameChars.ReplaceAllString(server, "_") + "__" + unsafeNameChars.ReplaceAllString(tool, "_")
+	if len(name) > maxToolName {
+		name = name[:maxToolName]
+	}
+	return name
+}
@@ -0,0 +1,241 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// The test binary doubles as a stdio MCP server when this variable is set.
+const fakeServerEnv = "JORIN_TEST_MCP_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		runFakeServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+var fakeTools = []map[string]any{
+	{"name": "echo", "description": "Echo text", "inputSchema": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}}, "annotations": map[string]any{"readOnlyHint": true}},
+	{"name": "fail", "description": "Always fails"},
+}
+
+// handleFake answers one request the way a small MCP server would. Page
+// size is one tool so pagination is exercised.
+func handleFake(method string, params json.RawMessage) (any, *RPCError) {
+	switch method {
+	case "initialize":
+		return map[string]any{"protocolVersion": ProtocolVersion, "capabilities": map[string]any{"tools": map[string]any{}}, "serverInfo": map[string]any{"name": "fake", "version": "1"}}, nil
+	case "tools/list":
+		var p struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(params, &p)
+		if p.Cursor == "" {
+			return map[string]any{"tools": fakeTools[:1], "nextCursor": "2"}, nil
+		}
+		return map[string]any{"tools": fakeTools[1:]}, nil
+	case "tools/call":
+		var p struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		_ = json.Unmarshal(params, &p)
+		if p.Name == "echo" {
+			return map[string]any{"content": []map[string]any{{"type": "text", "text": fmt.Sprint(p.Arguments["text"])}, {"type": "image", "mimeType": "image/png", "data": "AA=="}}}, nil
+		}
+		return map[string]any{"content": []map[string]any{{"type": "text", "text": "boom"}}, "isError": true}, nil
+	}
+	return nil, &RPCError{Code: codeMethodNotFound, Message: method}
+}
+
+func runFakeServer() {
+	fmt.Fprintln(os.Stderr, "fake server starting")
+	// a stray log line on stdout must not break the client
+	fmt.Println("not json")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var m message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil || len(m.ID) == 0 {
+			continue
+		}
+		if m.Method == "tools/call" {
+			// ask the client for a ping first, as servers may do mid-request
+			fmt.Println(`{"jsonrpc":"2.0","id":"srv-1","method":"ping"}`)
+		}
+		res, rpcErr := handleFake(m.Method, m.Params)
+		resp := message{JSONRPC: jsonrpcVersion, ID: m.ID, Error: rpcErr}
+		if res != nil {
+			resp.Result, _ = json.Marshal(res)
+		}
+		b, _ := json.Marshal(resp)
+		fmt.Println(string(b))
+	}
+}
+
+func fakeStdioConfig(t *testing.T) ServerConfig {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ServerConfig{Name: "fake", Command: exe, Args: []string{"-test.run=^$"}, Env: map[string]string{fakeServerEnv: "1"}}
+}
+
+func TestStdioServerToolsAreRegistered(t *testing.T) {
+	m := Start(context.Background(), []ServerConfig{fakeStdioConfig(t), {Name: "broken", Command: filepath.Join(t.TempDir(), "missing")}})
+	defer m.Close()
+	if errs := m.Errors(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken") {
+		t.Fatalf("expected one error for the broken server, got %v", errs)
+	}
+	m.Register()
+
+	var found []string
+	for _, tl := range tools.ToolsManifest() {
+		if strings.HasPrefix(tl.Function.Name, "mcp__fake__") {
+			found = append(found, tl.Function.Name)
+			if !strings.HasPrefix(tl.Function.Description, "[mcp:fake] ") || len(tl.Function.Parameters) == 0 {
+				t.Fatalf("unexpected tool definition: %+v", tl)
+			}
+		}
+	}
+	if strings.Join(found, ",") != "mcp__fake__echo,mcp__fake__fail" {
+		t.Fatalf("expected both pages of tools, got %v", found)
+	}
+
+	reg := tools.Registry()
+	out, err := reg["mcp__fake__echo"](context.Background(), map[string]any{"text": "hi"}, &types.Policy{Readonly: true})
+	if err != nil || out["text"] != "hi\n[image content: image/png]" {
+		t.Fatalf("unexpected echo result: %#v %v", out, err)
+	}
+	out, _ = reg["mcp__fake__fail"](context.Background(), nil, &types.Policy{})
+	if out["error"] != "boom" {
+		t.Fatalf("isError results should be reported as errors, got %#v", out)
+	}
+	out, _ = reg["mcp__fake__fail"](context.Background(), nil, &types.Policy{Readonly: true})
+	if e, _ := out["error"].(string); !strings.HasPrefix(e, "readonly session") {
+		t.Fatalf("tools without readOnlyHint must be refused in readonly sessions, got %#v", out)
+	}
+
+	status := m.Status()
+	if len(status) != 2 || len(status[0].Tools) != 2 || !status[0].Tools[0].ReadOnly || status[1].Err == nil {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	m.Close()
+	if _, ok := tools.Registry()["mcp__fake__echo"]; ok {
+		t.Fatalf("tools should be unregistered on close")
+	}
+}
+
+func TestHTTPServer(t *testing.T) {
+	var gotSession, gotVersion string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		var m message
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		if len(m.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if m.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "sess-1")
+		} else {
+			gotSession = r.Header.Get("Mcp-Session-Id")
+			gotVersion = r.Header.Get("MCP-Protocol-Version")
+		}
+		res, rpcErr := handleFake(m.Method, m.Params)
+		resp := message{JSONRPC: jsonrpcVersion, ID: m.ID, Error: rpcErr}
+		resp.Result, _ = json.Marshal(res)
+		b, _ := json.Marshal(resp)
+		if m.Method == "tools/call" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", b)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(h))
+	defer srv.Close()
+
+	c, err := Connect(context.Background(), ServerConfig{Name: "web", URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer tok"}})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	list, err := c.ListTools(context.Background())
+	if err != nil || len(list) != 2 {
+		t.Fatalf("unexpected tools: %+v %v", list, err)
+	}
+	res, err := c.CallTool(context.Background(), "echo", map[string]any{"text": "over sse"})
+	if err != nil || !strings.HasPrefix(res.Text(), "over sse") {
+		t.Fatalf("unexpected call result: %+v %v", res, err)
+	}
+	if gotSession != "sess-1" || gotVersion != ProtocolVersion {
+		t.Fatalf("session headers not sent: %q %q", gotSession, gotVersion)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "user.json")
+	project := filepath.Join(dir, "project.json")
+	t.Setenv("MCP_TEST_TOKEN", "secret")
+	write := func(p, s string) {
+		if err := os.WriteFile(p, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(user, `{"mcpServers":{
+		"fs":{"command":"user-fs"},
+		"web":{"url":"https://example.com/mcp","headers":{"Authorization":"Bearer ${MCP_TEST_TOKEN}"}},
+		"old":{"command":"x"}}}`)
+	write(project, `{"mcpServers":{"fs":{"command":"npx","args":["fs-server","${MCP_TEST_TOKEN}"]},"old":{"command":"x","disabled":true}}}`)
+
+	servers, err := LoadConfig(user, project, filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(servers) != 2 || servers[0].Name != "fs" || servers[1].Name != "web" {
+		t.Fatalf("unexpected servers: %+v", servers)
+	}
+	if servers[0].Command != "npx" || servers[0].Args[1] != "secret" || servers[0].Source != project {
+		t.Fatalf("project config should replace the user entry: %+v", servers[0])
+	}
+	if servers[1].Transport() != "http" || servers[1].Headers["Authorization"] != "Bearer secret" {
+		t.Fatalf("unexpected http server: %+v", servers[1])
+	}
+
+	write(project, `{"mcpServers":{"bad":{"command":"a","url":"http://b"}}}`)
+	if _, err := LoadConfig(project); err == nil {
+		t.Fatalf("expected error for server with both command and url")
+	}
+}
+
+func TestToolName(t *testing.T) {
+	if got := ToolName("my.server", "read file"); got != "mcp__my_server__read_file" {
+		t.Fatalf("unexpected name %q", got)
+	}
+	if got := ToolName(strings.Repeat("s", 40), strings.Repeat("t", 40)); len(got) != maxToolName {
+		t.Fatalf("expected name truncated to %d, got %d", maxToolName, len(got))
+	}
+}
@@ -0,0 +1,268 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// JSON-RPC error codes returned by Server.
+const (
+	codeParseError    = -32700
+	codeInvalidParams = -32602
+	codeInternalError = -32603
+)
+
+// supportedVersions are the protocol revisions Server can speak. A client
+// asking for one of them gets it back; any other request is answered with
+// ProtocolVersion.
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// ServerTool is a tool offered by Server.
+type ServerTool struct {
+	Tool types.Tool
+	// Exec runs a call. It is expected to check the policy and apply the
+	// tool timeout itself, as the executors from tools.Registry do.
+	Exec tools.ToolExec
+	// ReadOnly and Destructive become the tool's MCP annotations.
+	ReadOnly    bool
+	Destructive bool
+}
+
+// Server serves tools to an MCP client over newline-delimited JSON-RPC,
+// the stdio transport. Every call runs with Policy, so clients get the same
+// guarantees as the model does in an interactive session.
+type Server struct {
+	Name         string
+	Version      string
+	Instructions string
+	Tools        []ServerTool
+	Policy       *types.Policy
+
+	writeMu  sync.Mutex
+	w        io.Writer
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+}
+
+// Serve reads requests from r and writes responses to w until r is closed
+// or ctx is cancelled. Tool calls run concurrently and can be cancelled by
+// the client with notifications/cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	s.inflight = map[string]context.CancelFunc{}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxStdioLineBytes)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			// stdin closed: let running calls finish and answer them
+			return err
+		case line = <-lines:
+		}
+		if len(line) == 0 {
+			continue
+		}
+		var m message
+		if err := json.Unmarshal(line, &m); err != nil {
+			s.send(message{JSONRPC: jsonrpcVersion, ID: json.RawMessage("null"), Error: &RPCError{Code: codeParseError, Message: err.Error()}})
+			continue
+		}
+		switch {
+		case m.Method == "":
+			// responses to requests we never send
+		case len(m.ID) == 0:
+			s.handleNotification(&m)
+		case m.Method == "tools/call":
+			callCtx, callCancel := context.WithCancel(ctx)
+			s.mu.Lock()
+			s.inflight[string(m.ID)] = callCancel
+			s.mu.Unlock()
+			wg.Add(1)
+			go func(m message) {
+				defer wg.Done()
+				defer func() {
+					s.mu.Lock()
+					delete(s.inflight, string(m.ID))
+					s.mu.Unlock()
+					callCancel()
+				}()
+				res, err := s.callTool(callCtx, m.Params)
+				s.reply(&m, res, err)
+			}(m)
+		default:
+			res, err := s.handle(&m)
+			s.reply(&m, res, err)
+		}
+	}
+}
+
+func (s *Server) handleNotification(m *message) {
+	if m.Method != "notifications/cancelled" {
+		return
+	}
+	var p struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(m.Params, &p) != nil {
+		return
+	}
+	s.mu.Lock()
+	cancel := s.inflight[string(p.RequestID)]
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (s *Server) handle(m *message) (any, error) {
+	switch m.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(m.Params, &p)
+		v := ProtocolVersion
+		for _, sv := range supportedVersions {
+			if sv == p.ProtocolVersion {
+				v = sv
+			}
+		}
+		res := map[string]any{
+			"protocolVersion": v,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": s.Name, "version": s.Version},
+		}
+		if s.Instructions != "" {
+			res["instructions"] = s.Instructions
+		}
+		return res, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		list := make([]map[string]any, 0, len(s.Tools))
+		for _, t := range s.enabledTools() {
+			list = append(list, map[string]any{
+				"name":        t.Tool.Function.Name,
+				"description": t.Tool.Function.Description,
+				"inputSchema": t.Tool.Function.Parameters,
+				"annotations": map[string]any{"readOnlyHint": t.ReadOnly, "destructiveHint": t.Destructive},
+			})
+		}
+		return map[string]any{"tools": list}, nil
+	}
+	return nil, &RPCError{Code: codeMethodNotFound, Message: "method not found: " + m.Method}
+}
+
+func (s *Server) enabledTools() []ServerTool {
+	var out []ServerTool
+	for _, t := range s.Tools {
+		if !s.Policy.ToolDisabled(t.Tool.Function.Name) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// callTool runs a tool and converts its result map into an MCP tool result.
+// Policy refusals and tool errors are reported as results with isError set,
+// so the calling model sees them, rather than as protocol errors.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	var tool *ServerTool
+	for _, t := range s.enabledTools() {
+		if t.Tool.Function.Name == p.Name {
+			t := t
+			tool = &t
+			break
+		}
+	}
+	if tool == nil {
+		return nil, &RPCError{Code: codeInvalidParams, Message: "unknown tool: " + p.Name}
+	}
+	if p.Arguments == nil {
+		p.Arguments = map[string]any{}
+	}
+	out, err := tool.Exec(ctx, p.Arguments, s.Policy)
+	if err != nil {
+		return toolResult(map[string]any{"error": err.Error()}), nil
+	}
+	return toolResult(out), nil
+}
+
+func toolResult(out map[string]any) map[string]any {
+	b, err := json.Marshal(out)
+	if err != nil {
+		b = []byte(fmt.Sprintf(`{"error":%q}`, err.Error()))
+	}
+	_, isErr := out["error"]
+	return map[string]any{
+		"content":           []map[string]any{{"type": "text", "text": string(b)}},
+		"structuredContent": out,
+		"isError":           isErr,
+	}
+}
+
+func (s *Server) reply(req *message, result any, err error) {
+	resp := message{JSONRPC: jsonrpcVersion, ID: req.ID}
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		b, merr := json.Marshal(result)
+		if merr != nil {
+			resp.Error = &RPCError{Code: codeInternalError, Message: merr.Error()}
+		} else {
+			resp.Result = b
+		}
+	}
+	s.send(resp)
+}
+
+func (s *Server) send(m message) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, _ = s.w.Write(append(b, '\n'))
+}
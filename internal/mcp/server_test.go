@@ -0,0 +1,153 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// serverConn drives a Server over in-memory pipes.
+type serverConn struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *bufio.Scanner
+	done chan error
+}
+
+func startServer(t *testing.T, s *Server) *serverConn {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &serverConn{t: t, in: inW, out: bufio.NewScanner(outR), done: make(chan error, 1)}
+	go func() {
+		c.done <- s.Serve(context.Background(), inR, outW)
+		_ = outW.Close()
+	}()
+	t.Cleanup(func() { _ = inW.Close() })
+	return c
+}
+
+func (c *serverConn) send(msg string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.in, msg+"\n"); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+func (c *serverConn) recv() message {
+	c.t.Helper()
+	if !c.out.Scan() {
+		c.t.Fatalf("server closed output: %v", c.out.Err())
+	}
+	var m message
+	if err := json.Unmarshal(c.out.Bytes(), &m); err != nil {
+		c.t.Fatalf("bad response %q: %v", c.out.Text(), err)
+	}
+	return m
+}
+
+func testServer() *Server {
+	echo := func(_ context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+		if p.Readonly {
+			return map[string]any{"error": "readonly session"}, nil
+		}
+		return map[string]any{"echo": args["text"]}, nil
+	}
+	wait := func(ctx context.Context, _ map[string]any, _ *types.Policy) (map[string]any, error) {
+		<-ctx.Done()
+		return map[string]any{"error": "cancelled"}, nil
+	}
+	tool := func(name string) types.Tool {
+		return types.Tool{Type: "function", Function: types.ToolFunction{Name: name, Parameters: json.RawMessage(`{"type":"object"}`)}}
+	}
+	return &Server{
+		Name:    "test",
+		Version: "1",
+		Tools: []ServerTool{
+			{Tool: tool("echo"), Exec: echo, ReadOnly: true},
+			{Tool: tool("wait"), Exec: wait},
+			{Tool: tool("hidden"), Exec: echo},
+		},
+		Policy: &types.Policy{DisabledTools: []string{"hidden"}},
+	}
+}
+
+func TestServerListsAndCallsTools(t *testing.T) {
+	s := testServer()
+	c := startServer(t, s)
+
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"t","version":"0"}}}`)
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct{ Name string }
+	}
+	if err := decodeResult(ptr(c.recv()), &init); err != nil || init.ProtocolVersion != "2025-03-26" || init.ServerInfo.Name != "test" {
+		t.Fatalf("unexpected initialize result: %+v %v", init, err)
+	}
+	c.send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	var list struct{ Tools []Tool }
+	if err := decodeResult(ptr(c.recv()), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tools) != 2 || list.Tools[0].Name != "echo" || !list.Tools[0].ReadOnly() {
+		t.Fatalf("disabled tools must not be listed: %+v", list.Tools)
+	}
+
+	c.send(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	var res CallResult
+	if err := decodeResult(ptr(c.recv()), &res); err != nil || res.IsError || res.Text() != `{"echo":"hi"}` || string(res.StructuredContent) != `{"echo":"hi"}` {
+		t.Fatalf("unexpected call result: %+v %v", res, err)
+	}
+
+	s.Policy.Readonly = true
+	c.send(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	res = CallResult{}
+	if err := decodeResult(ptr(c.recv()), &res); err != nil || !res.IsError || !strings.Contains(res.Text(), "readonly session") {
+		t.Fatalf("policy refusals should be tool errors: %+v %v", res, err)
+	}
+
+	c.send(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"hidden"}}`)
+	if m := c.recv(); m.Error == nil || m.Error.Code != codeInvalidParams {
+		t.Fatalf("expected unknown tool error, got %+v", m)
+	}
+	c.send(`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`)
+	if m := c.recv(); m.Error == nil || m.Error.Code != codeMethodNotFound {
+		t.Fatalf("expected method not found, got %+v", m)
+	}
+}
+
+func TestServerCancelsCall(t *testing.T) {
+	c := startServer(t, testServer())
+	c.send(`{"jsonrpc":"2.0","id":"w","method":"tools/call","params":{"name":"wait"}}`)
+	// a call in flight must not block other requests
+	c.send(`{"jsonrpc":"2.0","id":7,"method":"ping"}`)
+	if m := c.recv(); string(m.ID) != "7" {
+		t.Fatalf("expected ping reply first, got %+v", m)
+	}
+	c.send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"w"}}`)
+	got := make(chan message, 1)
+	go func() { got <- c.recv() }()
+	select {
+	case m := <-got:
+		var res CallResult
+		if err := decodeResult(&m, &res); err != nil || string(m.ID) != `"w"` || !res.IsError {
+			t.Fatalf("unexpected reply to cancelled call: %+v %v", m, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cancelled call did not finish")
+	}
+	_ = c.in.Close()
+	if err := <-c.done; err != nil {
+		t.Fatalf("Serve returned %v after stdin closed", err)
+	}
+}
+
+func ptr(m message) *message { return &m }
@@ -0,0 +1,203 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxStdioLineBytes bounds a single message from a stdio server.
+	maxStdioLineBytes = 16 * 1024 * 1024
+	// stderrTailBytes is how much server stderr is kept for error messages.
+	stderrTailBytes = 2048
+	// closeGrace is how long a server may take to exit after stdin closes.
+	closeGrace = 2 * time.Second
+)
+
+// stdioTransport talks to a server started as a child process, exchanging
+// newline-delimited JSON-RPC messages over its stdin and stdout.
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *message
+	err     error // set once the read loop stops
+	done    chan struct{}
+}
+
+func startStdio(cfg ServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  &tailBuffer{max: stderrTailBytes},
+		pending: map[string]chan *message{},
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = t.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *stdioTransport) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStdioLineBytes)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var m message
+		if err := json.Unmarshal(line, &m); err != nil {
+			// servers sometimes log to stdout; ignore lines that are not JSON-RPC
+			continue
+		}
+		switch {
+		case m.isResponse():
+			t.mu.Lock()
+			ch := t.pending[string(m.ID)]
+			delete(t.pending, string(m.ID))
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- &m
+			}
+		case len(m.ID) > 0:
+			_ = t.write(replyTo(&m))
+		}
+		// notifications from the server are ignored
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = errors.New("server closed the connection")
+	}
+	t.mu.Lock()
+	t.err = err
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *stdioTransport) write(m message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(b, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, method string, params any, out any) error {
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.mu.Unlock()
+	req, err := newRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	ch := make(chan *message, 1)
+	t.mu.Lock()
+	t.pending[string(req.ID)] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, string(req.ID))
+		t.mu.Unlock()
+	}()
+	if err := t.write(req); err != nil {
+		return t.failure(err)
+	}
+	select {
+	case resp := <-ch:
+		return decodeResult(resp, out)
+	case <-t.done:
+		return t.failure(t.err)
+	case <-ctx.Done():
+		_ = t.notify(context.Background(), "notifications/cancelled", map[string]any{"requestId": id})
+		return ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(_ context.Context, method string, params any) error {
+	m, err := newRequest(0, method, params)
+	if err != nil {
+		return err
+	}
+	return t.write(m)
+}
+
+// failure adds the tail of the server's stderr to err, which usually says
+// why the server stopped.
+func (t *stdioTransport) failure(err error) error {
+	if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+		return fmt.Errorf("%w: %s", err, tail)
+	}
+	return err
+}
+
+// close closes the server's stdin and waits briefly for it to exit before
+// killing it.
+func (t *stdioTransport) close() error {
+	_ = t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(closeGrace):
+		_ = t.cmd.Process.Kill()
+		<-t.done
+	}
+	// stdout is drained, so Wait may release the pipes
+	_ = t.cmd.Wait()
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
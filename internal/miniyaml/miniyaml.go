@@ -0,0 +1,109 @@
+// Package miniyaml reads the subset of YAML that Jorin's config and policy
+// files use: "key: value" pairs, scalars optionally wrapped in single or
+// double quotes, inline lists ([a, b]) and indented "- item" lists. A "#"
+// outside quotes that starts a line or follows a space begins a comment.
+package miniyaml
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Line is a line of a file with its comment removed.
+type Line struct {
+	// N is the 1-based line number.
+	N      int
+	Indent int
+	// Text is the line without indentation, comment or trailing spaces.
+	Text string
+}
+
+// Lines reads r and returns its lines that are not blank once comments are
+// removed.
+func Lines(r io.Reader) ([]Line, error) {
+	var out []Line
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := stripComment(scanner.Text())
+		trim := strings.TrimSpace(line)
+		if trim == "" {
+			continue
+		}
+		out = append(out, Line{N: n, Indent: len(line) - len(strings.TrimLeft(line, " \t")), Text: trim})
+	}
+	return out, scanner.Err()
+}
+
+// Item reports whether text is a list item ("- x" or "-") and returns what
+// follows the dash, still quoted.
+func Item(text string) (string, bool) {
+	if text == "-" {
+		return "", true
+	}
+	if strings.HasPrefix(text, "- ") {
+		return strings.TrimSpace(text[2:]), true
+	}
+	return "", false
+}
+
+// KeyValue splits "key: value" at the first colon.
+func KeyValue(text string) (key, value string, ok bool) {
+	key, value, ok = strings.Cut(text, ":")
+	return strings.TrimSpace(key), strings.TrimSpace(value), ok
+}
+
+// Value parses the value of a "key: value" pair: an inline list or a
+// scalar. An empty value returns no values and block true, since a block
+// list may follow. vals is never nil.
+func Value(v string) (vals []string, block bool) {
+	switch {
+	case v == "":
+		return []string{}, true
+	case strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]"):
+		return SplitList(v[1 : len(v)-1]), false
+	}
+	return []string{Unquote(v)}, false
+}
+
+// SplitList splits a comma-separated list, unquoting its items and dropping
+// empty ones. The result is never nil.
+func SplitList(v string) []string {
+	out := []string{}
+	for _, p := range strings.Split(v, ",") {
+		if p = Unquote(strings.TrimSpace(p)); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Unquote removes matching single or double quotes around v.
+func Unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// stripComment removes a "#" comment that is outside quotes and starts the
+// line or follows a space.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
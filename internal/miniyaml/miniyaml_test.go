@@ -0,0 +1,55 @@
+package miniyaml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	src := "# header\nkey: value # note\n\n  - 'a # b'\n\t- c#d\n   # indented comment\n"
+	lines, err := Lines(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Line{
+		{N: 2, Indent: 0, Text: "key: value"},
+		{N: 4, Indent: 2, Text: "- 'a # b'"},
+		{N: 5, Indent: 1, Text: "- c#d"},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("Lines() = %+v, want %+v", lines, want)
+	}
+}
+
+func TestValues(t *testing.T) {
+	for v, want := range map[string][]string{
+		`[a, "b", 'c', ]`: {"a", "b", "c"},
+		`[]`:              {},
+		`"quoted"`:        {"quoted"},
+		`'single'`:        {"single"},
+		`plain: text`:     {"plain: text"},
+	} {
+		got, block := Value(v)
+		if block || !reflect.DeepEqual(got, want) {
+			t.Errorf("Value(%q) = %q, %v, want %q", v, got, block, want)
+		}
+	}
+	if got, block := Value(""); !block || got == nil || len(got) != 0 {
+		t.Errorf("Value(\"\") = %q, %v, want an empty block", got, block)
+	}
+
+	if key, value, ok := KeyValue("url: https://x"); !ok || key != "url" || value != "https://x" {
+		t.Errorf("KeyValue split at the wrong colon: %q %q", key, value)
+	}
+	for text, want := range map[string]string{"-": "", "- x: y": "x: y", "-x": "!"} {
+		got, ok := Item(text)
+		if want == "!" {
+			if ok {
+				t.Errorf("Item(%q) should not be an item", text)
+			}
+		} else if !ok || got != want {
+			t.Errorf("Item(%q) = %q, %v, want %q", text, got, ok, want)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package openai
 
-import "github.com/dave1010/jorin/internal/types"
+import (
+	"context"
+	"io"
+
+	"github.com/dave1010/jorin/internal/types"
+)
 
 // DefaultAgent implements types.Agent by delegating to package-level
 // ChatSession.
 type DefaultAgent struct {
 	LLM LLM
+	// Provider selects the backend (see Providers). When empty, a provider
+	// prefix on the model name such as "anthropic/" selects it, and OpenAI
+	// is used otherwise.
+	Provider string
 }
 
 func NewDefaultAgent(useResponsesAPI bool) *DefaultAgent {
@@ -15,9 +24,20 @@ func NewDefaultAgent(useResponsesAPI bool) *DefaultAgent {
 	return &DefaultAgent{LLM: nil}
 }
 
-func (a *DefaultAgent) ChatSession(model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
-	if a.LLM != nil {
-		return chatSessionWithLLM(a.LLM, model, msgs, pol)
+func (a *DefaultAgent) ChatSession(ctx context.Context, model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
+	return a.ChatSessionStream(ctx, model, msgs, pol, nil)
+}
+
+// ChatSessionStream runs a chat session, writing assistant text to out as it
+// is generated. A nil out disables streaming.
+func (a *DefaultAgent) ChatSessionStream(ctx context.Context, model string, msgs []types.Message, pol *types.Policy, out io.Writer) ([]types.Message, string, error) {
+	openaiLLM := a.LLM
+	if openaiLLM == nil {
+		openaiLLM = DefaultLLM
+	}
+	llm, model, err := resolveProvider(a.Provider, model, openaiLLM)
+	if err != nil {
+		return msgs, "", err
 	}
-	return ChatSession(model, msgs, pol)
+	return chatSessionWithLLM(ctx, llm, model, msgs, pol, out)
 }
@@ -0,0 +1,160 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 8192
+)
+
+// anthropicClient talks to the Anthropic Messages API. It reads
+// ANTHROPIC_API_KEY and, optionally, ANTHROPIC_BASE_URL.
+type anthropicClient struct{}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block: text, tool_use or tool_result.
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Role       string           `json:"role"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      *struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage,omitempty"`
+}
+
+func anthropicBase() string {
+	if b := os.Getenv("ANTHROPIC_BASE_URL"); b != "" {
+		return strings.TrimRight(b, "/")
+	}
+	return "https://api.anthropic.com"
+}
+
+func (a anthropicClient) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+	headers := map[string]string{
+		"x-api-key":         os.Getenv("ANTHROPIC_API_KEY"),
+		"anthropic-version": anthropicVersion,
+	}
+	var r anthropicResponse
+	if err := postJSON(ctx, anthropicBase()+"/v1/messages", headers, buildAnthropicRequest(model, msgs, toolsList), &r); err != nil {
+		return nil, err
+	}
+	return mapAnthropicResponse(&r), nil
+}
+
+// buildAnthropicRequest maps chat messages onto the Messages API: system
+// messages become the system prompt, tool calls become tool_use blocks and
+// tool messages become tool_result blocks in the following user turn.
+// Consecutive messages for the same role are merged, as the API expects
+// user and assistant turns to alternate.
+func buildAnthropicRequest(model string, msgs []types.Message, toolsList []types.Tool) anthropicRequest {
+	req := anthropicRequest{Model: model, MaxTokens: anthropicMaxTokens}
+	var system []string
+	for _, m := range msgs {
+		var role string
+		var blocks []anthropicBlock
+		switch m.Role {
+		case "system":
+			system = append(system, m.Content)
+			continue
+		case "tool":
+			role = "user"
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		case "assistant":
+			role = "assistant"
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: toolInput(tc.Function.Args)})
+			}
+		default:
+			role = "user"
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, blocks...)
+			continue
+		}
+		req.Messages = append(req.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	req.System = strings.Join(system, "\n")
+	for _, t := range toolsList {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		req.Tools = append(req.Tools, anthropicTool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: schema})
+	}
+	return req
+}
+
+func mapAnthropicResponse(r *anthropicResponse) *types.ChatResponse {
+	msg := types.Message{Role: "assistant"}
+	for _, b := range r.Content {
+		switch b.Type {
+		case "text":
+			msg.Content += b.Text
+		case "tool_use":
+			tc := types.ToolCall{ID: b.ID, Type: "function"}
+			tc.Function.Name = b.Name
+			tc.Function.Args = toolInput(b.Input)
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+	}
+	finish := "stop"
+	switch r.StopReason {
+	case "tool_use":
+		finish = "tool_calls"
+	case "max_tokens":
+		finish = "length"
+	}
+	// The message ID is not a Responses API ID, so it is not returned as
+	// the response ID recorded on messages.
+	res := &types.ChatResponse{Choices: []types.Choice{{Message: msg, FinishReason: finish}}}
+	if r.Usage != nil {
+		res.Usage = &types.Usage{PromptTokens: r.Usage.InputTokens, CompletionTokens: r.Usage.OutputTokens}
+	}
+	return res
+}
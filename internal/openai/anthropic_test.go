@@ -0,0 +1,129 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestAnthropicClient_ChatOnce(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("expected /v1/messages, got %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "sk-ant-test" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("missing auth headers: %v", r.Header)
+		}
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.System != "be brief" || req.MaxTokens == 0 {
+			t.Errorf("unexpected system/max_tokens: %q %d", req.System, req.MaxTokens)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Name != "shell" || len(req.Tools[0].InputSchema) == 0 {
+			t.Errorf("unexpected tools: %+v", req.Tools)
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","stop_reason":"tool_use","content":[
+			{"type":"text","text":"Listing files."},
+			{"type":"tool_use","id":"toolu_1","name":"shell","input":{"cmd":"ls"}}]}`))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(h))
+	defer srv.Close()
+	t.Setenv("ANTHROPIC_BASE_URL", srv.URL)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+
+	msgs := []types.Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "ls"}}
+	tools := []types.Tool{{Type: "function", Function: types.ToolFunction{Name: "shell", Parameters: json.RawMessage(`{"type":"object"}`)}}}
+	resp, err := anthropicClient{}.ChatOnce(context.Background(), "claude-test", msgs, tools)
+	if err != nil {
+		t.Fatalf("ChatOnce error: %v", err)
+	}
+	ch := resp.Choices[0]
+	if ch.FinishReason != "tool_calls" || ch.Message.Content != "Listing files." {
+		t.Fatalf("unexpected choice: %+v", ch)
+	}
+	if len(ch.Message.ToolCalls) != 1 || ch.Message.ToolCalls[0].ID != "toolu_1" || string(ch.Message.ToolCalls[0].Function.Args) != `{"cmd":"ls"}` {
+		t.Fatalf("unexpected tool calls: %+v", ch.Message.ToolCalls)
+	}
+	if resp.ID != "" {
+		t.Fatalf("anthropic message IDs must not be recorded as response IDs, got %q", resp.ID)
+	}
+}
+
+func TestAnthropicMessagesRoundTrip(t *testing.T) {
+	tc1 := types.ToolCall{ID: "toolu_1", Type: "function"}
+	tc1.Function.Name = "read_file"
+	tc1.Function.Args = json.RawMessage(`{"path":"a.txt"}`)
+	tc2 := types.ToolCall{ID: "toolu_2", Type: "function"}
+	tc2.Function.Name = "shell"
+	tc2.Function.Args = json.RawMessage(`"{\"cmd\":\"ls\"}"`)
+	msgs := []types.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "look"},
+		{Role: "assistant", Content: "Checking.", ToolCalls: []types.ToolCall{tc1, tc2}},
+		{Role: "tool", ToolCallID: "toolu_1", Content: `{"text":"hi"}`},
+		{Role: "tool", ToolCallID: "toolu_2", Content: `{"stdout":"a.txt"}`},
+		{Role: "user", Content: "thanks"},
+	}
+
+	req := buildAnthropicRequest("m", msgs, nil)
+	if len(req.Messages) != 3 {
+		t.Fatalf("expected user/assistant/user turns, got %+v", req.Messages)
+	}
+	asst := req.Messages[1]
+	if asst.Role != "assistant" || len(asst.Content) != 3 || asst.Content[2].Type != "tool_use" || string(asst.Content[2].Input) != `{"cmd":"ls"}` {
+		t.Fatalf("unexpected assistant turn: %+v", asst)
+	}
+	results := req.Messages[2]
+	if results.Role != "user" || len(results.Content) != 3 || results.Content[0].ToolUseID != "toolu_1" || results.Content[1].ToolUseID != "toolu_2" || results.Content[2].Text != "thanks" {
+		t.Fatalf("tool results should be merged into the next user turn: %+v", results)
+	}
+
+	// Mapping the assistant turn back must give the same message.
+	back := mapAnthropicResponse(&anthropicResponse{Content: asst.Content, StopReason: "tool_use"}).Choices[0].Message
+	if back.Content != "Checking." || len(back.ToolCalls) != 2 {
+		t.Fatalf("unexpected round trip: %+v", back)
+	}
+	for i, tc := range back.ToolCalls {
+		if tc.ID != msgs[2].ToolCalls[i].ID || tc.Function.Name != msgs[2].ToolCalls[i].Function.Name {
+			t.Fatalf("tool call %d did not round-trip: %+v", i, tc)
+		}
+	}
+	if string(back.ToolCalls[1].Function.Args) != `{"cmd":"ls"}` {
+		t.Fatalf("string-encoded args should be normalised, got %s", back.ToolCalls[1].Function.Args)
+	}
+}
+
+func TestResolveProvider(t *testing.T) {
+	fallback := completionsClient{}
+	cases := []struct {
+		provider, model string
+		wantLLM         LLM
+		wantModel       string
+	}{
+		{"", "gpt-5-mini", fallback, "gpt-5-mini"},
+		{"", "anthropic/claude-sonnet-4-5", anthropicClient{}, "claude-sonnet-4-5"},
+		{"", "ollama/llama3.1:8b", ollamaClient{}, "llama3.1:8b"},
+		{"", "openai/gpt-5", fallback, "gpt-5"},
+		{"", "meta-llama/Llama-3", fallback, "meta-llama/Llama-3"},
+		{"openai", "anthropic/claude-sonnet-4-5", fallback, "anthropic/claude-sonnet-4-5"},
+		{"ollama", "qwen3", ollamaClient{}, "qwen3"},
+	}
+	for _, c := range cases {
+		llm, model, err := resolveProvider(c.provider, c.model, fallback)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.provider, c.model, err)
+		}
+		if llm != c.wantLLM || model != c.wantModel {
+			t.Errorf("%q %q: got %T %q, want %T %q", c.provider, c.model, llm, model, c.wantLLM, c.wantModel)
+		}
+	}
+	if _, _, err := resolveProvider("bedrock", "x", fallback); err == nil {
+		t.Fatalf("expected unknown provider error")
+	}
+}
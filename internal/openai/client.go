@@ -2,6 +2,7 @@ package openai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,7 +17,7 @@ import (
 // produce a single chat completion. This abstraction lets us add other
 // LLM backends later without duplicating session orchestration logic.
 type LLM interface {
-	ChatOnce(model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error)
+	ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error)
 }
 
 // DefaultLLM is the package-level LLM implementation used by the
@@ -36,14 +37,21 @@ type completionsClient struct{}
 
 type responsesClient struct{}
 
+// BaseURL overrides the API base URL. When empty, OPENAI_BASE_URL or the
+// public OpenAI endpoint is used.
+var BaseURL string
+
 func openAIBase() string {
+	if BaseURL != "" {
+		return strings.TrimRight(BaseURL, "/")
+	}
 	if b := os.Getenv("OPENAI_BASE_URL"); b != "" {
 		return strings.TrimRight(b, "/")
 	}
 	return "https://api.openai.com"
 }
 
-func (o completionsClient) ChatOnce(model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+func (o completionsClient) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
 	body := types.ChatRequest{
 		Model:      model,
 		Messages:   msgs,
@@ -52,7 +60,7 @@ func (o completionsClient) ChatOnce(model string, msgs []types.Message, toolsLis
 	}
 	j, _ := json.Marshal(body)
 
-	req, _ := http.NewRequest("POST", openAIBase()+"/v1/chat/completions", bytes.NewReader(j))
+	req, _ := http.NewRequestWithContext(ctx, "POST", openAIBase()+"/v1/chat/completions", bytes.NewReader(j))
 	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := http.DefaultClient.Do(req)
@@ -71,104 +79,93 @@ func (o completionsClient) ChatOnce(model string, msgs []types.Message, toolsLis
 	return &out, nil
 }
 
-func (o responsesClient) ChatOnce(model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+func (o responsesClient) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+	body := buildResponsesRequest(model, msgs, toolsList)
+	j, _ := json.Marshal(body)
+	if os.Getenv("DEBUG") == "1" {
+		fmt.Fprintf(os.Stderr, "\n--- DEBUG REQUEST to /v1/responses ---\n%s\n", string(j))
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", openAIBase()+"/v1/responses", bytes.NewReader(j))
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, _ := io.ReadAll(resp.Body)
+	if os.Getenv("DEBUG") == "1" {
+		fmt.Fprintf(os.Stderr, "--- DEBUG RESPONSE (%d) ---\n%s\n---\n", resp.StatusCode, string(b))
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("API %d: %s", resp.StatusCode, string(b))
+	}
+
+	var r responsesResponse
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	return mapResponseToChatResponse(&r), nil
+}
+
+// buildResponsesRequest maps chat messages onto a Responses API request,
+// sending only the messages that follow the last known response ID.
+func buildResponsesRequest(model string, msgs []types.Message, toolsList []types.Tool) responsesRequest {
 	input := []any{}
 	var instructions string
 	var previousResponseID string
 
 	// Find the last message with a ResponseID to use as previousResponseID
-
 	lastWithID := -1
-
 	for i := len(msgs) - 1; i >= 0; i-- {
-
 		if msgs[i].ResponseID != "" {
-
 			previousResponseID = msgs[i].ResponseID
-
 			lastWithID = i
-
 			break
-
 		}
-
 	}
 
 	for i, m := range msgs {
-
 		if m.Role == "system" {
-
 			instructions += m.Content + "\n"
-
 			continue
-
 		}
-
 		// If we found a previousResponseID, skip messages that are already part of it
-
 		if i <= lastWithID {
-
 			continue
-
 		}
-
 		if m.Role == "tool" {
-
 			input = append(input, functionCallOutputItem{
-
-				Type: "function_call_output",
-
+				Type:   "function_call_output",
 				CallID: m.ToolCallID,
-
 				Output: m.Content,
 			})
-
 			continue
-
 		}
-
 		if m.Role == "assistant" && m.Content == "" && len(m.ToolCalls) == 0 {
-
 			continue
-
 		}
-
 		contentType := "input_text"
-
 		if m.Role == "assistant" {
-
 			contentType = "output_text"
-
 		}
-
 		input = append(input, inputMessage{
-
-			Type: "message",
-
-			Role: m.Role,
-
+			Type:    "message",
+			Role:    m.Role,
 			Content: []any{inputContent{Type: contentType, Text: m.Content}},
 		})
-
-		if len(m.ToolCalls) > 0 {
-
-			for _, tc := range m.ToolCalls {
-
-				input = append(input, functionCallItem{
-
-					Type: "function_call",
-
-					CallID: tc.ID,
-
-					Name: tc.Function.Name,
-
-					Arguments: tc.Function.Args,
-				})
-
-			}
-
+		for _, tc := range m.ToolCalls {
+			input = append(input, functionCallItem{
+				Type:      "function_call",
+				CallID:    tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Args,
+			})
 		}
-
 	}
 
 	// Map types.Tool to responses API tool format
@@ -192,40 +189,13 @@ func (o responsesClient) ChatOnce(model string, msgs []types.Message, toolsList
 	if len(tools) > 0 {
 		body.ToolChoice = "auto"
 	}
-	j, _ := json.Marshal(body)
-	if os.Getenv("DEBUG") == "1" {
-		fmt.Fprintf(os.Stderr, "\n--- DEBUG REQUEST to /v1/responses ---\n%s\n", string(j))
-	}
-
-	req, _ := http.NewRequest("POST", openAIBase()+"/v1/responses", bytes.NewReader(j))
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	b, _ := io.ReadAll(resp.Body)
-	if os.Getenv("DEBUG") == "1" {
-		fmt.Fprintf(os.Stderr, "--- DEBUG RESPONSE (%d) ---\n%s\n---\n", resp.StatusCode, string(b))
-	}
-
-	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("API %d: %s", resp.StatusCode, string(b))
-	}
-
-	var r responsesResponse
-	if err := json.Unmarshal(b, &r); err != nil {
-		return nil, err
-	}
-
-	return mapResponseToChatResponse(&r), nil
+	return body
 }
 
 func mapResponseToChatResponse(r *responsesResponse) *types.ChatResponse {
 	res := &types.ChatResponse{
-		ID: r.ID,
+		ID:    r.ID,
+		Usage: r.Usage.toUsage(),
 	}
 
 	msg := types.Message{
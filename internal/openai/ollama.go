@@ -0,0 +1,113 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// ollamaClient talks to Ollama's native /api/chat endpoint. The server is
+// taken from OLLAMA_HOST, as with the ollama CLI.
+type ollamaClient struct{}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []types.Tool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaResponse struct {
+	Message    ollamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	// PromptEvalCount and EvalCount are the prompt and output token counts.
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+func ollamaBase() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return "http://localhost:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimRight(host, "/")
+}
+
+func (o ollamaClient) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+	var r ollamaResponse
+	if err := postJSON(ctx, ollamaBase()+"/api/chat", nil, buildOllamaRequest(model, msgs, toolsList), &r); err != nil {
+		return nil, err
+	}
+	return mapOllamaResponse(&r), nil
+}
+
+// buildOllamaRequest maps chat messages onto /api/chat. Ollama identifies
+// tool results by tool name rather than call ID, so each tool message is
+// labelled with the name of the call it answers.
+func buildOllamaRequest(model string, msgs []types.Message, toolsList []types.Tool) ollamaRequest {
+	req := ollamaRequest{Model: model, Tools: toolsList}
+	names := map[string]string{}
+	for _, m := range msgs {
+		om := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, tc := range m.ToolCalls {
+			names[tc.ID] = tc.Function.Name
+			var call ollamaToolCall
+			call.ID = tc.ID
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = toolInput(tc.Function.Args)
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		if m.Role == "tool" {
+			om.ToolName = names[m.ToolCallID]
+		}
+		req.Messages = append(req.Messages, om)
+	}
+	return req
+}
+
+func mapOllamaResponse(r *ollamaResponse) *types.ChatResponse {
+	msg := types.Message{Role: "assistant", Content: r.Message.Content}
+	for _, c := range r.Message.ToolCalls {
+		id := c.ID
+		if id == "" {
+			id = newCallID()
+		}
+		tc := types.ToolCall{ID: id, Type: "function"}
+		tc.Function.Name = c.Function.Name
+		tc.Function.Args = toolInput(c.Function.Arguments)
+		msg.ToolCalls = append(msg.ToolCalls, tc)
+	}
+	finish := r.DoneReason
+	if len(msg.ToolCalls) > 0 {
+		finish = "tool_calls"
+	} else if finish == "" {
+		finish = "stop"
+	}
+	res := &types.ChatResponse{Choices: []types.Choice{{Message: msg, FinishReason: finish}}}
+	if r.PromptEvalCount > 0 || r.EvalCount > 0 {
+		res.Usage = &types.Usage{PromptTokens: r.PromptEvalCount, CompletionTokens: r.EvalCount}
+	}
+	return res
+}
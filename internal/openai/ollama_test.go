@@ -0,0 +1,69 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestOllamaClient_ChatOnce(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("expected /api/chat, got %s", r.URL.Path)
+		}
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req["stream"] != false {
+			t.Errorf("expected stream=false, got %v", req["stream"])
+		}
+		_, _ = w.Write([]byte(`{"model":"llama3.1","message":{"role":"assistant","content":"",
+			"tool_calls":[{"function":{"name":"read_file","arguments":{"path":"go.mod"}}}]},"done":true,"done_reason":"stop"}`))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(h))
+	defer srv.Close()
+	t.Setenv("OLLAMA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+	resp, err := ollamaClient{}.ChatOnce(context.Background(), "llama3.1", []types.Message{{Role: "user", Content: "read go.mod"}}, nil)
+	if err != nil {
+		t.Fatalf("ChatOnce error: %v", err)
+	}
+	ch := resp.Choices[0]
+	if ch.FinishReason != "tool_calls" || len(ch.Message.ToolCalls) != 1 {
+		t.Fatalf("unexpected choice: %+v", ch)
+	}
+	tc := ch.Message.ToolCalls[0]
+	if !strings.HasPrefix(tc.ID, "call_") || tc.Function.Name != "read_file" || string(tc.Function.Args) != `{"path":"go.mod"}` {
+		t.Fatalf("unexpected tool call: %+v args=%s", tc, tc.Function.Args)
+	}
+}
+
+func TestOllamaMessagesRoundTrip(t *testing.T) {
+	tc := types.ToolCall{ID: "call_abc", Type: "function"}
+	tc.Function.Name = "shell"
+	tc.Function.Args = json.RawMessage(`{"cmd":"ls"}`)
+	msgs := []types.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "ls"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{tc}},
+		{Role: "tool", ToolCallID: "call_abc", Content: `{"stdout":"x"}`},
+	}
+	req := buildOllamaRequest("m", msgs, nil)
+	if len(req.Messages) != 4 || req.Messages[0].Role != "system" {
+		t.Fatalf("unexpected messages: %+v", req.Messages)
+	}
+	if req.Messages[3].ToolName != "shell" {
+		t.Fatalf("tool result should carry the tool name, got %+v", req.Messages[3])
+	}
+	sent := req.Messages[2]
+	back := mapOllamaResponse(&ollamaResponse{Message: sent, Done: true}).Choices[0].Message
+	if len(back.ToolCalls) != 1 || back.ToolCalls[0].ID != "call_abc" || string(back.ToolCalls[0].Function.Args) != `{"cmd":"ls"}` {
+		t.Fatalf("tool call did not round-trip: %+v", back.ToolCalls)
+	}
+}
@@ -1,7 +1,11 @@
 package openai
 
 import (
+	"context"
 	"errors"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/dave1010/jorin/internal/tools"
 	"github.com/dave1010/jorin/internal/types"
@@ -9,27 +13,84 @@ import (
 
 const maxChatTurns = 100
 
+// RequestTimeout bounds each individual model call made by a chat session.
+// Zero means no limit beyond the caller's context.
+var RequestTimeout time.Duration
+
 // ChatOnce is a convenience wrapper that delegates to the package-level
 // DefaultLLM implementation. Callers can swap DefaultLLM for a different
 // provider in tests or to support other LLMs.
-func ChatOnce(model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
-	return DefaultLLM.ChatOnce(model, msgs, toolsList)
+func ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+	return DefaultLLM.ChatOnce(ctx, model, msgs, toolsList)
+}
+
+// DefaultProvider selects the backend used by ChatSession and
+// ChatSessionStream, as DefaultAgent.Provider does for an agent.
+var DefaultProvider string
+
+func ChatSession(ctx context.Context, model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
+	return ChatSessionStream(ctx, model, msgs, pol, nil)
+}
+
+// ChatSessionStream runs a chat session like ChatSession but writes assistant
+// text to out as it arrives when the LLM supports streaming.
+func ChatSessionStream(ctx context.Context, model string, msgs []types.Message, pol *types.Policy, out io.Writer) ([]types.Message, string, error) {
+	llm, model, err := resolveProvider(DefaultProvider, model, DefaultLLM)
+	if err != nil {
+		return msgs, "", err
+	}
+	return chatSessionWithLLM(ctx, llm, model, msgs, pol, out)
+}
+
+// chatSessionWithLLM runs the tool-calling loop. When out is non-nil and llm
+// implements StreamingLLM, text deltas are written to out as they arrive.
+// Cancelling ctx aborts the in-flight request or tool call; the returned
+// messages are always a valid history to continue from.
+func chatSessionWithLLM(ctx context.Context, llm LLM, model string, msgs []types.Message, pol *types.Policy, out io.Writer) ([]types.Message, string, error) {
+	msgs, text, _, err := runSession(ctx, llm, model, msgs, pol, out, budget{})
+	return msgs, text, err
+}
+
+// budget limits a session. Zero values mean no limit beyond maxChatTurns.
+type budget struct {
+	turns  int
+	tokens int
 }
 
-func ChatSession(model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
-	return chatSessionWithLLM(DefaultLLM, model, msgs, pol)
+// usage reports what a session consumed.
+type usage struct {
+	turns  int
+	tokens int
 }
 
-func chatSessionWithLLM(llm LLM, model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
+// runSession is the loop behind chatSessionWithLLM. It stops with
+// errTurnBudget or errTokenBudget once b is used up. Sessions below the
+// sub-agent depth limit are offered spawn_agent.
+func runSession(ctx context.Context, llm LLM, model string, msgs []types.Message, pol *types.Policy, out io.Writer, b budget) ([]types.Message, string, usage, error) {
 	toolsList := tools.ToolsManifest()
 	reg := tools.Registry()
-	for i := 0; i < maxChatTurns; i++ {
-		resp, err := llm.ChatOnce(model, msgs, toolsList)
+	if agentDepth(ctx) < maxAgentDepth {
+		toolsList = append(toolsList, spawnAgentTool)
+		reg["spawn_agent"] = tools.Guard("spawn_agent", spawnAgentExec(llm, model, systemPrompt(msgs)))
+	}
+	toolsList = tools.EnabledTools(toolsList, pol)
+	maxTurns := maxChatTurns
+	if b.turns > 0 && b.turns < maxTurns {
+		maxTurns = b.turns
+	}
+	var used usage
+	for used.turns < maxTurns {
+		if b.tokens > 0 && used.tokens >= b.tokens {
+			return msgs, "", used, errTokenBudget
+		}
+		resp, err := chatTurn(ctx, llm, model, msgs, toolsList, out)
 		if err != nil {
-			return msgs, "", err
+			return msgs, "", used, err
 		}
+		used.turns++
+		used.tokens += resp.Usage.Total()
 		if len(resp.Choices) == 0 {
-			return msgs, "", errors.New("no choices")
+			return msgs, "", used, errors.New("no choices")
 		}
 		ch := resp.Choices[0]
 		cm := ch.Message
@@ -38,12 +99,76 @@ func chatSessionWithLLM(llm LLM, model string, msgs []types.Message, pol *types.
 		msgs = append(msgs, cm)
 
 		if len(cm.ToolCalls) > 0 {
-			toolMsgs := handleToolCalls(cm.ToolCalls, reg, pol)
+			toolMsgs := handleToolCalls(ctx, cm.ToolCalls, reg, pol)
 			msgs = append(msgs, toolMsgs...)
+			if err := ctx.Err(); err != nil {
+				return msgs, "", used, err
+			}
 			continue
 		}
 
-		return msgs, cm.Content, nil
+		return msgs, cm.Content, used, nil
+	}
+	if b.turns > 0 && used.turns >= b.turns {
+		return msgs, "", used, errTurnBudget
+	}
+	return msgs, "", used, errors.New("max turns reached")
+}
+
+func chatTurn(ctx context.Context, llm LLM, model string, msgs []types.Message, toolsList []types.Tool, out io.Writer) (*types.ChatResponse, error) {
+	if RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, RequestTimeout)
+		defer cancel()
+	}
+	if out == nil {
+		return llm.ChatOnce(ctx, model, msgs, toolsList)
+	}
+	sw := &streamWriter{out: out}
+	var resp *types.ChatResponse
+	var err error
+	if sl, ok := llm.(StreamingLLM); ok {
+		resp, err = sl.ChatStream(ctx, model, msgs, toolsList, sw.write)
+	} else {
+		// backends without streaming still write their text to out, in one go
+		resp, err = llm.ChatOnce(ctx, model, msgs, toolsList)
+		if err == nil && len(resp.Choices) > 0 {
+			sw.write(resp.Choices[0].Message.Content)
+		}
+	}
+	sw.finish()
+	if err == nil && sw.err != nil {
+		err = sw.err
+	}
+	return resp, err
+}
+
+// streamWriter writes deltas to out and terminates the streamed message with
+// a newline so tool previews and prompts start on a fresh line.
+type streamWriter struct {
+	out   io.Writer
+	wrote bool
+	last  string
+	err   error
+}
+
+func (s *streamWriter) write(delta string) {
+	if delta == "" || s.err != nil {
+		return
+	}
+	if _, err := io.WriteString(s.out, delta); err != nil {
+		s.err = err
+		return
+	}
+	s.wrote = true
+	s.last = delta
+}
+
+func (s *streamWriter) finish() {
+	if !s.wrote || s.err != nil || strings.HasSuffix(s.last, "\n") {
+		return
+	}
+	if _, err := io.WriteString(s.out, "\n"); err != nil {
+		s.err = err
 	}
-	return msgs, "", errors.New("max turns reached")
 }
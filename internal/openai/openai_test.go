@@ -1,12 +1,15 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/dave1010/jorin/internal/tools"
 	"github.com/dave1010/jorin/internal/types"
 )
 
@@ -35,7 +38,7 @@ func TestChatOnceDecodesResponse(t *testing.T) {
 	}()
 
 	msgs := []types.Message{{Role: "system", Content: "x"}}
-	resp, err := ChatOnce("model", msgs, nil)
+	resp, err := ChatOnce(context.Background(), "model", msgs, nil)
 	if err != nil {
 		t.Fatalf("ChatOnce error: %v", err)
 	}
@@ -43,3 +46,92 @@ func TestChatOnceDecodesResponse(t *testing.T) {
 		t.Fatalf("unexpected resp: %#v", resp)
 	}
 }
+
+// cancellingLLM asks for a tool call and cancels the session while the
+// request for it is being answered.
+type cancellingLLM struct {
+	cancel context.CancelFunc
+}
+
+func (c cancellingLLM) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+	c.cancel()
+	tc := types.ToolCall{ID: "call_1", Type: "function"}
+	tc.Function.Name = "shell"
+	tc.Function.Args = json.RawMessage(`{"cmd":"echo never"}`)
+	return &types.ChatResponse{Choices: []types.Choice{{Message: types.Message{Role: "assistant", ToolCalls: []types.ToolCall{tc}}}}}, nil
+}
+
+func TestChatSessionCancelledKeepsValidHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs := []types.Message{{Role: "user", Content: "run it"}}
+	out, _, err := chatSessionWithLLM(ctx, cancellingLLM{cancel: cancel}, "m", msgs, &types.Policy{}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("expected user, assistant and tool messages, got %+v", out)
+	}
+	last := out[2]
+	if last.Role != "tool" || last.ToolCallID != "call_1" || last.Content != `{"error":"cancelled"}` {
+		t.Fatalf("unexpected tool message: %+v", last)
+	}
+}
+
+func TestDisabledToolsAreHiddenAndRefused(t *testing.T) {
+	pol := &types.Policy{DisabledTools: []string{"shell"}}
+	for _, tool := range tools.EnabledTools(tools.ToolsManifest(), pol) {
+		if tool.Function.Name == "shell" {
+			t.Fatalf("disabled tool should not be offered to the model")
+		}
+	}
+
+	tc := types.ToolCall{ID: "call_1", Type: "function"}
+	tc.Function.Name = "shell"
+	tc.Function.Args = json.RawMessage(`{"cmd":"echo hi"}`)
+	msgs := handleToolCalls(context.Background(), []types.ToolCall{tc}, tools.Registry(), pol)
+	if len(msgs) != 1 || msgs[0].Content != `{"error":"tool disabled by policy"}` {
+		t.Fatalf("unexpected tool messages: %+v", msgs)
+	}
+}
+
+type fakeApprover struct {
+	seen     []string
+	decision types.ApprovalDecision
+}
+
+func (f *fakeApprover) Approve(_ context.Context, req types.ApprovalRequest) types.ApprovalDecision {
+	f.seen = append(f.seen, req.Tool)
+	return f.decision
+}
+
+func TestToolCallsNeedingApproval(t *testing.T) {
+	shell := types.ToolCall{ID: "call_1", Type: "function"}
+	shell.Function.Name = "shell"
+	shell.Function.Args = json.RawMessage(`{"cmd":"echo original"}`)
+	read := types.ToolCall{ID: "call_2", Type: "function"}
+	read.Function.Name = "read_file"
+	read.Function.Args = json.RawMessage(`{"path":"/nonexistent"}`)
+	calls := []types.ToolCall{shell, read}
+
+	// without an approver the call is refused (fail closed)
+	msgs := handleToolCalls(context.Background(), calls, tools.Registry(), &types.Policy{Approve: types.ApproveShell})
+	if msgs[0].Content != `{"error":"approval required (approve=shell) but there is no terminal to ask"}` {
+		t.Fatalf("unexpected result without approver: %s", msgs[0].Content)
+	}
+
+	a := &fakeApprover{decision: types.ApprovalDecision{Reason: "use make instead"}}
+	msgs = handleToolCalls(context.Background(), calls, tools.Registry(), &types.Policy{Approve: types.ApproveShell, Approver: a})
+	if msgs[0].Content != `{"error":"denied by user: use make instead"}` {
+		t.Fatalf("the denial reason should reach the model, got %s", msgs[0].Content)
+	}
+	if len(a.seen) != 1 {
+		t.Fatalf("only shell needs approval in shell mode, asked about %v", a.seen)
+	}
+
+	a = &fakeApprover{decision: types.ApprovalDecision{Allow: true, Args: map[string]any{"cmd": "echo edited"}}}
+	msgs = handleToolCalls(context.Background(), calls[:1], tools.Registry(), &types.Policy{Approve: types.ApproveAlways, Approver: a})
+	var out map[string]any
+	if err := json.Unmarshal([]byte(msgs[0].Content), &out); err != nil || out["stdout"] != "edited\n" {
+		t.Fatalf("the edited command should run, got %s", msgs[0].Content)
+	}
+}
@@ -0,0 +1,114 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Providers selectable with --provider or a model prefix such as
+// "anthropic/claude-sonnet-4-5".
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// Providers lists the supported provider names.
+var Providers = []string{ProviderOpenAI, ProviderAnthropic, ProviderOllama}
+
+// resolveProvider picks the backend for model. An explicit provider wins and
+// leaves the model name untouched, so OpenAI-compatible gateways can use
+// names like "anthropic/claude-...". Otherwise a known provider prefix on the
+// model selects the backend and is stripped. openaiLLM serves the OpenAI
+// provider so the configured API mode is kept.
+func resolveProvider(provider string, model string, openaiLLM LLM) (LLM, string, error) {
+	if provider == "" {
+		if p, rest, ok := strings.Cut(model, "/"); ok && isProvider(p) {
+			provider, model = p, rest
+		}
+	}
+	switch provider {
+	case "", ProviderOpenAI:
+		return openaiLLM, model, nil
+	case ProviderAnthropic:
+		return anthropicClient{}, model, nil
+	case ProviderOllama:
+		return ollamaClient{}, model, nil
+	}
+	return nil, "", fmt.Errorf("unknown provider %q (expected one of %s)", provider, strings.Join(Providers, ", "))
+}
+
+func isProvider(name string) bool {
+	for _, p := range Providers {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// postJSON sends body to url and decodes a successful JSON reply into out.
+func postJSON(ctx context.Context, url string, headers map[string]string, body any, out any) error {
+	j, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	if os.Getenv("DEBUG") == "1" {
+		fmt.Fprintf(os.Stderr, "\n--- DEBUG REQUEST to %s ---\n%s\n", url, string(j))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(j))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if os.Getenv("DEBUG") == "1" {
+		fmt.Fprintf(os.Stderr, "--- DEBUG RESPONSE (%d) ---\n%s\n---\n", resp.StatusCode, string(b))
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("API %d: %s", resp.StatusCode, string(b))
+	}
+	return json.Unmarshal(b, out)
+}
+
+// toolInput returns tool-call arguments as a JSON object, unwrapping
+// arguments that were sent as a JSON-encoded string.
+func toolInput(args json.RawMessage) json.RawMessage {
+	trimmed := bytes.TrimSpace(args)
+	if len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed) {
+		return trimmed
+	}
+	var inner string
+	if err := json.Unmarshal(trimmed, &inner); err == nil {
+		if in := bytes.TrimSpace([]byte(inner)); len(in) > 0 && in[0] == '{' && json.Valid(in) {
+			return in
+		}
+	}
+	return json.RawMessage(`{}`)
+}
+
+// newCallID makes an ID for tool calls from backends that do not assign one.
+func newCallID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
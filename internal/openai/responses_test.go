@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -48,7 +49,7 @@ func TestResponsesClient_ChatOnce(t *testing.T) {
 
 	client := responsesClient{}
 	msgs := []types.Message{{Role: "user", Content: "hi"}}
-	resp, err := client.ChatOnce("gpt-4o", msgs, nil)
+	resp, err := client.ChatOnce(context.Background(), "gpt-4o", msgs, nil)
 	if err != nil {
 		t.Fatalf("ChatOnce error: %v", err)
 	}
@@ -92,7 +93,7 @@ func TestResponsesClient_ChatOnce_PreviousResponseID(t *testing.T) {
 		{Role: "assistant", Content: "hello", ResponseID: "prev_123"},
 		{Role: "user", Content: "how are you?"},
 	}
-	_, err := client.ChatOnce("gpt-4o", msgs, nil)
+	_, err := client.ChatOnce(context.Background(), "gpt-4o", msgs, nil)
 	if err != nil {
 		t.Fatalf("ChatOnce error: %v", err)
 	}
@@ -148,7 +149,7 @@ func TestResponsesClient_ChatOnce_InputStructure(t *testing.T) {
 
 	client := responsesClient{}
 	msgs := []types.Message{{Role: "user", Content: "hi"}}
-	_, err := client.ChatOnce("gpt-4o", msgs, nil)
+	_, err := client.ChatOnce(context.Background(), "gpt-4o", msgs, nil)
 	if err != nil {
 		t.Fatalf("ChatOnce error: %v", err)
 	}
@@ -182,7 +183,7 @@ func TestResponsesClient_ChatOnce_ToolCall(t *testing.T) {
 	defer func() { _ = os.Setenv("OPENAI_BASE_URL", prev) }()
 
 	client := responsesClient{}
-	resp, err := client.ChatOnce("gpt-4o", nil, nil)
+	resp, err := client.ChatOnce(context.Background(), "gpt-4o", nil, nil)
 	if err != nil {
 		t.Fatalf("ChatOnce error: %v", err)
 	}
@@ -240,7 +241,7 @@ func TestResponsesClient_ChatOnce_ToolMapping(t *testing.T) {
 			},
 		},
 	}
-	_, err := client.ChatOnce("gpt-4o", nil, toolsList)
+	_, err := client.ChatOnce(context.Background(), "gpt-4o", nil, toolsList)
 	if err != nil {
 		t.Fatalf("ChatOnce error: %v", err)
 	}
@@ -291,7 +292,7 @@ func TestResponsesClient_ChatOnce_ToolOutput_InputStructure(t *testing.T) {
 		{Role: "assistant", Content: "thinking", ResponseID: "prev_123"},
 		{Role: "tool", Content: "tool result", ToolCallID: "call_abc"},
 	}
-	_, err := client.ChatOnce("gpt-4o", msgs, nil)
+	_, err := client.ChatOnce(context.Background(), "gpt-4o", msgs, nil)
 	if err != nil {
 		t.Fatalf("ChatOnce error: %v", err)
 	}
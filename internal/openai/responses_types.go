@@ -2,6 +2,8 @@ package openai
 
 import (
 	"encoding/json"
+
+	"github.com/dave1010/jorin/internal/types"
 )
 
 type responsesRequest struct {
@@ -12,11 +14,26 @@ type responsesRequest struct {
 	ToolChoice         interface{} `json:"tool_choice,omitempty"`
 	Temperature        float32     `json:"temperature,omitempty"`
 	PreviousResponseID string      `json:"previous_response_id,omitempty"`
+	Stream             bool        `json:"stream,omitempty"`
 }
 
 type responsesResponse struct {
 	ID     string                `json:"id"`
 	Output []responsesOutputItem `json:"output"`
+	Usage  *responsesUsage       `json:"usage,omitempty"`
+}
+
+type responsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+func (u *responsesUsage) toUsage() *types.Usage {
+	if u == nil {
+		return nil
+	}
+	return &types.Usage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens, TotalTokens: u.TotalTokens}
 }
 
 type responsesOutputItem struct {
@@ -0,0 +1,266 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dave1010/jorin/internal/sse"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// StreamingLLM is implemented by LLM backends that can stream assistant text
+// as it is generated. onDelta receives each text fragment as it arrives; the
+// returned response is the fully assembled message, including any tool calls
+// rebuilt from their argument deltas.
+type StreamingLLM interface {
+	LLM
+	ChatStream(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool, onDelta func(string)) (*types.ChatResponse, error)
+}
+
+func postStream(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(ctx, "POST", openAIBase()+path, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("API %d: %s", resp.StatusCode, string(b))
+	}
+	return resp, nil
+}
+
+type completionsChunk struct {
+	ID      string       `json:"id"`
+	Usage   *types.Usage `json:"usage"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// toolCallBuilder accumulates a streamed tool call.
+type toolCallBuilder struct {
+	id   string
+	name string
+	args strings.Builder
+}
+
+func buildToolCalls(builders map[int]*toolCallBuilder) []types.ToolCall {
+	if len(builders) == 0 {
+		return nil
+	}
+	idx := make([]int, 0, len(builders))
+	for i := range builders {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	calls := make([]types.ToolCall, 0, len(idx))
+	for _, i := range idx {
+		b := builders[i]
+		args := strings.TrimSpace(b.args.String())
+		if args == "" {
+			args = "{}"
+		}
+		tc := types.ToolCall{ID: b.id, Type: "function"}
+		tc.Function.Name = b.name
+		tc.Function.Args = json.RawMessage(args)
+		calls = append(calls, tc)
+	}
+	return calls
+}
+
+func (o completionsClient) ChatStream(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool, onDelta func(string)) (*types.ChatResponse, error) {
+	body := types.ChatRequest{
+		Model:      model,
+		Messages:   msgs,
+		Tools:      toolsList,
+		ToolChoice: "auto",
+		Stream:     true,
+		// the final chunk then carries token usage
+		StreamOptions: &types.StreamOptions{IncludeUsage: true},
+	}
+	j, _ := json.Marshal(body)
+	resp, err := postStream(ctx, "/v1/chat/completions", j)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var id string
+	var finish string
+	var usage *types.Usage
+	var content strings.Builder
+	calls := map[int]*toolCallBuilder{}
+	err = sse.Read(resp.Body, func(_ string, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk completionsChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decode stream chunk: %w", err)
+		}
+		if chunk.ID != "" {
+			id = chunk.ID
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, ch := range chunk.Choices {
+			if ch.Delta.Content != "" {
+				content.WriteString(ch.Delta.Content)
+				if onDelta != nil {
+					onDelta(ch.Delta.Content)
+				}
+			}
+			for _, tc := range ch.Delta.ToolCalls {
+				b := calls[tc.Index]
+				if b == nil {
+					b = &toolCallBuilder{}
+					calls[tc.Index] = b
+				}
+				if tc.ID != "" {
+					b.id = tc.ID
+				}
+				if tc.Function.Name != "" {
+					b.name = tc.Function.Name
+				}
+				b.args.WriteString(tc.Function.Arguments)
+			}
+			if ch.FinishReason != "" {
+				finish = ch.FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := types.Message{Role: "assistant", Content: content.String(), ToolCalls: buildToolCalls(calls)}
+	return &types.ChatResponse{
+		ID:      id,
+		Choices: []types.Choice{{Message: msg, FinishReason: finish}},
+		Usage:   usage,
+	}, nil
+}
+
+type responsesStreamEvent struct {
+	Type        string              `json:"type"`
+	ItemID      string              `json:"item_id"`
+	OutputIndex int                 `json:"output_index"`
+	Delta       string              `json:"delta"`
+	Item        responsesOutputItem `json:"item"`
+	Response    *responsesResponse  `json:"response"`
+	Message     string              `json:"message"`
+}
+
+func (o responsesClient) ChatStream(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool, onDelta func(string)) (*types.ChatResponse, error) {
+	body := buildResponsesRequest(model, msgs, toolsList)
+	body.Stream = true
+	j, _ := json.Marshal(body)
+	if os.Getenv("DEBUG") == "1" {
+		fmt.Fprintf(os.Stderr, "\n--- DEBUG REQUEST to /v1/responses (stream) ---\n%s\n", string(j))
+	}
+	resp, err := postStream(ctx, "/v1/responses", j)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var completed *responsesResponse
+	var id string
+	var content strings.Builder
+	calls := map[int]*toolCallBuilder{}
+	err = sse.Read(resp.Body, func(event string, data string) error {
+		if os.Getenv("DEBUG") == "1" {
+			fmt.Fprintf(os.Stderr, "--- DEBUG EVENT %s ---\n%s\n", event, data)
+		}
+		var ev responsesStreamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("decode stream event: %w", err)
+		}
+		if ev.Type == "" {
+			ev.Type = event
+		}
+		switch ev.Type {
+		case "response.created":
+			if ev.Response != nil {
+				id = ev.Response.ID
+			}
+		case "response.output_text.delta":
+			content.WriteString(ev.Delta)
+			if onDelta != nil {
+				onDelta(ev.Delta)
+			}
+		case "response.output_item.added":
+			if ev.Item.Type == "function_call" {
+				b := &toolCallBuilder{id: ev.Item.CallID, name: ev.Item.Name}
+				if b.id == "" {
+					b.id = ev.Item.ID
+				}
+				calls[ev.OutputIndex] = b
+			}
+		case "response.function_call_arguments.delta":
+			if b := calls[ev.OutputIndex]; b != nil {
+				b.args.WriteString(ev.Delta)
+			}
+		case "response.completed":
+			completed = ev.Response
+		case "response.failed", "error":
+			msg := ev.Message
+			if msg == "" {
+				msg = data
+			}
+			return errors.New("stream error: " + msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The completed event carries the authoritative output; deltas are only
+	// used when the server omits it.
+	if completed != nil && len(completed.Output) > 0 {
+		return mapResponseToChatResponse(completed), nil
+	}
+	var usage *types.Usage
+	if completed != nil {
+		if completed.ID != "" {
+			id = completed.ID
+		}
+		usage = completed.Usage.toUsage()
+	}
+	msg := types.Message{Role: "assistant", Content: content.String(), ToolCalls: buildToolCalls(calls)}
+	return &types.ChatResponse{
+		ID:      id,
+		Choices: []types.Choice{{Message: msg, FinishReason: "stop"}},
+		Usage:   usage,
+	}, nil
+}
@@ -0,0 +1,152 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func sseServer(t *testing.T, path string, events []string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("expected %s, got %s", path, r.URL.Path)
+		}
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if req["stream"] != true {
+			t.Errorf("expected stream=true, got %v", req["stream"])
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			_, _ = fmt.Fprint(w, ev+"\n\n")
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}))
+}
+
+func TestCompletionsClient_ChatStream(t *testing.T) {
+	srv := sseServer(t, "/v1/chat/completions", []string{
+		`data: {"id":"chatcmpl_1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`data: {"id":"chatcmpl_1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a.txt\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"chatcmpl_1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}`,
+		`data: [DONE]`,
+	})
+	defer srv.Close()
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+
+	var deltas []string
+	resp, err := completionsClient{}.ChatStream(context.Background(), "m", []types.Message{{Role: "user", Content: "hi"}}, nil, func(s string) {
+		deltas = append(deltas, s)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream error: %v", err)
+	}
+	if strings.Join(deltas, "|") != "Hel|lo" {
+		t.Errorf("unexpected deltas: %q", deltas)
+	}
+	msg := resp.Choices[0].Message
+	if msg.Content != "Hello" {
+		t.Errorf("expected content Hello, got %q", msg.Content)
+	}
+	if resp.ID != "chatcmpl_1" || resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("unexpected id/finish: %q %q", resp.ID, resp.Choices[0].FinishReason)
+	}
+	if resp.Usage.Total() != 17 {
+		t.Errorf("expected usage from the final chunk, got %+v", resp.Usage)
+	}
+	if len(msg.ToolCalls) != 1 {
+		t.Fatalf("expected 1 tool call, got %d", len(msg.ToolCalls))
+	}
+	tc := msg.ToolCalls[0]
+	if tc.ID != "call_1" || tc.Function.Name != "read_file" || string(tc.Function.Args) != `{"path":"a.txt"}` {
+		t.Errorf("unexpected tool call: %+v args=%s", tc, tc.Function.Args)
+	}
+}
+
+func TestResponsesClient_ChatStream(t *testing.T) {
+	srv := sseServer(t, "/v1/responses", []string{
+		"event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_9\",\"output\":[]}}",
+		"event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"output_index\":0,\"delta\":\"Look\"}",
+		"event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"output_index\":0,\"delta\":\"ing\"}",
+		"event: response.output_item.added\ndata: {\"type\":\"response.output_item.added\",\"output_index\":1,\"item\":{\"type\":\"function_call\",\"id\":\"fc_1\",\"call_id\":\"call_7\",\"name\":\"shell\"}}",
+		"event: response.function_call_arguments.delta\ndata: {\"type\":\"response.function_call_arguments.delta\",\"output_index\":1,\"delta\":\"{\\\"cmd\\\":\"}",
+		"event: response.function_call_arguments.delta\ndata: {\"type\":\"response.function_call_arguments.delta\",\"output_index\":1,\"delta\":\"\\\"ls\\\"}\"}",
+	})
+	defer srv.Close()
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+
+	var got strings.Builder
+	resp, err := responsesClient{}.ChatStream(context.Background(), "m", []types.Message{{Role: "user", Content: "hi"}}, nil, func(s string) {
+		got.WriteString(s)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream error: %v", err)
+	}
+	if got.String() != "Looking" {
+		t.Errorf("unexpected streamed text: %q", got.String())
+	}
+	if resp.ID != "resp_9" {
+		t.Errorf("expected resp_9, got %q", resp.ID)
+	}
+	msg := resp.Choices[0].Message
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID != "call_7" || string(msg.ToolCalls[0].Function.Args) != `{"cmd":"ls"}` {
+		t.Fatalf("unexpected tool calls: %+v", msg.ToolCalls)
+	}
+}
+
+func TestResponsesClient_ChatStreamUsesCompletedResponse(t *testing.T) {
+	srv := sseServer(t, "/v1/responses", []string{
+		"event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"partial\"}",
+		"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_done\",\"output\":[{\"type\":\"message\",\"content\":[{\"type\":\"output_text\",\"text\":\"final text\"}]}]}}",
+	})
+	defer srv.Close()
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+
+	resp, err := responsesClient{}.ChatStream(context.Background(), "m", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ChatStream error: %v", err)
+	}
+	if resp.ID != "resp_done" || resp.Choices[0].Message.Content != "final text" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestChatSessionStreamWritesDeltas(t *testing.T) {
+	srv := sseServer(t, "/v1/chat/completions", []string{
+		`data: {"choices":[{"index":0,"delta":{"content":"streamed "}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"content":"answer"},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	})
+	defer srv.Close()
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+
+	var out bytes.Buffer
+	msgs, final, err := chatSessionWithLLM(context.Background(), completionsClient{}, "m", []types.Message{{Role: "user", Content: "hi"}}, &types.Policy{}, &out)
+	if err != nil {
+		t.Fatalf("chat session error: %v", err)
+	}
+	if final != "streamed answer" {
+		t.Errorf("unexpected final output: %q", final)
+	}
+	if out.String() != "streamed answer\n" {
+		t.Errorf("unexpected streamed output: %q", out.String())
+	}
+	if len(msgs) != 2 || msgs[1].Content != "streamed answer" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+}
@@ -0,0 +1,179 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dave1010/jorin/internal/tools"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+const (
+	// maxAgentDepth is how deeply sub-agents may nest. The top-level session
+	// is depth 0.
+	maxAgentDepth = 2
+	// maxConcurrentAgents bounds sibling sub-agents of one session running
+	// at once.
+	maxConcurrentAgents = 4
+	// defaultAgentTurns is the turn budget of a sub-agent that sets none.
+	defaultAgentTurns = 30
+)
+
+var (
+	errTurnBudget  = errors.New("turn budget exhausted")
+	errTokenBudget = errors.New("token budget exhausted")
+)
+
+const subAgentInstructions = `
+
+You are a sub-agent working on a single task for a parent agent. Work autonomously with the tools available; nobody will answer questions. Only your final message is returned to the parent, so end with a concise summary of what you found or changed (file paths, commands, results) and anything left unresolved.`
+
+var spawnAgentTool = types.Tool{Type: "function", Function: types.ToolFunction{
+	Name: "spawn_agent",
+	Description: "Delegate a self-contained task to a sub-agent with its own conversation and return only its final summary. " +
+		"Use it for exploration or work that would otherwise fill this conversation with intermediate output. " +
+		"The sub-agent gets the same tools under this session's policy, optionally narrowed further. " +
+		"Several spawn_agent calls in one turn run concurrently.",
+	Parameters: json.RawMessage(`{"type":"object","properties":{
+		"task":{"type":"string","description":"Complete description of the task, including any context the sub-agent needs"},
+		"readonly":{"type":"boolean","description":"Forbid file writes"},
+		"dry_shell":{"type":"boolean","description":"Report shell commands instead of running them"},
+		"allow":{"type":"array","items":{"type":"string"},"description":"Shell allow rules such as \"go test\"; each must be covered by a current allow rule"},
+		"deny":{"type":"array","items":{"type":"string"},"description":"Additional shell deny rules such as \"git push\""},
+		"cwd":{"type":"string","description":"Working directory inside the current one; file tools are confined to it"},
+		"max_turns":{"type":"integer","description":"Maximum model requests (default 30)"},
+		"max_tokens":{"type":"integer","description":"Maximum total tokens across the sub-agent's requests"}
+	},"required":["task"]}`),
+}}
+
+type agentDepthKey struct{}
+
+func agentDepth(ctx context.Context) int {
+	d, _ := ctx.Value(agentDepthKey{}).(int)
+	return d
+}
+
+// systemPrompt returns the system message of msgs, if any.
+func systemPrompt(msgs []types.Message) string {
+	if len(msgs) > 0 && msgs[0].Role == "system" {
+		return msgs[0].Content
+	}
+	return ""
+}
+
+// spawnAgentExec returns the spawn_agent executor for a session using llm
+// and model. Sub-agents start from the parent's system prompt with their
+// own empty history.
+func spawnAgentExec(llm LLM, model string, sys string) tools.ToolExec {
+	// Slots are per session: a sub-agent waiting for its own children
+	// must not hold a slot they need.
+	slots := make(chan struct{}, maxConcurrentAgents)
+	return func(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+		task, _ := args["task"].(string)
+		if strings.TrimSpace(task) == "" {
+			return nil, errors.New("missing task")
+		}
+		parent := types.Policy{}
+		if p != nil {
+			parent = *p
+		}
+		req := types.Policy{
+			Readonly: boolArg(args, "readonly"),
+			DryShell: boolArg(args, "dry_shell"),
+			Allow:    stringsArg(args, "allow"),
+			Deny:     stringsArg(args, "deny"),
+		}
+		req.CWD, _ = args["cwd"].(string)
+		child, err := parent.Narrow(req)
+		if err != nil {
+			return map[string]any{"error": "policy: " + err.Error()}, nil
+		}
+		b := budget{turns: intArg(args, "max_turns"), tokens: intArg(args, "max_tokens")}
+		if b.turns <= 0 {
+			b.turns = defaultAgentTurns
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return map[string]any{"error": tools.CancelReason(ctx.Err())}, nil
+		}
+
+		if child.Shell != nil {
+			// the parent's cd, exports and functions must not reach the
+			// sub-agent, nor the sub-agent's the parent's, and its shell
+			// must start in its own cwd
+			sh := child.Shell.New()
+			defer sh.Close()
+			child.Shell = sh
+		}
+
+		ctx = context.WithValue(ctx, agentDepthKey{}, agentDepth(ctx)+1)
+		msgs := []types.Message{
+			{Role: "system", Content: sys + subAgentInstructions},
+			{Role: "user", Content: task},
+		}
+		msgs, summary, used, err := runSession(ctx, llm, model, msgs, &child, nil, b)
+		res := map[string]any{"turns": used.turns, "tokens": used.tokens}
+		if err != nil {
+			res["error"] = err.Error()
+			if ctx.Err() != nil {
+				res["error"] = tools.CancelReason(ctx.Err())
+			}
+			if partial := lastAssistantText(msgs); partial != "" {
+				res["partial"] = partial
+			}
+			return res, nil
+		}
+		res["summary"] = summary
+		return res, nil
+	}
+}
+
+func lastAssistantText(msgs []types.Message) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "assistant" && strings.TrimSpace(msgs[i].Content) != "" {
+			return msgs[i].Content
+		}
+	}
+	return ""
+}
+
+func boolArg(args map[string]any, key string) bool {
+	b, _ := args[key].(bool)
+	return b
+}
+
+func intArg(args map[string]any, key string) int {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+func stringsArg(args map[string]any, key string) []string {
+	list, _ := args[key].([]any)
+	var out []string
+	for _, v := range list {
+		if s, ok := v.(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// agentPrefix indents tool previews from sub-agents by their depth.
+func agentPrefix(ctx context.Context) string {
+	d := agentDepth(ctx)
+	if d == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s[sub-agent %d] ", strings.Repeat("  ", d), d)
+}
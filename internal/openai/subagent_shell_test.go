@@ -0,0 +1,52 @@
+//go:build !windows
+
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/shell"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestSpawnAgentGetsItsOwnShellSession(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sess := shell.NewSession(&shell.LocalRunner{})
+	defer sess.Close()
+	ctx := context.Background()
+	if _, err := sess.Run(ctx, "export WHO=parent", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var childOut string
+	llm := &scriptedLLM{respond: func(msgs []types.Message) types.Message {
+		if len(msgs) == 2 {
+			tc := types.ToolCall{ID: "s", Type: "function"}
+			tc.Function.Name = "shell"
+			tc.Function.Args = json.RawMessage(`{"cmd":"echo \"[$WHO]\"; pwd; export WHO=child"}`)
+			return types.Message{ToolCalls: []types.ToolCall{tc}}
+		}
+		childOut = msgs[len(msgs)-1].Content
+		return types.Message{Content: "done"}
+	}}
+	exec := spawnAgentExec(llm, "m", "sys")
+	out, _ := exec(ctx, map[string]any{"task": "t", "cwd": "sub"}, &types.Policy{CWD: dir, Shell: sess})
+	if out["summary"] != "done" {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+	if want := `[]\n` + filepath.Join(dir, "sub") + `\n`; !strings.Contains(childOut, want) {
+		t.Fatalf("the sub-agent's shell should start fresh in its cwd, got %s", childOut)
+	}
+	res, err := sess.Run(ctx, "echo $WHO", dir)
+	if err != nil || res.Stdout != "parent\n" {
+		t.Fatalf("the sub-agent changed the parent's shell: %+v %v", res, err)
+	}
+}
@@ -0,0 +1,137 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// scriptedLLM answers parent and sub-agent requests with respond and
+// records every request it sees.
+type scriptedLLM struct {
+	mu       sync.Mutex
+	requests [][]types.Message
+	tools    [][]types.Tool
+	respond  func(msgs []types.Message) types.Message
+}
+
+func (s *scriptedLLM) ChatOnce(ctx context.Context, model string, msgs []types.Message, toolsList []types.Tool) (*types.ChatResponse, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, append([]types.Message(nil), msgs...))
+	s.tools = append(s.tools, toolsList)
+	s.mu.Unlock()
+	msg := s.respond(msgs)
+	msg.Role = "assistant"
+	return &types.ChatResponse{Choices: []types.Choice{{Message: msg}}, Usage: &types.Usage{TotalTokens: 100}}, nil
+}
+
+func isSubAgent(msgs []types.Message) bool {
+	return strings.Contains(systemPrompt(msgs), "You are a sub-agent")
+}
+
+func spawnCall(id string, args string) types.ToolCall {
+	tc := types.ToolCall{ID: id, Type: "function"}
+	tc.Function.Name = "spawn_agent"
+	tc.Function.Args = json.RawMessage(args)
+	return tc
+}
+
+func TestSpawnAgentRunsSiblingsConcurrentlyWithOwnHistory(t *testing.T) {
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	both := make(chan struct{})
+	go func() { arrived.Wait(); close(both) }()
+
+	llm := &scriptedLLM{respond: func(msgs []types.Message) types.Message {
+		last := msgs[len(msgs)-1]
+		switch {
+		case isSubAgent(msgs):
+			// each child waits until its sibling is running too
+			arrived.Done()
+			select {
+			case <-both:
+			case <-time.After(5 * time.Second):
+				return types.Message{Content: "sibling never started"}
+			}
+			return types.Message{Content: "summary of " + last.Content}
+		case last.Role == "user":
+			return types.Message{ToolCalls: []types.ToolCall{
+				spawnCall("c1", `{"task":"explore a"}`),
+				spawnCall("c2", `{"task":"explore b","readonly":true}`),
+			}}
+		default:
+			return types.Message{Content: "done"}
+		}
+	}}
+
+	msgs := []types.Message{{Role: "system", Content: "sys"}, {Role: "user", Content: "refactor"}}
+	out, final, err := chatSessionWithLLM(context.Background(), llm, "m", msgs, &types.Policy{}, nil)
+	if err != nil || final != "done" {
+		t.Fatalf("unexpected result %q %v", final, err)
+	}
+	if len(out) != 6 {
+		t.Fatalf("parent history should hold only the tool results, got %d messages: %+v", len(out), out)
+	}
+	for i, want := range []string{"summary of explore a", "summary of explore b"} {
+		var res map[string]any
+		if err := json.Unmarshal([]byte(out[3+i].Content), &res); err != nil || res["summary"] != want {
+			t.Fatalf("unexpected result for child %d: %s", i, out[3+i].Content)
+		}
+	}
+	for _, req := range llm.requests {
+		if isSubAgent(req) && (len(req) != 2 || !strings.HasPrefix(req[0].Content, "sys")) {
+			t.Fatalf("child should start from the parent system prompt with a fresh history: %+v", req)
+		}
+	}
+}
+
+func TestSpawnAgentBudgetsAndPolicy(t *testing.T) {
+	llm := &scriptedLLM{respond: func(msgs []types.Message) types.Message {
+		if isSubAgent(msgs) {
+			// never finishes on its own
+			tc := types.ToolCall{ID: "x", Type: "function"}
+			tc.Function.Name = "read_file"
+			tc.Function.Args = json.RawMessage(`{"path":"/nonexistent"}`)
+			return types.Message{Content: "still looking", ToolCalls: []types.ToolCall{tc}}
+		}
+		return types.Message{Content: "n/a"}
+	}}
+	exec := spawnAgentExec(llm, "m", "sys")
+	parent := &types.Policy{Allow: []string{"go "}, Deny: []string{"rm"}}
+
+	out, _ := exec(context.Background(), map[string]any{"task": "t", "max_turns": float64(2)}, parent)
+	if out["error"] != errTurnBudget.Error() || out["turns"] != 2 || out["partial"] != "still looking" {
+		t.Fatalf("unexpected turn budget result: %#v", out)
+	}
+	out, _ = exec(context.Background(), map[string]any{"task": "t", "max_tokens": float64(150)}, parent)
+	if out["error"] != errTokenBudget.Error() || out["tokens"] != 200 {
+		t.Fatalf("unexpected token budget result: %#v", out)
+	}
+
+	out, _ = exec(context.Background(), map[string]any{"task": "t", "allow": []any{"curl"}}, parent)
+	if e, _ := out["error"].(string); !strings.HasPrefix(e, "policy:") {
+		t.Fatalf("a wider allow list must be refused, got %#v", out)
+	}
+	out, _ = exec(context.Background(), map[string]any{"task": "t", "cwd": "../.."}, parent)
+	if e, _ := out["error"].(string); !strings.HasPrefix(e, "policy:") {
+		t.Fatalf("a cwd outside the parent's must be refused, got %#v", out)
+	}
+}
+
+func TestSpawnAgentDepthIsLimited(t *testing.T) {
+	llm := &scriptedLLM{respond: func(msgs []types.Message) types.Message { return types.Message{Content: "ok"} }}
+	ctx := context.WithValue(context.Background(), agentDepthKey{}, maxAgentDepth)
+	if _, _, _, err := runSession(ctx, llm, "m", []types.Message{{Role: "user", Content: "x"}}, &types.Policy{}, nil, budget{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tl := range llm.tools[0] {
+		if tl.Function.Name == "spawn_agent" {
+			t.Fatalf("spawn_agent offered beyond the depth limit")
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/dave1010/jorin/internal/tools"
 	"github.com/dave1010/jorin/internal/types"
@@ -12,24 +14,54 @@ import (
 
 const colorReset = "\x1b[0m"
 
-func handleToolCalls(calls []types.ToolCall, reg map[string]tools.ToolExec, pol *types.Policy) []types.Message {
-	toolMsgs := make([]types.Message, 0, len(calls))
-	for _, tc := range calls {
+// handleToolCalls runs each tool call and returns one tool message per call.
+// spawn_agent calls run concurrently with each other and with the remaining
+// calls; results keep the order of calls. Once ctx is cancelled the remaining
+// calls are answered with a cancellation error so the conversation stays
+// valid for the next request.
+func handleToolCalls(ctx context.Context, calls []types.ToolCall, reg map[string]tools.ToolExec, pol *types.Policy) []types.Message {
+	toolMsgs := make([]types.Message, len(calls))
+	var wg sync.WaitGroup
+	for i, tc := range calls {
+		if ctx.Err() != nil {
+			toolMsgs[i] = toolErrorMessage(tc, "cancelled")
+			continue
+		}
 		parsedArgs, parsed := parseToolArgs(tc)
 		preview := buildToolPreview(tc, parsedArgs, parsed)
-		emitToolPreview(tc.Function.Name, preview)
+		emitToolPreview(tc.Function.Name, agentPrefix(ctx)+preview)
 
+		if pol.ToolDisabled(tc.Function.Name) {
+			toolMsgs[i] = toolErrorMessage(tc, "tool disabled by policy")
+			continue
+		}
 		fn := reg[tc.Function.Name]
 		if fn == nil {
-			toolMsgs = append(toolMsgs, toolErrorMessage(tc, "unknown tool"))
+			toolMsgs[i] = toolErrorMessage(tc, "unknown tool")
 			continue
 		}
 		if !parsed && parsedArgs == nil {
 			parsedArgs = map[string]any{}
 		}
-		out, _ := fn(parsedArgs, pol)
-		toolMsgs = append(toolMsgs, toolOutputMessage(tc, out))
+		if tc.Function.Name == "spawn_agent" {
+			// a sub-agent's own tool calls are bounded by the tool timeout,
+			// not the sub-agent as a whole
+			wg.Add(1)
+			go func(i int, tc types.ToolCall, args map[string]any) {
+				defer wg.Done()
+				out, err := fn(ctx, args, pol)
+				if err != nil {
+					toolMsgs[i] = toolErrorMessage(tc, err.Error())
+					return
+				}
+				toolMsgs[i] = toolOutputMessage(tc, out)
+			}(i, tc, parsedArgs)
+			continue
+		}
+		out, _ := fn(ctx, parsedArgs, pol)
+		toolMsgs[i] = toolOutputMessage(tc, out)
 	}
+	wg.Wait()
 	return toolMsgs
 }
 
@@ -50,13 +82,13 @@ func parseToolArgs(tc types.ToolCall) (map[string]any, bool) {
 
 func fallbackToolArgs(name string, inner string) (map[string]any, bool) {
 	switch name {
-	case "shell":
+	case "shell", "process_start":
 		return map[string]any{"cmd": inner}, true
 	case "read_file":
 		return map[string]any{"path": inner}, true
 	case "write_file":
 		return map[string]any{"path": inner, "text": ""}, true
-	case "http_get":
+	case "http_get", "http_request":
 		return map[string]any{"url": inner}, true
 	default:
 		return nil, false
@@ -75,12 +107,23 @@ func previewFromParsedArgs(name string, args map[string]any, raw string) string
 	switch name {
 	case "shell":
 		return "$ " + tools.Preview(stringFromArg(args, "cmd", raw), 200)
+	case "process_start":
+		return "$ " + tools.Preview(stringFromArg(args, "cmd", raw), 200) + " &"
 	case "read_file":
 		return "📄 " + stringFromArg(args, "path", tools.Preview(raw, 200))
-	case "write_file":
+	case "write_file", "edit_file":
 		return "✏️ " + stringFromArg(args, "path", tools.Preview(raw, 200))
+	case "list_dir":
+		return "📁 " + stringFromArg(args, "path", ".")
+	case "glob", "search":
+		return "🔍 " + tools.Preview(stringFromArg(args, "pattern", raw), 200)
 	case "http_get":
 		return "🌐 " + stringFromArg(args, "url", tools.Preview(raw, 200))
+	case "http_request":
+		method := strings.ToUpper(stringFromArg(args, "method", "GET"))
+		return "🌐 " + method + " " + stringFromArg(args, "url", tools.Preview(raw, 200))
+	case "spawn_agent":
+		return "🤖 " + tools.Preview(stringFromArg(args, "task", raw), 200)
 	default:
 		return name + " " + tools.Preview(raw, 200)
 	}
@@ -97,11 +140,13 @@ func previewFromRawArgs(name string, raw string) string {
 	switch name {
 	case "shell":
 		return "$ " + tools.Preview(raw, 200)
+	case "process_start":
+		return "$ " + tools.Preview(raw, 200) + " &"
 	case "read_file":
 		return "📄 " + tools.Preview(raw, 200)
-	case "write_file":
+	case "write_file", "edit_file":
 		return "✏️ " + tools.Preview(raw, 200)
-	case "http_get":
+	case "http_get", "http_request":
 		return "🌐 " + tools.Preview(raw, 200)
 	default:
 		return name + " " + tools.Preview(raw, 200)
@@ -130,11 +175,11 @@ func shouldColorizeOutput() bool {
 
 func toolColor(name string) string {
 	switch name {
-	case "shell":
+	case "shell", "process_start":
 		return "\x1b[32m"
 	case "read_file":
 		return "\x1b[33m"
-	case "write_file":
+	case "write_file", "edit_file":
 		return "\x1b[38;5;208m"
 	default:
 		return "\x1b[36m"
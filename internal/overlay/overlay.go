@@ -0,0 +1,541 @@
+// Package overlay keeps the file changes of a run out of the workspace.
+// Files the tools write go to a copy-on-write layer in a temporary
+// directory, and reads see that layer over the real tree. Shell commands
+// cannot be redirected file by file, so the first one turns the layer into
+// a scratch copy of the workspace for them to run in. At the end the
+// changes are shown as a diff and reach the real tree only when applied.
+package overlay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/dave1010/jorin/internal/diff"
+)
+
+// gitDir is never copied back: shell commands in the scratch copy change it
+// all the time, and the tools may not write it by default.
+const gitDir = ".git"
+
+// FS is an overlay over a workspace root. It implements types.FileSystem
+// and is safe for concurrent use.
+type FS struct {
+	root string // the resolved workspace root
+	dir  string // the temporary directory holding the layer
+
+	mu sync.Mutex
+	// deleted holds the root's files removed in the layer, by path
+	// relative to root.
+	deleted map[string]bool
+	// copied is set once the workspace was copied to work for the shell;
+	// from then on work holds every file and the layer is unused.
+	copied bool
+}
+
+// File is a file's content and mode, or its absence.
+type File struct {
+	Exists bool
+	Data   []byte
+	// Mode holds the permission bits, or fs.ModeSymlink for a symbolic link
+	// whose target is Data.
+	Mode fs.FileMode
+}
+
+// Change is a file that differs between the overlay and the root.
+type Change struct {
+	// Path is slash-separated and relative to the root.
+	Path string
+	Old  File
+	New  File
+}
+
+// New returns an empty overlay over root.
+func New(root string) (*FS, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "jorin-overlay-")
+	if err != nil {
+		return nil, err
+	}
+	return &FS{root: root, dir: dir, deleted: map[string]bool{}}, nil
+}
+
+// Root returns the directory the overlay covers.
+func (o *FS) Root() string { return o.root }
+
+// Dir returns the temporary directory the overlay keeps its files in.
+func (o *FS) Dir() string { return o.dir }
+
+// Close removes the overlay's files.
+func (o *FS) Close() error { return os.RemoveAll(o.dir) }
+
+func (o *FS) upper() string { return filepath.Join(o.dir, "upper") }
+func (o *FS) work() string  { return filepath.Join(o.dir, "work") }
+
+// rel returns path relative to the root.
+func (o *FS) rel(path string) (string, error) {
+	rel, err := filepath.Rel(o.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the overlay root %s", path, o.root)
+	}
+	return rel, nil
+}
+
+// lookup returns where the content of path is: in the scratch copy, the
+// layer or the root.
+func (o *FS) lookup(path string) (string, error) {
+	rel, err := o.rel(path)
+	if err != nil {
+		return "", err
+	}
+	if o.copied {
+		return filepath.Join(o.work(), rel), nil
+	}
+	if o.deleted[rel] {
+		return "", &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	if up := filepath.Join(o.upper(), rel); exists(up) {
+		return up, nil
+	}
+	return path, nil
+}
+
+// ReadFile reads the overlay's version of the file at path.
+func (o *FS) ReadFile(path string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	return data, renameErr(err, path)
+}
+
+// Stat describes the overlay's version of the file at path.
+func (o *FS) Stat(path string) (fs.FileInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	return info, renameErr(err, path)
+}
+
+// ReadDir lists the overlay's version of the directory at path, sorted by
+// name.
+func (o *FS) ReadDir(path string) ([]fs.DirEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rel, err := o.rel(path)
+	if err != nil {
+		return nil, err
+	}
+	if o.copied {
+		ents, err := os.ReadDir(filepath.Join(o.work(), rel))
+		return ents, renameErr(err, path)
+	}
+	byName := map[string]fs.DirEntry{}
+	ents, rootErr := os.ReadDir(path)
+	for _, e := range ents {
+		if !o.deleted[filepath.Join(rel, e.Name())] {
+			byName[e.Name()] = e
+		}
+	}
+	ents, upperErr := os.ReadDir(filepath.Join(o.upper(), rel))
+	if rootErr != nil && upperErr != nil {
+		return nil, rootErr
+	}
+	for _, e := range ents {
+		byName[e.Name()] = e
+	}
+	out := make([]fs.DirEntry, 0, len(byName))
+	for _, e := range byName {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// WriteFile writes the file at path in the overlay.
+func (o *FS) WriteFile(path string, data []byte, mode fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rel, err := o.rel(path)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(o.upper(), rel)
+	if o.copied {
+		target = filepath.Join(o.work(), rel)
+	}
+	if err := writeFile(target, data, mode); err != nil {
+		return renameErr(err, path)
+	}
+	delete(o.deleted, rel)
+	return nil
+}
+
+// Remove removes the file at path from the overlay.
+func (o *FS) Remove(path string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rel, err := o.rel(path)
+	if err != nil {
+		return err
+	}
+	if o.copied {
+		return renameErr(os.Remove(filepath.Join(o.work(), rel)), path)
+	}
+	up := filepath.Join(o.upper(), rel)
+	inUpper, inRoot := exists(up), !o.deleted[rel] && exists(path)
+	if !inUpper && !inRoot {
+		return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrNotExist}
+	}
+	if inUpper {
+		if err := os.Remove(up); err != nil {
+			return renameErr(err, path)
+		}
+	}
+	if exists(path) {
+		o.deleted[rel] = true
+	}
+	return nil
+}
+
+// ShellDir returns the directory in the scratch copy that stands for dir,
+// or for the process directory when dir is empty. The first call copies
+// the workspace, with the overlay's changes, into the overlay.
+func (o *FS) ShellDir(dir string) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		dir = wd
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	rel, err := o.rel(dir)
+	if err != nil {
+		return "", err
+	}
+	if !o.copied {
+		if err := o.copyWorkspace(); err != nil {
+			_ = os.RemoveAll(o.work())
+			return "", fmt.Errorf("copying the workspace for the shell: %w", err)
+		}
+	}
+	return filepath.Join(o.work(), rel), nil
+}
+
+func (o *FS) copyWorkspace() error {
+	skip := func(rel string) bool { return o.deleted[rel] }
+	if err := copyTree(o.root, o.work(), skip); err != nil {
+		return err
+	}
+	if exists(o.upper()) {
+		if err := copyTree(o.upper(), o.work(), nil); err != nil {
+			return err
+		}
+	}
+	o.copied = true
+	o.deleted = map[string]bool{}
+	return os.RemoveAll(o.upper())
+}
+
+// Changes returns the files that differ between the overlay and the root,
+// sorted by path. Symbolic links count as files; directories and anything
+// under .git are left out.
+func (o *FS) Changes() ([]Change, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var changes []Change
+	add := func(rel string, newFile File) error {
+		oldFile, err := readFile(filepath.Join(o.root, rel))
+		if err != nil {
+			return err
+		}
+		if !same(oldFile, newFile) {
+			changes = append(changes, Change{Path: filepath.ToSlash(rel), Old: oldFile, New: newFile})
+		}
+		return nil
+	}
+
+	top := o.upper()
+	if o.copied {
+		top = o.work()
+	}
+	err := walkFiles(top, func(rel string) error {
+		f, err := readFile(filepath.Join(top, rel))
+		if err != nil {
+			return err
+		}
+		return add(rel, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if o.copied {
+		// files the shell removed
+		err = walkFiles(o.root, func(rel string) error {
+			f, err := readFile(filepath.Join(top, rel))
+			if err != nil || f.Exists {
+				return err
+			}
+			return add(rel, File{})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for rel := range o.deleted {
+		if err := add(rel, File{}); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// Apply writes changes to the root. save, if set, is called with the
+// paths about to change before any is written, so the apply can be undone.
+func (o *FS) Apply(changes []Change, save func(paths ...string) error) error {
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = filepath.Join(o.root, filepath.FromSlash(c.Path))
+	}
+	if save != nil {
+		if err := save(paths...); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+	for i, c := range changes {
+		path := paths[i]
+		var err error
+		switch {
+		case !c.New.Exists:
+			if err = os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		case c.New.Mode&fs.ModeSymlink != 0:
+			if err = os.Remove(path); err == nil || errors.Is(err, fs.ErrNotExist) {
+				if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+					err = os.Symlink(string(c.New.Data), path)
+				}
+			}
+		default:
+			err = writeFile(path, c.New.Data, c.New.Mode.Perm())
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Path, err)
+		}
+	}
+	return nil
+}
+
+// Diff returns changes as a git-style unified diff, which git apply and
+// the apply_patch tool accept.
+func Diff(changes []Change) string {
+	var b strings.Builder
+	for _, c := range changes {
+		oldName, newName := "a/"+c.Path, "b/"+c.Path
+		fmt.Fprintf(&b, "diff --git %s %s\n", oldName, newName)
+		switch {
+		case !c.Old.Exists:
+			fmt.Fprintf(&b, "new file mode %06o\n", gitMode(c.New.Mode))
+			oldName = "/dev/null"
+		case !c.New.Exists:
+			fmt.Fprintf(&b, "deleted file mode %06o\n", gitMode(c.Old.Mode))
+			newName = "/dev/null"
+		case gitMode(c.Old.Mode) != gitMode(c.New.Mode):
+			fmt.Fprintf(&b, "old mode %06o\nnew mode %06o\n", gitMode(c.Old.Mode), gitMode(c.New.Mode))
+		}
+		if bytes.IndexByte(c.Old.Data, 0) >= 0 || bytes.IndexByte(c.New.Data, 0) >= 0 {
+			fmt.Fprintf(&b, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		b.WriteString(diff.Unified(oldName, newName, string(c.Old.Data), string(c.New.Data)))
+	}
+	return b.String()
+}
+
+// gitMode returns the mode git records for a file of mode m.
+func gitMode(m fs.FileMode) fs.FileMode {
+	switch {
+	case m&fs.ModeSymlink != 0:
+		return 0o120000
+	case m&0o111 != 0:
+		return 0o100755
+	}
+	return 0o100644
+}
+
+func same(a, b File) bool {
+	if a.Exists != b.Exists {
+		return false
+	}
+	return !a.Exists || gitMode(a.Mode) == gitMode(b.Mode) && bytes.Equal(a.Data, b.Data)
+}
+
+// readFile returns the file at path. Directories and special files count
+// as no file.
+func readFile(path string) (File, error) {
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR):
+		// ENOTDIR: a file in place of one of path's directories
+		return File{}, nil
+	case err != nil:
+		return File{}, err
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		return File{Exists: true, Data: []byte(target), Mode: fs.ModeSymlink}, err
+	case !info.Mode().IsRegular():
+		return File{}, nil
+	}
+	data, err := os.ReadFile(path)
+	return File{Exists: true, Data: data, Mode: info.Mode().Perm()}, err
+}
+
+// walkFiles calls fn with the path relative to top of each file and
+// symbolic link under top, except in top's .git directory.
+func walkFiles(top string, fn func(rel string) error) error {
+	return filepath.WalkDir(top, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == top && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, _ := filepath.Rel(top, path)
+		if d.IsDir() {
+			if rel == gitDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(rel)
+	})
+}
+
+// copyTree copies the directories, files and symbolic links under src to
+// dst, replacing files that exist, except the paths relative to src that
+// skip reports.
+func copyTree(src, dst string, skip func(rel string) bool) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		if skip != nil && skip(rel) {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(dst, mode)
+	}
+	return err
+}
+
+// writeFile writes data to a temporary file that replaces path, so
+// readers never see half a file.
+func writeFile(path string, data []byte, mode fs.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// renameErr reports a file error under path, the name the caller used,
+// rather than the overlay's own file.
+func renameErr(err error, path string) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: pe.Op, Path: path, Err: pe.Err}
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package overlay
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func write(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "<none>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// newOverlay returns an overlay over a workspace holding keep.txt,
+// edit.txt and gone.txt, and the workspace's path.
+func newOverlay(t *testing.T) (*FS, string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(root, "keep.txt"), "keep\n")
+	write(t, filepath.Join(root, "edit.txt"), "one\ntwo\n")
+	write(t, filepath.Join(root, "gone.txt"), "gone\n")
+	write(t, filepath.Join(root, ".git", "HEAD"), "ref: refs/heads/main\n")
+	o, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = o.Close() })
+	return o, root
+}
+
+func TestCopyOnWrite(t *testing.T) {
+	o, root := newOverlay(t)
+	edit, gone, added := filepath.Join(root, "edit.txt"), filepath.Join(root, "gone.txt"), filepath.Join(root, "dir", "new.txt")
+	if err := o.WriteFile(edit, []byte("one\nTWO\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.WriteFile(added, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	// the overlay sees the changes, the workspace does not
+	if b, err := o.ReadFile(edit); err != nil || string(b) != "one\nTWO\n" {
+		t.Fatalf("ReadFile(edit.txt) = %q, %v", b, err)
+	}
+	if b, err := o.ReadFile(filepath.Join(root, "keep.txt")); err != nil || string(b) != "keep\n" {
+		t.Fatalf("ReadFile(keep.txt) = %q, %v", b, err)
+	}
+	if _, err := o.Stat(gone); !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), gone) {
+		t.Fatalf("Stat(gone.txt) error = %v, want not found under its own name", err)
+	}
+	if err := o.Remove(gone); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("removing gone.txt twice: %v", err)
+	}
+	if got := read(t, edit) + read(t, added) + read(t, gone); got != "one\ntwo\n<none>gone\n" {
+		t.Fatalf("the workspace changed: %q", got)
+	}
+	if _, err := o.ReadFile(filepath.Join(filepath.Dir(root), "outside.txt")); err == nil || !strings.Contains(err.Error(), "outside the overlay root") {
+		t.Fatalf("expected a path outside the root to be refused, got %v", err)
+	}
+
+	// writing a removed file brings it back
+	if err := o.WriteFile(gone, []byte("back\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := o.ReadFile(gone); err != nil || string(b) != "back\n" {
+		t.Fatalf("ReadFile(gone.txt) = %q, %v", b, err)
+	}
+}
+
+func TestChangesDiffAndApply(t *testing.T) {
+	o, root := newOverlay(t)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(o.WriteFile(filepath.Join(root, "edit.txt"), []byte("one\nTWO\n"), 0o644))
+	must(o.WriteFile(filepath.Join(root, "keep.txt"), []byte("keep\n"), 0o644)) // unchanged
+	must(o.WriteFile(filepath.Join(root, "dir", "new.txt"), []byte("new"), 0o755))
+	must(o.Remove(filepath.Join(root, "gone.txt")))
+
+	changes, err := o.Changes()
+	must(err)
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	if got := strings.Join(paths, " "); got != "dir/new.txt edit.txt gone.txt" {
+		t.Fatalf("changed paths = %q", got)
+	}
+	want := `diff --git a/dir/new.txt b/dir/new.txt
+new file mode 100755
+--- /dev/null
++++ b/dir/new.txt
+@@ -0,0 +1 @@
++new
+\ No newline at end of file
+diff --git a/edit.txt b/edit.txt
+--- a/edit.txt
++++ b/edit.txt
+@@ -1,2 +1,2 @@
+ one
+-two
++TWO
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+`
+	if got := Diff(changes); got != want {
+		t.Fatalf("Diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	var saved []string
+	must(o.Apply(changes, func(paths ...string) error {
+		saved = append(saved, paths...)
+		return nil
+	}))
+	if len(saved) != 3 || saved[0] != filepath.Join(root, "dir", "new.txt") {
+		t.Fatalf("save got %v", saved)
+	}
+	got := read(t, filepath.Join(root, "edit.txt")) + read(t, filepath.Join(root, "dir", "new.txt")) + read(t, filepath.Join(root, "gone.txt"))
+	if got != "one\nTWO\nnew<none>" {
+		t.Fatalf("workspace after Apply: %q", got)
+	}
+	if info, err := os.Stat(filepath.Join(root, "dir", "new.txt")); err != nil || info.Mode().Perm() != 0o755 {
+		t.Fatalf("new.txt mode: %v, %v", info, err)
+	}
+	if changes, err := o.Changes(); err != nil || len(changes) != 0 {
+		t.Fatalf("after Apply Changes() = %v, %v", changes, err)
+	}
+}
+
+func TestShellDirCopiesTheWorkspace(t *testing.T) {
+	o, root := newOverlay(t)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(o.WriteFile(filepath.Join(root, "edit.txt"), []byte("edited\n"), 0o644))
+	must(o.Remove(filepath.Join(root, "gone.txt")))
+	must(os.Mkdir(filepath.Join(root, "sub"), 0o755))
+
+	dir, err := o.ShellDir(filepath.Join(root, "sub"))
+	must(err)
+	if !strings.HasPrefix(dir, o.Dir()) || filepath.Base(dir) != "sub" {
+		t.Fatalf("ShellDir = %s, want sub in the scratch copy under %s", dir, o.Dir())
+	}
+	work := filepath.Dir(dir)
+	// the copy holds the overlay's view, including .git
+	if got := read(t, filepath.Join(work, "edit.txt")) + read(t, filepath.Join(work, "gone.txt")) + read(t, filepath.Join(work, ".git", "HEAD")); got != "edited\n<none>ref: refs/heads/main\n" {
+		t.Fatalf("scratch copy: %q", got)
+	}
+
+	// what commands do in the copy shows up as changes, except in .git
+	write(t, filepath.Join(work, "built.txt"), "out\n")
+	must(os.Remove(filepath.Join(work, "keep.txt")))
+	write(t, filepath.Join(work, ".git", "HEAD"), "ref: refs/heads/other\n")
+	must(o.WriteFile(filepath.Join(root, "sub", "tool.txt"), []byte("tool\n"), 0o644))
+	if b, err := os.ReadFile(filepath.Join(dir, "tool.txt")); err != nil || string(b) != "tool\n" {
+		t.Fatalf("tool writes after the copy must land in it: %q, %v", b, err)
+	}
+
+	changes, err := o.Changes()
+	must(err)
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	if got := strings.Join(paths, " "); got != "built.txt edit.txt gone.txt keep.txt sub/tool.txt" {
+		t.Fatalf("changed paths = %q", got)
+	}
+	if read(t, filepath.Join(root, "keep.txt")) != "keep\n" {
+		t.Fatal("the workspace changed")
+	}
+
+	if _, err := o.ShellDir(filepath.Dir(root)); err == nil {
+		t.Fatal("expected a directory outside the root to be refused")
+	}
+}
@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+)
+
+func init() {
+	p := &Plugin{
+		Name:        "checkpoint-plugin",
+		Description: "Provides /undo, /checkpoints and /restore to revert the agent's file edits",
+		Commands: map[string]CommandDef{
+			"undo":        {Description: "Revert the files changed by the last turn", Handler: undoHandler},
+			"checkpoints": {Description: "List the checkpoints of this session", Handler: checkpointsHandler},
+			"restore":     {Description: "Return files to their state before checkpoint n (/restore <n>)", Handler: restoreHandler},
+		},
+	}
+	RegisterPlugin(p)
+}
+
+func undoHandler(ctx context.Context, name string, args []string, raw string, out io.Writer, errOut io.Writer) (bool, error) {
+	s, cwd := Checkpoints()
+	if s == nil {
+		_, err := fmt.Fprintln(errOut, "checkpoints not available")
+		return true, err
+	}
+	cp, err := s.Undo()
+	if err != nil {
+		return true, writeCheckpointError(errOut, err)
+	}
+	_, err = fmt.Fprintln(out, "Undid checkpoint", cp.Describe(cwd))
+	return true, err
+}
+
+func checkpointsHandler(ctx context.Context, name string, args []string, raw string, out io.Writer, errOut io.Writer) (bool, error) {
+	s, cwd := Checkpoints()
+	if s == nil {
+		_, err := fmt.Fprintln(errOut, "checkpoints not available")
+		return true, err
+	}
+	list, err := s.List()
+	if err != nil {
+		return true, writeCheckpointError(errOut, err)
+	}
+	if len(list) == 0 {
+		_, err := fmt.Fprintln(out, "No checkpoints yet: the agent has not changed any files in this session.")
+		return true, err
+	}
+	for _, cp := range list {
+		if _, err := fmt.Fprintln(out, cp.Describe(cwd)); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func restoreHandler(ctx context.Context, name string, args []string, raw string, out io.Writer, errOut io.Writer) (bool, error) {
+	s, cwd := Checkpoints()
+	if s == nil {
+		_, err := fmt.Fprintln(errOut, "checkpoints not available")
+		return true, err
+	}
+	if len(args) != 1 {
+		_, err := fmt.Fprintln(errOut, "usage: /restore <n> (see /checkpoints)")
+		return true, err
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		_, err := fmt.Fprintf(errOut, "invalid checkpoint %q\n", args[0])
+		return true, err
+	}
+	undone, err := s.Restore(n)
+	if err != nil {
+		return true, writeCheckpointError(errOut, err)
+	}
+	for _, cp := range undone {
+		if _, err := fmt.Fprintln(out, "Undid checkpoint", cp.Describe(cwd)); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func writeCheckpointError(errOut io.Writer, err error) error {
+	if errors.Is(err, checkpoint.ErrNone) {
+		_, werr := fmt.Fprintln(errOut, "Nothing to undo: the agent has not changed any files in this session.")
+		return werr
+	}
+	_, werr := fmt.Fprintln(errOut, "ERR:", err)
+	return werr
+}
@@ -0,0 +1,64 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+func init() {
+	p := &Plugin{
+		Name:        "mcp-plugin",
+		Description: "Provides /mcp command to list MCP servers and their tools",
+		Commands: map[string]CommandDef{
+			"mcp": {Description: "List MCP servers and tools (/mcp <server> for details)", Handler: mcpHandler},
+		},
+	}
+	RegisterPlugin(p)
+}
+
+func mcpHandler(ctx context.Context, name string, args []string, raw string, out io.Writer, errOut io.Writer) (bool, error) {
+	servers := MCPServers()
+	if len(servers) == 0 {
+		_, err := fmt.Fprintln(out, "No MCP servers configured. Add them to ~/.config/jorin/mcp.json or .jorin/mcp.json.")
+		return true, err
+	}
+	if len(args) > 0 {
+		for _, s := range servers {
+			if s.Name == args[0] {
+				return true, writeMCPServer(out, s, true)
+			}
+		}
+		_, err := fmt.Fprintf(errOut, "unknown MCP server: %s\n", args[0])
+		return true, err
+	}
+	for _, s := range servers {
+		if err := writeMCPServer(out, s, false); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func writeMCPServer(out io.Writer, s MCPServer, detail bool) error {
+	status := fmt.Sprintf("%d tools", len(s.Tools))
+	if s.Error != "" {
+		status = "error: " + s.Error
+	}
+	if _, err := fmt.Fprintf(out, "%s (%s %s): %s\n", s.Name, s.Transport, s.Target, status); err != nil {
+		return err
+	}
+	for _, t := range s.Tools {
+		line := "  " + t.Name
+		if t.ReadOnly {
+			line += " [read-only]"
+		}
+		if detail && t.Description != "" {
+			line += " - " + t.Description
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"io"
 	"sync"
+
+	"github.com/dave1010/jorin/internal/checkpoint"
+	"github.com/dave1010/jorin/internal/shell"
 )
 
 // CommandHandler is the signature for handling a slash command registered by a
@@ -40,6 +43,14 @@ var (
 	// modelProvider can be set by the host (eg. the UI) so plugins can access
 	// the current model name.
 	modelProvider func() string
+	// mcpProvider reports the MCP servers connected by the host.
+	mcpProvider func() []MCPServer
+	// checkpoints and checkpointCWD are the host's checkpoint store and the
+	// directory paths are shown relative to.
+	checkpoints   *checkpoint.Store
+	checkpointCWD string
+	// processes runs the host's background processes.
+	processes *shell.Supervisor
 )
 
 // RegisterPlugin registers a plugin and its commands. If a command name
@@ -141,3 +152,67 @@ func Model() string {
 	}
 	return modelProvider()
 }
+
+// MCPServer describes a connected (or failed) MCP server for display.
+type MCPServer struct {
+	Name      string
+	Transport string
+	Target    string
+	Error     string
+	Tools     []MCPTool
+}
+
+// MCPTool describes a tool offered by an MCP server.
+type MCPTool struct {
+	Name        string
+	Description string
+	ReadOnly    bool
+}
+
+// SetMCPProvider sets a callback used by plugins to list MCP servers.
+func SetMCPProvider(f func() []MCPServer) {
+	mu.Lock()
+	defer mu.Unlock()
+	mcpProvider = f
+}
+
+// MCPServers returns the MCP servers reported by the provider, if any.
+func MCPServers() []MCPServer {
+	mu.RLock()
+	f := mcpProvider
+	mu.RUnlock()
+	if f == nil {
+		return nil
+	}
+	return f()
+}
+
+// SetCheckpoints sets the checkpoint store the /undo, /checkpoints and
+// /restore commands work on; paths are shown relative to cwd.
+func SetCheckpoints(s *checkpoint.Store, cwd string) {
+	mu.Lock()
+	defer mu.Unlock()
+	checkpoints, checkpointCWD = s, cwd
+}
+
+// Checkpoints returns the checkpoint store set by the host, if any, and the
+// directory paths are shown relative to.
+func Checkpoints() (*checkpoint.Store, string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return checkpoints, checkpointCWD
+}
+
+// SetProcesses sets the supervisor whose processes /ps shows.
+func SetProcesses(s *shell.Supervisor) {
+	mu.Lock()
+	defer mu.Unlock()
+	processes = s
+}
+
+// Processes returns the supervisor set by the host, if any.
+func Processes() *shell.Supervisor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return processes
+}
@@ -0,0 +1,72 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// psTailBytes is how much recent output /ps <id> shows.
+const psTailBytes = 4000
+
+func init() {
+	p := &Plugin{
+		Name:        "process-plugin",
+		Description: "Provides /ps to show the agent's background processes",
+		Commands: map[string]CommandDef{
+			"ps": {Description: "List background processes, or show one's recent output (/ps <id>)", Handler: psHandler},
+		},
+	}
+	RegisterPlugin(p)
+}
+
+func psHandler(ctx context.Context, name string, args []string, raw string, out io.Writer, errOut io.Writer) (bool, error) {
+	s := Processes()
+	if s == nil {
+		_, err := fmt.Fprintln(errOut, "background processes not available")
+		return true, err
+	}
+	if len(args) > 1 {
+		_, err := fmt.Fprintln(errOut, "usage: /ps [id]")
+		return true, err
+	}
+	if len(args) == 1 {
+		proc, err := s.Get(args[0])
+		if err != nil {
+			_, err := fmt.Fprintln(errOut, "ERR:", err)
+			return true, err
+		}
+		if _, err := fmt.Fprintf(out, "%s  $ %s\n", proc.ID, proc.Command); err != nil {
+			return true, err
+		}
+		tail := strings.TrimRight(strings.ToValidUTF8(string(proc.Tail(psTailBytes)), "�"), "\n")
+		if tail == "" {
+			tail = "(no output)"
+		}
+		_, err = fmt.Fprintln(out, tail)
+		return true, err
+	}
+	list := s.List()
+	if len(list) == 0 {
+		_, err := fmt.Fprintln(out, "No background processes.")
+		return true, err
+	}
+	for _, proc := range list {
+		st := proc.State()
+		state, end := "running", time.Now()
+		switch {
+		case st.Running:
+		case st.Killed:
+			state, end = "killed", st.Ended
+		default:
+			state, end = fmt.Sprintf("exited %d", st.ExitCode), st.Ended
+		}
+		age := end.Sub(proc.Started).Round(time.Second)
+		if _, err := fmt.Fprintf(out, "%-4s %-9s %8s  pid %-7d %s\n", proc.ID, state, age, proc.PID, proc.Command); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
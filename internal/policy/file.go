@@ -0,0 +1,195 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/dave1010/jorin/internal/config"
+	"github.com/dave1010/jorin/internal/miniyaml"
+	"github.com/dave1010/jorin/internal/shell"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// FileName is the name of policy files, next to the user config file and in
+// a project's .jorin directory.
+const FileName = "policy.yaml"
+
+// Paths returns the policy files that apply in dir: the user file, then the
+// nearest .jorin/policy.yaml in dir or its parents, if any.
+func Paths(dir string) []string {
+	var paths []string
+	if p, err := config.UserPath(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(p), FileName))
+	}
+	if dir == "" {
+		return paths
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return paths
+	}
+	for {
+		p := filepath.Join(dir, ".jorin", FileName)
+		if st, err := os.Stat(p); err == nil && !st.IsDir() {
+			return append(paths, p)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return paths
+		}
+		dir = parent
+	}
+}
+
+// Load reads the policy files at paths. Missing files are skipped.
+func Load(paths ...string) ([]types.PolicyFile, error) {
+	var out []types.PolicyFile
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		rules, err := Parse(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		out = append(out, types.PolicyFile{Path: p, Rules: rules})
+	}
+	return out, nil
+}
+
+// Parse reads a policy file (see miniyaml): a "rules:" list whose items are
+// maps with the keys tool, command, path, host, decision and message.
+// Values are scalars or lists.
+//
+//	rules:
+//	  - tool: shell
+//	    command: git push
+//	    decision: ask
+//	    message: pushing needs a human
+func Parse(r io.Reader) ([]types.PolicyRule, error) {
+	lines, err := miniyaml.Lines(r)
+	if err != nil {
+		return nil, err
+	}
+	var rules []types.PolicyRule
+	var cur *types.PolicyRule
+	var listKey string
+	keyIndent := -1
+	inRules := false
+	finish := func() error {
+		if cur == nil {
+			return nil
+		}
+		if err := validate(cur); err != nil {
+			return fmt.Errorf("rule at line %d: %w", cur.Line, err)
+		}
+		rules = append(rules, *cur)
+		cur = nil
+		return nil
+	}
+	for _, l := range lines {
+		n, trim := l.N, l.Text
+		if l.Indent == 0 {
+			if trim != "rules:" {
+				return nil, fmt.Errorf("line %d: expected \"rules:\", got %q", n, trim)
+			}
+			inRules = true
+			continue
+		}
+		if !inRules {
+			return nil, fmt.Errorf("line %d: expected \"rules:\" first", n)
+		}
+		if item, ok := miniyaml.Item(trim); ok {
+			if listKey != "" && l.Indent >= keyIndent {
+				if err := set(cur, listKey, []string{miniyaml.Unquote(item)}, true); err != nil {
+					return nil, fmt.Errorf("line %d: %w", n, err)
+				}
+				continue
+			}
+			// a new rule; its first key may follow the dash
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			cur = &types.PolicyRule{Line: n}
+			listKey = ""
+			keyIndent = l.Indent + 2
+			if item == "" {
+				continue
+			}
+			trim = item
+		} else if cur == nil {
+			return nil, fmt.Errorf("line %d: expected a \"- \" rule item, got %q", n, trim)
+		} else {
+			keyIndent = l.Indent
+		}
+		key, value, ok := miniyaml.KeyValue(trim)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value, got %q", n, trim)
+		}
+		vals, block := miniyaml.Value(value)
+		listKey = ""
+		if block {
+			listKey = key
+		}
+		if err := set(cur, key, vals, false); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func set(r *types.PolicyRule, key string, vals []string, appending bool) error {
+	var list *[]string
+	switch key {
+	case "tool":
+		list = &r.Tools
+	case "command":
+		list = &r.Commands
+	case "path":
+		list = &r.Paths
+	case "host":
+		list = &r.Hosts
+	case "decision", "message":
+		if appending || len(vals) != 1 {
+			return fmt.Errorf("%s takes a single value", key)
+		}
+		if key == "decision" {
+			r.Decision = vals[0]
+		} else {
+			r.Message = vals[0]
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	*list = append(*list, vals...)
+	return nil
+}
+
+func validate(r *types.PolicyRule) error {
+	switch r.Decision {
+	case types.DecisionAllow, types.DecisionAsk, types.DecisionDeny:
+	case "":
+		return errors.New("missing decision")
+	default:
+		return fmt.Errorf("decision must be %s, %s or %s, got %q", types.DecisionAllow, types.DecisionAsk, types.DecisionDeny, r.Decision)
+	}
+	for _, c := range r.Commands {
+		if err := shell.ValidRule(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
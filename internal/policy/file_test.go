@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestParse(t *testing.T) {
+	src := `# project rules
+rules:
+  - tool: shell
+    command: git push   # needs a human
+    decision: ask
+    message: "pushing needs a human"
+  - tool: [write_file, apply_patch]
+    path:
+      - migrations/**
+      - '*.lock'
+    decision: deny
+
+  -
+    host: "*.internal"
+    decision: deny
+`
+	rules, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []types.PolicyRule{
+		{Tools: []string{"shell"}, Commands: []string{"git push"}, Decision: "ask", Message: "pushing needs a human", Line: 3},
+		{Tools: []string{"write_file", "apply_patch"}, Paths: []string{"migrations/**", "*.lock"}, Decision: "deny", Line: 7},
+		{Hosts: []string{"*.internal"}, Decision: "deny", Line: 13},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Fatalf("got %+v\nwant %+v", rules, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"policy:\n":                                      "expected \"rules:\"",
+		"rules:\n  tool: shell\n":                        "expected a \"- \" rule item",
+		"rules:\n  - tool: shell\n":                      "rule at line 2: missing decision",
+		"rules:\n  - decision: maybe\n":                  "decision must be allow, ask or deny",
+		"rules:\n  - colour: red\n    decision: deny\n":  "line 2: unknown key \"colour\"",
+		"rules:\n  - command: /[/\n    decision: deny\n": "rule at line 2:",
+		"rules:\n  - decision: [ask, deny]\n":            "decision takes a single value",
+	}
+	for src, want := range cases {
+		_, err := Parse(strings.NewReader(src))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestLoadAndPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	project := t.TempDir()
+	sub := filepath.Join(project, "a", "b")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(project, ".jorin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(project, ".jorin", FileName)
+	if err := os.WriteFile(file, []byte("rules:\n  - tool: shell\n    decision: deny\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := Paths(sub)
+	if len(paths) != 2 || paths[1] != file {
+		t.Fatalf("Paths = %v, want the user file then %s", paths, file)
+	}
+	files, err := Load(paths...)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	// the user file does not exist and is skipped
+	if len(files) != 1 || files[0].Path != file || len(files[0].Rules) != 1 {
+		t.Fatalf("Load = %+v", files)
+	}
+
+	if err := os.WriteFile(file, []byte("rules:\n  - tool: shell\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(paths...); err == nil || !strings.HasPrefix(err.Error(), file+": ") {
+		t.Fatalf("expected an error naming %s, got %v", file, err)
+	}
+}
@@ -0,0 +1,293 @@
+// Package policy decides whether tool calls may run. Rules come from the
+// settings (readonly, disabled_tools, allow/deny and approve) and from the
+// user and project policy files. Within each source the first matching rule
+// decides; across sources the strictest decision wins, so no file can relax
+// another file or the settings.
+package policy
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dave1010/jorin/internal/shell"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// SettingsSource names the rules derived from the policy settings.
+const SettingsSource = "settings"
+
+// Call is a tool call as the rules see it.
+type Call struct {
+	Tool string
+	// Command, Path and URL are the arguments rules match, when the call
+	// has them.
+	Command string
+	Path    string
+	URL     string
+}
+
+// NewCall returns the call to tool with args, taking the command, path and
+// URL from the "cmd", "path" and "url" arguments.
+func NewCall(tool string, args map[string]any) Call {
+	c := Call{Tool: tool}
+	c.Command, _ = args["cmd"].(string)
+	c.Path, _ = args["path"].(string)
+	c.URL, _ = args["url"].(string)
+	return c
+}
+
+// Result is the decision of one source, or of all of them.
+type Result struct {
+	// Decision is one of the types.Decision* constants. A source without a
+	// matching rule allows the call.
+	Decision string
+	// Message explains the decision to the model or the user.
+	Message string
+	// Source is SettingsSource or a policy file; "" when no rule matched.
+	Source string
+	// Line is where the matching rule starts in Source, if it is a file.
+	Line int
+	// Rule describes the matching rule.
+	Rule string
+}
+
+// Where names the matching rule's source and line.
+func (r Result) Where() string {
+	if r.Line > 0 {
+		return fmt.Sprintf("%s:%d", r.Source, r.Line)
+	}
+	return r.Source
+}
+
+// Matched reports whether a rule decided the result.
+func (r Result) Matched() bool { return r.Source != "" }
+
+// Check returns the decision for call under p.
+func Check(p *types.Policy, call Call) Result {
+	res, _ := Explain(p, call)
+	return res
+}
+
+// Explain returns the decision for call under p along with the result of
+// each source, settings first and then each rule file in order.
+func Explain(p *types.Policy, call Call) (Result, []Result) {
+	sources := []Result{settingsResult(p, call)}
+	for _, f := range p.RuleFiles {
+		sources = append(sources, evaluate(p, f.Path, f.Rules, call))
+	}
+	return strictest(sources), sources
+}
+
+// CheckAll returns the strictest decision for calls, such as one for each
+// file a patch touches.
+func CheckAll(p *types.Policy, calls []Call) Result {
+	var results []Result
+	for _, c := range calls {
+		results = append(results, Check(p, c))
+	}
+	return strictest(results)
+}
+
+// strictest returns the strictest matched result, or allow.
+func strictest(results []Result) Result {
+	out := Result{Decision: types.DecisionAllow}
+	for _, r := range results {
+		if r.Matched() && (!out.Matched() || rank(r.Decision) > rank(out.Decision)) {
+			out = r
+		}
+	}
+	return out
+}
+
+// rank orders decisions from least to most strict.
+func rank(decision string) int {
+	switch decision {
+	case types.DecisionAsk:
+		return 2
+	case types.DecisionDeny:
+		return 3
+	}
+	return 1
+}
+
+// Settings returns the rules equivalent to p's readonly, disabled_tools and
+// approve settings. The shell allow and deny lists are checked separately by
+// shell.CheckPolicy, so their refusals can name the failing command.
+func Settings(p *types.Policy) []types.PolicyRule {
+	var rules []types.PolicyRule
+	for _, t := range p.DisabledTools {
+		rules = append(rules, types.PolicyRule{Tools: []string{t}, Decision: types.DecisionDeny, Message: "tool disabled by policy"})
+	}
+	if p.Readonly {
+		rules = append(rules, types.PolicyRule{Tools: []string{"write_file", "edit_file", "apply_patch"}, Decision: types.DecisionDeny, Message: "readonly session"})
+	}
+	var ask []string
+	switch p.Approve {
+	case types.ApproveShell:
+		ask = []string{"shell"}
+	case types.ApproveWrites:
+		ask = []string{"shell", "write_file", "edit_file", "apply_patch"}
+	case types.ApproveAlways:
+		ask = []string{"*"}
+	default:
+		return rules
+	}
+	// a sub-agent's tool calls are approved one by one, and dry-run shell
+	// commands do nothing worth approving
+	quiet := []string{"spawn_agent"}
+	if p.DryShell {
+		quiet = append(quiet, "shell")
+	}
+	return append(rules,
+		types.PolicyRule{Tools: quiet, Decision: types.DecisionAllow},
+		types.PolicyRule{Tools: ask, Decision: types.DecisionAsk, Message: "approve=" + p.Approve},
+	)
+}
+
+func settingsResult(p *types.Policy, call Call) Result {
+	res := evaluate(p, SettingsSource, Settings(p), call)
+	if call.Tool != "shell" || res.Matched() && res.Decision == types.DecisionDeny {
+		return res
+	}
+	if ok, reason := shell.CheckPolicy(call.Command, p.Allow, p.Deny); !ok {
+		return Result{Decision: types.DecisionDeny, Message: reason, Source: SettingsSource, Rule: "allow/deny lists"}
+	}
+	return res
+}
+
+// evaluate returns the result of the first rule matching call.
+func evaluate(p *types.Policy, source string, rules []types.PolicyRule, call Call) Result {
+	for _, r := range rules {
+		ok, part := matches(p, r, call)
+		if !ok {
+			continue
+		}
+		res := Result{Decision: r.Decision, Message: r.Message, Source: source, Line: r.Line, Rule: Describe(r)}
+		where := res.Where()
+		// ask messages become the reason given by RequestApproval
+		if res.Message == "" {
+			switch {
+			case r.Decision == types.DecisionAllow:
+			case r.Decision == types.DecisionAsk && part != "":
+				res.Message = fmt.Sprintf("%q matches %s", part, where)
+			case r.Decision == types.DecisionAsk:
+				res.Message = where
+			case part != "":
+				res.Message = fmt.Sprintf("denied by policy: %q matches %s", part, where)
+			default:
+				res.Message = fmt.Sprintf("denied by policy (%s)", where)
+			}
+		}
+		return res
+	}
+	return Result{Decision: types.DecisionAllow}
+}
+
+// matches reports whether rule r applies to call and, for command rules,
+// which part of the command matched. Arguments that cannot be parsed match
+// ask and deny rules, so that they fail closed.
+func matches(p *types.Policy, r types.PolicyRule, call Call) (bool, string) {
+	if len(r.Tools) > 0 && !anyGlob(r.Tools, call.Tool) {
+		return false, ""
+	}
+	strict := r.Decision != types.DecisionAllow
+	part := ""
+	if len(r.Commands) > 0 {
+		if call.Command == "" {
+			return false, ""
+		}
+		if strict {
+			var err error
+			part, _, err = shell.MatchDeny(call.Command, r.Commands)
+			if err != nil {
+				part = call.Command
+			} else if part == "" {
+				return false, ""
+			}
+		} else if bad, _, err := shell.MatchAllow(call.Command, r.Commands); err != nil || bad != "" {
+			return false, ""
+		}
+	}
+	if len(r.Paths) > 0 {
+		if call.Path == "" {
+			return false, ""
+		}
+		abs, rel, _, err := p.WorkspacePath(call.Path)
+		if err != nil {
+			return strict, part
+		}
+		abs = strings.TrimPrefix(filepath.ToSlash(abs), "/")
+		found := false
+		for _, g := range r.Paths {
+			if types.MatchPathGlob(g, rel) || strings.HasPrefix(g, "/") && types.MatchPathGlob(g, abs) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, ""
+		}
+	}
+	if len(r.Hosts) > 0 {
+		if call.URL == "" {
+			return false, ""
+		}
+		u, err := url.Parse(call.URL)
+		if err != nil || u.Hostname() == "" {
+			return strict, part
+		}
+		if !anyGlob(r.Hosts, strings.ToLower(u.Hostname())) {
+			return false, ""
+		}
+	}
+	return true, part
+}
+
+// Describe formats a rule the way policy files write it.
+func Describe(r types.PolicyRule) string {
+	var parts []string
+	add := func(key string, vals []string) {
+		switch len(vals) {
+		case 0:
+		case 1:
+			parts = append(parts, fmt.Sprintf("%s: %s", key, vals[0]))
+		default:
+			parts = append(parts, fmt.Sprintf("%s: [%s]", key, strings.Join(vals, ", ")))
+		}
+	}
+	add("tool", r.Tools)
+	add("command", r.Commands)
+	add("path", r.Paths)
+	add("host", r.Hosts)
+	parts = append(parts, "decision: "+r.Decision)
+	return strings.Join(parts, ", ")
+}
+
+// MatchHost reports whether host matches one of the globs, as a rule's
+// host field does.
+func MatchHost(globs []string, host string) bool {
+	return anyGlob(globs, strings.ToLower(host))
+}
+
+func anyGlob(globs []string, s string) bool {
+	for _, g := range globs {
+		if globMatch(g, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches tool names and hosts, where "*" matches any run of
+// characters and "?" any one.
+func globMatch(glob, s string) bool {
+	if !strings.ContainsAny(glob, "*?") {
+		return strings.EqualFold(glob, s)
+	}
+	re := "(?i)^" + strings.ReplaceAll(strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, ".*"), `\?`, ".") + "$"
+	ok, _ := regexp.MatchString(re, s)
+	return ok
+}
@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func file(path string, rules ...types.PolicyRule) types.PolicyFile {
+	for i := range rules {
+		rules[i].Line = i + 2
+	}
+	return types.PolicyFile{Path: path, Rules: rules}
+}
+
+func TestCheckFirstMatchWins(t *testing.T) {
+	p := &types.Policy{RuleFiles: []types.PolicyFile{file("project",
+		types.PolicyRule{Tools: []string{"shell"}, Commands: []string{"git status"}, Decision: "allow"},
+		types.PolicyRule{Tools: []string{"shell"}, Commands: []string{"git"}, Decision: "ask", Message: "git needs a look"},
+		types.PolicyRule{Tools: []string{"shell"}, Decision: "deny"},
+	)}}
+	cases := []struct {
+		cmd, decision, message string
+	}{
+		{"git status", "allow", ""},
+		{"git status && git push", "ask", "git needs a look"},
+		{"git push", "ask", "git needs a look"},
+		{"ls", "deny", "denied by policy (project:4)"},
+	}
+	for _, c := range cases {
+		res := Check(p, Call{Tool: "shell", Command: c.cmd})
+		if res.Decision != c.decision || res.Message != c.message {
+			t.Errorf("%q: got %s %q, want %s %q", c.cmd, res.Decision, res.Message, c.decision, c.message)
+		}
+	}
+	if res := Check(p, Call{Tool: "read_file", Path: "x"}); res.Decision != "allow" || res.Matched() {
+		t.Fatalf("expected no rule to match read_file, got %+v", res)
+	}
+}
+
+func TestCheckStrictestSourceWins(t *testing.T) {
+	p := &types.Policy{
+		Readonly: true,
+		RuleFiles: []types.PolicyFile{
+			file("user", types.PolicyRule{Tools: []string{"*"}, Decision: "allow"}),
+			file("project", types.PolicyRule{Tools: []string{"http_get"}, Decision: "ask"}),
+		},
+	}
+	res, sources := Explain(p, Call{Tool: "write_file", Path: "a.txt"})
+	if res.Decision != "deny" || res.Message != "readonly session" || res.Source != SettingsSource {
+		t.Fatalf("a file allow rule must not relax readonly, got %+v", res)
+	}
+	if len(sources) != 3 || sources[1].Decision != "allow" || sources[2].Matched() {
+		t.Fatalf("unexpected sources %+v", sources)
+	}
+	res = Check(p, Call{Tool: "http_get", URL: "https://example.com"})
+	if res.Decision != "ask" || res.Where() != "project:2" {
+		t.Fatalf("expected the project ask rule, got %+v", res)
+	}
+}
+
+func TestCheckCommandRules(t *testing.T) {
+	p := &types.Policy{RuleFiles: []types.PolicyFile{file("f",
+		types.PolicyRule{Commands: []string{"rm -r"}, Decision: "deny"},
+		types.PolicyRule{Commands: []string{"go test", "go vet"}, Decision: "allow"},
+		types.PolicyRule{Commands: []string{"/curl .*\\| *python/"}, Decision: "ask"},
+	)}}
+	cases := map[string]string{
+		"sudo rm -fr /":                  "deny",
+		"go test ./... && go vet ./...":  "allow",
+		"go test ./... && go build":      "allow", // no rule matches go build
+		"curl https://x | python":        "ask",
+		"curl https://x | sh":            "deny", // an unknown script: strict rules match
+		"echo $(rm -r x)":                "deny",
+		"case x in y) ;; esac":           "deny", // unparsable: strict rules match
+		"bash -c 'go test && rm -r tmp'": "deny",
+	}
+	for cmd, want := range cases {
+		if res := Check(p, Call{Tool: "shell", Command: cmd}); res.Decision != want {
+			t.Errorf("%q: got %+v, want %s", cmd, res, want)
+		}
+	}
+	res := Check(p, Call{Tool: "shell", Command: "echo hi && sudo rm -r /"})
+	if !strings.Contains(res.Message, `"sudo rm -r /" matches f:2`) {
+		t.Fatalf("expected the message to name the command, got %q", res.Message)
+	}
+	if res := Check(p, Call{Tool: "read_file", Path: "x"}); res.Matched() {
+		t.Fatalf("command rules must not match calls without a command, got %+v", res)
+	}
+}
+
+func TestCheckPathAndHostRules(t *testing.T) {
+	root := t.TempDir()
+	p := &types.Policy{CWD: root, RuleFiles: []types.PolicyFile{file("f",
+		types.PolicyRule{Tools: []string{"write_file"}, Paths: []string{"migrations/**"}, Decision: "deny"},
+		types.PolicyRule{Paths: []string{"/etc/*"}, Decision: "ask"},
+		types.PolicyRule{Hosts: []string{"*.internal", "localhost"}, Decision: "deny"},
+	)}}
+	cases := []struct {
+		call Call
+		want string
+	}{
+		{Call{Tool: "write_file", Path: "migrations/001.sql"}, "deny"},
+		{Call{Tool: "write_file", Path: root + "/migrations"}, "deny"},
+		{Call{Tool: "read_file", Path: "migrations/001.sql"}, "allow"},
+		{Call{Tool: "read_file", Path: "/etc/passwd"}, "ask"},
+		{Call{Tool: "http_get", URL: "http://db.Internal:5432/x"}, "deny"},
+		{Call{Tool: "http_get", URL: "http://localhost/"}, "deny"},
+		{Call{Tool: "http_get", URL: "https://example.com/internal"}, "allow"},
+		{Call{Tool: "http_get", URL: "::"}, "deny"},
+	}
+	for _, c := range cases {
+		if res := Check(p, c.call); res.Decision != c.want {
+			t.Errorf("%+v: got %+v, want %s", c.call, res, c.want)
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	p := &types.Policy{DisabledTools: []string{"http_get"}, Approve: types.ApproveWrites, Deny: []string{"rm"}}
+	cases := []struct {
+		call     Call
+		decision string
+		message  string
+	}{
+		{Call{Tool: "http_get"}, "deny", "tool disabled by policy"},
+		{Call{Tool: "write_file", Path: "a"}, "ask", "approve=writes"},
+		{Call{Tool: "edit_file", Path: "a"}, "ask", "approve=writes"},
+		{Call{Tool: "shell", Command: "ls"}, "ask", "approve=writes"},
+		{Call{Tool: "shell", Command: "rm x"}, "deny", `denied by policy: "rm x" matches deny rule "rm"`},
+		{Call{Tool: "spawn_agent"}, "allow", ""},
+		{Call{Tool: "read_file", Path: "a"}, "allow", ""},
+	}
+	for _, c := range cases {
+		res := Check(p, c.call)
+		if res.Decision != c.decision || res.Message != c.message {
+			t.Errorf("%+v: got %s %q, want %s %q", c.call, res.Decision, res.Message, c.decision, c.message)
+		}
+	}
+
+	p = &types.Policy{Approve: types.ApproveShell, DryShell: true}
+	if res := Check(p, Call{Tool: "shell", Command: "ls"}); res.Decision != "allow" {
+		t.Fatalf("dry-run shell commands should not ask, got %+v", res)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	r := types.PolicyRule{Tools: []string{"write_file", "apply_patch"}, Paths: []string{"*.lock"}, Decision: "deny"}
+	if got, want := Describe(r), "tool: [write_file, apply_patch], path: *.lock, decision: deny"; got != want {
+		t.Fatalf("Describe = %q, want %q", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package ralph
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -10,7 +11,7 @@ import (
 )
 
 // Run runs the Ralph Wiggum loop.
-func Run(ag agent.Agent, model string, initialPrompt string, systemPrompt string, pol *types.Policy, maxTries int, stdout io.Writer, stderr io.Writer) error {
+func Run(ctx context.Context, ag agent.Agent, model string, initialPrompt string, systemPrompt string, pol *types.Policy, maxTries int, stdout io.Writer, stderr io.Writer) error {
 	if maxTries < 1 {
 		return fmt.Errorf("ralph max tries must be at least 1")
 	}
@@ -25,7 +26,7 @@ func Run(ag agent.Agent, model string, initialPrompt string, systemPrompt string
 			{Role: "system", Content: systemPrompt},
 			{Role: "user", Content: currentPrompt},
 		}
-		_, out, err := ag.ChatSession(model, msgs, pol)
+		_, out, err := ag.ChatSession(ctx, model, msgs, pol)
 		if err != nil {
 			return err
 		}
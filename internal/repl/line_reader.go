@@ -17,6 +17,10 @@ import (
 // (e.g. when in/out are not terminals) so StartREPL remains testable.
 type LineReader interface {
 	ReadLine(prompt string) (string, error)
+	// ReadLineWithText is like ReadLine but pre-fills the line with text for
+	// editing. Non-interactive readers ignore text. Answers are not added to
+	// the history.
+	ReadLineWithText(prompt, text string) (string, error)
 	Close() error
 	// If supported, allow adding history lines
 	AppendHistory(lines []string)
@@ -64,6 +68,10 @@ func (s *scannerReader) ReadLine(prompt string) (string, error) {
 	return "", io.EOF
 }
 
+func (s *scannerReader) ReadLineWithText(prompt, _ string) (string, error) {
+	return s.ReadLine(prompt)
+}
+
 func (s *scannerReader) Close() error                 { return nil }
 func (s *scannerReader) AppendHistory(lines []string) {}
 
@@ -89,6 +97,14 @@ func (lr *linerReader) ReadLine(prompt string) (string, error) {
 	return line, nil
 }
 
+func (lr *linerReader) ReadLineWithText(prompt, text string) (string, error) {
+	line, err := lr.l.PromptWithSuggestion(strings.TrimRight(prompt, "\n"), text, -1)
+	if errors.Is(err, io.EOF) {
+		return "", io.EOF
+	}
+	return line, err
+}
+
 func (lr *linerReader) Close() error {
 	return lr.l.Close()
 }
@@ -5,9 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/dave1010/jorin/internal/agent"
+	"github.com/dave1010/jorin/internal/approval"
+	"github.com/dave1010/jorin/internal/checkpoint"
 	"github.com/dave1010/jorin/internal/prompt"
 	"github.com/dave1010/jorin/internal/repl/commands"
 	"github.com/dave1010/jorin/internal/tools"
@@ -28,6 +32,24 @@ type StartOptions struct {
 	Config  *Config
 	Handler commands.Handler
 	History History
+	// Stream writes assistant text to Output as it arrives when the agent
+	// supports it. Leave false for non-interactive output.
+	Stream bool
+	// CatchInterrupts makes Ctrl-C (SIGINT) cancel the running turn and
+	// return to the prompt instead of terminating the process.
+	CatchInterrupts bool
+	// Messages seeds the conversation, e.g. when resuming a saved session.
+	// When empty the conversation starts with the current system prompt.
+	Messages []types.Message
+	// OnTurn, if set, is called with the full conversation after every turn
+	// forwarded to the agent so callers can persist it.
+	OnTurn func(msgs []types.Message)
+	// AskApproval asks on Input about tool calls that Policy.Approve wants
+	// approved. When false those calls are refused.
+	AskApproval bool
+	// Checkpoints, if set, groups the files each turn changes into a
+	// checkpoint. Policy.Checkpoints should save into the same store.
+	Checkpoints *checkpoint.Store
 }
 
 func StartREPL(opts StartOptions) error {
@@ -37,7 +59,10 @@ func StartREPL(opts StartOptions) error {
 	if _, err := fmt.Fprintln(opts.Output, headerStyleStr("jorin\u003e (Ctrl-D to exit)")); err != nil {
 		return err
 	}
-	msgs := []types.Message{{Role: "system", Content: prompt.SystemPrompt()}}
+	msgs := opts.Messages
+	if len(msgs) == 0 {
+		msgs = []types.Message{{Role: "system", Content: prompt.SystemPrompt()}}
+	}
 	reg := tools.Registry()
 
 	// create a LineReader that provides proper terminal editing when possible
@@ -47,6 +72,11 @@ func StartREPL(opts StartOptions) error {
 		// append previous history so arrow-up works for past sessions
 		lr.AppendHistory(opts.History.List(0))
 	}
+	if opts.AskApproval && opts.Policy.AsksApproval() {
+		pol := *opts.Policy
+		pol.Approver = approval.NewTerminal(lr.ReadLineWithText, opts.ErrOut)
+		opts.Policy = &pol
+	}
 
 	for {
 		select {
@@ -78,14 +108,31 @@ func StartREPL(opts StartOptions) error {
 		if handled {
 			continue
 		}
-		handled, err = handleShellCommand(trim, reg, opts.Policy, opts.Output, opts.ErrOut)
+		turnCtx, stop := turnContext(opts.Ctx, opts.CatchInterrupts)
+		handled, err = handleShellCommand(turnCtx, trim, reg, opts.Policy, opts.Output, opts.ErrOut)
 		if err != nil {
+			stop()
 			return err
 		}
 		if handled {
+			stop()
 			continue
 		}
-		msgs, err = forwardToAgent(opts.Agent, opts.Model, trim, opts.Policy, opts.History, msgs, opts.Output, opts.ErrOut)
+		if opts.Checkpoints != nil {
+			opts.Checkpoints.Begin(trim)
+		}
+		msgs, err = forwardToAgent(turnCtx, opts.Agent, opts.Model, trim, opts.Policy, opts.History, msgs, opts.Stream, opts.Output, opts.ErrOut)
+		stop()
+		if opts.Checkpoints != nil {
+			if cerr := opts.Checkpoints.End(); cerr != nil {
+				if _, werr := fmt.Fprintln(opts.ErrOut, errorStyleStr("WARN: checkpoint:"), cerr); werr != nil {
+					return werr
+				}
+			}
+		}
+		if opts.OnTurn != nil {
+			opts.OnTurn(msgs)
+		}
 		if err != nil {
 			return err
 		}
@@ -122,7 +169,29 @@ func parseAndHandleCommand(ctx context.Context, line string, cfg *Config, handle
 	return line, false, nil
 }
 
-func handleShellCommand(line string, reg map[string]tools.ToolExec, pol *types.Policy, out io.Writer, errOut io.Writer) (bool, error) {
+// turnContext returns a context for a single REPL turn. When catch is true,
+// SIGINT cancels the turn rather than killing the process.
+func turnContext(parent context.Context, catch bool) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	if !catch {
+		return ctx, cancel
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+func handleShellCommand(ctx context.Context, line string, reg map[string]tools.ToolExec, pol *types.Policy, out io.Writer, errOut io.Writer) (bool, error) {
 	if !strings.HasPrefix(line, "!") {
 		return false, nil
 	}
@@ -140,7 +209,14 @@ func handleShellCommand(line string, reg map[string]tools.ToolExec, pol *types.P
 		}
 		return true, nil
 	}
-	res, err := sh(map[string]any{"cmd": cmdStr}, pol)
+	if pol != nil {
+		// the user typed the command, so it is not put to them again; deny
+		// rules still apply
+		p := *pol
+		p.Approver = typedCommand{}
+		pol = &p
+	}
+	res, err := sh(ctx, map[string]any{"cmd": cmdStr}, pol)
 	if err != nil {
 		if _, werr := fmt.Fprintln(errOut, errorStyleStr("ERR:"), err); werr != nil {
 			return true, werr
@@ -153,6 +229,13 @@ func handleShellCommand(line string, reg map[string]tools.ToolExec, pol *types.P
 	return true, nil
 }
 
+// typedCommand approves the commands the user runs with "!".
+type typedCommand struct{}
+
+func (typedCommand) Approve(context.Context, types.ApprovalRequest) types.ApprovalDecision {
+	return types.ApprovalDecision{Allow: true}
+}
+
 func reportShellResult(cmdStr string, res map[string]any, out io.Writer, errOut io.Writer) error {
 	if e, ok := res["error"]; ok {
 		if _, werr := fmt.Fprintln(errOut, errorStyleStr("ERR:"), e); werr != nil {
@@ -175,6 +258,11 @@ func reportShellResult(cmdStr string, res map[string]any, out io.Writer, errOut
 			return werr
 		}
 	}
+	if output, ok := res["output"].(string); ok && output != "" {
+		if _, werr := fmt.Fprintln(out, infoStyleStr(output)); werr != nil {
+			return werr
+		}
+	}
 	if serr, ok := res["stderr"].(string); ok && serr != "" {
 		if _, werr := fmt.Fprintln(errOut, errorStyleStr(serr)); werr != nil {
 			return werr
@@ -188,20 +276,37 @@ func reportShellResult(cmdStr string, res map[string]any, out io.Writer, errOut
 	return nil
 }
 
-func forwardToAgent(a agent.Agent, model string, line string, pol *types.Policy, hist History, msgs []types.Message, out io.Writer, errOut io.Writer) ([]types.Message, error) {
+func forwardToAgent(ctx context.Context, a agent.Agent, model string, line string, pol *types.Policy, hist History, msgs []types.Message, stream bool, out io.Writer, errOut io.Writer) ([]types.Message, error) {
 	msgs = append(msgs, types.Message{Role: "user", Content: line})
 	if hist != nil {
 		hist.Add(line)
 	}
 	var outStr string
 	var err error
-	msgs, outStr, err = a.ChatSession(model, msgs, pol)
+	sa, streaming := a.(agent.StreamingAgent)
+	streaming = streaming && stream
+	if streaming {
+		msgs, outStr, err = sa.ChatSessionStream(ctx, model, msgs, pol, out)
+	} else {
+		msgs, outStr, err = a.ChatSession(ctx, model, msgs, pol)
+	}
+	if err != nil && ctx.Err() != nil {
+		// keep the conversation so far and return to the prompt
+		if _, werr := fmt.Fprintln(errOut, infoStyleStr("interrupted")); werr != nil {
+			return msgs, werr
+		}
+		return msgs, nil
+	}
 	if err != nil {
 		if _, werr := fmt.Fprintln(errOut, errorStyleStr("ERR:"), err); werr != nil {
 			return msgs, werr
 		}
 		return msgs, nil
 	}
+	if streaming {
+		// the answer has already been written as it streamed
+		return msgs, nil
+	}
 	if _, werr := fmt.Fprintln(out, infoStyleStr(outStr)); werr != nil {
 		return msgs, werr
 	}
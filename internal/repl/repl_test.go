@@ -3,6 +3,7 @@ package repl
 import (
 	"bytes"
 	"context"
+	"io"
 	"strings"
 	"testing"
 
@@ -15,7 +16,7 @@ import (
 // minimal mock agent that echoes last user message
 type mockAgent struct{}
 
-func (m *mockAgent) ChatSession(model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
+func (m *mockAgent) ChatSession(ctx context.Context, model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
 	if len(msgs) == 0 {
 		return msgs, "", nil
 	}
@@ -66,3 +67,73 @@ func TestREPLHandlerDispatch(t *testing.T) {
 		t.Fatalf("expected model echo in out: %s", out.String())
 	}
 }
+
+// streamingAgent writes its answer to out while "streaming".
+type streamingAgent struct {
+	mockAgent
+	streamed int
+}
+
+func (s *streamingAgent) ChatSessionStream(ctx context.Context, model string, msgs []types.Message, pol *types.Policy, out io.Writer) ([]types.Message, string, error) {
+	s.streamed++
+	_, _ = io.WriteString(out, "STREAM\n")
+	return msgs, "STREAM", nil
+}
+
+func TestREPLStreamsWhenEnabled(t *testing.T) {
+	for _, stream := range []bool{true, false} {
+		out := &bytes.Buffer{}
+		errOut := &bytes.Buffer{}
+		a := &streamingAgent{}
+		if err := StartREPL(StartOptions{
+			Ctx:     context.Background(),
+			Agent:   a,
+			Model:   "test-model",
+			Policy:  &types.Policy{},
+			Input:   bytes.NewBufferString("hello\n"),
+			Output:  out,
+			ErrOut:  errOut,
+			Handler: commands.NewDefaultHandler(out, errOut, nil, prompt.SystemPrompt),
+			Stream:  stream,
+		}); err != nil {
+			t.Fatalf("StartREPL failed: %v", err)
+		}
+		if stream {
+			if a.streamed != 1 || strings.Count(out.String(), "STREAM") != 1 {
+				t.Fatalf("expected a single streamed answer, got %q", out.String())
+			}
+			continue
+		}
+		if a.streamed != 0 || !strings.Contains(out.String(), "ECHO: hello") {
+			t.Fatalf("expected non-streaming answer, got %q", out.String())
+		}
+	}
+}
+
+// blockingAgent waits for the turn to be cancelled.
+type blockingAgent struct {
+	cancel context.CancelFunc
+}
+
+func (b *blockingAgent) ChatSession(ctx context.Context, model string, msgs []types.Message, pol *types.Policy) ([]types.Message, string, error) {
+	b.cancel()
+	<-ctx.Done()
+	return msgs, "", ctx.Err()
+}
+
+func TestForwardToAgentInterruptedKeepsConversation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	msgs := []types.Message{{Role: "system", Content: "sys"}}
+	msgs, err := forwardToAgent(ctx, &blockingAgent{cancel: cancel}, "m", "hello", &types.Policy{}, nil, msgs, false, out, errOut)
+	if err != nil {
+		t.Fatalf("expected interruption to be handled, got %v", err)
+	}
+	if len(msgs) != 2 || msgs[1].Content != "hello" {
+		t.Fatalf("expected conversation to be kept, got %+v", msgs)
+	}
+	if !strings.Contains(errOut.String(), "interrupted") {
+		t.Fatalf("expected interrupted notice, got %q", errOut.String())
+	}
+}
@@ -1,23 +1,164 @@
 package session
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/dave1010/jorin/internal/types"
 )
 
+// API modes recorded in session metadata.
+const (
+	APIModeChat      = "chat_completions"
+	APIModeResponses = "responses"
+)
+
+const maxTitleLen = 60
+
+// ErrNotFound is returned when no stored session matches an ID.
+var ErrNotFound = errors.New("session not found")
+
+// Metadata describes a stored session without its transcript.
+type Metadata struct {
+	ID           string       `json:"id"`
+	Title        string       `json:"title,omitempty"`
+	Model        string       `json:"model,omitempty"`
+	Provider     string       `json:"provider,omitempty"`
+	APIMode      string       `json:"api_mode,omitempty"`
+	CWD          string       `json:"cwd,omitempty"`
+	Created      time.Time    `json:"created"`
+	Updated      time.Time    `json:"updated"`
+	MessageCount int          `json:"message_count"`
+	Policy       types.Policy `json:"policy"`
+}
+
+// Session is a persisted conversation: its metadata plus the full message
+// history sent to the model.
+type Session struct {
+	Meta     Metadata        `json:"meta"`
+	Messages []types.Message `json:"messages"`
+}
+
+// New returns an empty session with a fresh ID and creation time.
+func New() *Session {
+	now := time.Now().UTC()
+	return &Session{Meta: Metadata{ID: NewID(now), Created: now, Updated: now}}
+}
+
+// NewID returns a sortable, human-readable session ID such as
+// 20240131-154502-3fa1.
+func NewID(t time.Time) string {
+	b := make([]byte, 2)
+	_, _ = rand.Read(b)
+	return t.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
 // Store represents a persistence backend for chat sessions.
 type Store interface {
-	Save(id string, msgs []types.Message) error
-	Load(id string) ([]types.Message, error)
-	List() ([]string, error)
+	Save(s *Session) error
+	Load(id string) (*Session, error)
+	// List returns stored sessions, most recently updated first.
+	List() ([]Metadata, error)
 	Delete(id string) error
 }
 
+// DefaultDir returns the directory sessions are stored in:
+// $XDG_STATE_HOME/jorin/sessions, falling back to ~/.local/state.
+func DefaultDir() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "jorin", "sessions"), nil
+}
+
+// Resolve maps ref to a stored session ID. ref may be a full ID or a unique
+// prefix of one.
+func Resolve(s Store, ref string) (string, error) {
+	if err := validateID(ref); err != nil {
+		return "", err
+	}
+	list, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	for _, m := range list {
+		if m.ID == ref {
+			return ref, nil
+		}
+		if strings.HasPrefix(m.ID, ref) {
+			matches = append(matches, m.ID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrNotFound, ref)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("session %q is ambiguous: matches %s", ref, strings.Join(matches, ", "))
+}
+
+// Latest returns the most recently updated session, preferring sessions that
+// were started in cwd. It returns ErrNotFound when the store is empty.
+func Latest(s Store, cwd string) (*Session, error) {
+	list, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	id := list[0].ID
+	for _, m := range list {
+		if cwd != "" && m.CWD == cwd {
+			id = m.ID
+			break
+		}
+	}
+	return s.Load(id)
+}
+
+// Title derives a short session title from the first user message.
+func Title(msgs []types.Message) string {
+	for _, m := range msgs {
+		if m.Role != "user" {
+			continue
+		}
+		t := strings.Join(strings.Fields(m.Content), " ")
+		if len(t) > maxTitleLen {
+			t = t[:maxTitleLen] + "..."
+		}
+		return t
+	}
+	return ""
+}
+
+func validateID(id string) error {
+	if id == "" {
+		return errors.New("missing id")
+	}
+	if id == "." || id == ".." || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return fmt.Errorf("invalid session id %q", id)
+	}
+	return nil
+}
+
 // FileStore is a simple file-backed Store implementation that writes one
 // JSON file per session under a base directory.
 type FileStore struct {
@@ -32,59 +173,110 @@ func (f *FileStore) pathFor(id string) string {
 	return filepath.Join(f.BaseDir, id+".json")
 }
 
-func (f *FileStore) Save(id string, msgs []types.Message) error {
-	if id == "" {
-		return errors.New("missing id")
+// Save writes the session, refreshing its updated time, title and message
+// count. Transcripts can contain secrets, so files are private to the user.
+func (f *FileStore) Save(s *Session) error {
+	if err := validateID(s.Meta.ID); err != nil {
+		return err
 	}
-	if err := os.MkdirAll(f.BaseDir, 0o755); err != nil {
+	if err := os.MkdirAll(f.BaseDir, 0o700); err != nil {
 		return err
 	}
-	b, err := json.MarshalIndent(msgs, "", "  ")
+	s.Meta.Updated = time.Now().UTC()
+	if s.Meta.Created.IsZero() {
+		s.Meta.Created = s.Meta.Updated
+	}
+	if s.Meta.Title == "" {
+		s.Meta.Title = Title(s.Messages)
+	}
+	s.Meta.MessageCount = len(s.Messages)
+	b, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(f.pathFor(id), b, 0o644)
+	tmp, err := os.CreateTemp(f.BaseDir, "."+s.Meta.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.pathFor(s.Meta.ID))
 }
 
-func (f *FileStore) Load(id string) ([]types.Message, error) {
-	if id == "" {
-		return nil, errors.New("missing id")
+// Load reads a session. Files written by older versions, which hold only a
+// bare message array, are returned with metadata derived from the file.
+func (f *FileStore) Load(id string) (*Session, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
 	}
-	b, err := os.ReadFile(f.pathFor(id))
+	path := f.pathFor(id)
+	b, err := os.ReadFile(path)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
 		return nil, err
 	}
-	var msgs []types.Message
-	if err := json.Unmarshal(b, &msgs); err != nil {
-		return nil, err
+	var s Session
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(b, &s.Messages); err != nil {
+			return nil, fmt.Errorf("session %s: %w", id, err)
+		}
+		if st, err := os.Stat(path); err == nil {
+			s.Meta.Created = st.ModTime().UTC()
+			s.Meta.Updated = s.Meta.Created
+		}
+		s.Meta.Title = Title(s.Messages)
+		s.Meta.MessageCount = len(s.Messages)
+	} else if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("session %s: %w", id, err)
 	}
-	return msgs, nil
+	s.Meta.ID = id
+	return &s, nil
 }
 
-func (f *FileStore) List() ([]string, error) {
+func (f *FileStore) List() ([]Metadata, error) {
 	ents, err := os.ReadDir(f.BaseDir)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			return []string{}, nil
+			return []Metadata{}, nil
 		}
 		return nil, err
 	}
-	out := []string{}
+	out := []Metadata{}
 	for _, e := range ents {
-		if e.IsDir() {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".json" || strings.HasPrefix(name, ".") {
 			continue
 		}
-		name := e.Name()
-		if filepath.Ext(name) == ".json" {
-			out = append(out, name[:len(name)-len(".json")])
+		s, err := f.Load(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			// skip unreadable files rather than hiding every other session
+			continue
 		}
+		out = append(out, s.Meta)
 	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Updated.After(out[j].Updated)
+	})
 	return out, nil
 }
 
 func (f *FileStore) Delete(id string) error {
-	if id == "" {
-		return errors.New("missing id")
+	if err := validateID(id); err != nil {
+		return err
+	}
+	if err := os.Remove(f.pathFor(id)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return err
 	}
-	return os.Remove(f.pathFor(id))
+	return nil
 }
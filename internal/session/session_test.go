@@ -0,0 +1,117 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestFileStoreSaveLoadRoundTrip(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	s := New()
+	s.Meta.Model = "gpt-test"
+	s.Meta.APIMode = APIModeResponses
+	s.Meta.Policy = types.Policy{Readonly: true, Deny: []string{"rm"}, ToolTimeout: time.Minute}
+	s.Messages = []types.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "fix   the\nflaky test"},
+		{Role: "assistant", Content: "done", ResponseID: "resp_1"},
+	}
+	if err := store.Save(s); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := store.Load(s.Meta.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.Meta.Model != "gpt-test" || got.Meta.APIMode != APIModeResponses {
+		t.Fatalf("unexpected metadata: %+v", got.Meta)
+	}
+	if got.Meta.Title != "fix the flaky test" || got.Meta.MessageCount != 3 {
+		t.Fatalf("unexpected title/count: %q %d", got.Meta.Title, got.Meta.MessageCount)
+	}
+	if !got.Meta.Policy.Readonly || got.Meta.Policy.ToolTimeout != time.Minute || len(got.Meta.Policy.Deny) != 1 {
+		t.Fatalf("policy not preserved: %+v", got.Meta.Policy)
+	}
+	if len(got.Messages) != 3 || got.Messages[2].ResponseID != "resp_1" {
+		t.Fatalf("messages not preserved: %+v", got.Messages)
+	}
+
+	info, err := os.Stat(store.pathFor(s.Meta.ID))
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected private session file, got %v", info.Mode().Perm())
+	}
+}
+
+func TestFileStoreLoadsLegacyMessageArray(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `[{"role":"system","content":"sys"},{"role":"user","content":"hello"}]`
+	if err := os.WriteFile(filepath.Join(dir, "old.json"), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewFileStore(dir).Load("old")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.Meta.ID != "old" || got.Meta.Title != "hello" || len(got.Messages) != 2 {
+		t.Fatalf("unexpected legacy session: %+v", got)
+	}
+}
+
+func TestFileStoreListAndResolve(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	for _, id := range []string{"20240101-000000-aaaa", "20240102-000000-bbbb", "20240102-000000-bbcc"} {
+		s := New()
+		s.Meta.ID = id
+		s.Meta.CWD = "/work/" + id
+		if err := store.Save(s); err != nil {
+			t.Fatalf("Save %s: %v", id, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 3 || list[0].ID != "20240102-000000-bbcc" {
+		t.Fatalf("expected most recent first, got %+v", list)
+	}
+
+	if id, err := Resolve(store, "20240101"); err != nil || id != "20240101-000000-aaaa" {
+		t.Fatalf("prefix resolve: %q %v", id, err)
+	}
+	if _, err := Resolve(store, "20240102-000000-b"); err == nil {
+		t.Fatalf("expected ambiguous prefix error")
+	}
+	if _, err := Resolve(store, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := Resolve(store, "../etc"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected invalid id error, got %v", err)
+	}
+
+	latest, err := Latest(store, "/work/20240101-000000-aaaa")
+	if err != nil || latest.Meta.ID != "20240101-000000-aaaa" {
+		t.Fatalf("expected latest session in cwd, got %+v %v", latest, err)
+	}
+	latest, err = Latest(store, "/elsewhere")
+	if err != nil || latest.Meta.ID != "20240102-000000-bbcc" {
+		t.Fatalf("expected most recent session, got %+v %v", latest, err)
+	}
+
+	if err := store.Delete("20240101-000000-aaaa"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete("20240101-000000-aaaa"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound on second delete, got %v", err)
+	}
+}
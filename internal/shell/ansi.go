@@ -0,0 +1,94 @@
+package shell
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// StripANSI returns terminal output as plain text. Escape sequences (colors,
+// cursor movement, titles) are removed and CRLF line endings become LF. As
+// on a terminal, a carriage return goes back to the start of the line and a
+// backspace one character, so what follows overwrites it, and erasing to the
+// end of the line removes the rest; a progress bar that redraws its line
+// leaves only its last state.
+func StripANSI(s string) string {
+	var out strings.Builder
+	var line []rune // the current line, rewritten by \r and \b
+	col := 0
+	flush := func() {
+		out.WriteString(string(line))
+		line, col = line[:0], 0
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\x1b':
+			end := skipEscape(s, i)
+			if s[end] == 'K' && i+1 < end && s[i+1] == '[' && col < len(line) {
+				line = line[:col]
+			}
+			i = end
+			continue
+		case '\n':
+			flush()
+			out.WriteByte('\n')
+			continue
+		case '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				continue
+			}
+			col = 0
+			continue
+		case '\b':
+			if col > 0 {
+				col--
+			}
+			continue
+		case '\a', '\x00':
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		i += n - 1
+		if col < len(line) {
+			line[col] = r
+		} else {
+			line = append(line, r)
+		}
+		col++
+	}
+	flush()
+	return out.String()
+}
+
+// skipEscape returns the index of the last byte of the escape sequence that
+// starts at s[i].
+func skipEscape(s string, i int) int {
+	if i+1 >= len(s) {
+		return i
+	}
+	switch s[i+1] {
+	case '[': // CSI: parameters, then a final byte in @ to ~
+		for j := i + 2; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return j
+			}
+		}
+		return len(s) - 1
+	case ']', 'P', '_', '^': // OSC and other strings, ended by BEL or ESC \
+		for j := i + 2; j < len(s); j++ {
+			if s[j] == '\a' {
+				return j
+			}
+			if s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(s) - 1
+	case '(', ')', '*', '+': // character set selection
+		if i+2 < len(s) {
+			return i + 2
+		}
+		return len(s) - 1
+	}
+	return i + 1
+}
@@ -0,0 +1,22 @@
+package shell
+
+import "testing"
+
+func TestStripANSI(t *testing.T) {
+	cases := map[string]string{
+		"plain\n":                               "plain\n",
+		"\x1b[1;32mok\x1b[0m\r\n":               "ok\n",
+		"\x1b]0;title\aprompt$ ":                "prompt$ ",
+		" 10%\r 50%\r100%\n":                    "100%\n",
+		"working...\r\x1b[Kdone\n":              "done\n",
+		"abc\b\bX\n":                            "aXc\n",
+		"héllo\rH\n":                            "Héllo\n",
+		"\x1b[?25l\x1b(Bhidden cursor\x1b[?25h": "hidden cursor",
+		"a\x1b[2Kb":                             "ab",
+	}
+	for in, want := range cases {
+		if got := StripANSI(in); got != want {
+			t.Errorf("StripANSI(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
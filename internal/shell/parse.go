@@ -0,0 +1,595 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SimpleCommand is a simple command found in a bash command line.
+type SimpleCommand struct {
+	// Args holds the words after quote removal. Expansions are kept as
+	// written, e.g. "$HOME" or "$(...)".
+	Args []string
+	// Assigns holds leading NAME=value words.
+	Assigns   []string
+	Redirects []Redirect
+	// Dynamic reports that what the command runs cannot be known before
+	// running it: its name contains an expansion or, once unwrapped by the
+	// policy checks, it is a shell reading its script from stdin.
+	Dynamic bool
+	// Text is the command's source text.
+	Text string
+}
+
+// Redirect is a redirection such as "> out.txt" or "2>&1".
+type Redirect struct {
+	Op     string
+	Target string
+}
+
+// Parse splits a bash command line into its simple commands: the parts of
+// pipelines and &&, || and ; lists, and the commands inside subshells,
+// groups, if/while/for bodies, command and process substitutions, and
+// here-documents. Syntax it does not understand (case statements, function
+// definitions, arithmetic commands) is an error rather than a guess.
+func Parse(src string) ([]SimpleCommand, error) {
+	p := &parser{src: src}
+	if err := p.list(0); err != nil {
+		return nil, err
+	}
+	return p.cmds, nil
+}
+
+type parser struct {
+	src      string
+	pos      int
+	cmds     []SimpleCommand
+	heredocs []heredoc
+}
+
+type heredoc struct {
+	delim  string
+	strip  bool // <<- strips leading tabs
+	quoted bool // a quoted delimiter disables expansions in the body
+}
+
+type word struct {
+	text    string
+	quoted  bool
+	dynamic bool
+	assign  bool // starts with an unquoted NAME=
+}
+
+var errUnsupported = errors.New("unsupported syntax")
+
+// prefixKeywords may start a command and are followed by another command.
+var prefixKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "do": true,
+	"while": true, "until": true, "!": true, "{": true,
+}
+
+// endKeywords close a compound command.
+var endKeywords = map[string]bool{"fi": true, "done": true, "}": true}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek(s string) bool { return strings.HasPrefix(p.src[p.pos:], s) }
+
+// escape skips a backslash and the character it escapes.
+func (p *parser) escape() error {
+	if p.pos+1 >= len(p.src) {
+		return errors.New("unterminated escape")
+	}
+	p.pos += 2
+	return nil
+}
+
+// list parses commands until close (')' for subshells and substitutions, 0
+// for the end of input).
+func (p *parser) list(close byte) error {
+	for {
+		p.skipBlanks()
+		if p.eof() {
+			if close != 0 {
+				return fmt.Errorf("missing %q", close)
+			}
+			return nil
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == close:
+			p.pos++
+			return nil
+		case c == ')':
+			return errors.New("unexpected \")\"")
+		case c == '\n':
+			p.pos++
+			if err := p.readHeredocs(); err != nil {
+				return err
+			}
+		case c == ';' && p.peek(";;"):
+			return fmt.Errorf("%w: case statement", errUnsupported)
+		case c == ';' || c == '|' || c == '&' && !p.peek("&>"):
+			p.pos++
+		default:
+			if err := p.command(close); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *parser) skipBlanks() {
+	for !p.eof() {
+		switch {
+		case p.src[p.pos] == ' ' || p.src[p.pos] == '\t':
+			p.pos++
+		case p.peek("\\\n"):
+			p.pos += 2
+		case p.src[p.pos] == '#':
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// command parses one simple command, subshell or keyword-prefixed command.
+func (p *parser) command(close byte) error {
+	if p.peek("((") {
+		return fmt.Errorf("%w: arithmetic command", errUnsupported)
+	}
+	if p.src[p.pos] == '(' {
+		p.pos++
+		if err := p.list(')'); err != nil {
+			return err
+		}
+		_, err := p.redirects()
+		return err
+	}
+
+	start := p.pos
+	var words []word
+	var redirs []Redirect
+	for {
+		p.skipBlanks()
+		if p.eof() {
+			break
+		}
+		c := p.src[p.pos]
+		if c == '\n' || c == ';' || c == '|' || c == ')' || c == '&' && !p.peek("&>") {
+			break
+		}
+		if c == '(' {
+			if len(words) == 1 {
+				return fmt.Errorf("%w: function definition", errUnsupported)
+			}
+			return errors.New("unexpected \"(\"")
+		}
+		if r, ok, err := p.redirect(); err != nil {
+			return err
+		} else if ok {
+			redirs = append(redirs, r)
+			continue
+		}
+		w, err := p.word()
+		if err != nil {
+			return err
+		}
+		if len(words) == 0 && len(redirs) == 0 && !w.quoted && prefixKeywords[w.text] {
+			start = p.pos
+			continue
+		}
+		words = append(words, w)
+	}
+	text := strings.TrimSpace(p.src[start:p.pos])
+
+	for len(words) > 0 && !words[0].quoted && endKeywords[words[0].text] {
+		words = words[1:]
+	}
+	if len(words) > 0 && !words[0].quoted {
+		switch words[0].text {
+		case "for", "select":
+			// the loop header only holds words; their substitutions were
+			// collected while reading them
+			return nil
+		case "case", "function", "coproc":
+			return fmt.Errorf("%w: %s", errUnsupported, words[0].text)
+		}
+	}
+
+	cmd := SimpleCommand{Redirects: redirs, Text: text}
+	for i, w := range words {
+		if len(cmd.Args) == 0 && w.assign {
+			cmd.Assigns = append(cmd.Assigns, w.text)
+			continue
+		}
+		if len(cmd.Args) == 0 {
+			cmd.Dynamic = w.dynamic
+		}
+		cmd.Args = append(cmd.Args, words[i].text)
+	}
+	if len(cmd.Args) > 0 {
+		p.cmds = append(p.cmds, cmd)
+	}
+	return nil
+}
+
+func isAssignment(s string) bool {
+	eq := strings.IndexByte(s, '=')
+	if eq <= 0 {
+		return false
+	}
+	name := strings.TrimSuffix(s[:eq], "+")
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// redirects parses the redirections after a subshell.
+func (p *parser) redirects() ([]Redirect, error) {
+	var out []Redirect
+	for {
+		p.skipBlanks()
+		if p.eof() {
+			return out, nil
+		}
+		r, ok, err := p.redirect()
+		if err != nil || !ok {
+			return out, err
+		}
+		out = append(out, r)
+	}
+}
+
+var redirectOps = []string{"&>>", "&>", "<<<", "<<-", "<<", "<>", "<&", ">>", ">&", ">|", "<", ">"}
+
+// redirect parses a redirection at the current position, if there is one.
+func (p *parser) redirect() (Redirect, bool, error) {
+	i := p.pos
+	for i < len(p.src) && p.src[i] >= '0' && p.src[i] <= '9' {
+		i++
+	}
+	if i == p.pos && strings.HasPrefix(p.src[i:], "{") {
+		if end := strings.IndexByte(p.src[i:], '}'); end > 0 && i+end+1 < len(p.src) && strings.ContainsRune("<>", rune(p.src[i+end+1])) {
+			i += end + 1
+		}
+	}
+	rest := p.src[i:]
+	if strings.HasPrefix(rest, "<(") || strings.HasPrefix(rest, ">(") {
+		return Redirect{}, false, nil
+	}
+	var op string
+	for _, o := range redirectOps {
+		if strings.HasPrefix(rest, o) && (o[0] != '&' || i == p.pos) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return Redirect{}, false, nil
+	}
+	p.pos = i + len(op)
+	p.skipBlanks()
+	if p.eof() || strings.ContainsRune("\n;|&<>()", rune(p.src[p.pos])) {
+		return Redirect{}, false, fmt.Errorf("missing target for %q", op)
+	}
+	w, err := p.word()
+	if err != nil {
+		return Redirect{}, false, err
+	}
+	if op == "<<" || op == "<<-" {
+		p.heredocs = append(p.heredocs, heredoc{delim: w.text, strip: op == "<<-", quoted: w.quoted})
+	}
+	return Redirect{Op: op, Target: w.text}, true, nil
+}
+
+// readHeredocs consumes the bodies of pending here-documents, which start
+// on the line after their redirection.
+func (p *parser) readHeredocs() error {
+	pending := p.heredocs
+	p.heredocs = nil
+	for _, h := range pending {
+		var body strings.Builder
+		for !p.eof() {
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			line := p.src[p.pos:]
+			if end >= 0 {
+				line = p.src[p.pos : p.pos+end]
+				p.pos += end + 1
+			} else {
+				p.pos = len(p.src)
+			}
+			if h.strip {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == h.delim {
+				break
+			}
+			body.WriteString(line)
+			body.WriteByte('\n')
+		}
+		if !h.quoted {
+			sub := &parser{src: body.String()}
+			if err := sub.expansions(); err != nil {
+				return err
+			}
+			p.cmds = append(p.cmds, sub.cmds...)
+		}
+	}
+	return nil
+}
+
+// expansions scans text that is not split into commands (a here-document
+// body) and parses the command substitutions in it.
+func (p *parser) expansions() error {
+	var b strings.Builder
+	for !p.eof() {
+		switch p.src[p.pos] {
+		case '\\':
+			if err := p.escape(); err != nil {
+				return err
+			}
+		case '$':
+			if _, err := p.dollar(&b); err != nil {
+				return err
+			}
+		case '`':
+			if err := p.backtick(&b); err != nil {
+				return err
+			}
+		default:
+			p.pos++
+		}
+	}
+	return nil
+}
+
+// word reads one word, parsing any substitutions inside it.
+func (p *parser) word() (word, error) {
+	var w word
+	var b strings.Builder
+	start := p.pos
+	for !p.eof() {
+		c := p.src[p.pos]
+		switch {
+		case (c == '<' || c == '>') && p.pos+1 < len(p.src) && p.src[p.pos+1] == '(':
+			p.pos += 2
+			if err := p.list(')'); err != nil {
+				return w, err
+			}
+			b.WriteString(string(c) + "(...)")
+			w.dynamic = true
+		case c == '(' && isAssignment(b.String()) && strings.HasSuffix(b.String(), "="):
+			// array assignment: NAME=(a b c)
+			end := strings.IndexByte(p.src[p.pos:], ')')
+			if end < 0 {
+				return w, errors.New("missing \")\"")
+			}
+			b.WriteString(p.src[p.pos : p.pos+end+1])
+			p.pos += end + 1
+		case strings.IndexByte(" \t\n;&|<>()", c) >= 0:
+			if p.pos == start {
+				return w, fmt.Errorf("unexpected %q", c)
+			}
+			w.text = b.String()
+			return w, nil
+		case c == '\\':
+			if p.peek("\\\n") {
+				p.pos += 2
+				continue
+			}
+			if err := p.escape(); err != nil {
+				return w, err
+			}
+			b.WriteByte(p.src[p.pos-1])
+			w.quoted = true
+		case c == '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return w, errors.New("unterminated single quote")
+			}
+			b.WriteString(p.src[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+			w.quoted = true
+		case c == '"':
+			p.pos++
+			dyn, err := p.doubleQuoted(&b)
+			if err != nil {
+				return w, err
+			}
+			w.quoted = true
+			w.dynamic = w.dynamic || dyn
+		case c == '$':
+			dyn, err := p.dollar(&b)
+			if err != nil {
+				return w, err
+			}
+			w.dynamic = w.dynamic || dyn
+		case c == '`':
+			if err := p.backtick(&b); err != nil {
+				return w, err
+			}
+			w.dynamic = true
+		default:
+			if c == '=' && !w.quoted && !w.assign && b.Len() > 0 {
+				w.assign = isAssignment(b.String() + "=")
+			}
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	w.text = b.String()
+	return w, nil
+}
+
+// doubleQuoted reads up to the closing double quote.
+func (p *parser) doubleQuoted(b *strings.Builder) (bool, error) {
+	dynamic := false
+	for !p.eof() {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return dynamic, nil
+		case '\\':
+			if p.pos+1 < len(p.src) && strings.IndexByte("$`\"\\\n", p.src[p.pos+1]) >= 0 {
+				if p.src[p.pos+1] != '\n' {
+					b.WriteByte(p.src[p.pos+1])
+				}
+				p.pos += 2
+				continue
+			}
+			b.WriteByte(c)
+			p.pos++
+		case '$':
+			dyn, err := p.dollar(b)
+			if err != nil {
+				return false, err
+			}
+			dynamic = dynamic || dyn
+		case '`':
+			if err := p.backtick(b); err != nil {
+				return false, err
+			}
+			dynamic = true
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return false, errors.New("unterminated double quote")
+}
+
+// dollar reads an expansion starting with '$' and reports whether it is one
+// (a lone '$' is literal).
+func (p *parser) dollar(b *strings.Builder) (bool, error) {
+	start := p.pos
+	switch {
+	case p.peek("$(("):
+		p.pos += 3
+		if err := p.balanced('(', ')', 2); err != nil {
+			return false, err
+		}
+	case p.peek("$("):
+		p.pos += 2
+		if err := p.list(')'); err != nil {
+			return false, err
+		}
+		b.WriteString("$(...)")
+		return true, nil
+	case p.peek("${"):
+		p.pos += 2
+		if err := p.balanced('{', '}', 1); err != nil {
+			return false, err
+		}
+	case p.peek("$'"):
+		// ANSI-C quoting: keep the escapes as written
+		end := p.pos + 2
+		for end < len(p.src) && p.src[end] != '\'' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			return false, errors.New("unterminated $' quote")
+		}
+		b.WriteString(p.src[p.pos+2 : end])
+		p.pos = end + 1
+		return false, nil
+	default:
+		p.pos++
+		if p.eof() {
+			b.WriteByte('$')
+			return false, nil
+		}
+		c := p.src[p.pos]
+		switch {
+		case strings.IndexByte("@*#?$!-0123456789", c) >= 0:
+			p.pos++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			for !p.eof() {
+				c := p.src[p.pos]
+				if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+					break
+				}
+				p.pos++
+			}
+		default:
+			b.WriteByte('$')
+			return false, nil
+		}
+	}
+	b.WriteString(p.src[start:p.pos])
+	return true, nil
+}
+
+// balanced skips to the depth-th unmatched close, parsing the command
+// substitutions it passes.
+func (p *parser) balanced(open, close byte, depth int) error {
+	var discard strings.Builder
+	for !p.eof() {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\':
+			if err := p.escape(); err != nil {
+				return err
+			}
+		case c == '$' && !p.peek("$(("):
+			if _, err := p.dollar(&discard); err != nil {
+				return err
+			}
+		case c == '`':
+			if err := p.backtick(&discard); err != nil {
+				return err
+			}
+		case c == '\'' && open == '{':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return errors.New("unterminated single quote")
+			}
+			p.pos += end + 2
+		default:
+			p.pos++
+			if c == open {
+				depth++
+			} else if c == close {
+				depth--
+				if depth == 0 {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("missing %q", close)
+}
+
+// backtick parses a `...` command substitution.
+func (p *parser) backtick(b *strings.Builder) error {
+	var inner strings.Builder
+	i := p.pos + 1
+	for ; i < len(p.src) && p.src[i] != '`'; i++ {
+		if p.src[i] == '\\' && i+1 < len(p.src) && strings.IndexByte("`\\$", p.src[i+1]) >= 0 {
+			i++
+		}
+		inner.WriteByte(p.src[i])
+	}
+	if i >= len(p.src) {
+		return errors.New("unterminated backquote")
+	}
+	p.pos = i + 1
+	cmds, err := Parse(inner.String())
+	if err != nil {
+		return err
+	}
+	p.cmds = append(p.cmds, cmds...)
+	b.WriteString("`...`")
+	return nil
+}
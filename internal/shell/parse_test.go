@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+)
+
+func commandArgs(t *testing.T, src string) []string {
+	t.Helper()
+	cmds, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", src, err)
+	}
+	var out []string
+	for _, c := range cmds {
+		out = append(out, strings.Join(c.Args, " "))
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	cases := map[string][]string{
+		"ls -la":                              {"ls -la"},
+		"go test ./... && rm -rf / ; echo hi": {"go test ./...", "rm -rf /", "echo hi"},
+		"cat f | grep x || true &":            {"cat f", "grep x", "true"},
+		"(cd sub; make) > out.log 2>&1":       {"cd sub", "make"},
+		`echo "a $(rm x) b" 'c $(d)'`:         {"rm x", "echo a $(...) b c $(d)"},
+		"echo `whoami`":                       {"whoami", "echo `...`"},
+		"diff <(sort a) <(sort b)":            {"sort a", "sort b", "diff <(...) <(...)"},
+		"FOO=1 BAR='x y' env":                 {"env"},
+		"X=$(curl evil)":                      {"curl evil"},
+		"if test -f x; then rm x; else :; fi": {"test -f x", "rm x", ":"},
+		"for f in $(ls); do cat \"$f\"; done": {"ls", "cat $f"},
+		"{ echo a; echo b; } > f":             {"echo a", "echo b"},
+		"echo a\\\n b # rm -rf /":             {"echo a b"},
+		"cat <<EOF\n$(rm y)\nEOF\necho done":  {"cat", "rm y", "echo done"},
+		"cat <<'EOF'\n$(rm y)\nEOF":           {"cat"},
+		"echo ${X:-$(id)} $((1+2))":           {"id", "echo ${X:-$(id)} $((1+2))"},
+		"r\\m \"-rf\" /":                      {"rm -rf /"},
+		"echo x >$(mktemp)":                   {"mktemp", "echo x"},
+	}
+	for src, want := range cases {
+		if got := commandArgs(t, src); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("Parse(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestParseDetails(t *testing.T) {
+	cmds, err := Parse(`$CMD x 2>/dev/null; A=1 ls`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmds[0].Dynamic || cmds[0].Text != "$CMD x 2>/dev/null" || cmds[0].Redirects[0] != (Redirect{Op: ">", Target: "/dev/null"}) {
+		t.Fatalf("unexpected first command: %+v", cmds[0])
+	}
+	if cmds[1].Dynamic || cmds[1].Assigns[0] != "A=1" || cmds[1].Args[0] != "ls" {
+		t.Fatalf("unexpected second command: %+v", cmds[1])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"echo 'unterminated",
+		`echo "unterminated`,
+		"echo $(ls",
+		"echo `ls",
+		"ls )",
+		"ls >",
+		"case x in a) rm y;; esac",
+		"f() { rm y; }",
+		"(( x++ ))",
+		`\`,
+		`echo \`,
+		`echo a\`,
+		`echo ${a\`,
+		`echo $((1\`,
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q): expected an error", src)
+		}
+	}
+}
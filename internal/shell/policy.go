@@ -0,0 +1,570 @@
+package shell
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Policy rules are either a regular expression between slashes, matched
+// against a command's words joined by spaces (deny patterns are also matched
+// against the whole command line), or words: a program glob, then
+// argument globs, where words starting with "-" are flags that must be
+// present anywhere in the command. Short flags may be combined, so "rm -rf"
+// also matches "rm -fr /" and "rm -r -f /".
+//
+// An allow rule matches a command whose program matches the first word and
+// whose leading non-flag arguments match the remaining words. A deny rule
+// matches a command containing its words in order anywhere, so "rm" also
+// catches "xargs rm" and "sudo rm". For deny rules, common long options
+// count as their short flags ("rm --recursive --force" matches "rm -rf"),
+// and a command whose program is an expansion, such as "$CMD", or a shell
+// reading its script from stdin, such as "curl ... | sh", matches every rule
+// list.
+
+// maxNesting bounds how deep "bash -c" and wrapper commands are unwrapped.
+const maxNesting = 8
+
+// CheckPolicy reports whether cmd may run under the allow and deny rules,
+// and if not, which part of it failed. Every simple command in cmd must pass:
+// none may match a deny rule and, if there are allow rules, each must match
+// one. Commands run through wrappers such as env, sudo, xargs or bash -c are
+// checked both as written and as the command they run. A command line that
+// cannot be parsed is refused.
+func CheckPolicy(cmd string, allow, deny []string) (bool, string) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return true, ""
+	}
+	refusal := "not allowed by policy"
+	if len(allow) == 0 {
+		refusal = "denied by policy"
+	}
+	if _, err := split(cmd); err != nil {
+		return false, fmt.Sprintf("%s: %v", refusal, err)
+	}
+	part, rule, err := MatchDeny(cmd, deny)
+	if err != nil {
+		return false, fmt.Sprintf("denied by policy: %v", err)
+	}
+	if part != "" && rule == "" {
+		return false, fmt.Sprintf("denied by policy: what %q runs is not known until it runs", part)
+	}
+	if part != "" {
+		return false, fmt.Sprintf("denied by policy: %q matches deny rule %q", part, rule)
+	}
+	if len(allow) == 0 {
+		return true, ""
+	}
+	part, why, err := MatchAllow(cmd, allow)
+	if err != nil {
+		return false, fmt.Sprintf("not allowed by policy: %v", err)
+	}
+	if part != "" {
+		return false, "not allowed by policy: " + why
+	}
+	return true, ""
+}
+
+// MatchDeny returns the first part of cmd matching one of rules as a deny
+// rule, and that rule. Regular expressions are also matched against the
+// whole line, which is then the part returned. A part whose program is an
+// expansion matches any rules, with rule "". part is "" if nothing matches.
+func MatchDeny(cmd string, rules []string) (part, rule string, err error) {
+	parsed, err := parseRules(rules)
+	if err != nil || len(parsed) == 0 {
+		return "", "", err
+	}
+	parts, err := split(cmd)
+	if err != nil {
+		return "", "", err
+	}
+	for _, r := range parsed {
+		// a pattern may span several commands, such as "curl ... | sh"
+		if r.re != nil && r.re.MatchString(cmd) {
+			return cmd, r.raw, nil
+		}
+	}
+	for _, p := range parts {
+		for _, l := range p.layers {
+			if l.Dynamic {
+				// it could be any program, so it could match any rule
+				return l.Text, "", nil
+			}
+			for _, r := range parsed {
+				if r.denies(l) {
+					return l.Text, r.raw, nil
+				}
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// MatchAllow returns the first part of cmd that no rule allows and why, or
+// "" if every part is allowed. A part whose program is an expansion, such as
+// "$CMD", is never allowed.
+func MatchAllow(cmd string, rules []string) (part, why string, err error) {
+	parsed, err := parseRules(rules)
+	if err != nil {
+		return "", "", err
+	}
+	parts, err := split(cmd)
+	if err != nil {
+		return "", "", err
+	}
+	for _, p := range parts {
+		for _, l := range p.inner {
+			if l.Dynamic {
+				return l.Text, fmt.Sprintf("what %q runs is not known until it runs", l.Text), nil
+			}
+			if !anyAllows(parsed, l) {
+				return l.Text, fmt.Sprintf("%q does not match an allow rule", l.Text), nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// ValidRule reports whether rule can be used as an allow or deny rule.
+func ValidRule(rule string) error {
+	_, err := parseRule(rule)
+	return err
+}
+
+// part is a simple command of a command line with the commands it runs
+// through wrappers: layers from outermost to innermost, and the innermost
+// ones that really execute.
+type part struct {
+	layers, inner []SimpleCommand
+}
+
+func split(cmd string) ([]part, error) {
+	cmds, err := Parse(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse command: %v", err)
+	}
+	parts := make([]part, 0, len(cmds))
+	for _, c := range cmds {
+		layers, inner, err := unwrap(c, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %v", c.Text, err)
+		}
+		parts = append(parts, part{layers: layers, inner: inner})
+	}
+	return parts, nil
+}
+
+// RuleCovers reports whether every command allowed by the rule child is
+// also allowed by the rule parent. It is conservative: a regular expression
+// only covers itself.
+func RuleCovers(parent, child string) bool {
+	p, err := parseRule(parent)
+	if err != nil {
+		return false
+	}
+	c, err := parseRule(child)
+	if err != nil {
+		return false
+	}
+	if p.re != nil || c.re != nil {
+		return p.raw == c.raw
+	}
+	if len(p.words) == 0 || len(c.words) < len(p.words) {
+		return false
+	}
+	for i, w := range p.words {
+		if c.words[i] != w && (hasGlob(c.words[i]) || !globMatch(w, c.words[i])) {
+			return false
+		}
+	}
+	for _, f := range p.flags {
+		if !contains(c.flags, f) {
+			return false
+		}
+	}
+	return true
+}
+
+type rule struct {
+	raw   string
+	re    *regexp.Regexp
+	words []string
+	flags []string
+}
+
+func parseRules(list []string) ([]rule, error) {
+	var out []rule
+	for _, s := range list {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		r, err := parseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func parseRule(s string) (rule, error) {
+	r := rule{raw: strings.TrimSpace(s)}
+	if len(r.raw) >= 2 && strings.HasPrefix(r.raw, "/") && strings.HasSuffix(r.raw, "/") {
+		re, err := regexp.Compile(r.raw[1 : len(r.raw)-1])
+		if err != nil {
+			return r, fmt.Errorf("invalid rule %q: %v", r.raw, err)
+		}
+		r.re = re
+		return r, nil
+	}
+	for _, w := range strings.Fields(r.raw) {
+		if len(w) > 1 && w[0] == '-' {
+			r.flags = append(r.flags, w)
+		} else {
+			r.words = append(r.words, w)
+		}
+	}
+	return r, nil
+}
+
+func anyAllows(rules []rule, c SimpleCommand) bool {
+	for _, r := range rules {
+		if r.allows(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows matches the program and leading arguments.
+func (r rule) allows(c SimpleCommand) bool {
+	if r.re != nil {
+		return r.re.MatchString(strings.Join(c.Args, " "))
+	}
+	if len(r.words) == 0 || !matchProgram(r.words[0], c.Args[0]) || !r.hasFlags(c, false) {
+		return false
+	}
+	args := positional(c.Args[1:])
+	if len(args) < len(r.words)-1 {
+		return false
+	}
+	for i, w := range r.words[1:] {
+		if !globMatch(w, args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// denies matches the rule's words in order anywhere in the command.
+func (r rule) denies(c SimpleCommand) bool {
+	if r.re != nil {
+		return r.re.MatchString(strings.Join(c.Args, " ")) || r.re.MatchString(c.Text)
+	}
+	if !r.hasFlags(c, true) {
+		return false
+	}
+	i := 0
+	for _, a := range append(c.Args[:1:1], positional(c.Args[1:])...) {
+		if i < len(r.words) && (i == 0 && matchProgram(r.words[0], a) || i > 0 && globMatch(r.words[i], a)) {
+			i++
+		}
+	}
+	return i == len(r.words)
+}
+
+// hasFlags reports whether c has all of the rule's flags. With aliases,
+// the long options in longFlags also count as their short flags.
+func (r rule) hasFlags(c SimpleCommand, aliases bool) bool {
+	for _, f := range r.flags {
+		if !hasFlag(c.Args[1:], f, aliases) {
+			return false
+		}
+	}
+	return true
+}
+
+// longFlags maps common long options to the short flags they stand for.
+// "--recursive" is -r for rm, cp and grep but -R for chmod and chown, so it
+// counts as both.
+var longFlags = map[string]string{
+	"--recursive": "rR",
+	"--force":     "f",
+	"--all":       "a",
+	"--delete":    "d",
+	"--verbose":   "v",
+}
+
+// positional returns the arguments that are not flags.
+func positional(args []string) []string {
+	var out []string
+	for i, a := range args {
+		if a == "--" {
+			return append(out, args[i+1:]...)
+		}
+		if len(a) < 2 || a[0] != '-' {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// hasFlag reports whether args contain flag, allowing short flags to be
+// combined ("-rf" is present in "-f -r" and "-vfr"). With aliases, the
+// options in longFlags are also taken as their short flags, and the other
+// way round.
+func hasFlag(args []string, flag string, aliases bool) bool {
+	long := strings.HasPrefix(flag, "--")
+	short := map[rune]bool{}
+	for _, a := range args {
+		if a == "--" {
+			break
+		}
+		if len(a) < 2 || a[0] != '-' {
+			continue
+		}
+		if globMatch(flag, a) || long && strings.HasPrefix(a, flag+"=") {
+			return true
+		}
+		if !strings.HasPrefix(a, "--") {
+			for _, c := range a[1:] {
+				short[c] = true
+			}
+		} else if aliases {
+			name, _, _ := strings.Cut(a, "=")
+			for _, c := range longFlags[name] {
+				short[c] = true
+			}
+		}
+	}
+	if hasGlob(flag) {
+		return false
+	}
+	if long {
+		for _, c := range longFlags[flag] {
+			if aliases && short[c] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range flag[1:] {
+		if !short[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchProgram matches a word glob against an argument or, for a program
+// run by path, its base name.
+func matchProgram(pattern, arg string) bool {
+	return globMatch(pattern, arg) || !strings.Contains(pattern, "/") && strings.Contains(arg, "/") && globMatch(pattern, filepath.Base(arg))
+}
+
+func hasGlob(s string) bool { return strings.ContainsAny(s, "*?[") }
+
+// globMatch matches shell-style patterns where "*" also matches "/".
+func globMatch(pattern, s string) bool {
+	if !hasGlob(pattern) {
+		return pattern == s
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	return err == nil && re.MatchString(s)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapper describes a command that runs another command given as its
+// arguments: the options that take a value and how many operands come
+// before the command.
+type wrapper struct {
+	valueFlags string
+	operands   int
+}
+
+var wrappers = map[string]wrapper{
+	"env":     {valueFlags: "uCS", operands: 0},
+	"sudo":    {valueFlags: "ugCDhprtU", operands: 0},
+	"doas":    {valueFlags: "uC", operands: 0},
+	"nohup":   {},
+	"time":    {},
+	"nice":    {valueFlags: "n"},
+	"ionice":  {valueFlags: "cnp"},
+	"timeout": {valueFlags: "sk", operands: 1},
+	"exec":    {valueFlags: "a"},
+	"command": {},
+	"builtin": {},
+	"setsid":  {},
+	"stdbuf":  {valueFlags: "ioe"},
+	"xargs":   {valueFlags: "aEeIiLlnPsd"},
+	"chrt":    {operands: 1},
+	"watch":   {valueFlags: "nd"},
+	"strace":  {valueFlags: "eoPpSsUuXI"},
+}
+
+var privileged = map[string]bool{"sudo": true, "doas": true}
+
+var shells = map[string]bool{"bash": true, "sh": true, "dash": true, "zsh": true, "ksh": true}
+
+// unwrap returns the commands c runs, outermost first, and the innermost
+// ones, which are what c really executes.
+func unwrap(c SimpleCommand, depth int) (layers, inner []SimpleCommand, err error) {
+	if depth > maxNesting {
+		return nil, nil, fmt.Errorf("commands nested more than %d deep", maxNesting)
+	}
+	layers = []SimpleCommand{c}
+	if c.Dynamic {
+		return layers, layers, nil
+	}
+	name := filepath.Base(c.Args[0])
+
+	var script string
+	var scripted bool
+	switch {
+	case name == "eval":
+		script, scripted = strings.Join(c.Args[1:], " "), true
+	case shells[name]:
+		script, scripted = shellScript(c.Args[1:])
+		if !scripted && shellReadsStdin(c.Args[1:]) {
+			// "echo ... | bash": the script is not known until it runs
+			c.Dynamic = true
+			return []SimpleCommand{c}, []SimpleCommand{c}, nil
+		}
+	}
+	if scripted {
+		cmds, err := Parse(script)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, sub := range cmds {
+			l, in, err := unwrap(sub, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			layers = append(layers, l...)
+			inner = append(inner, in...)
+		}
+		return layers, inner, nil
+	}
+
+	w, ok := wrappers[name]
+	if !ok {
+		return layers, layers, nil
+	}
+	rest := skipOptions(c.Args[1:], w, name == "env")
+	if len(rest) == 0 {
+		return layers, layers, nil
+	}
+	sub := SimpleCommand{Args: rest, Text: strings.Join(rest, " ")}
+	l, in, err := unwrap(sub, depth+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if privileged[name] {
+		// running as another user needs allowing in its own right
+		in = append([]SimpleCommand{c}, in...)
+	}
+	return append(layers, l...), in, nil
+}
+
+// shellScript returns the script of "bash -c SCRIPT ...".
+func shellScript(args []string) (string, bool) {
+	for i, a := range args {
+		if len(a) < 2 || a[0] != '-' || a == "--" {
+			return "", false
+		}
+		if !strings.HasPrefix(a, "--") && strings.ContainsRune(a[1:], 'c') {
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// shellReadsStdin reports whether a shell run with args and no -c reads
+// its script from stdin: with -s, or with no script file operand.
+func shellReadsStdin(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-" || a == "--":
+			return i+1 == len(args)
+		case a == "--rcfile" || a == "--init-file":
+			i++
+		case len(a) < 2 || a[0] != '-' && a[0] != '+':
+			// the script file
+			return false
+		case a[0] == '-' && a[1] != '-' && strings.ContainsRune(a[1:], 's'):
+			return true
+		case a[1] != '-' && strings.ContainsAny(a[1:], "oO"):
+			// -o/+o and -O/+O take an option name
+			i++
+		}
+	}
+	return true
+}
+
+// skipOptions drops a wrapper's options and operands, returning the command
+// it runs.
+func skipOptions(args []string, w wrapper, assigns bool) []string {
+	i := 0
+	for i < len(args) {
+		a := args[i]
+		if a == "--" {
+			i++
+			break
+		}
+		if assigns && isAssignment(a) {
+			i++
+			continue
+		}
+		if len(a) < 2 || a[0] != '-' {
+			break
+		}
+		i++
+		if !strings.HasPrefix(a, "--") && len(a) == 2 && strings.IndexByte(w.valueFlags, a[1]) >= 0 {
+			i++
+		}
+	}
+	i += w.operands
+	if i >= len(args) {
+		return nil
+	}
+	return args[i:]
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op on Windows; exec.CommandContext kills the
+// direct child only.
+func setProcessGroup(c *exec.Cmd) {}
+
+// signalGroup is a no-op on Windows, which has no process groups to signal;
+// stopping a process falls back to killing it through its context.
+func signalGroup(pid int, sig syscall.Signal) {}
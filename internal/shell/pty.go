@@ -0,0 +1,56 @@
+package shell
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultIdleTimeout is how long a command run by RunPTY may go without
+	// output before it is killed, unless PTYOptions says otherwise.
+	DefaultIdleTimeout = 2 * time.Minute
+	// inputQuiet is how long a terminal command must be silent before
+	// RunPTY checks whether it is waiting for input.
+	inputQuiet = 500 * time.Millisecond
+	// ptyPoll is how often RunPTY checks on a terminal command.
+	ptyPoll = 100 * time.Millisecond
+	// ptyBufferBytes is how much terminal output RunPTY keeps.
+	ptyBufferBytes = 1 << 20
+	// the terminal's size, wide enough that progress bars rarely wrap
+	ptyRows, ptyColumns = 50, 200
+)
+
+// ptyEnv is added to the environment of terminal commands: a terminal type
+// most programs know, its size, and pagers that print instead of waiting
+// for keys.
+var ptyEnv = []string{
+	"TERM=xterm-256color",
+	"LINES=" + strconv.Itoa(ptyRows),
+	"COLUMNS=" + strconv.Itoa(ptyColumns),
+	"PAGER=cat",
+	"GIT_PAGER=cat",
+}
+
+// PTYOptions configures RunPTY.
+type PTYOptions struct {
+	// Stdin is typed into the terminal a line at a time, each time the
+	// command waits for input. A final newline is added if it has none.
+	Stdin string
+	// IdleTimeout kills the command after that long without output. Zero
+	// means DefaultIdleTimeout, and a negative value no limit.
+	IdleTimeout time.Duration
+}
+
+// PTYResult is the outcome of a command run by RunPTY.
+type PTYResult struct {
+	// Output is what the command wrote to the terminal, stdout and stderr
+	// together with the echo of Stdin, as plain text (see StripANSI). Only
+	// the last 1 MiB is kept.
+	Output   string
+	ExitCode int
+	// WaitingForInput reports that the command was killed because it was
+	// waiting for input after all of Stdin had been typed. Idle reports
+	// that it was killed after IdleTimeout without output.
+	WaitingForInput bool
+	Idle            bool
+}
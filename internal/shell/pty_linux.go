@@ -0,0 +1,292 @@
+//go:build linux
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// PTYSupported reports whether RunPTY works on this platform.
+const PTYSupported = true
+
+// RunPTY runs cmd with runner r, which must implement Starter, on a new
+// pseudo-terminal, so programs behave as they do for a user: they see a
+// terminal on stdin, stdout and stderr, and can prompt for input. The
+// command is killed when it reads the terminal with nothing left to read,
+// since nobody will answer, or when it has written nothing for the idle
+// timeout. An error means the command could not be started.
+func RunPTY(ctx context.Context, r Runner, cmd, cwd string, opts PTYOptions) (PTYResult, error) {
+	st, ok := r.(Starter)
+	if !ok {
+		return PTYResult{}, errors.New("the shell runner cannot run commands on a terminal")
+	}
+	idle := opts.IdleTimeout
+	if idle == 0 {
+		idle = DefaultIdleTimeout
+	}
+	master, slave, err := openPTY()
+	if err != nil {
+		return PTYResult{}, fmt.Errorf("opening a terminal: %w", err)
+	}
+	defer func() { _ = master.Close() }()
+	var tty syscall.Stat_t
+	if err := syscall.Fstat(int(slave.Fd()), &tty); err != nil {
+		_ = slave.Close()
+		return PTYResult{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := st.Cmd(ctx, cmd, cwd)
+	c.Env = append(os.Environ(), ptyEnv...)
+	c.Stdin, c.Stdout, c.Stderr = slave, slave, slave
+	// a new session with the terminal as its controlling terminal; its
+	// process group is still the one cancelling kills
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	err = c.Start()
+	_ = slave.Close()
+	if err != nil {
+		return PTYResult{}, err
+	}
+
+	t := &terminal{out: ring{buf: make([]byte, ptyBufferBytes)}, last: time.Now(), done: make(chan struct{})}
+	go t.read(master)
+	exited := make(chan struct{})
+	go func() {
+		_ = c.Wait()
+		close(exited)
+	}()
+
+	input := opts.Stdin
+	if input != "" && !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+	var res PTYResult
+	pgid := c.Process.Pid
+	tick := time.NewTicker(ptyPoll)
+	defer tick.Stop()
+wait:
+	for {
+		select {
+		case <-exited:
+			break wait
+		case <-tick.C:
+		}
+		quiet := t.quiet()
+		switch {
+		case input != "" && quiet >= ptyPoll && readingTerminal(pgid, uint64(tty.Rdev)):
+			// type the next line as the command asks for it, so the
+			// output reads like a session at the terminal
+			line := input[:strings.IndexByte(input, '\n')+1]
+			input = input[len(line):]
+			if _, err := io.WriteString(master, line); err != nil {
+				input = ""
+			}
+			continue
+		case input == "" && quiet >= inputQuiet && readingTerminal(pgid, uint64(tty.Rdev)):
+			res.WaitingForInput = true
+		case idle > 0 && quiet >= idle:
+			res.Idle = true
+		default:
+			continue
+		}
+		cancel()
+		<-exited
+		break wait
+	}
+	// whatever it left running would keep the terminal open
+	signalGroup(c.Process.Pid, syscall.SIGKILL)
+	select {
+	case <-t.done:
+	case <-time.After(killGrace):
+	}
+
+	res.ExitCode = -1
+	if ps := c.ProcessState; ps != nil {
+		res.ExitCode = ps.ExitCode()
+	}
+	res.Output = StripANSI(t.output())
+	return res, nil
+}
+
+// terminal collects a command's terminal output.
+type terminal struct {
+	mu   sync.Mutex
+	out  ring
+	last time.Time     // when output last arrived
+	done chan struct{} // closed when the terminal has closed
+}
+
+func (t *terminal) read(master *os.File) {
+	defer close(t.done)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := master.Read(buf)
+		if n > 0 {
+			t.mu.Lock()
+			t.out.write(buf[:n])
+			t.last = time.Now()
+			t.mu.Unlock()
+		}
+		if err != nil {
+			// EIO once every process has closed the terminal
+			return
+		}
+	}
+}
+
+// quiet returns how long ago output last arrived.
+func (t *terminal) quiet() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.last)
+}
+
+func (t *terminal) output() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, _ := t.out.since(0)
+	return string(data)
+}
+
+// openPTY returns the master and slave ends of a new pseudo-terminal.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var n uint32
+	var unlock int32
+	ws := struct{ rows, cols, x, y uint16 }{ptyRows, ptyColumns, 0, 0}
+	for _, call := range []struct {
+		req uintptr
+		arg unsafe.Pointer
+	}{
+		{syscall.TIOCGPTN, unsafe.Pointer(&n)},
+		{syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)},
+		{syscall.TIOCSWINSZ, unsafe.Pointer(&ws)},
+	} {
+		if err := ioctl(master, call.req, call.arg); err != nil {
+			_ = master.Close()
+			return nil, nil, err
+		}
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// ioctl runs an ioctl on f without taking it out of non-blocking mode, so
+// closing f still interrupts a read.
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readingTerminal reports whether a process of the command whose process
+// group is pgid is blocked reading the terminal device rdev, which for a
+// silent command means it is waiting for input.
+func readingTerminal(pgid int, rdev uint64) bool {
+	for _, pid := range groupProcesses(pgid) {
+		// "<syscall number> <first argument> ...", or "running"
+		data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/syscall")
+		fields := strings.Fields(string(data))
+		if err != nil || len(fields) < 2 || fields[0] != strconv.Itoa(syscall.SYS_READ) {
+			continue
+		}
+		fd, err := strconv.ParseUint(fields[1], 0, 32)
+		if err != nil {
+			continue
+		}
+		var st syscall.Stat_t
+		if syscall.Stat(fmt.Sprintf("/proc/%d/fd/%d", pid, fd), &st) == nil && uint64(st.Rdev) == rdev {
+			return true
+		}
+	}
+	return false
+}
+
+// groupProcesses returns the processes of the command whose process group
+// is pgid: the group leader and its descendants where the kernel lists each
+// process's children, otherwise the members of the group, found by reading
+// the stat of every process in /proc.
+func groupProcesses(pgid int) []int {
+	if pids, ok := descendants(pgid); ok {
+		return pids
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// "<pid> (<comm>) <state> <ppid> <pgrp> ...", where comm may hold
+		// spaces and parentheses
+		data, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		i := strings.LastIndexByte(string(data), ')')
+		if err != nil || i < 0 {
+			continue
+		}
+		if f := strings.Fields(string(data[i+1:])); len(f) >= 3 && f[2] == strconv.Itoa(pgid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// descendants returns pid and the processes below it, read from the
+// children files of /proc. It reports false if the kernel does not provide
+// them.
+func descendants(pid int) ([]int, bool) {
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		tasks, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", pids[i]))
+		if err != nil {
+			continue
+		}
+		for _, t := range tasks {
+			data, err := os.ReadFile(fmt.Sprintf("/proc/%d/task/%s/children", pids[i], t.Name()))
+			if err != nil {
+				if i == 0 && errors.Is(err, os.ErrNotExist) {
+					return nil, false
+				}
+				continue
+			}
+			for _, f := range strings.Fields(string(data)) {
+				if child, err := strconv.Atoi(f); err == nil {
+					pids = append(pids, child)
+				}
+			}
+		}
+	}
+	return pids, true
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package shell
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunPTY(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	run := func(cmd string, opts PTYOptions) PTYResult {
+		t.Helper()
+		res, err := RunPTY(ctx, &LocalRunner{}, cmd, dir, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+		return res
+	}
+
+	res := run("[ -t 0 ] && [ -t 1 ] && echo tty; printf '\\033[31mred\\033[0m\\n'; echo \"$PAGER\"; exit 3", PTYOptions{})
+	if !strings.HasSuffix(res.Output, "tty\nred\ncat\n") || res.ExitCode != 3 || res.WaitingForInput || res.Idle {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	start := time.Now()
+	res = run("read -p 'Name? ' name; echo \"hello $name\"", PTYOptions{})
+	if !res.WaitingForInput || !strings.HasSuffix(res.Output, "Name? ") {
+		t.Fatalf("a prompt without stdin should be killed: %+v", res)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("waiting for input took %v to detect", time.Since(start))
+	}
+
+	res = run("read -p 'Name? ' name; echo \"hello $name\"", PTYOptions{Stdin: "jo"})
+	if res.WaitingForInput || res.ExitCode != 0 || !strings.HasSuffix(res.Output, "Name? jo\nhello jo\n") {
+		t.Fatalf("stdin should answer the prompt: %+v", res)
+	}
+
+	res = run("echo started; exec sleep 30", PTYOptions{IdleTimeout: 3 * time.Second})
+	if !res.Idle || res.WaitingForInput || !strings.HasSuffix(res.Output, "started\n") {
+		t.Fatalf("a silent command should hit the idle timeout: %+v", res)
+	}
+}
+
+func TestGroupProcesses(t *testing.T) {
+	other := exec.Command("sleep", "30")
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = other.Process.Kill()
+		_ = other.Wait()
+	}()
+	c := exec.Command("sh", "-c", "sleep 30 & wait")
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		signalGroup(c.Process.Pid, syscall.SIGKILL)
+		_ = c.Wait()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pids := groupProcesses(c.Process.Pid)
+		if len(pids) == 2 && (pids[0] == c.Process.Pid || pids[1] == c.Process.Pid) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the shell and its sleep, got %v", pids)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	for _, pid := range groupProcesses(c.Process.Pid) {
+		if pid == other.Process.Pid || pid == os.Getpid() {
+			t.Fatalf("unrelated process %d listed with the command", pid)
+		}
+	}
+}
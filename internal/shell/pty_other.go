@@ -0,0 +1,17 @@
+//go:build !linux
+
+package shell
+
+import (
+	"context"
+	"errors"
+)
+
+// PTYSupported reports whether RunPTY works on this platform.
+const PTYSupported = false
+
+// RunPTY runs commands on a pseudo-terminal on Linux only; elsewhere it
+// returns an error.
+func RunPTY(ctx context.Context, r Runner, cmd, cwd string, opts PTYOptions) (PTYResult, error) {
+	return PTYResult{}, errors.New("terminal mode is only supported on Linux")
+}
@@ -0,0 +1,161 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sandboxes accepted by NewRunner.
+const (
+	SandboxNone     = "none"
+	SandboxAuto     = "auto"
+	SandboxBwrap    = "bwrap"
+	SandboxNsjail   = "nsjail"
+	SandboxFirejail = "firejail"
+)
+
+// Sandboxes lists the sandbox tools in the order SandboxAuto tries them.
+var Sandboxes = []string{SandboxBwrap, SandboxNsjail, SandboxFirejail}
+
+// probeTimeout bounds the trial command NewRunner runs in a sandbox.
+const probeTimeout = 10 * time.Second
+
+// SandboxConfig selects and configures the runner for shell commands.
+type SandboxConfig struct {
+	// Kind is one of the Sandbox* constants. Empty means SandboxNone.
+	Kind string
+	// Writable lists the directories commands may write to. The rest of the
+	// file system is read-only and /tmp is private to each command.
+	Writable []string
+	// NoNetwork runs commands without network access.
+	NoNetwork bool
+	Limits    Limits
+}
+
+// NewRunner returns the runner for cfg. An explicitly named sandbox must be
+// installed and working; SandboxAuto uses the first one that is. Without a
+// sandbox Writable is ignored and NoNetwork, which cannot be enforced, is an
+// error.
+func NewRunner(cfg SandboxConfig) (Runner, error) {
+	switch cfg.Kind {
+	case "", SandboxNone:
+		if cfg.NoNetwork {
+			return nil, fmt.Errorf("disabling the network needs a sandbox")
+		}
+		return &LocalRunner{Limits: cfg.Limits}, nil
+	case SandboxAuto:
+		var errs []string
+		for _, kind := range Sandboxes {
+			r, err := newSandboxRunner(kind, cfg)
+			if err == nil {
+				return r, nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return nil, fmt.Errorf("no usable sandbox (%s)", strings.Join(errs, "; "))
+	case SandboxBwrap, SandboxNsjail, SandboxFirejail:
+		return newSandboxRunner(cfg.Kind, cfg)
+	}
+	return nil, fmt.Errorf("unknown sandbox %q", cfg.Kind)
+}
+
+// SandboxRunner runs commands with bash -lc inside bwrap, nsjail or
+// firejail.
+type SandboxRunner struct {
+	kind     string
+	path     string
+	writable []string
+	cfg      SandboxConfig
+}
+
+func newSandboxRunner(kind string, cfg SandboxConfig) (*SandboxRunner, error) {
+	path, err := exec.LookPath(kind)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found", kind)
+	}
+	r := &SandboxRunner{kind: kind, path: path, cfg: cfg}
+	for _, d := range cfg.Writable {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return nil, err
+		}
+		if st, err := os.Stat(abs); err != nil || !st.IsDir() {
+			return nil, fmt.Errorf("writable directory %s does not exist", d)
+		}
+		r.writable = append(r.writable, abs)
+	}
+	// user namespaces may be unavailable even when the tool is installed
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	if _, stderr, rc := r.Run(ctx, "true", ""); rc != 0 {
+		return nil, fmt.Errorf("%s is installed but cannot run commands: %s", kind, strings.TrimSpace(stderr))
+	}
+	return r, nil
+}
+
+// Sandbox implements Sandboxed.
+func (r *SandboxRunner) Sandbox() string { return r.kind }
+
+func (r *SandboxRunner) Run(ctx context.Context, cmd string, cwd string) (string, string, int) {
+	return run(r.Cmd(ctx, cmd, cwd))
+}
+
+// Cmd implements Starter.
+func (r *SandboxRunner) Cmd(ctx context.Context, cmd string, cwd string) *exec.Cmd {
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	} else if abs, err := filepath.Abs(cwd); err == nil {
+		cwd = abs
+	}
+	return command(ctx, r.argv(r.cfg.Limits.script(cmd), cwd), cwd)
+}
+
+// argv returns the sandbox command line that runs script with bash -lc.
+func (r *SandboxRunner) argv(script, cwd string) []string {
+	var args []string
+	switch r.kind {
+	case SandboxBwrap:
+		args = []string{"--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp"}
+		for _, d := range r.writable {
+			args = append(args, "--bind", d, d)
+		}
+		args = append(args, "--unshare-pid", "--die-with-parent", "--new-session")
+		if r.cfg.NoNetwork {
+			args = append(args, "--unshare-net")
+		}
+		if cwd != "" {
+			args = append(args, "--chdir", cwd)
+		}
+	case SandboxNsjail:
+		args = []string{"--mode", "o", "--quiet", "--keep_env", "--time_limit", "0",
+			"--bindmount_ro", "/", "--bindmount", "/dev", "--tmpfsmount", "/tmp"}
+		for _, d := range r.writable {
+			args = append(args, "--bindmount", d)
+		}
+		// nsjail's default rlimits are tight; Limits are applied by ulimit
+		for _, l := range []string{"as", "cpu", "fsize", "nofile", "nproc"} {
+			args = append(args, "--rlimit_"+l, "hard")
+		}
+		if !r.cfg.NoNetwork {
+			args = append(args, "--disable_clone_newnet")
+		}
+		if cwd != "" {
+			args = append(args, "--cwd", cwd)
+		}
+	case SandboxFirejail:
+		args = []string{"--quiet", "--noprofile", "--read-only=/", "--private-tmp"}
+		for _, d := range r.writable {
+			args = append(args, "--read-write="+d)
+		}
+		if r.cfg.NoNetwork {
+			args = append(args, "--net=none")
+		}
+	}
+	argv := append([]string{r.path}, args...)
+	return append(argv, "--", "bash", "-lc", script)
+}
@@ -0,0 +1,90 @@
+//go:build !windows
+
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSandbox installs an executable called name on PATH that skips its
+// options and runs the command after "--", like a sandbox that confines
+// nothing.
+func fakeSandbox(t *testing.T, name string) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nwhile [ \"$1\" != \"--\" ]; do shift; done\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestNewRunnerSelectsSandbox(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := NewRunner(SandboxConfig{Kind: SandboxAuto}); err == nil || !strings.Contains(err.Error(), "no usable sandbox") {
+		t.Fatalf("expected auto to fail without sandboxes, got %v", err)
+	}
+	if _, err := NewRunner(SandboxConfig{Kind: SandboxBwrap}); err == nil {
+		t.Fatalf("expected a missing bwrap to be an error")
+	}
+	if _, err := NewRunner(SandboxConfig{NoNetwork: true}); err == nil {
+		t.Fatalf("expected disabling the network without a sandbox to be an error")
+	}
+
+	t.Setenv("PATH", "/usr/bin:/bin")
+	fakeSandbox(t, "firejail")
+	work := t.TempDir()
+	r, err := NewRunner(SandboxConfig{Kind: SandboxAuto, Writable: []string{work}})
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+	if SandboxName(r) != SandboxFirejail {
+		t.Fatalf("expected firejail, got %q", SandboxName(r))
+	}
+	out, _, rc := r.Run(context.Background(), "pwd", work)
+	if rc != 0 || strings.TrimSpace(out) != work {
+		t.Fatalf("unexpected result %q rc=%d", out, rc)
+	}
+	if SandboxName(&LocalRunner{}) != "" {
+		t.Fatalf("the local runner is not a sandbox")
+	}
+}
+
+func TestSandboxArgv(t *testing.T) {
+	cfg := SandboxConfig{NoNetwork: true}
+	cases := map[string][]string{
+		SandboxBwrap:    {"--ro-bind / /", "--bind /work /work", "--unshare-net", "--chdir /work/sub", "-- bash -lc ls"},
+		SandboxNsjail:   {"--bindmount_ro /", "--bindmount /work", "--cwd /work/sub", "-- bash -lc ls"},
+		SandboxFirejail: {"--read-only=/", "--read-write=/work", "--net=none", "-- bash -lc ls"},
+	}
+	for kind, want := range cases {
+		r := &SandboxRunner{kind: kind, path: kind, writable: []string{"/work"}, cfg: cfg}
+		got := strings.Join(r.argv("ls", "/work/sub"), " ")
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: %q missing from %q", kind, w, got)
+			}
+		}
+		if kind == SandboxNsjail && strings.Contains(got, "--disable_clone_newnet") {
+			t.Errorf("nsjail must keep its network namespace when the network is off: %q", got)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	if got := (Limits{}).script("ls"); got != "ls" {
+		t.Fatalf("no limits should leave the command alone, got %q", got)
+	}
+	l := Limits{CPU: 1500 * time.Millisecond, MemoryMB: 512, Procs: 64}
+	if got := l.script("ls"); got != "ulimit -t 2 -v 524288 -u 64 || exit 126\nls" {
+		t.Fatalf("unexpected script %q", got)
+	}
+	out, _, rc := (&LocalRunner{Limits: Limits{CPU: time.Minute}}).Run(context.Background(), "ulimit -t", "")
+	if rc != 0 || strings.TrimSpace(out) != "60" {
+		t.Fatalf("limit not applied: %q rc=%d", out, rc)
+	}
+}
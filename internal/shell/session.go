@@ -0,0 +1,380 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTimeout bounds each command of a Session unless its
+// Timeout is changed.
+const DefaultSessionTimeout = 10 * time.Minute
+
+// sessionBufferBytes is how much of each of a command's stdout and stderr a
+// Session keeps; older output is dropped.
+const sessionBufferBytes = 1 << 20
+
+// sessionInit defines the function that reports a command's exit status,
+// working directory and exported environment after a marker line, so they
+// can be told apart from its output.
+const sessionInit = `__jorin_status() {
+	local rc=$? v IFS=$' \t\n'
+	builtin printf '\n%s\0%d\0%s\0' "$1" "$rc" "$PWD"
+	for v in $(compgen -e); do builtin printf '%s=%s\0' "$v" "${!v}"; done
+	builtin printf '%s\n' "$1"
+	builtin printf '\n%s\n' "$1" >&2
+}
+`
+
+// sessionNoise lists variables that change by themselves and are left out
+// of SessionResult.Env.
+var sessionNoise = map[string]bool{"_": true, "PWD": true, "OLDPWD": true, "SHLVL": true}
+
+// Session runs commands one at a time in a long-lived bash, so the working
+// directory, variables and functions set by one command are there for the
+// next. Each command's stdin is empty, and its stdout, stderr and exit code
+// are read back separately. When the shell exits or a command is killed, the
+// next command starts a new shell. A Session is safe for concurrent use;
+// commands wait for the one running.
+type Session struct {
+	// Timeout bounds each command; 0 means no limit beyond the caller's
+	// context. A command that runs out of time is killed with the shell.
+	Timeout time.Duration
+
+	runner Runner
+	sem    chan struct{}
+	sh     *sessionShell
+	closed bool
+}
+
+// NewSession returns a Session whose shell is started by runner r, which
+// must implement Starter, on the first command.
+func NewSession(r Runner) *Session {
+	return &Session{Timeout: DefaultSessionTimeout, runner: r, sem: make(chan struct{}, 1)}
+}
+
+// New returns an empty Session that starts its shell as s does, with the
+// same Timeout. Its directory, variables and functions are its own.
+func (s *Session) New() *Session {
+	n := NewSession(s.runner)
+	n.Timeout = s.Timeout
+	return n
+}
+
+// SessionResult is the outcome of a command run by a Session.
+type SessionResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// Dir is the shell's working directory after the command.
+	Dir string
+	// Env holds the exported variables the shell has added or changed since
+	// it started, and Unset those it has removed.
+	Env   map[string]string
+	Unset []string
+	// Restarted reports that a new shell was started for the command, with
+	// a fresh directory and environment, because the previous one had
+	// exited. Exited reports that the command ended the shell, by running
+	// exit or by being killed.
+	Restarted bool
+	Exited    bool
+	// TimedOut reports that the command ran longer than Timeout.
+	TimedOut bool
+}
+
+// Run runs cmd in the session's shell, starting one in cwd if there is none.
+// An error means the command could not be sent; a command that fails or is
+// cancelled still returns a result, with the output read so far.
+func (s *Session) Run(ctx context.Context, cmd, cwd string) (SessionResult, error) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return SessionResult{}, ctx.Err()
+	}
+	defer func() { <-s.sem }()
+	if s.closed {
+		return SessionResult{}, errors.New("the session is ending")
+	}
+
+	var res SessionResult
+	if s.sh == nil || s.sh.exited() {
+		res.Restarted = s.sh != nil
+		sh, err := startSessionShell(s.runner, cwd)
+		if err != nil {
+			return SessionResult{}, err
+		}
+		s.sh = sh
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	out, err := s.sh.run(ctx, cmd, &res)
+	if err != nil {
+		return SessionResult{}, err
+	}
+	if !out {
+		// killed, exited or out of time: whatever state it had is gone
+		res.Exited = true
+		res.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+		s.sh.kill()
+	}
+	return res, nil
+}
+
+// Dir returns the shell's working directory after the last command, or ""
+// if no shell is running.
+func (s *Session) Dir() string {
+	select {
+	case s.sem <- struct{}{}:
+	default:
+		// a command is running and may change it
+		return ""
+	}
+	defer func() { <-s.sem }()
+	if s.sh == nil || s.sh.exited() {
+		return ""
+	}
+	return s.sh.dir
+}
+
+// Close kills the shell and refuses further commands, waiting for a running
+// command to finish first.
+func (s *Session) Close() {
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+	s.closed = true
+	if s.sh != nil {
+		s.sh.kill()
+	}
+}
+
+// sessionShell is one bash process of a Session.
+type sessionShell struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stdin  io.WriteCloser
+	done   chan struct{} // closed once bash has exited
+
+	mu       sync.Mutex
+	stdout   bytes.Buffer
+	stderr   bytes.Buffer
+	changed  chan struct{} // closed and replaced on output and on exit
+	exitCode int
+
+	dir  string
+	base map[string]string // the environment it started with
+}
+
+func startSessionShell(r Runner, cwd string) (*sessionShell, error) {
+	st, ok := r.(Starter)
+	if !ok {
+		return nil, errors.New("the shell runner cannot keep a shell open")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sh := &sessionShell{cancel: cancel, done: make(chan struct{}), changed: make(chan struct{})}
+	// the login shell sets up the environment, then reads commands from stdin
+	sh.cmd = st.Cmd(ctx, "exec bash", cwd)
+	sh.cmd.Stdout = sessionWriter{sh, &sh.stdout}
+	sh.cmd.Stderr = sessionWriter{sh, &sh.stderr}
+	stdin, err := sh.cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sh.stdin = stdin
+	if err := sh.cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	go sh.wait()
+
+	// the first status gives the starting directory and environment, and
+	// drops whatever the profile printed
+	var res SessionResult
+	ctx, stop := context.WithTimeout(context.Background(), probeTimeout)
+	defer stop()
+	if ok, err := sh.send(ctx, sessionInit, &res); err != nil || !ok {
+		sh.kill()
+		if err == nil {
+			err = fmt.Errorf("the shell did not start: %s", strings.TrimSpace(res.Stderr))
+		}
+		return nil, err
+	}
+	return sh, nil
+}
+
+// run runs cmd and fills in res. It reports false if the shell exited or
+// ctx ended before the command finished.
+func (sh *sessionShell) run(ctx context.Context, cmd string, res *SessionResult) (bool, error) {
+	// eval keeps a syntax error from ending the shell, and the quoting
+	// keeps the command from reading the rest of the script
+	return sh.send(ctx, "eval "+quote(cmd)+" </dev/null\n", res)
+}
+
+func (sh *sessionShell) send(ctx context.Context, script string, res *SessionResult) (bool, error) {
+	marker, err := newMarker()
+	if err != nil {
+		return false, err
+	}
+	script += "__jorin_status " + marker + "\n"
+	if _, err := io.WriteString(sh.stdin, script); err != nil {
+		// it has exited; report that like any other exit
+		<-sh.done
+	}
+	start := []byte("\n" + marker + "\x00")
+	end := []byte("\x00" + marker + "\n")
+	errEnd := []byte("\n" + marker + "\n")
+	for {
+		sh.mu.Lock()
+		out, errOut := sh.stdout.Bytes(), sh.stderr.Bytes()
+		i := bytes.Index(out, start)
+		j := -1
+		if i >= 0 {
+			j = bytes.Index(out[i:], end)
+		}
+		k := bytes.Index(errOut, errEnd)
+		if i >= 0 && j >= 0 && k >= 0 {
+			res.Stdout, res.Stderr = string(out[:i]), string(errOut[:k])
+			status := string(out[i+len(start) : i+j+1])
+			sh.stdout.Next(i + j + len(end))
+			sh.stderr.Next(k + len(errEnd))
+			sh.mu.Unlock()
+			return true, sh.parseStatus(status, res)
+		}
+		changed, exited := sh.changed, sh.exited()
+		if exited || ctx.Err() != nil {
+			res.Stdout, res.Stderr = string(out), string(errOut)
+			res.ExitCode = -1
+			if exited {
+				res.ExitCode = sh.exitCode
+			}
+			sh.stdout.Reset()
+			sh.stderr.Reset()
+			sh.mu.Unlock()
+			return false, nil
+		}
+		sh.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// parseStatus reads the exit code, directory and environment written by
+// __jorin_status, each ending in a NUL byte.
+func (sh *sessionShell) parseStatus(status string, res *SessionResult) error {
+	fields := strings.Split(strings.TrimSuffix(status, "\x00"), "\x00")
+	if len(fields) < 2 {
+		return fmt.Errorf("unexpected shell status %q", status)
+	}
+	rc, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("unexpected shell status %q", status)
+	}
+	env := map[string]string{}
+	for _, kv := range fields[2:] {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	if sh.base == nil {
+		sh.base = env
+	}
+	res.ExitCode, res.Dir = rc, fields[1]
+	sh.dir = res.Dir
+	for k, v := range env {
+		if old, ok := sh.base[k]; (!ok || old != v) && !sessionNoise[k] {
+			if res.Env == nil {
+				res.Env = map[string]string{}
+			}
+			res.Env[k] = v
+		}
+	}
+	for k := range sh.base {
+		if _, ok := env[k]; !ok && !sessionNoise[k] {
+			res.Unset = append(res.Unset, k)
+		}
+	}
+	sort.Strings(res.Unset)
+	return nil
+}
+
+func (sh *sessionShell) wait() {
+	_ = sh.cmd.Wait()
+	sh.cancel()
+	sh.mu.Lock()
+	sh.exitCode = -1
+	if ps := sh.cmd.ProcessState; ps != nil {
+		sh.exitCode = ps.ExitCode()
+	}
+	close(sh.done)
+	sh.notify()
+	sh.mu.Unlock()
+}
+
+// exited reports whether bash has exited.
+func (sh *sessionShell) exited() bool {
+	select {
+	case <-sh.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// kill stops bash and everything it started, and waits for it to exit.
+func (sh *sessionShell) kill() {
+	sh.cancel()
+	<-sh.done
+}
+
+// notify wakes send. sh.mu must be held.
+func (sh *sessionShell) notify() {
+	close(sh.changed)
+	sh.changed = make(chan struct{})
+}
+
+// sessionWriter adds a stream's output to its buffer, keeping the last
+// sessionBufferBytes so the status written after a command is still found.
+type sessionWriter struct {
+	sh  *sessionShell
+	buf *bytes.Buffer
+}
+
+func (w sessionWriter) Write(b []byte) (int, error) {
+	w.sh.mu.Lock()
+	defer w.sh.mu.Unlock()
+	w.buf.Write(b)
+	if n := w.buf.Len() - sessionBufferBytes; n > 0 {
+		w.buf.Next(n)
+	}
+	w.sh.notify()
+	return len(b), nil
+}
+
+// newMarker returns a line no command's output will contain by chance.
+func newMarker() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "__jorin_" + hex.EncodeToString(b), nil
+}
+
+// quote quotes s as a single bash word.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
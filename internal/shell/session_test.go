@@ -0,0 +1,103 @@
+//go:build !windows
+
+package shell
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionKeepsState(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSession(&LocalRunner{})
+	defer s.Close()
+	ctx := context.Background()
+	run := func(cmd string) SessionResult {
+		t.Helper()
+		res, err := s.Run(ctx, cmd, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+		return res
+	}
+
+	res := run("mkdir sub && cd sub && export GREETING='hi there' && greet() { echo \"$GREETING $1\"; }")
+	if res.ExitCode != 0 || res.Dir != filepath.Join(dir, "sub") || res.Stdout != "" || res.Stderr != "" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if !reflect.DeepEqual(res.Env, map[string]string{"GREETING": "hi there"}) {
+		t.Fatalf("env = %v", res.Env)
+	}
+	res = run("greet you; pwd; echo oops >&2; printf 'no newline'; false")
+	if res.Stdout != "hi there you\n"+filepath.Join(dir, "sub")+"\nno newline" || res.Stderr != "oops\n" || res.ExitCode != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res = run("read line; echo \"[$line]\""); res.Stdout != "[]\n" {
+		t.Fatalf("a command should read empty stdin: %+v", res)
+	}
+	if res = run("if then"); res.ExitCode != 2 || res.Exited {
+		t.Fatalf("a syntax error should fail the command, not the shell: %+v", res)
+	}
+	if res = run("unset GREETING; echo ok"); res.Env != nil || !reflect.DeepEqual(res.Unset, []string(nil)) || res.Stdout != "ok\n" {
+		t.Fatalf("unexpected result after unset %+v", res)
+	}
+	if s.Dir() != filepath.Join(dir, "sub") {
+		t.Fatalf("Dir() = %q", s.Dir())
+	}
+}
+
+func TestSessionRecovers(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSession(&LocalRunner{})
+	defer s.Close()
+	ctx := context.Background()
+
+	res, err := s.Run(ctx, "cd /; echo bye; exit 3", dir)
+	if err != nil || res.Stdout != "bye\n" || res.ExitCode != 3 || !res.Exited {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+	res, err = s.Run(ctx, "pwd", dir)
+	if err != nil || !res.Restarted || res.Stdout != dir+"\n" {
+		t.Fatalf("expected a new shell in %s: %+v %v", dir, res, err)
+	}
+
+	s.Timeout = 300 * time.Millisecond
+	start := time.Now()
+	res, err = s.Run(ctx, "echo started; sleep 30", dir)
+	if err != nil || !res.TimedOut || !res.Exited || res.Stdout != "started\n" {
+		t.Fatalf("expected a timeout: %+v %v", res, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("the timeout took %s", time.Since(start))
+	}
+	s.Timeout = DefaultSessionTimeout
+	if res, err = s.Run(ctx, "echo again", dir); err != nil || !res.Restarted || res.Stdout != "again\n" {
+		t.Fatalf("expected a new shell after the timeout: %+v %v", res, err)
+	}
+}
+
+func TestSessionNewAndOutputLimit(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSession(&LocalRunner{})
+	defer s.Close()
+	ctx := context.Background()
+	if _, err := s.Run(ctx, "export WHO=first; cd /", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	other := s.New()
+	defer other.Close()
+	res, err := other.Run(ctx, "echo \"[$WHO]\"; pwd", dir)
+	if err != nil || res.Stdout != "[]\n"+dir+"\n" {
+		t.Fatalf("a new session should not share state: %+v %v", res, err)
+	}
+
+	res, err = s.Run(ctx, "head -c 3000000 /dev/zero | tr '\\0' x; echo; echo $WHO", dir)
+	if err != nil || len(res.Stdout) > sessionBufferBytes || !strings.HasSuffix(res.Stdout, "x\nfirst\n") || res.ExitCode != 0 {
+		t.Fatalf("long output should keep its end: %d bytes, %+v", len(res.Stdout), err)
+	}
+}
@@ -2,28 +2,118 @@ package shell
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os/exec"
+	"strings"
+	"time"
 )
 
 // Runner executes shell commands. Implementations should aim to avoid
 // using a full shell when not required, but the default runner uses
-// "bash -lc" to preserve existing behavior.
+// "bash -lc" to preserve existing behavior. Cancelling ctx must stop the
+// command and anything it started.
 type Runner interface {
-	Run(cmd string, cwd string) (stdout string, stderr string, returncode int)
+	Run(ctx context.Context, cmd string, cwd string) (stdout string, stderr string, returncode int)
 }
 
 // DefaultRunner is used by packages that need to execute shell commands.
 // Tests can replace DefaultRunner with a mock.
 var DefaultRunner Runner = &LocalRunner{}
 
-// LocalRunner executes commands using bash -lc and captures stdout/stderr.
-type LocalRunner struct{}
+// Sandboxed is implemented by runners that confine the commands they run.
+type Sandboxed interface {
+	// Sandbox names the sandbox in use, such as "bwrap".
+	Sandbox() string
+}
+
+// SandboxName returns the sandbox r runs commands in, or "" if none.
+func SandboxName(r Runner) string {
+	if s, ok := r.(Sandboxed); ok {
+		return s.Sandbox()
+	}
+	return ""
+}
+
+// killGrace is how long a cancelled command may keep its pipes open after
+// its process group has been killed.
+const killGrace = 2 * time.Second
+
+// Command returns a "bash -lc" command bound to ctx. The command runs in its
+// own process group and the whole group is killed when ctx is done, so
+// background children do not outlive a cancelled call.
+func Command(ctx context.Context, cmd string, cwd string) *exec.Cmd {
+	return command(ctx, []string{"bash", "-lc", cmd}, cwd)
+}
 
-func (l *LocalRunner) Run(cmd string, cwd string) (string, string, int) {
-	c := exec.Command("bash", "-lc", cmd)
+func command(ctx context.Context, argv []string, cwd string) *exec.Cmd {
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	if cwd != "" {
 		c.Dir = cwd
 	}
+	setProcessGroup(c)
+	c.WaitDelay = killGrace
+	return c
+}
+
+// Limits bounds the resources of each command. Zero values mean no limit.
+type Limits struct {
+	// CPU is the CPU time a command may use, rounded up to whole seconds.
+	CPU time.Duration
+	// MemoryMB caps the virtual memory of each process.
+	MemoryMB int
+	// Procs caps the number of processes of the user running the command.
+	Procs int
+}
+
+// script prefixes cmd with the ulimit calls for l. The command does not run
+// if a limit cannot be applied.
+func (l Limits) script(cmd string) string {
+	var args []string
+	if l.CPU > 0 {
+		args = append(args, fmt.Sprintf("-t %d", int((l.CPU+time.Second-1)/time.Second)))
+	}
+	if l.MemoryMB > 0 {
+		args = append(args, fmt.Sprintf("-v %d", l.MemoryMB*1024))
+	}
+	if l.Procs > 0 {
+		args = append(args, fmt.Sprintf("-u %d", l.Procs))
+	}
+	if len(args) == 0 {
+		return cmd
+	}
+	return "ulimit " + strings.Join(args, " ") + " || exit 126\n" + cmd
+}
+
+// LocalRunner executes commands using bash -lc and captures stdout/stderr.
+type LocalRunner struct {
+	Limits Limits
+}
+
+func (l *LocalRunner) Run(ctx context.Context, cmd string, cwd string) (string, string, int) {
+	return run(l.Cmd(ctx, cmd, cwd))
+}
+
+// Cmd implements Starter.
+func (l *LocalRunner) Cmd(ctx context.Context, cmd string, cwd string) *exec.Cmd {
+	return Command(ctx, l.Limits.script(cmd), cwd)
+}
+
+// RunInput runs cmd like r.Run, with stdin as its standard input. r must
+// implement Starter.
+func RunInput(ctx context.Context, r Runner, cmd, cwd, stdin string) (string, string, int, error) {
+	st, ok := r.(Starter)
+	if !ok {
+		return "", "", 0, errors.New("the shell runner cannot pass input to commands")
+	}
+	c := st.Cmd(ctx, cmd, cwd)
+	c.Stdin = strings.NewReader(stdin)
+	stdout, stderr, rc := run(c)
+	return stdout, stderr, rc, nil
+}
+
+func run(c *exec.Cmd) (string, string, int) {
 	var out bytes.Buffer
 	var errb bytes.Buffer
 	c.Stdout = &out
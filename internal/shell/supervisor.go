@@ -0,0 +1,355 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxProcesses bounds the processes a Supervisor runs at once.
+	MaxProcesses = 10
+	// processBufferBytes is how much of each process's output is kept.
+	processBufferBytes = 1 << 20
+)
+
+// Starter is implemented by runners that can leave a command running in the
+// background.
+type Starter interface {
+	// Cmd returns the command Run would run for cmd in cwd, not yet
+	// started. Cancelling ctx kills it and everything it started.
+	Cmd(ctx context.Context, cmd string, cwd string) *exec.Cmd
+}
+
+// Supervisor runs the background processes of the process tools, such as
+// dev servers and file watchers. Each process gets a handle ("p1", "p2",
+// ...), and its combined stdout and stderr is kept in a ring buffer to be
+// read incrementally. Close kills whatever is still running. A Supervisor is
+// safe for concurrent use.
+type Supervisor struct {
+	mu     sync.Mutex
+	procs  []*Process
+	next   int
+	closed bool
+}
+
+// NewSupervisor returns an empty Supervisor.
+func NewSupervisor() *Supervisor { return &Supervisor{} }
+
+// Start starts cmd in cwd with runner r, which must implement Starter, and
+// returns it running. Its stdin is empty.
+func (s *Supervisor) Start(r Runner, cmd, cwd string) (*Process, error) {
+	st, ok := r.(Starter)
+	if !ok {
+		return nil, errors.New("the shell runner cannot start background processes")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errors.New("the session is ending")
+	}
+	running := 0
+	for _, p := range s.procs {
+		if p.State().Running {
+			running++
+		}
+	}
+	if running >= MaxProcesses {
+		return nil, fmt.Errorf("%d processes are already running; kill one first", running)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Process{
+		ID:      fmt.Sprintf("p%d", s.next+1),
+		Command: cmd,
+		Dir:     cwd,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+		out:     ring{buf: make([]byte, processBufferBytes)},
+	}
+	p.cmd = st.Cmd(ctx, cmd, cwd)
+	// one writer for both makes exec share a pipe, keeping their order
+	p.cmd.Stdout, p.cmd.Stderr = p, p
+	if err := p.cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	s.next++
+	p.PID, p.Started = p.cmd.Process.Pid, time.Now()
+	s.procs = append(s.procs, p)
+	go p.wait()
+	return p, nil
+}
+
+// Get returns the process with handle id.
+func (s *Supervisor) Get(id string) (*Process, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.procs {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no process %q", id)
+}
+
+// List returns the processes started so far, oldest first.
+func (s *Supervisor) List() []*Process {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Process(nil), s.procs...)
+}
+
+// Kill stops the process with handle id and everything it started: SIGTERM
+// first, then SIGKILL if it has not exited after a grace period. Killing a
+// process that has already exited does nothing.
+func (s *Supervisor) Kill(id string) (*Process, error) {
+	p, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	p.stop()
+	return p, nil
+}
+
+// Close kills every running process, waits for them to exit and refuses
+// new ones. It returns how many it killed.
+func (s *Supervisor) Close() int {
+	s.mu.Lock()
+	s.closed = true
+	procs := append([]*Process(nil), s.procs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	killed := 0
+	for _, p := range procs {
+		wg.Add(1)
+		go func(p *Process) {
+			defer wg.Done()
+			if p.stop() {
+				mu.Lock()
+				killed++
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	return killed
+}
+
+// Process is a command started by a Supervisor.
+type Process struct {
+	ID      string
+	Command string
+	Dir     string
+	PID     int
+	Started time.Time
+
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the process has exited
+
+	mu       sync.Mutex
+	out      ring
+	read     int64         // where the next Read starts by default
+	changed  chan struct{} // closed and replaced on output and on exit
+	exitCode int
+	ended    time.Time
+	killed   bool
+}
+
+// ProcessState is a snapshot of a Process.
+type ProcessState struct {
+	// Running is false once the process has exited; ExitCode, which is -1
+	// after a signal, and Ended are then set. Killed reports that Kill or
+	// Close stopped it.
+	Running  bool
+	ExitCode int
+	Ended    time.Time
+	Killed   bool
+	// Output is how many bytes it has written, and Unread how many of them
+	// Read has not returned.
+	Output int64
+	Unread int64
+}
+
+// State returns the process's current state.
+func (p *Process) State() ProcessState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := ProcessState{Running: p.ended.IsZero(), Output: p.out.total, Unread: p.out.total - p.read}
+	if !st.Running {
+		st.ExitCode, st.Ended, st.Killed = p.exitCode, p.ended, p.killed
+	}
+	return st
+}
+
+// Done returns a channel that is closed once the process has exited.
+func (p *Process) Done() <-chan struct{} { return p.done }
+
+// Write adds output to the ring buffer.
+func (p *Process) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out.write(b)
+	p.notify()
+	return len(b), nil
+}
+
+// notify wakes the callers of WaitOutput. p.mu must be held.
+func (p *Process) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Chunk is output returned by Read.
+type Chunk struct {
+	Data []byte
+	// Offset is where Data starts in the output. Dropped counts the bytes
+	// before it, from where the read was asked to start, that were
+	// overwritten before they could be read.
+	Offset, Dropped int64
+	// More reports output after Data.
+	More bool
+}
+
+// Read returns up to max bytes of output starting at offset from, or where
+// the previous Read stopped if from is negative.
+func (p *Process) Read(from int64, max int) Chunk {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if from < 0 {
+		from = p.read
+	}
+	var c Chunk
+	c.Data, c.Offset = p.out.since(from)
+	if c.Offset > from {
+		c.Dropped = c.Offset - from
+	}
+	if len(c.Data) > max {
+		c.Data, c.More = c.Data[:max], true
+	}
+	p.read = c.Offset + int64(len(c.Data))
+	return c
+}
+
+// Tail returns up to the last max bytes of output, without moving where
+// the next Read starts.
+func (p *Process) Tail(max int) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, _ := p.out.since(p.out.total - int64(max))
+	return data
+}
+
+// WaitOutput waits until the process has written output after offset from
+// (or after the previous Read, if from is negative) that enough accepts,
+// or until the process exits or ctx is done. enough is given all the output
+// after from that is still buffered; nil accepts any.
+func (p *Process) WaitOutput(ctx context.Context, from int64, enough func([]byte) bool) {
+	for {
+		p.mu.Lock()
+		if from < 0 {
+			from = p.read
+		}
+		data, _ := p.out.since(from)
+		changed, exited := p.changed, !p.ended.IsZero()
+		p.mu.Unlock()
+		if exited || len(data) > 0 && (enough == nil || enough(data)) {
+			return
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// wait records how the process ended. Anything it left running in its
+// process group is killed, so nothing outlives it unsupervised.
+func (p *Process) wait() {
+	_ = p.cmd.Wait()
+	signalGroup(p.PID, syscall.SIGKILL)
+	p.cancel()
+	p.mu.Lock()
+	p.exitCode = -1
+	if ps := p.cmd.ProcessState; ps != nil {
+		p.exitCode = ps.ExitCode()
+	}
+	p.ended = time.Now()
+	p.notify()
+	p.mu.Unlock()
+	close(p.done)
+}
+
+// stop terminates the process if it is running and reports whether it was.
+func (p *Process) stop() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+	p.mu.Lock()
+	p.killed = true
+	p.mu.Unlock()
+	signalGroup(p.PID, syscall.SIGTERM)
+	select {
+	case <-p.done:
+	case <-time.After(killGrace):
+		p.cancel()
+		<-p.done
+	}
+	return true
+}
+
+// ring keeps the last len(buf) bytes written to it.
+type ring struct {
+	buf   []byte
+	total int64 // bytes written so far
+}
+
+func (r *ring) write(b []byte) {
+	size := int64(len(r.buf))
+	if int64(len(b)) > size {
+		r.total += int64(len(b)) - size
+		b = b[int64(len(b))-size:]
+	}
+	for len(b) > 0 {
+		n := copy(r.buf[r.total%size:], b)
+		b = b[n:]
+		r.total += int64(n)
+	}
+}
+
+// since returns the bytes written from offset off on that are still held,
+// and the offset they start at.
+func (r *ring) since(off int64) ([]byte, int64) {
+	size := int64(len(r.buf))
+	if first := r.total - size; off < first {
+		off = first
+	}
+	if off < 0 {
+		off = 0
+	}
+	if off >= r.total {
+		return nil, r.total
+	}
+	out := make([]byte, 0, r.total-off)
+	for o := off; o < r.total; {
+		i := o % size
+		end := size
+		if rest := r.total - o; end-i > rest {
+			end = i + rest
+		}
+		out = append(out, r.buf[i:end]...)
+		o += end - i
+	}
+	return out, off
+}
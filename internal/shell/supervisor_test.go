@@ -0,0 +1,104 @@
+//go:build !windows
+
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingKeepsLastBytes(t *testing.T) {
+	r := ring{buf: make([]byte, 8)}
+	r.write([]byte("hello "))
+	r.write([]byte("world"))
+	if data, off := r.since(0); string(data) != "lo world" || off != 3 {
+		t.Fatalf("since(0) = %q at %d", data, off)
+	}
+	if data, off := r.since(9); string(data) != "ld" || off != 9 {
+		t.Fatalf("since(9) = %q at %d", data, off)
+	}
+	r.write([]byte("0123456789"))
+	if data, off := r.since(11); string(data) != "23456789" || off != 13 {
+		t.Fatalf("a write larger than the buffer: %q at %d", data, off)
+	}
+	if data, off := r.since(30); data != nil || off != 21 {
+		t.Fatalf("since past the end = %q at %d", data, off)
+	}
+}
+
+func TestSupervisorReadsOutputIncrementally(t *testing.T) {
+	s := NewSupervisor()
+	defer s.Close()
+	dir := t.TempDir()
+	p, err := s.Start(&LocalRunner{}, "echo one; until [ -e go ]; do sleep 0.05; done; echo two >&2; exit 3", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "p1" || p.PID == 0 {
+		t.Fatalf("unexpected process %+v", p)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p.WaitOutput(ctx, -1, func(b []byte) bool { return strings.Contains(string(b), "one") })
+	// a login shell's profile may write something first
+	c := p.Read(-1, processBufferBytes)
+	if !strings.HasSuffix(string(c.Data), "one\n") || c.Offset != 0 {
+		t.Fatalf("first read: %q at %d", c.Data, c.Offset)
+	}
+	first := int64(len(c.Data))
+	if err := os.WriteFile(filepath.Join(dir, "go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p.WaitOutput(ctx, -1, nil)
+	<-p.done
+	st := p.State()
+	if st.Running || st.ExitCode != 3 || st.Killed || st.Unread != 4 {
+		t.Fatalf("unexpected state %+v", st)
+	}
+	if c := p.Read(-1, 2); string(c.Data) != "tw" || c.Offset != first || !c.More {
+		t.Fatalf("limited read: %q at %d", c.Data, c.Offset)
+	}
+	if c := p.Read(first-4, 100); string(c.Data) != "one\ntwo\n" {
+		t.Fatalf("read from an offset: %q", c.Data)
+	}
+	if _, err := s.Get("p9"); err == nil {
+		t.Fatalf("expected an error for an unknown handle")
+	}
+}
+
+func TestSupervisorKillStopsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSupervisor()
+	p, err := s.Start(&LocalRunner{}, "(sleep 1 && touch late) & sleep 30", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := s.Kill(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > killGrace+time.Second {
+		t.Fatalf("kill took %s", time.Since(start))
+	}
+	if st := p.State(); st.Running || !st.Killed {
+		t.Fatalf("unexpected state after kill: %+v", st)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(dir, "late")); err == nil {
+		t.Fatalf("a child of the killed process survived")
+	}
+
+	if _, err := s.Start(&LocalRunner{}, "sleep 30", dir); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Close(); n != 1 {
+		t.Fatalf("Close killed %d processes, want 1", n)
+	}
+	if _, err := s.Start(&LocalRunner{}, "true", dir); err == nil {
+		t.Fatalf("a closed supervisor should refuse new processes")
+	}
+}
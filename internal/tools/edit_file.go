@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dave1010/jorin/internal/diff"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// EditText replaces old with new in text and returns the result and the
+// number of replacements. old must occur exactly once unless replaceAll is
+// set. When text uses CRLF line endings and old, written with LF, is not
+// found as given, old and new are matched and written with CRLF instead.
+func EditText(text, old, new string, replaceAll bool) (string, int, error) {
+	if old == "" {
+		return "", 0, errors.New("old_string is empty; use write_file to create or replace a whole file")
+	}
+	if old == new {
+		return "", 0, errors.New("old_string and new_string are the same")
+	}
+	n := strings.Count(text, old)
+	if n == 0 && strings.Contains(text, "\r\n") && strings.Contains(old, "\n") && !strings.Contains(old, "\r\n") {
+		old = strings.ReplaceAll(old, "\n", "\r\n")
+		new = strings.ReplaceAll(new, "\n", "\r\n")
+		n = strings.Count(text, old)
+	}
+	switch {
+	case n == 0:
+		return "", 0, errors.New("old_string not found; read the file again and copy the text exactly, including whitespace")
+	case n > 1 && !replaceAll:
+		return "", 0, fmt.Errorf("old_string matches %d times; include more surrounding lines to make it unique, or set replace_all", n)
+	case !replaceAll:
+		return strings.Replace(text, old, new, 1), 1, nil
+	}
+	return strings.ReplaceAll(text, old, new), n, nil
+}
+
+func editFileToolExec(_ context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	name, _ := args["path"].(string)
+	if name == "" {
+		return nil, errors.New("missing path")
+	}
+	old, _ := args["old_string"].(string)
+	new, _ := args["new_string"].(string)
+	replaceAll, _ := args["replace_all"].(bool)
+
+	path, err := p.ResolvePath(name, true)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	fsys := fileSystem(p)
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	if info.IsDir() {
+		return map[string]any{"error": path + " is a directory"}, nil
+	}
+	b, err := fsys.ReadFile(path)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	text, n, err := EditText(string(b), old, new, replaceAll)
+	if err != nil {
+		return map[string]any{"error": fmt.Sprintf("%s: %v", name, err)}, nil
+	}
+	if p.Checkpoints != nil {
+		if err := p.Checkpoints.Save(path); err != nil {
+			return map[string]any{"error": "checkpoint: " + err.Error()}, nil
+		}
+	}
+	if err := fsys.WriteFile(path, []byte(text), info.Mode().Perm()); err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	res := map[string]any{"ok": true, "replacements": n}
+	d := diff.Unified(name, name, string(b), text)
+	if len(d) > maxToolOutputBytes {
+		d, res["diff_truncated"] = truncateUTF8(d, maxToolOutputBytes), true
+	}
+	res["diff"] = d
+	return res, nil
+}
+
+// truncateUTF8 returns at most the first n bytes of s, cut before a
+// character rather than inside one.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// fileSystem returns the file system the file tools use under p.
+func fileSystem(p *types.Policy) types.FileSystem {
+	if p.FS != nil {
+		return p.FS
+	}
+	return osFS{}
+}
+
+// osFS is the operating system's file system.
+type osFS struct{}
+
+func (osFS) ReadFile(path string) ([]byte, error)       { return os.ReadFile(path) }
+func (osFS) Stat(path string) (fs.FileInfo, error)      { return os.Stat(path) }
+func (osFS) ReadDir(path string) ([]fs.DirEntry, error) { return os.ReadDir(path) }
+func (osFS) Remove(path string) error                   { return os.Remove(path) }
+func (osFS) ShellDir(dir string) (string, error)        { return dir, nil }
+
+// WriteFile writes data to a temporary file that replaces path, so readers
+// never see half a file.
+func (osFS) WriteFile(path string, data []byte, mode fs.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"path"
+	"strings"
+)
+
+// ignoreRule is one pattern of a .gitignore file.
+type ignoreRule struct {
+	// dir is the directory of the .gitignore file, slash-separated and
+	// relative to the repository; "" is the top.
+	dir     string
+	elems   []string // the pattern's path elements; "**" matches any number
+	negate  bool     // a "!" pattern re-includes what earlier ones ignored
+	dirOnly bool     // a pattern ending in "/" matches only directories
+}
+
+// gitignore holds the .gitignore rules that apply to a walk of a
+// repository. As in git, the last matching rule decides, and rules of
+// deeper files come after those of their parents.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+// add parses the .gitignore file in dir, relative to the repository.
+func (g *gitignore) add(dir string, data []byte) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		r := ignoreRule{dir: dir}
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "/") {
+			// a slash anchors the pattern to the file's directory
+			r.elems = strings.Split(strings.TrimPrefix(line, "/"), "/")
+		} else {
+			r.elems = []string{"**", line}
+		}
+		g.rules = append(g.rules, r)
+	}
+}
+
+// ignored reports whether the slash-separated path rel, relative to the
+// repository, is ignored.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range g.rules {
+		if r.dirOnly && !isDir || r.negate != ignored {
+			continue
+		}
+		sub := rel
+		if r.dir != "" {
+			if !strings.HasPrefix(rel, r.dir+"/") {
+				continue
+			}
+			sub = rel[len(r.dir)+1:]
+		}
+		if matchElems(r.elems, strings.Split(sub, "/")) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// matchElems matches path elements against pattern elements, where "**"
+// matches any number of elements and the others are path.Match patterns.
+func matchElems(pattern, elems []string) bool {
+	if len(pattern) == 0 {
+		return len(elems) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchElems(pattern[1:], elems[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elems) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], elems[0])
+	return ok && matchElems(pattern[1:], elems[1:])
+}
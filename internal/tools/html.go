@@ -0,0 +1,451 @@
+package tools
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// htmlToMarkdown converts an HTML page to markdown the model can read:
+// headings, paragraphs, lists, links, images, emphasis, code blocks and
+// tables keep their shape, and scripts, styles and other markup are
+// dropped. Relative links are resolved against base when it is set. It also
+// returns the page's title.
+func htmlToMarkdown(doc string, base *url.URL) (text, title string) {
+	c := &htmlConverter{base: base}
+	for i := 0; i < len(doc); {
+		if doc[i] != '<' {
+			end := strings.IndexByte(doc[i:], '<')
+			if end < 0 {
+				end = len(doc) - i
+			}
+			c.text(html.UnescapeString(doc[i : i+end]))
+			i += end
+			continue
+		}
+		rest := doc[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			i += skipPast(rest, "-->")
+		case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"):
+			i += skipPast(rest, ">")
+		case strings.HasPrefix(rest, "</"):
+			name, _ := tagName(rest[2:])
+			if name == "" {
+				// not a tag after all
+				c.text("</")
+				i += 2
+				continue
+			}
+			i += skipPast(rest, ">")
+			c.end(name)
+		default:
+			name, n := tagName(rest[1:])
+			if name == "" {
+				c.text("<")
+				i++
+				continue
+			}
+			attrs, selfClosing, m := parseAttrs(rest[1+n:])
+			i += 1 + n + m
+			switch name {
+			case "script", "style", "textarea", "title":
+				// raw text up to the closing tag
+				end := indexFold(doc[i:], "</"+name)
+				if end < 0 {
+					end = len(doc) - i
+				}
+				if name == "title" && title == "" {
+					title = strings.Join(strings.Fields(html.UnescapeString(doc[i:i+end])), " ")
+				} else if name == "textarea" {
+					c.text(html.UnescapeString(doc[i : i+end]))
+				}
+				i += end
+				i += skipPast(doc[i:], ">")
+				continue
+			}
+			c.start(name, attrs)
+			if selfClosing {
+				c.end(name)
+			}
+		}
+	}
+	return c.finish(), title
+}
+
+// skipPast returns the length of s up to and including the first sep, or
+// len(s) if there is none.
+func skipPast(s, sep string) int {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return len(s)
+	}
+	return i + len(sep)
+}
+
+// indexFold is strings.Index ignoring ASCII case.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// tagName reads a lower-cased tag name at the start of s and returns it and
+// its length; "" means s does not start with one.
+func tagName(s string) (string, int) {
+	n := 0
+	for n < len(s) && (s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 0 && (s[n] >= '0' && s[n] <= '9' || s[n] == '-' || s[n] == ':')) {
+		n++
+	}
+	return strings.ToLower(s[:n]), n
+}
+
+// parseAttrs reads a tag's attributes up to its closing '>' and returns
+// them, whether the tag ended in "/>", and how much of s it read.
+func parseAttrs(s string) (map[string]string, bool, int) {
+	attrs := map[string]string{}
+	i := 0
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '>':
+			return attrs, i > 0 && s[i-1] == '/', i + 1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '/':
+			i++
+			continue
+		}
+		start := i
+		for i < len(s) && !strings.ContainsRune(" \t\n\r\f/>=", rune(s[i])) {
+			i++
+		}
+		name := strings.ToLower(s[start:i])
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r') {
+			i++
+		}
+		if i >= len(s) || s[i] != '=' {
+			attrs[name] = ""
+			continue
+		}
+		i++
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r') {
+			i++
+		}
+		var value string
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			q := s[i]
+			end := strings.IndexByte(s[i+1:], q)
+			if end < 0 {
+				end = len(s) - i - 1
+			}
+			value = s[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r\f>", rune(s[i])) {
+				i++
+			}
+			value = s[start:i]
+		}
+		attrs[name] = html.UnescapeString(value)
+	}
+	return attrs, false, len(s)
+}
+
+// htmlConverter writes markdown for the elements htmlToMarkdown reads.
+type htmlConverter struct {
+	base *url.URL
+	b    strings.Builder
+	// space is a collapsed run of white space not yet written, and
+	// trimSpace drops white space that follows an opening marker.
+	space, trimSpace bool
+	pre              int // depth of <pre> elements
+	skip             int // depth of elements whose content is dropped
+	lists            []htmlList
+	links            []string // closing text of the open links
+	cells            int      // cells written in the current table row
+}
+
+type htmlList struct {
+	ordered bool
+	n       int
+}
+
+// blockTags separate their content from what surrounds it by a blank line.
+var blockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "header": true,
+	"footer": true, "main": true, "nav": true, "aside": true, "form": true,
+	"fieldset": true, "figure": true, "figcaption": true, "address": true,
+	"details": true, "summary": true, "dl": true, "blockquote": true,
+	"table": true, "center": true,
+}
+
+// skippedTags have content that is not part of the page's text.
+var skippedTags = map[string]bool{
+	"head": true, "noscript": true, "template": true, "svg": true,
+	"iframe": true, "object": true, "select": true, "canvas": true,
+}
+
+func (c *htmlConverter) start(name string, attrs map[string]string) {
+	if name == "body" {
+		// whatever was left open before it, such as a <head> without its
+		// end tag, is over
+		c.skip = 0
+		return
+	}
+	if skippedTags[name] {
+		c.skip++
+		return
+	}
+	if c.skip > 0 {
+		return
+	}
+	switch {
+	case blockTags[name]:
+		c.block()
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+		c.block()
+		c.marker(strings.Repeat("#", int(name[1]-'0')) + " ")
+	}
+	switch name {
+	case "br":
+		if c.pre > 0 {
+			c.b.WriteString("\n")
+		} else {
+			c.line()
+		}
+	case "hr":
+		c.block()
+		c.b.WriteString("---")
+		c.block()
+	case "pre":
+		c.block()
+		c.b.WriteString("```\n")
+		c.pre++
+	case "code":
+		if c.pre == 0 {
+			c.marker("`")
+		}
+	case "strong", "b":
+		c.marker("**")
+	case "em", "i":
+		c.marker("_")
+	case "ul", "ol":
+		l := htmlList{ordered: name == "ol", n: 1}
+		if n, err := strconv.Atoi(attrs["start"]); err == nil {
+			l.n = n
+		}
+		if len(c.lists) == 0 {
+			c.block()
+		}
+		c.lists = append(c.lists, l)
+	case "li":
+		c.line()
+		indent := 0
+		if len(c.lists) > 0 {
+			indent = len(c.lists) - 1
+		}
+		c.b.WriteString(strings.Repeat("  ", indent))
+		bullet := "- "
+		if len(c.lists) > 0 && c.lists[len(c.lists)-1].ordered {
+			l := &c.lists[len(c.lists)-1]
+			bullet = strconv.Itoa(l.n) + ". "
+			l.n++
+		}
+		c.marker(bullet)
+	case "dt", "dd":
+		c.line()
+	case "tr":
+		c.line()
+		c.cells = 0
+	case "td", "th":
+		if c.cells > 0 {
+			c.space = false
+			c.b.WriteString(" | ")
+			c.trimSpace = true
+		}
+		c.cells++
+	case "a":
+		href := c.resolve(attrs["href"])
+		if href == "" {
+			c.links = append(c.links, "")
+			return
+		}
+		c.marker("[")
+		c.links = append(c.links, "]("+href+")")
+	case "img":
+		src := c.resolve(attrs["src"])
+		if src != "" {
+			c.flushSpace()
+			c.b.WriteString("![" + strings.Join(strings.Fields(attrs["alt"]), " ") + "](" + src + ")")
+		}
+	}
+}
+
+func (c *htmlConverter) end(name string) {
+	if skippedTags[name] {
+		if c.skip > 0 {
+			c.skip--
+		}
+		return
+	}
+	if c.skip > 0 {
+		return
+	}
+	switch {
+	case blockTags[name], len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+		c.block()
+	}
+	switch name {
+	case "pre":
+		if c.pre == 0 {
+			return
+		}
+		c.pre--
+		if s := c.b.String(); !strings.HasSuffix(s, "\n") {
+			c.b.WriteString("\n")
+		}
+		c.b.WriteString("```")
+		c.block()
+	case "code":
+		if c.pre == 0 {
+			c.b.WriteString("`")
+		}
+	case "strong", "b":
+		c.b.WriteString("**")
+	case "em", "i":
+		c.b.WriteString("_")
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		if len(c.lists) == 0 {
+			c.block()
+		} else {
+			c.line()
+		}
+	case "li", "dt", "dd", "tr":
+		c.line()
+	case "a":
+		if n := len(c.links); n > 0 {
+			c.b.WriteString(c.links[n-1])
+			c.links = c.links[:n-1]
+		}
+	}
+}
+
+// resolve returns a link target for the page, or "" for links that lead
+// nowhere useful: fragments, scripts and inline data.
+func (c *htmlConverter) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	lower := strings.ToLower(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "data:") {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if c.base != nil {
+		u = c.base.ResolveReference(u)
+	}
+	return u.String()
+}
+
+func (c *htmlConverter) text(s string) {
+	if c.skip > 0 {
+		return
+	}
+	if c.pre > 0 {
+		c.b.WriteString(s)
+		return
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !c.trimSpace {
+				c.space = true
+			}
+			continue
+		}
+		c.flushSpace()
+		c.trimSpace = false
+		c.b.WriteRune(r)
+	}
+}
+
+// marker writes the opening of an inline element, such as "**" or "- ",
+// and drops the white space right after it.
+func (c *htmlConverter) marker(s string) {
+	c.flushSpace()
+	c.b.WriteString(s)
+	c.trimSpace = true
+}
+
+// flushSpace writes a pending space, unless a line has just started.
+func (c *htmlConverter) flushSpace() {
+	if c.space {
+		if s := c.b.String(); s != "" && !strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, " ") {
+			c.b.WriteString(" ")
+		}
+		c.space = false
+	}
+}
+
+// line starts a new line, and block a new paragraph.
+func (c *htmlConverter) line() { c.breakLines(1) }
+
+func (c *htmlConverter) block() { c.breakLines(2) }
+
+func (c *htmlConverter) breakLines(n int) {
+	c.space, c.trimSpace = false, true
+	s := c.b.String()
+	if s == "" {
+		return
+	}
+	have := len(s) - len(strings.TrimRight(s, "\n"))
+	for ; have < n; have++ {
+		c.b.WriteString("\n")
+	}
+}
+
+// finish tidies the markdown: trailing spaces go, and runs of blank lines
+// outside code blocks become one.
+func (c *htmlConverter) finish() string {
+	var out []string
+	fenced, blank := false, false
+	for _, l := range strings.Split(c.b.String(), "\n") {
+		if strings.HasPrefix(l, "```") {
+			fenced = !fenced
+		}
+		if !fenced {
+			l = strings.TrimRightFunc(l, unicode.IsSpace)
+			if l == "" {
+				if blank {
+					continue
+				}
+				blank = true
+			} else {
+				blank = false
+			}
+		}
+		out = append(out, l)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// isHTML reports whether a response is an HTML page, from its content type
+// or, without one, its first bytes.
+func isHTML(contentType string, body []byte) bool {
+	ct := strings.ToLower(contentType)
+	if strings.Contains(ct, "html") {
+		return true
+	}
+	if ct != "" {
+		return false
+	}
+	head := strings.ToLower(strings.TrimSpace(string(body[:minInt(len(body), 512)])))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html")
+}
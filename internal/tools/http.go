@@ -0,0 +1,313 @@
+package tools
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/dave1010/jorin/internal/policy"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+const (
+	maxHTTPReadBytes = 2 << 20 // read from the network
+	maxHTTPBodyBytes = 50_000  // returned to the model
+	maxHTTPRedirects = 10
+)
+
+// httpRootCAs replaces the system's root certificates when set, so tests
+// can trust an httptest TLS server.
+var httpRootCAs *x509.CertPool
+
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// sharedAddresses is the carrier-grade NAT range, which net.IP does not
+// count as private.
+var sharedAddresses = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// httpCall is a request made by http_get or http_request.
+type httpCall struct {
+	method  string
+	url     string
+	headers map[string]string
+	body    string
+	raw     bool // return HTML as it is
+	// withHeaders adds the response headers to the result.
+	withHeaders bool
+}
+
+func httpGetToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	u, _ := args["url"].(string)
+	if u == "" {
+		return nil, errors.New("missing url")
+	}
+	return doHTTP(ctx, p, httpCall{method: http.MethodGet, url: u}), nil
+}
+
+func httpRequestToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	u, _ := args["url"].(string)
+	if u == "" {
+		return nil, errors.New("missing url")
+	}
+	c := httpCall{method: http.MethodGet, url: u, headers: map[string]string{}, withHeaders: true}
+	if m, _ := args["method"].(string); m != "" {
+		c.method = strings.ToUpper(strings.TrimSpace(m))
+	}
+	if !httpMethods[c.method] {
+		return map[string]any{"error": fmt.Sprintf("unsupported method %q", c.method)}, nil
+	}
+	if hs, ok := args["headers"].(map[string]any); ok {
+		for k, v := range hs {
+			s, ok := v.(string)
+			if !ok {
+				return map[string]any{"error": fmt.Sprintf("header %q must be a string", k)}, nil
+			}
+			c.headers[k] = s
+		}
+	}
+	c.body, _ = args["body"].(string)
+	c.raw, _ = args["raw"].(bool)
+	return doHTTP(ctx, p, c), nil
+}
+
+// doHTTP makes the request under the policy's egress rules and returns
+// the response as a tool result.
+func doHTTP(ctx context.Context, p *types.Policy, c httpCall) map[string]any {
+	if p == nil {
+		p = &types.Policy{}
+	}
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	if err := checkEgress(p, u); err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
+	defer cancel()
+	var body io.Reader
+	if c.body != "" {
+		body = strings.NewReader(c.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, u.String(), body)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	client := newHTTPClient(p)
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPReadBytes+1))
+	if err != nil {
+		return map[string]any{"error": "reading the response: " + err.Error(), "status": resp.StatusCode}
+	}
+	truncated := len(data) > maxHTTPReadBytes
+	if truncated {
+		data = data[:maxHTTPReadBytes]
+	}
+
+	ct := resp.Header.Get("Content-Type")
+	res := map[string]any{"status": resp.StatusCode, "content_type": ct}
+	if final := resp.Request.URL.String(); final != u.String() {
+		res["url"] = final
+	}
+	if c.withHeaders {
+		res["headers"] = flattenHeaders(resp.Header)
+	}
+	text, encoding, ok := decodeText(data)
+	switch {
+	case !ok || binaryType(ct):
+		res["binary"], res["bytes"], res["body"] = true, len(data), ""
+		return res
+	case encoding != "":
+		res["encoding"] = encoding
+	}
+	if !c.raw && isHTML(ct, data) {
+		var title string
+		text, title = htmlToMarkdown(text, resp.Request.URL)
+		res["format"] = "markdown"
+		if title != "" {
+			res["title"] = title
+		}
+	}
+	if len(text) > maxHTTPBodyBytes {
+		n := maxHTTPBodyBytes
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		text, truncated = text[:n], true
+	}
+	res["body"], res["truncated"] = text, truncated
+	return res
+}
+
+// checkEgress refuses URLs the policy does not let the HTTP tools reach:
+// schemes other than http and https, hosts matching HTTPDeny or missing
+// from a non-empty HTTPAllow, and, without HTTPPrivate, local addresses
+// written in the URL. Names that resolve to local addresses are refused
+// when they are dialled.
+func checkEgress(p *types.Policy, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q; use http or https", u.Scheme)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	switch {
+	case host == "":
+		return fmt.Errorf("%s has no host", u)
+	case policy.MatchHost(p.HTTPDeny, host):
+		return fmt.Errorf("%s is blocked by http_deny", host)
+	case len(p.HTTPAllow) > 0 && !policy.MatchHost(p.HTTPAllow, host):
+		return fmt.Errorf("%s is not in http_allow", host)
+	case p.HTTPPrivate:
+		return nil
+	case host == "localhost" || strings.HasSuffix(host, ".localhost"):
+		return fmt.Errorf("%s is a loopback address; set http_private to allow it", host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if kind := localAddress(ip); kind != "" {
+			return fmt.Errorf("%s is a %s address; set http_private to allow it", host, kind)
+		}
+	}
+	return nil
+}
+
+// localAddress names the kind of a loopback, private, link-local or other
+// non-public address, or returns "" for a public one.
+func localAddress(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return "loopback"
+	case ip.IsPrivate():
+		return "private"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return "link-local"
+	case ip.IsUnspecified():
+		return "unspecified"
+	case ip.IsMulticast():
+		return "multicast"
+	case sharedAddresses.Contains(ip):
+		return "shared"
+	}
+	return ""
+}
+
+// dialControl refuses connections to local addresses unless the policy
+// allows them. It runs after name resolution, so a public name cannot lead
+// to a private address.
+func dialControl(p *types.Policy) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		if p.HTTPPrivate {
+			return nil
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			if kind := localAddress(ip); kind != "" {
+				return fmt.Errorf("%s is a %s address; set http_private to allow it", ip, kind)
+			}
+		}
+		return nil
+	}
+}
+
+// newHTTPClient returns a client that connects directly, without a proxy,
+// checks each redirect and each dialled address against the policy, and
+// adds the policy's credentials to HTTPS requests.
+func newHTTPClient(p *types.Policy) *http.Client {
+	dialer := &net.Dialer{Timeout: httpTimeout, Control: dialControl(p)}
+	tr := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: httpTimeout,
+		ForceAttemptHTTP2:   true,
+	}
+	if httpRootCAs != nil {
+		tr.TLSClientConfig = &tls.Config{RootCAs: httpRootCAs}
+	}
+	return &http.Client{
+		Transport: credentialTransport{base: tr, creds: p.HTTPCredentials},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxHTTPRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxHTTPRedirects)
+			}
+			return checkEgress(p, req.URL)
+		},
+	}
+}
+
+// credentialTransport adds the headers of matching credentials to each
+// HTTPS request, redirects included, so they only reach the hosts they
+// are meant for.
+type credentialTransport struct {
+	base  http.RoundTripper
+	creds []types.HTTPCredential
+}
+
+func (t credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || len(t.creds) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	var add []types.HTTPCredential
+	for _, c := range t.creds {
+		if policy.MatchHost([]string{c.Host}, req.URL.Hostname()) {
+			add = append(add, c)
+		}
+	}
+	if len(add) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	for _, c := range add {
+		req.Header.Set(c.Header, c.Value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+func (t credentialTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// binaryType reports whether a content type is never text.
+func binaryType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/", "application/octet-stream", "application/pdf", "application/zip", "application/gzip"} {
+		if strings.HasPrefix(ct, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func flattenHeaders(h http.Header) map[string]string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		out[k] = strings.Join(h[k], ", ")
+	}
+	return out
+}
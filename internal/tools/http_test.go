@@ -1,10 +1,17 @@
 package tools
 
 import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dave1010/jorin/internal/types"
 )
@@ -19,7 +26,7 @@ func TestHTTPGet(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	out, err := r["http_get"](map[string]any{"url": srv.URL}, &types.Policy{})
+	out, err := r["http_get"](context.Background(), map[string]any{"url": srv.URL}, &types.Policy{HTTPPrivate: true})
 	if err != nil {
 		t.Fatalf("http_get failed: %v", err)
 	}
@@ -40,7 +47,7 @@ func TestHTTPGetWaitsForResponse(t *testing.T) {
 	defer srv.Close()
 
 	start := time.Now()
-	out, err := r["http_get"](map[string]any{"url": srv.URL}, &types.Policy{})
+	out, err := r["http_get"](context.Background(), map[string]any{"url": srv.URL}, &types.Policy{HTTPPrivate: true})
 	if err != nil {
 		t.Fatalf("http_get delayed failed: %v", err)
 	}
@@ -52,3 +59,182 @@ func TestHTTPGetWaitsForResponse(t *testing.T) {
 		t.Fatalf("unexpected duration: %v", dur)
 	}
 }
+
+func TestHTTPRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "42")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"method":%q,"token":%q,"body":%q}`, r.Method, r.Header.Get("X-Token"), b)
+	}))
+	defer srv.Close()
+	p := &types.Policy{HTTPPrivate: true}
+
+	out := callTool(t, "http_request", map[string]any{
+		"url": srv.URL, "method": "post", "headers": map[string]any{"X-Token": "abc"}, "body": "hello",
+	}, p)
+	if out["status"] != http.StatusCreated || out["content_type"] != "application/json" || out["truncated"] != false {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+	if out["body"] != `{"method":"POST","token":"abc","body":"hello"}` {
+		t.Fatalf("body = %q", out["body"])
+	}
+	if out["headers"].(map[string]string)["X-Request-Id"] != "42" {
+		t.Fatalf("headers = %#v", out["headers"])
+	}
+	if out := callTool(t, "http_request", map[string]any{"url": srv.URL, "method": "TRACE"}, p); out["error"] == nil {
+		t.Fatalf("expected an unsupported method to be refused: %#v", out)
+	}
+	if out := callTool(t, "http_request", map[string]any{"url": srv.URL, "headers": map[string]any{"X-Token": 1.0}}, p); out["error"] == nil {
+		t.Fatalf("expected a header that is not a string to be refused: %#v", out)
+	}
+}
+
+func TestHTTPRequestBodies(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><title>Demo  page</title><style>p{}</style></head>
+<body><h1>Hello</h1><p>See the <a href="/docs">docs</a>.</p><script>alert(1)</script></body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = io.WriteString(w, page)
+		case "/big":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, strings.Repeat("é", 30_000))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, "\x89PNG\r\n")
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	p := &types.Policy{HTTPPrivate: true}
+
+	out := callTool(t, "http_get", map[string]any{"url": srv.URL + "/page"}, p)
+	want := "# Hello\n\nSee the [docs](" + srv.URL + "/docs)."
+	if out["body"] != want || out["title"] != "Demo page" || out["format"] != "markdown" {
+		t.Fatalf("converted page: %#v", out)
+	}
+	if out := callTool(t, "http_request", map[string]any{"url": srv.URL + "/page", "raw": true}, p); out["body"] != page || out["format"] != nil {
+		t.Fatalf("raw page: %#v", out)
+	}
+	if out := callTool(t, "http_get", map[string]any{"url": srv.URL + "/moved"}, p); out["url"] != srv.URL+"/page" || out["body"] != want {
+		t.Fatalf("redirected page: %#v", out)
+	}
+
+	out = callTool(t, "http_get", map[string]any{"url": srv.URL + "/big"}, p)
+	body := out["body"].(string)
+	if out["truncated"] != true || len(body) != maxHTTPBodyBytes || !utf8.ValidString(body) {
+		t.Fatalf("truncated %v, %d bytes, valid %v", out["truncated"], len(body), utf8.ValidString(body))
+	}
+	if out := callTool(t, "http_get", map[string]any{"url": srv.URL + "/image"}, p); out["binary"] != true || out["body"] != "" {
+		t.Fatalf("binary body: %#v", out)
+	}
+}
+
+func TestHTTPEgressPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "localhost", 1)+"/", http.StatusFound)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		url  string
+		p    *types.Policy
+		want string
+	}{
+		{srv.URL, &types.Policy{}, "loopback address"},
+		{"http://localhost:1/", &types.Policy{}, "loopback address"},
+		{"http://[::ffff:127.0.0.1]/", &types.Policy{}, "loopback address"},
+		{"http://169.254.169.254/latest/meta-data/", &types.Policy{}, "link-local address"},
+		{"http://10.1.2.3/", &types.Policy{}, "private address"},
+		{"http://0.0.0.0/", &types.Policy{}, "unspecified address"},
+		{"file:///etc/passwd", &types.Policy{}, "unsupported URL scheme"},
+		{"https://api.example.com/", &types.Policy{HTTPDeny: []string{"*.example.com"}}, "blocked by http_deny"},
+		{"https://example.com/", &types.Policy{HTTPAllow: []string{"example.org"}}, "not in http_allow"},
+		{srv.URL + "/away", &types.Policy{HTTPPrivate: true, HTTPAllow: []string{"127.0.0.1"}}, "localhost is not in http_allow"},
+	}
+	for _, c := range cases {
+		out := callTool(t, "http_request", map[string]any{"url": c.url}, c.p)
+		if got := fmt.Sprint(out["error"]); !strings.Contains(got, c.want) {
+			t.Errorf("%s: error %q, want %q", c.url, got, c.want)
+		}
+	}
+	if out := callTool(t, "http_request", map[string]any{"url": srv.URL}, &types.Policy{HTTPPrivate: true, HTTPAllow: []string{"127.0.0.1"}}); out["body"] != "ok" {
+		t.Fatalf("expected an allowed host to be reached: %#v", out)
+	}
+
+	// names that resolve to local addresses are refused when dialled
+	control := dialControl(&types.Policy{})
+	if err := control("tcp", "127.0.0.1:80", nil); err == nil || !strings.Contains(err.Error(), "loopback") {
+		t.Fatalf("dialling loopback: %v", err)
+	}
+	if err := control("tcp", "[fe80::1]:80", nil); err == nil {
+		t.Fatal("expected dialling a link-local address to be refused")
+	}
+	if err := control("tcp", "100.64.0.1:80", nil); err == nil {
+		t.Fatal("expected dialling a shared address to be refused")
+	}
+	if err := control("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Fatalf("dialling a public address: %v", err)
+	}
+	if err := dialControl(&types.Policy{HTTPPrivate: true})("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Fatalf("dialling loopback with http_private: %v", err)
+	}
+}
+
+func TestHTTPCredentials(t *testing.T) {
+	seen := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("Authorization")+"|"+r.Header.Get("X-Api-Key"))
+	}
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(seen))
+	defer tlsSrv.Close()
+	plain := httptest.NewServer(http.HandlerFunc(seen))
+	defer plain.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsSrv.Certificate())
+	httpRootCAs = pool
+	t.Cleanup(func() { httpRootCAs = nil })
+
+	p := &types.Policy{HTTPPrivate: true, HTTPCredentials: []types.HTTPCredential{
+		{Host: "127.0.0.1", Header: "Authorization", Value: "Bearer secret"},
+		{Host: "api.example.com", Header: "X-Api-Key", Value: "other"},
+	}}
+	if out := callTool(t, "http_get", map[string]any{"url": tlsSrv.URL}, p); out["body"] != "Bearer secret|" {
+		t.Fatalf("expected only the matching credential over HTTPS: %#v", out)
+	}
+	if out := callTool(t, "http_get", map[string]any{"url": plain.URL}, p); out["body"] != "|" {
+		t.Fatalf("expected no credentials over plain HTTP: %#v", out)
+	}
+}
+
+func TestHTMLToMarkdown(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/")
+	cases := []struct{ html, want string }{
+		{`<p>one  <b>two</b>
+			<i>three</i></p><p>four</p>`, "one **two** _three_\n\nfour"},
+		{`<h2> Title </h2>text<br>more`, "## Title\n\ntext\nmore"},
+		{`<ul><li>a</li><li>b<ol><li>c</li><li>d</li></ol></li></ul>`, "- a\n- b\n  1. c\n  2. d"},
+		{`<pre><code>if x {
+	y()
+}</code></pre>`, "```\nif x {\n\ty()\n}\n```"},
+		{`Use <code>go test</code>.`, "Use `go test`."},
+		{`<a href="guide.html">Guide</a> <a href="#top">top</a> <a href="javascript:x()">js</a>`, "[Guide](https://example.com/docs/guide.html) top js"},
+		{`<img src="/logo.png" alt="Logo">`, "![Logo](https://example.com/logo.png)"},
+		{`<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>`, "a | b\n1 | 2"},
+		{`<head><meta charset="utf-8"><body>x &amp; y &lt;z&gt;<!-- note --></body>`, "x & y <z>"},
+		{`<nav>Menu</nav><noscript>enable js</noscript><svg><text>icon</text></svg>a < b`, "Menu\n\na < b"},
+	}
+	for _, c := range cases {
+		if got, _ := htmlToMarkdown(c.html, base); got != c.want {
+			t.Errorf("htmlToMarkdown(%q) =\n%q\nwant\n%q", c.html, got, c.want)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package tools
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/dave1010/jorin/internal/types"
 )
 
 type operation int
@@ -14,105 +19,280 @@ const (
 	opCreate operation = iota
 	opUpdate
 	opDelete
+	opRename
 )
 
+func (o operation) String() string {
+	switch o {
+	case opCreate:
+		return "create"
+	case opDelete:
+		return "delete"
+	case opRename:
+		return "rename"
+	}
+	return "update"
+}
+
 type hunk struct {
 	oldStart int
 	oldLen   int
 	newStart int
 	newLen   int
 	lines    []string
+	// noEOLOld and noEOLNew record a "\ No newline at end of file" marker
+	// after an old or new line of the hunk.
+	noEOLOld bool
+	noEOLNew bool
+	// anchored hunks come from envelopes: they have no line numbers and
+	// are found after the previous hunk, below each of the anchors (the
+	// text after "@@"). atEOF hunks must match at the end of the file.
+	anchored bool
+	anchors  []string
+	atEOF    bool
 }
 
+// parsedPatch is the change to one file.
 type parsedPatch struct {
 	op       operation
 	filePath string
-	hunks    []hunk
+	// oldPath is the file renamed to filePath.
+	oldPath string
+	// mode is the file mode from a git "new file mode" or "new mode"
+	// header, or 0.
+	mode  os.FileMode
+	hunks []hunk
+
+	git    bool // started by a "diff --git" line
+	header bool // the ---/+++ header has been read
 }
 
-func parsePatch(patch string) (*parsedPatch, error) {
-	scanner := bufio.NewScanner(strings.NewReader(patch))
-	var line1, line2 string
-
-	// Skip until we find "--- "
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "--- ") {
-			line1 = line
-			break
+// parsePatch splits patch into the changes to each file. It accepts plain
+// unified diffs, with one ---/+++ header per file, git diffs, whose
+// "diff --git" headers may add renames, new and deleted files and mode
+// changes, and "*** Begin Patch" envelopes (see parseEnvelope). Text before
+// the first header is ignored.
+func parsePatch(patch string) ([]*parsedPatch, error) {
+	lines := strings.Split(patch, "\n")
+	envelope := false
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+		if strings.TrimSpace(lines[i]) == envelopeBegin {
+			envelope = true
 		}
 	}
+	var files []*parsedPatch
+	var err error
+	if envelope {
+		files, err = parseEnvelope(lines)
+	} else {
+		files, err = parseUnified(lines)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	if line1 == "" {
+	if len(files) == 0 {
 		return nil, errors.New("invalid patch format: missing '--- ' header")
 	}
+	for _, f := range files {
+		if f.filePath == "" {
+			return nil, errors.New("invalid patch format: missing file path")
+		}
+		if f.op == opUpdate && len(f.hunks) == 0 && f.mode == 0 {
+			return nil, fmt.Errorf("patch for %s has no hunks", f.filePath)
+		}
+	}
+	return files, nil
+}
 
-	if scanner.Scan() {
-		line2 = scanner.Text()
-	} else {
-		return nil, errors.New("invalid patch format: missing second line after '--- '")
+func parseUnified(lines []string) ([]*parsedPatch, error) {
+	isFileHeader := func(i int) bool {
+		return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
 	}
 
-	var p parsedPatch
-	var err error
+	var files []*parsedPatch
+	var cur *parsedPatch
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			cur = &parsedPatch{op: opUpdate, git: true}
+			cur.oldPath, cur.filePath = gitPaths(strings.TrimPrefix(line, "diff --git "))
+			files = append(files, cur)
+
+		case isFileHeader(i):
+			if cur == nil || !cur.git || cur.header || !cur.gitHeaderMatches(line, lines[i+1]) {
+				cur = &parsedPatch{op: opUpdate}
+				files = append(files, cur)
+			}
+			if err := cur.parseHeader(line, lines[i+1]); err != nil {
+				return nil, err
+			}
+			i++
 
-	if strings.HasPrefix(line1, "--- /dev/null") {
-		p.op = opCreate
-		p.filePath, err = parseFilePath(line2)
-		if err != nil {
-			return nil, err
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, errors.New("invalid patch format: missing '--- ' header")
+			}
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			// The body runs until the next hunk or file header. Lines the
+			// model left without a prefix are dropped, except blank lines
+			// followed by more of the hunk, which are blank context lines.
+			blank := 0
+			for i+1 < len(lines) && !strings.HasPrefix(lines[i+1], "@@") && !strings.HasPrefix(lines[i+1], "diff --git ") && !isFileHeader(i+1) {
+				i++
+				l := lines[i]
+				switch {
+				case l == "":
+					blank++
+				case strings.HasPrefix(l, `\`):
+					if len(h.lines) == 0 {
+						continue
+					}
+					switch h.lines[len(h.lines)-1][0] {
+					case '-':
+						h.noEOLOld = true
+					case '+':
+						h.noEOLNew = true
+					default:
+						h.noEOLOld, h.noEOLNew = true, true
+					}
+				case l[0] == ' ' || l[0] == '+' || l[0] == '-':
+					for ; blank > 0; blank-- {
+						h.lines = append(h.lines, " ")
+					}
+					h.lines = append(h.lines, l)
+				}
+			}
+			cur.hunks = append(cur.hunks, h)
+
+		case cur != nil && cur.git && !cur.header:
+			if err := cur.parseGitHeader(line); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			return nil, errors.New("binary patches are not supported")
 		}
-	} else if strings.HasPrefix(line2, "+++ /dev/null") {
+	}
+	return files, nil
+}
+
+// gitHeaderMatches reports whether a ---/+++ header names the files of the
+// "diff --git" line before it, rather than starting a plain diff of another
+// file after a git section without hunks.
+func (p *parsedPatch) gitHeaderMatches(line1, line2 string) bool {
+	oldPath, err1 := parseFilePath(line1)
+	newPath, err2 := parseFilePath(line2)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return (oldPath == "/dev/null" || oldPath == p.oldPath) && (newPath == "/dev/null" || newPath == p.filePath)
+}
+
+// parseHeader reads a "--- old" and "+++ new" header pair.
+func (p *parsedPatch) parseHeader(line1, line2 string) error {
+	p.header = true
+	oldPath, err := parseFilePath(line1)
+	if err != nil {
+		return err
+	}
+	newPath, err := parseFilePath(line2)
+	if err != nil {
+		return err
+	}
+	switch {
+	case oldPath == "/dev/null":
+		p.op = opCreate
+		p.filePath = newPath
+	case newPath == "/dev/null":
 		p.op = opDelete
-		p.filePath, err = parseFilePath(line1)
-		if err != nil {
-			return nil, err
-		}
-	} else {
+		p.filePath = oldPath
+	case p.op == opRename:
+		p.oldPath, p.filePath = oldPath, newPath
+	case oldPath != newPath:
+		return fmt.Errorf("file paths in patch header do not match: %q (from %q) vs %q (from %q). Ensure both headers use the same file path", oldPath, line1, newPath, line2)
+	default:
 		p.op = opUpdate
-		p.filePath, err = parseFilePath(line1)
-		if err != nil {
-			return nil, err
+		p.filePath = newPath
+	}
+	return nil
+}
+
+// parseGitHeader reads an extended header line of a git diff.
+func (p *parsedPatch) parseGitHeader(line string) error {
+	key, value := line, ""
+	for _, k := range []string{"new file mode ", "deleted file mode ", "new mode ", "rename from ", "rename to "} {
+		if strings.HasPrefix(line, k) {
+			key, value = strings.TrimSpace(k), unquotePath(strings.TrimPrefix(line, k))
+			break
 		}
-		// Sanity check
-		fp2, err := parseFilePath(line2)
+	}
+	switch key {
+	case "new file mode", "new mode":
+		m, err := strconv.ParseUint(value, 8, 32)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("invalid mode line: %q", line)
+		}
+		p.mode = os.FileMode(m).Perm()
+		if key == "new file mode" {
+			p.op = opCreate
+		}
+	case "deleted file mode":
+		p.op = opDelete
+	case "rename from":
+		p.op = opRename
+		p.oldPath = value
+	case "rename to":
+		p.op = opRename
+		p.filePath = value
+	default:
+		if strings.HasPrefix(line, "copy from ") || strings.HasPrefix(line, "copy to ") {
+			return errors.New("copies are not supported; create the new file instead")
 		}
-		if p.filePath != fp2 {
-			return nil, fmt.Errorf("file paths in patch header do not match: %q (from %q) vs %q (from %q). Ensure both headers use the same file path", p.filePath, line1, fp2, line2)
+		if strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch" {
+			return errors.New("binary patches are not supported")
 		}
 	}
+	return nil
+}
 
-	var currentHunk *hunk
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "@@") {
-			if currentHunk != nil {
-				p.hunks = append(p.hunks, *currentHunk)
-			}
-			currentHunk = &hunk{}
-			_, err := fmt.Sscanf(line, "@@ -%d,%d +%d,%d @@", &currentHunk.oldStart, &currentHunk.oldLen, &currentHunk.newStart, &currentHunk.newLen)
-			if err != nil {
-				// try alternative format @@ -%d +%d @@
-				_, err = fmt.Sscanf(line, "@@ -%d +%d @@", &currentHunk.oldStart, &currentHunk.newStart)
-				if err != nil {
-					return nil, fmt.Errorf("malformed hunk header: %q. Expected format '@@ -oldStart,oldLen +newStart,newLen @@'", line)
-				}
-				currentHunk.oldLen = 1
-				currentHunk.newLen = 1
-			}
-			continue
-		}
-		if currentHunk != nil {
-			currentHunk.lines = append(currentHunk.lines, line)
+// gitPaths returns the paths in the rest of a "diff --git a/old b/new" line.
+// Renames and other changes with spaces in the path are described by later
+// header lines, so a best guess is enough.
+func gitPaths(rest string) (string, string) {
+	if strings.HasPrefix(rest, `"`) {
+		if q, err := strconv.QuotedPrefix(rest); err == nil {
+			return stripPrefix(unquotePath(q)), stripPrefix(unquotePath(strings.TrimSpace(rest[len(q):])))
 		}
 	}
-	if currentHunk != nil {
-		p.hunks = append(p.hunks, *currentHunk)
+	i := strings.Index(rest, " b/")
+	if i < 0 {
+		return "", ""
 	}
+	return stripPrefix(rest[:i]), stripPrefix(unquotePath(rest[i+1:]))
+}
 
-	return &p, nil
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func parseHunkHeader(line string) (hunk, error) {
+	m := hunkHeader.FindStringSubmatch(line)
+	if m == nil {
+		return hunk{}, fmt.Errorf("malformed hunk header: %q. Expected format '@@ -oldStart,oldLen +newStart,newLen @@'", line)
+	}
+	// a missing length means one line
+	n := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		v, _ := strconv.Atoi(s)
+		return v
+	}
+	return hunk{oldStart: n(m[1]), oldLen: n(m[2]), newStart: n(m[3]), newLen: n(m[4])}, nil
 }
 
 func parseFilePath(line string) (string, error) {
@@ -120,63 +300,328 @@ func parseFilePath(line string) (string, error) {
 	if len(parts) != 2 {
 		return "", fmt.Errorf("invalid patch header line: %q", line)
 	}
-	pathPart := strings.TrimSpace(parts[1])
-	if strings.HasPrefix(pathPart, "a/") || strings.HasPrefix(pathPart, "b/") {
-		return pathPart[2:], nil
+	pathPart := parts[1]
+	// diff -u appends a timestamp after a tab
+	if i := strings.IndexByte(pathPart, '\t'); i >= 0 {
+		pathPart = pathPart[:i]
+	}
+	pathPart = unquotePath(strings.TrimSpace(pathPart))
+	if pathPart == "" {
+		return "", fmt.Errorf("invalid patch header line: %q", line)
+	}
+	return stripPrefix(pathPart), nil
+}
+
+func stripPrefix(path string) string {
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+// unquotePath decodes a path git quoted because of unusual characters.
+func unquotePath(path string) string {
+	if strings.HasPrefix(path, `"`) {
+		if s, err := strconv.Unquote(path); err == nil {
+			return s
+		}
 	}
-	return pathPart, nil
+	return path
 }
 
+// PatchPaths returns the files a patch creates, updates, renames or deletes,
+// including both paths of a rename.
+func PatchPaths(patch string) ([]string, error) {
+	files, err := parsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range files {
+		if f.op == opRename {
+			paths = append(paths, f.oldPath)
+		}
+		paths = append(paths, f.filePath)
+	}
+	return paths, nil
+}
+
+// ApplyPatch applies patch to the files it names, relative to the working
+// directory.
 func ApplyPatch(patch string) error {
-	p, err := parsePatch(patch)
+	_, err := applyPatch(patch, patchOptions{fuzz: PatchFuzz})
+	return err
+}
+
+// fileChange is the outcome of one file's part of a patch.
+type fileChange struct {
+	op   operation
+	path string
+	from string // the old path of a rename
+	text string // the new content, unless the file is deleted
+	fuzz int    // the loosest fuzz level a hunk needed
+}
+
+// patchOptions control applyPatch.
+type patchOptions struct {
+	// resolve maps a patch path to the file to change, and may refuse it.
+	// Nil uses the paths in the patch as given.
+	resolve func(string) (string, error)
+	// check patches the files in memory without writing them.
+	check bool
+	// fs holds the files. Nil uses the operating system's.
+	fs types.FileSystem
+	// fuzz is the loosest fuzz level hunks may match at (see PatchFuzz).
+	fuzz int
+	// save, if set, is called with the files about to be written, before
+	// any is.
+	save func(paths ...string) error
+}
+
+// applyPatch applies every file in patch. All files are patched in memory
+// before any is written, so a patch that does not apply changes nothing,
+// and if a write fails the files already written are restored.
+func applyPatch(patch string, opts patchOptions) ([]fileChange, error) {
+	files, err := parsePatch(patch)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	fsys := opts.fs
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	s := &patchSet{resolve: opts.resolve, fs: fsys, fuzz: opts.fuzz, orig: map[string]fileState{}, cur: map[string]*fileState{}}
+	var changes []fileChange
+	for _, f := range files {
+		c, err := s.apply(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.filePath, err)
+		}
+		changes = append(changes, c)
+	}
+	if opts.check {
+		return changes, nil
+	}
+	if opts.save != nil {
+		if err := opts.save(s.changed()...); err != nil {
+			return nil, fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+	return changes, s.commit()
+}
+
+// fileState is a file's content, or its absence.
+type fileState struct {
+	exists bool
+	data   []byte
+	mode   os.FileMode
+}
 
-	switch p.op {
+// patchSet holds the files a patch touches, as they were and as the patch
+// leaves them.
+type patchSet struct {
+	resolve func(string) (string, error)
+	fs      types.FileSystem
+	fuzz    int
+	order   []string
+	orig    map[string]fileState
+	cur     map[string]*fileState
+}
+
+// file returns the state of the file at the patch path p.
+func (s *patchSet) file(p string) (*fileState, error) {
+	path := p
+	if s.resolve != nil {
+		var err error
+		if path, err = s.resolve(p); err != nil {
+			return nil, err
+		}
+	}
+	if f, ok := s.cur[path]; ok {
+		return f, nil
+	}
+	st := fileState{mode: 0o644}
+	info, err := s.fs.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, fmt.Errorf("%s is a directory", p)
+	case err == nil:
+		data, err := s.fs.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		st = fileState{exists: true, data: data, mode: info.Mode().Perm()}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	s.orig[path] = st
+	s.cur[path] = &st
+	s.order = append(s.order, path)
+	return &st, nil
+}
+
+func (s *patchSet) apply(f *parsedPatch) (fileChange, error) {
+	c := fileChange{op: f.op, path: f.filePath}
+	dst, err := s.file(f.filePath)
+	if err != nil {
+		return c, err
+	}
+	switch f.op {
 	case opCreate:
-		return createFile(p.filePath, p.hunks)
-	case opUpdate:
-		return updateFile(p.filePath, p.hunks)
+		if dst.exists {
+			return c, errors.New("file already exists")
+		}
+		mode := f.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		*dst = fileState{exists: true, data: createText(f.hunks), mode: mode}
 	case opDelete:
-		return deleteFile(p.filePath)
+		if !dst.exists {
+			return c, errors.New("file not found")
+		}
+		*dst = fileState{}
+		return c, nil
+	default:
+		src := dst
+		if f.op == opRename {
+			c.from = f.oldPath
+			if src, err = s.file(f.oldPath); err != nil {
+				return c, err
+			}
+			if !src.exists {
+				return c, fmt.Errorf("%s: file not found", f.oldPath)
+			}
+			if dst.exists && dst != src {
+				return c, errors.New("file already exists")
+			}
+		} else if !dst.exists {
+			return c, errors.New("file not found")
+		}
+		data, fuzz, err := patchText(src.data, f.hunks, s.fuzz)
+		c.fuzz = fuzz
+		if err != nil {
+			return c, err
+		}
+		mode := src.mode
+		if f.mode != 0 {
+			mode = f.mode
+		}
+		*src = fileState{}
+		*dst = fileState{exists: true, data: data, mode: mode}
 	}
-	return errors.New("unknown operation")
+	c.text = string(dst.data)
+	return c, nil
 }
 
-func createFile(path string, hunks []hunk) error {
+// changed returns the paths of the files the patch changes.
+func (s *patchSet) changed() []string {
+	var paths []string
+	for _, path := range s.order {
+		cur, orig := *s.cur[path], s.orig[path]
+		if cur.exists != orig.exists || cur.mode != orig.mode || !bytes.Equal(cur.data, orig.data) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// commit writes every file the patch changed. If a write fails, the files
+// already written are restored.
+func (s *patchSet) commit() error {
+	var done []string
+	for _, path := range s.changed() {
+		cur := *s.cur[path]
+		if err := writeState(s.fs, path, cur); err != nil {
+			for i := len(done) - 1; i >= 0; i-- {
+				_ = writeState(s.fs, done[i], s.orig[done[i]])
+			}
+			return err
+		}
+		done = append(done, path)
+	}
+	return nil
+}
+
+// writeState makes the file at path match st.
+func writeState(fsys types.FileSystem, path string, st fileState) error {
+	if !st.exists {
+		err := fsys.Remove(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return fsys.WriteFile(path, st.data, st.mode)
+}
+
+// createText returns the content of a file created by hunks.
+func createText(hunks []hunk) []byte {
 	var content strings.Builder
+	eol := true
 	for _, h := range hunks {
 		for _, line := range h.lines {
-			if strings.HasPrefix(line, "+") {
-				content.WriteString(line[1:])
-				content.WriteString("\n")
-			} else if strings.HasPrefix(line, " ") {
+			if line[0] == '+' || line[0] == ' ' {
 				content.WriteString(line[1:])
 				content.WriteString("\n")
-			} else if !strings.HasPrefix(line, "-") {
-				return fmt.Errorf("invalid diff content for create: %s", line)
 			}
 		}
+		eol = !h.noEOLNew
 	}
-
-	return os.WriteFile(path, []byte(content.String()), 0644)
+	text := content.String()
+	if !eol {
+		text = strings.TrimSuffix(text, "\n")
+	}
+	return []byte(text)
 }
 
-func updateFile(path string, hunks []hunk) error {
-	f, err := os.ReadFile(path)
-	if err != nil {
-		return err
+// patchText applies hunks to data. Lines are matched without their line
+// endings, and the result keeps data's CRLF or LF endings. Whether it ends
+// with a newline follows the "\ No newline at end of file" markers. It also
+// returns the loosest fuzz level a hunk needed.
+func patchText(data []byte, hunks []hunk, fuzz int) ([]byte, int, error) {
+	text := string(data)
+	sep := "\n"
+	if i := strings.IndexByte(text, '\n'); i > 0 && text[i-1] == '\r' {
+		sep = "\r\n"
 	}
-	originalLines := strings.Split(string(f), "\n")
-	if len(originalLines) > 0 && originalLines[len(originalLines)-1] == "" {
-		originalLines = originalLines[:len(originalLines)-1]
+	eol := text == "" || strings.HasSuffix(text, "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSuffix(lines[i], "\r")
+		}
+	}
+	for _, h := range hunks {
+		switch {
+		case h.noEOLNew:
+			eol = false
+		case h.noEOLOld:
+			eol = true
+		}
 	}
 
-	currentLines := originalLines
+	lines, used, err := applyHunks(lines, hunks, fuzz)
+	if err != nil {
+		return nil, used, err
+	}
+	if len(lines) == 0 {
+		return []byte{}, used, nil
+	}
+	out := strings.Join(lines, sep)
+	if eol {
+		out += sep
+	}
+	return []byte(out), used, nil
+}
 
+func applyHunks(currentLines []string, hunks []hunk, fuzz int) ([]string, int, error) {
 	// Track the cumulative shift in line numbers caused by previous hunks
 	globalOffset := 0
+	// and where the previous hunk ended, for anchored hunks
+	cursor := 0
+	maxUsed := 0
 
 	for i, h := range hunks {
 		// Calculate where we expect the hunk to apply based on its header and previous shifts
@@ -186,152 +631,58 @@ func updateFile(path string, hunks []hunk) error {
 		}
 
 		// Find the actual application point
-		applyAt, err := findHunkLocation(currentLines, h, expectedStart)
+		var applyAt, used int
+		var err error
+		if h.anchored {
+			applyAt, used, err = findAnchoredLocation(currentLines, h, cursor, fuzz)
+		} else {
+			applyAt, used, err = findHunkLocation(currentLines, h, expectedStart, fuzz)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to apply hunk %d: %w", i+1, err)
+			return nil, maxUsed, fmt.Errorf("failed to apply hunk %d: %w", i+1, err)
+		}
+		if used > maxUsed {
+			maxUsed = used
 		}
 
 		// Apply the hunk at the found location
 		var nextLines []string
 		nextLines = append(nextLines, currentLines[:applyAt]...)
 
+		hunkOldLen := 0
+		hunkNewLen := 0
 		for _, line := range h.lines {
-			if strings.HasPrefix(line, "+") {
+			switch line[0] {
+			case '+':
 				nextLines = append(nextLines, line[1:])
-			} else if strings.HasPrefix(line, " ") {
+				hunkNewLen++
+			case ' ':
 				// Keep existing line
 				if applyAt < len(currentLines) {
 					nextLines = append(nextLines, currentLines[applyAt])
 					applyAt++
 				}
-			} else if strings.HasPrefix(line, "-") {
+				hunkOldLen++
+				hunkNewLen++
+			case '-':
 				// Skip existing line (delete)
 				applyAt++
+				hunkOldLen++
 			}
 		}
 
+		cursor = len(nextLines)
+
 		// Append the rest of the file
 		if applyAt < len(currentLines) {
 			nextLines = append(nextLines, currentLines[applyAt:]...)
 		}
 
-		// Update global offset for next hunk
-		// The shift is newLen - oldLen
-		// However, since we are re-searching for the location for every hunk,
-		// strict globalOffset tracking is less critical for finding the location,
-		// but `findHunkLocation` uses expectedStart as a hint.
-		// Let's rely on the difference between the found location and where we ended up.
-
-		hunkOldLen := 0
-		hunkNewLen := 0
-		for _, line := range h.lines {
-			if strings.HasPrefix(line, " ") {
-				hunkOldLen++
-				hunkNewLen++
-			} else if strings.HasPrefix(line, "-") {
-				hunkOldLen++
-			} else if strings.HasPrefix(line, "+") {
-				hunkNewLen++
-			}
-		}
-
-		// Adjust globalOffset.
-		// Actually, since we rebuild currentLines, the indices for the *next* hunk
-		// in the *original* file (h.oldStart) need to be adjusted by how much
-		// we've changed the file size so far.
-		globalOffset += (hunkNewLen - hunkOldLen)
+		// The indices for the next hunk in the original file (h.oldStart)
+		// need to be adjusted by how much we've changed the file size so far.
+		globalOffset += hunkNewLen - hunkOldLen
 
 		currentLines = nextLines
 	}
-
-	return os.WriteFile(path, []byte(strings.Join(currentLines, "\n")+"\n"), 0644)
-}
-
-func findHunkLocation(lines []string, h hunk, expectedStart int) (int, error) {
-	// Construct the block of lines we are looking for (context + deleted lines)
-	var searchBlock []string
-	for _, line := range h.lines {
-		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "-") {
-			searchBlock = append(searchBlock, line[1:])
-		}
-	}
-
-	if len(searchBlock) == 0 {
-		// Pure addition? It applies at expectedStart
-		return expectedStart, nil
-	}
-
-	// 1. Try exact match at expectedStart
-	if matchAt(lines, searchBlock, expectedStart) {
-		return expectedStart, nil
-	}
-
-	// 2. Search locally around expectedStart? Or just global search?
-	// Let's do a global search and find the closest match to expectedStart.
-	var candidates []int
-	for i := 0; i <= len(lines)-len(searchBlock); i++ {
-		if matchAt(lines, searchBlock, i) {
-			candidates = append(candidates, i)
-		}
-	}
-
-	if len(candidates) == 0 {
-		// Construct a detailed error message showing what was expected vs found at expectedStart
-		// Limit the output to first few lines to avoid huge error messages
-		details := ""
-		if expectedStart < len(lines) {
-			limit := 3
-			if len(searchBlock) < limit {
-				limit = len(searchBlock)
-			}
-			details = fmt.Sprintf("\nExpected first %d lines:\n", limit)
-			for i := 0; i < limit; i++ {
-				details += fmt.Sprintf("  %q\n", searchBlock[i])
-			}
-			details += fmt.Sprintf("Found at line %d:\n", expectedStart+1)
-			for i := 0; i < limit && expectedStart+i < len(lines); i++ {
-				details += fmt.Sprintf("  %q\n", lines[expectedStart+i])
-			}
-		} else {
-			details = fmt.Sprintf("\nExpected start at line %d, but file has only %d lines.", expectedStart+1, len(lines))
-		}
-		return -1, fmt.Errorf("hunk context not found in file%s", details)
-	}
-
-	// Find closest candidate
-	bestCandidate := candidates[0]
-	minDist := abs(candidates[0] - expectedStart)
-
-	for _, c := range candidates {
-		dist := abs(c - expectedStart)
-		if dist < minDist {
-			minDist = dist
-			bestCandidate = c
-		}
-	}
-
-	return bestCandidate, nil
-}
-
-func matchAt(lines []string, block []string, start int) bool {
-	if start < 0 || start+len(block) > len(lines) {
-		return false
-	}
-	for i, line := range block {
-		if lines[start+i] != line {
-			return false
-		}
-	}
-	return true
-}
-
-func abs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
-func deleteFile(path string) error {
-	return os.Remove(path)
+	return currentLines, maxUsed, nil
 }
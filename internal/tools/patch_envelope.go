@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	envelopeBegin = "*** Begin Patch"
+	envelopeEnd   = "*** End Patch"
+)
+
+// parseEnvelope parses the patch format many models are trained to write:
+//
+//	*** Begin Patch
+//	*** Update File: path/to/file.go
+//	*** Move to: path/to/renamed.go
+//	@@ func main() {
+//	 context
+//	-old
+//	+new
+//	*** Add File: path/to/new.txt
+//	+content
+//	*** Delete File: path/to/old.txt
+//	*** End Patch
+//
+// Update hunks have no line numbers. Each is found after the previous one,
+// below the lines named after its "@@" markers, and "*** End of File" ties
+// a hunk to the end of the file.
+func parseEnvelope(lines []string) ([]*parsedPatch, error) {
+	i := 0
+	for i < len(lines) && strings.TrimSpace(lines[i]) != envelopeBegin {
+		i++
+	}
+	var files []*parsedPatch
+	var cur *parsedPatch
+	var h *hunk
+	blank := 0
+	flush := func() {
+		if h != nil && (len(h.lines) > 0 || cur.op == opCreate) {
+			cur.hunks = append(cur.hunks, *h)
+		}
+		h = nil
+		blank = 0
+	}
+	start := func(op operation, path string) error {
+		flush()
+		if path == "" {
+			return fmt.Errorf("line %d: missing file path", i+1)
+		}
+		cur = &parsedPatch{op: op, filePath: path}
+		files = append(files, cur)
+		if op == opCreate {
+			h = &hunk{}
+		}
+		return nil
+	}
+
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		var err error
+		switch trim := strings.TrimSpace(line); {
+		case trim == envelopeEnd:
+			flush()
+			return files, nil
+		case strings.HasPrefix(line, "*** Add File: "):
+			err = start(opCreate, strings.TrimSpace(strings.TrimPrefix(line, "*** Add File: ")))
+		case strings.HasPrefix(line, "*** Delete File: "):
+			err = start(opDelete, strings.TrimSpace(strings.TrimPrefix(line, "*** Delete File: ")))
+		case strings.HasPrefix(line, "*** Update File: "):
+			err = start(opUpdate, strings.TrimSpace(strings.TrimPrefix(line, "*** Update File: ")))
+		case strings.HasPrefix(line, "*** Move to: "):
+			if cur == nil || cur.op != opUpdate || len(cur.hunks) > 0 || h != nil {
+				return nil, fmt.Errorf("line %d: \"*** Move to:\" must follow \"*** Update File:\"", i+1)
+			}
+			cur.op = opRename
+			cur.oldPath = cur.filePath
+			cur.filePath = strings.TrimSpace(strings.TrimPrefix(line, "*** Move to: "))
+		case trim == "*** End of File":
+			if h != nil {
+				h.atEOF = true
+			}
+			flush()
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil || (cur.op != opUpdate && cur.op != opRename) {
+				return nil, fmt.Errorf("line %d: \"@@\" outside an \"*** Update File:\" section", i+1)
+			}
+			if h != nil && len(h.lines) > 0 {
+				flush()
+			}
+			if h == nil {
+				h = &hunk{anchored: true}
+			}
+			if anchor := strings.TrimSpace(strings.TrimPrefix(line, "@@")); anchor != "" {
+				h.anchors = append(h.anchors, anchor)
+			}
+		case cur == nil:
+			// text between "*** Begin Patch" and the first file
+		case line == "":
+			// a blank line, unless it ends the section
+			blank++
+		default:
+			err = addEnvelopeLine(cur, &h, line, &blank)
+			if err != nil {
+				err = fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	flush()
+	return files, nil
+}
+
+// addEnvelopeLine adds a content line to the current hunk, after the blank
+// lines before it.
+func addEnvelopeLine(f *parsedPatch, h **hunk, line string, blank *int) error {
+	switch f.op {
+	case opDelete:
+		return fmt.Errorf("unexpected line after \"*** Delete File: %s\": %q", f.filePath, line)
+	case opCreate:
+		if line[0] != '+' {
+			return fmt.Errorf("lines of an added file must start with '+', got %q", line)
+		}
+		if *h == nil {
+			return fmt.Errorf("unexpected line after \"*** End of File\": %q", line)
+		}
+		for ; *blank > 0; *blank-- {
+			(*h).lines = append((*h).lines, "+")
+		}
+	default:
+		if line[0] != ' ' && line[0] != '+' && line[0] != '-' {
+			return fmt.Errorf("hunk lines must start with ' ', '+' or '-', got %q", line)
+		}
+		if *h == nil {
+			// the first hunk may leave out its "@@"
+			*h = &hunk{anchored: true}
+		}
+		for ; *blank > 0; *blank-- {
+			(*h).lines = append((*h).lines, " ")
+		}
+	}
+	(*h).lines = append((*h).lines, line)
+	return nil
+}
+
+// findAnchoredLocation finds where an anchored hunk applies: after from,
+// below its anchors, or at the end of the file for atEOF hunks. Anchors
+// match ignoring surrounding whitespace; the hunk matches at the strictest
+// fuzz level it can, which is returned.
+func findAnchoredLocation(lines []string, h hunk, from, fuzz int) (int, int, error) {
+	for _, a := range h.anchors {
+		i, _ := seekLines(lines, []string{a}, from, false, MaxPatchFuzz)
+		if i < 0 {
+			return -1, 0, fmt.Errorf("context %q not found in file", a)
+		}
+		from = i + 1
+	}
+	block := hunkBlock(h)
+	if len(block) == 0 {
+		// pure additions go below the anchors, or at the end
+		if len(h.anchors) > 0 {
+			return from, 0, nil
+		}
+		return len(lines), 0, nil
+	}
+	if i, level := seekLines(lines, block, from, h.atEOF, fuzz); i >= 0 {
+		return i, level, nil
+	}
+	return -1, 0, hunkMismatch(lines, block, from, fuzz)
+}
+
+// seekLines returns the first index at or after from where block matches
+// lines, trying an exact match before looser ones up to fuzz, and the
+// level that matched; the index is -1 if none does. With eof set a match
+// ending at the last line is preferred.
+func seekLines(lines, block []string, from int, eof bool, fuzz int) (int, int) {
+	for level := 0; level <= fuzz; level++ {
+		if eof && matchAt(lines, block, len(lines)-len(block), level) {
+			return len(lines) - len(block), level
+		}
+		for at := from; at+len(block) <= len(lines); at++ {
+			if matchAt(lines, block, at, level) {
+				return at, level
+			}
+		}
+	}
+	return -1, 0
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxPatchFuzz is the loosest fuzz level apply_patch accepts.
+const MaxPatchFuzz = 2
+
+// PatchFuzz is the fuzz level apply_patch uses when a call does not set one.
+// Hunk context matches exactly at level 0, ignoring trailing whitespace at
+// level 1 and ignoring indentation as well at level 2. Lines matched loosely
+// keep the file's whitespace; only '+' lines are written as the patch has
+// them.
+var PatchFuzz = 1
+
+// fuzzNorms normalize lines for comparison at each fuzz level.
+var fuzzNorms = [MaxPatchFuzz + 1]func(string) string{
+	func(s string) string { return s },
+	func(s string) string { return strings.TrimRight(s, " \t") },
+	strings.TrimSpace,
+}
+
+// maxMismatchLines bounds the lines of the file shown when a hunk does not
+// apply.
+const maxMismatchLines = 20
+
+// hunkBlock returns the lines a hunk expects in the file: its context and
+// deleted lines.
+func hunkBlock(h hunk) []string {
+	var block []string
+	for _, line := range h.lines {
+		if line[0] == ' ' || line[0] == '-' {
+			block = append(block, line[1:])
+		}
+	}
+	return block
+}
+
+// findHunkLocation returns where a hunk with line numbers applies: the
+// match nearest expectedStart at the strictest fuzz level that matches
+// anywhere, and that level.
+func findHunkLocation(lines []string, h hunk, expectedStart, fuzz int) (int, int, error) {
+	block := hunkBlock(h)
+	if len(block) == 0 {
+		// a pure addition applies at expectedStart
+		if expectedStart > len(lines) {
+			return len(lines), 0, nil
+		}
+		return expectedStart, 0, nil
+	}
+	for level := 0; level <= fuzz; level++ {
+		best := -1
+		for i := 0; i+len(block) <= len(lines); i++ {
+			if matchAt(lines, block, i, level) && (best < 0 || abs(i-expectedStart) < abs(best-expectedStart)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return best, level, nil
+		}
+	}
+	return -1, 0, hunkMismatch(lines, block, expectedStart, fuzz)
+}
+
+// matchAt reports whether block matches lines from start at a fuzz level.
+func matchAt(lines []string, block []string, start, level int) bool {
+	if start < 0 || start+len(block) > len(lines) {
+		return false
+	}
+	norm := fuzzNorms[level]
+	for i, line := range block {
+		if norm(lines[start+i]) != norm(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// hunkMismatch explains why block matches nowhere in lines: it shows the
+// region most like block (the one with the most lines equal apart from
+// whitespace, nearest near), marks the lines that differ, and says when
+// the differences are whitespace only and which fuzz level would apply.
+func hunkMismatch(lines, block []string, near, fuzz int) error {
+	var b strings.Builder
+	b.WriteString("hunk context not found in file")
+	if len(block) > len(lines) {
+		fmt.Fprintf(&b, ": the hunk has %d lines of context or removals but the file has only %d lines", len(block), len(lines))
+		return errors.New(b.String())
+	}
+	loose := fuzzNorms[MaxPatchFuzz]
+	best, bestScore := 0, -1
+	for i := 0; i+len(block) <= len(lines); i++ {
+		score := 0
+		for j, l := range block {
+			if loose(lines[i+j]) == loose(l) {
+				score++
+			}
+		}
+		if score > bestScore || score == bestScore && abs(i-near) < abs(best-near) {
+			best, bestScore = i, score
+		}
+	}
+	if bestScore == 0 {
+		fmt.Fprintf(&b, ": none of its %d lines of context or removals are in the file; first expected line: %q", len(block), block[0])
+		return errors.New(b.String())
+	}
+
+	norm := fuzzNorms[fuzz]
+	var differ []int
+	for j, l := range block {
+		if norm(lines[best+j]) != norm(l) {
+			differ = append(differ, j)
+		}
+	}
+	if len(differ) == 0 {
+		// only anchored hunks get here: the match is above where they may apply
+		fmt.Fprintf(&b, ": lines %d-%d match but come before the previous hunk or anchor; hunks must be in file order", best+1, best+len(block))
+		return errors.New(b.String())
+	}
+	fmt.Fprintf(&b, "\nClosest match is lines %d-%d (%d of %d lines match at fuzz %d); '!' marks lines that differ:\n",
+		best+1, best+len(block), len(block)-len(differ), len(block), fuzz)
+	shown := 0
+	for j, l := range block {
+		different := len(differ) > 0 && differ[0] == j
+		if different {
+			differ = differ[1:]
+		} else if len(block) > maxMismatchLines {
+			// show only the differences of long hunks
+			continue
+		}
+		if shown == maxMismatchLines {
+			fmt.Fprintf(&b, "  ... %d more differing lines\n", len(differ)+1)
+			break
+		}
+		shown++
+		mark := " "
+		if different {
+			mark = "!"
+		}
+		fmt.Fprintf(&b, "  %d %s %q", best+j+1, mark, lines[best+j])
+		if different {
+			note := ""
+			if loose(lines[best+j]) == loose(l) {
+				note = ", whitespace only"
+			}
+			fmt.Fprintf(&b, "  (hunk: %q%s)", l, note)
+		}
+		b.WriteString("\n")
+	}
+	if bestScore == len(block) {
+		level := fuzz + 1
+		for !matchAt(lines, block, best, level) {
+			level++
+		}
+		fmt.Fprintf(&b, "The differences are whitespace only; the hunk applies at fuzz %d.", level)
+	}
+	return errors.New(strings.TrimSuffix(b.String(), "\n"))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	testing "testing"
 )
@@ -13,10 +14,14 @@ func TestParsePatch(t *testing.T) {
 @@ -0,0 +1,1 @@
 +hello
 `
-		p, err := parsePatch(patch)
+		files, err := parsePatch(patch)
 		if err != nil {
 			t.Fatalf("parsePatch() error = %v", err)
 		}
+		if len(files) != 1 {
+			t.Fatalf("len(files) = %d, want 1", len(files))
+		}
+		p := files[0]
 		if p.op != opCreate {
 			t.Errorf("p.op = %v, want %v", p.op, opCreate)
 		}
@@ -41,10 +46,14 @@ func TestParsePatch(t *testing.T) {
 -hello
 +world
 `
-		p, err := parsePatch(patch)
+		files, err := parsePatch(patch)
 		if err != nil {
 			t.Fatalf("parsePatch() error = %v", err)
 		}
+		if len(files) != 1 {
+			t.Fatalf("len(files) = %d, want 1", len(files))
+		}
+		p := files[0]
 		if p.op != opUpdate {
 			t.Errorf("p.op = %v, want %v", p.op, opUpdate)
 		}
@@ -68,10 +77,14 @@ func TestParsePatch(t *testing.T) {
 @@ -1,1 +0,0 @@
 -hello
 `
-		p, err := parsePatch(patch)
+		files, err := parsePatch(patch)
 		if err != nil {
 			t.Fatalf("parsePatch() error = %v", err)
 		}
+		if len(files) != 1 {
+			t.Fatalf("len(files) = %d, want 1", len(files))
+		}
+		p := files[0]
 		if p.op != opDelete {
 			t.Errorf("p.op = %v, want %v", p.op, opDelete)
 		}
@@ -115,10 +128,14 @@ func TestParsePatch(t *testing.T) {
 -hello
 +world
 `
-		p, err := parsePatch(patch)
+		files, err := parsePatch(patch)
 		if err != nil {
 			t.Fatalf("parsePatch() error = %v", err)
 		}
+		if len(files) != 1 {
+			t.Fatalf("len(files) = %d, want 1", len(files))
+		}
+		p := files[0]
 		if p.filePath != "foo.txt" {
 			t.Errorf("p.filePath = %q, want %q", p.filePath, "foo.txt")
 		}
@@ -388,9 +405,448 @@ func TestApplyPatch_ReproIssues(t *testing.T) {
 			if !strings.Contains(err.Error(), "hunk context not found") {
 				t.Errorf("Error message should explain failure. Got: %v", err)
 			}
-			if !strings.Contains(err.Error(), "Expected first") {
+			if !strings.Contains(err.Error(), `first expected line: "line NOT FOUND"`) {
 				t.Errorf("Error message should show expectations. Got: %v", err)
 			}
 		}
 	})
 }
+
+func TestApplyPatch_MultiFileGit(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, mode os.FileMode) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	write("a.txt", "one\r\ntwo\r\nthree\r\n", 0o644)
+	write("old.sh", "echo old\n", 0o644)
+	write("gone.txt", "bye\n", 0o644)
+	write("tail.txt", "x\ny", 0o644)
+
+	patch := `Here you go:
+
+diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+diff --git a/old.sh b/bin/new.sh
+old mode 100644
+new mode 100755
+similarity index 90%
+rename from old.sh
+rename to bin/new.sh
+--- a/old.sh
++++ b/bin/new.sh
+@@ -1 +1 @@
+-echo old
++echo new
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/empty b/empty
+new file mode 100644
+index 0000000..e69de29
+--- a/tail.txt
++++ b/tail.txt
+@@ -1,2 +1,2 @@
+ x
+-y
+\ No newline at end of file
++z
+\ No newline at end of file
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,3 @@
++# Title
++
++body
+`
+	resolve := func(p string) (string, error) { return filepath.Join(dir, p), nil }
+	changes, err := applyPatch(patch, patchOptions{resolve: resolve})
+	if err != nil {
+		t.Fatalf("applyPatch() error = %v", err)
+	}
+	var ops []string
+	for _, c := range changes {
+		ops = append(ops, c.op.String()+" "+c.path)
+	}
+	want := "update a.txt, rename bin/new.sh, delete gone.txt, create empty, update tail.txt, create docs/new.md"
+	if got := strings.Join(ops, ", "); got != want {
+		t.Fatalf("changes = %s, want %s", got, want)
+	}
+	if got := read("a.txt"); got != "one\r\nTWO\r\nthree\r\n" {
+		t.Errorf("a.txt = %q, want CRLF endings kept", got)
+	}
+	if got := read("bin/new.sh"); got != "echo new\n" {
+		t.Errorf("bin/new.sh = %q", got)
+	}
+	if st, err := os.Stat(filepath.Join(dir, "bin/new.sh")); err != nil || st.Mode().Perm() != 0o755 {
+		t.Errorf("expected bin/new.sh to be executable, got %v %v", st, err)
+	}
+	for _, name := range []string{"old.sh", "gone.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be gone", name)
+		}
+	}
+	if got := read("empty"); got != "" {
+		t.Errorf("empty = %q", got)
+	}
+	if got := read("tail.txt"); got != "x\nz" {
+		t.Errorf("tail.txt = %q, want no final newline", got)
+	}
+	if got := read("docs/new.md"); got != "# Title\n\nbody\n" {
+		t.Errorf("docs/new.md = %q, want the blank line kept", got)
+	}
+}
+
+func TestApplyPatch_AllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	for _, f := range []string{a, b} {
+		if err := os.WriteFile(f, []byte("hello\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolve := func(p string) (string, error) { return filepath.Join(dir, p), nil }
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-hello
++hi
+--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-missing
++hi
+`
+	_, err := applyPatch(patch, patchOptions{resolve: resolve})
+	if err == nil || !strings.HasPrefix(err.Error(), "b.txt: failed to apply hunk 1") {
+		t.Fatalf("expected b.txt to fail, got %v", err)
+	}
+	if got, _ := os.ReadFile(a); string(got) != "hello\n" {
+		t.Fatalf("a.txt was written although b.txt failed: %q", got)
+	}
+
+	// check reports the result without writing
+	patch = strings.Replace(patch, "-missing", "-hello", 1)
+	changes, err := applyPatch(patch, patchOptions{resolve: resolve, check: true})
+	if err != nil || len(changes) != 2 || changes[1].text != "hi\n" {
+		t.Fatalf("check: %+v, %v", changes, err)
+	}
+	if got, _ := os.ReadFile(b); string(got) != "hello\n" {
+		t.Fatalf("check wrote b.txt: %q", got)
+	}
+
+	// creating a file that exists is refused
+	if _, err := applyPatch("--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+x\n", patchOptions{resolve: resolve}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an error creating an existing file, got %v", err)
+	}
+}
+
+func TestPatchSetCommitRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(a, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// a regular file where a directory is needed makes the second write fail
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(blocker, "x.txt")
+	s := &patchSet{
+		fs:    osFS{},
+		order: []string{a, bad},
+		orig:  map[string]fileState{a: {exists: true, data: []byte("old\n"), mode: 0o644}, bad: {}},
+		cur: map[string]*fileState{
+			a:   {exists: true, data: []byte("new\n"), mode: 0o644},
+			bad: {exists: true, data: []byte("x\n"), mode: 0o644},
+		},
+	}
+	if err := s.commit(); err == nil {
+		t.Fatal("expected the second write to fail")
+	}
+	if got, _ := os.ReadFile(a); string(got) != "old\n" {
+		t.Fatalf("a.txt = %q, want it restored", got)
+	}
+}
+
+func TestParsePatchGitPaths(t *testing.T) {
+	files, err := parsePatch("diff --git \"a/with space.txt\" \"b/with space.txt\"\nold mode 100644\nnew mode 100755\n")
+	if err != nil {
+		t.Fatalf("parsePatch() error = %v", err)
+	}
+	if len(files) != 1 || files[0].filePath != "with space.txt" || files[0].mode != 0o755 || files[0].op != opUpdate {
+		t.Fatalf("unexpected parse %+v", files[0])
+	}
+	if _, err := parsePatch("diff --git a/x b/x\nBinary files a/x and b/x differ\n"); err == nil {
+		t.Fatal("expected binary patches to be refused")
+	}
+	paths, err := PatchPaths("diff --git a/x b/y\nrename from x\nrename to y\n")
+	if err != nil || strings.Join(paths, ",") != "x,y" {
+		t.Fatalf("PatchPaths = %v, %v", paths, err)
+	}
+}
+
+// TestApplyPatch_BothFormats applies the same changes written as a unified
+// diff and as a "*** Begin Patch" envelope.
+func TestApplyPatch_BothFormats(t *testing.T) {
+	const main = "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n"
+	cases := []struct {
+		name, unified, envelope string
+		want                    map[string]string // "" means deleted
+	}{
+		{
+			name: "update",
+			unified: `--- a/main.go
++++ b/main.go
+@@ -7,3 +7,4 @@
+ func b() {
++	println("b")
+ 	return
+ }
+`,
+			envelope: `*** Begin Patch
+*** Update File: main.go
+@@ func b() {
++	println("b")
+ 	return
+ }
+*** End Patch
+`,
+			want: map[string]string{"main.go": strings.Replace(main, "func b() {\n", "func b() {\n\tprintln(\"b\")\n", 1)},
+		},
+		{
+			name: "add, delete and move",
+			unified: `diff --git a/notes.txt b/notes.txt
+new file mode 100644
+--- /dev/null
++++ b/notes.txt
+@@ -0,0 +1,2 @@
++one
++two
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+diff --git a/main.go b/cmd/main.go
+rename from main.go
+rename to cmd/main.go
+--- a/main.go
++++ b/cmd/main.go
+@@ -9,2 +9,3 @@
+ 	return
+ }
++// end
+`,
+			envelope: `*** Begin Patch
+*** Add File: notes.txt
++one
++two
+*** Delete File: old.txt
+*** Update File: main.go
+*** Move to: cmd/main.go
+@@
+ 	return
+ }
++// end
+*** End of File
+*** End Patch
+`,
+			want: map[string]string{"notes.txt": "one\ntwo\n", "old.txt": "", "main.go": "", "cmd/main.go": main + "// end\n"},
+		},
+	}
+	for _, c := range cases {
+		for format, patch := range map[string]string{"unified": c.unified, "envelope": c.envelope} {
+			t.Run(c.name+"/"+format, func(t *testing.T) {
+				dir := t.TempDir()
+				for name, content := range map[string]string{"main.go": main, "old.txt": "old\n"} {
+					if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				resolve := func(p string) (string, error) { return filepath.Join(dir, p), nil }
+				if _, err := applyPatch(patch, patchOptions{resolve: resolve}); err != nil {
+					t.Fatalf("applyPatch() error = %v", err)
+				}
+				for name, want := range c.want {
+					got, err := os.ReadFile(filepath.Join(dir, name))
+					if want == "" {
+						if !os.IsNotExist(err) {
+							t.Errorf("%s should be gone", name)
+						}
+						continue
+					}
+					if string(got) != want {
+						t.Errorf("%s = %q, want %q", name, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	files, err := parsePatch(`Sure, here is the change.
+*** Begin Patch
+*** Update File: a.py
+@@ class A:
+@@     def f(self):
+-        return 1
++        return 2
+
+ x = 1
+*** End Patch
+`)
+	if err != nil {
+		t.Fatalf("parsePatch() error = %v", err)
+	}
+	if len(files) != 1 || files[0].op != opUpdate || files[0].filePath != "a.py" || len(files[0].hunks) != 1 {
+		t.Fatalf("unexpected parse %+v", files)
+	}
+	h := files[0].hunks[0]
+	if !h.anchored || strings.Join(h.anchors, "|") != "class A:|def f(self):" {
+		t.Errorf("anchors = %q", h.anchors)
+	}
+	if want := []string{"-        return 1", "+        return 2", " ", " x = 1"}; strings.Join(h.lines, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", h.lines, want)
+	}
+
+	for src, want := range map[string]string{
+		"*** Begin Patch\n*** Add File: x\nno plus\n*** End Patch\n":                 "must start with '+'",
+		"*** Begin Patch\n*** Delete File: x\n-y\n*** End Patch\n":                   "unexpected line",
+		"*** Begin Patch\n*** Add File: x\n@@\n*** End Patch\n":                      "outside an \"*** Update File:\"",
+		"*** Begin Patch\n*** Move to: y\n*** End Patch\n":                           "must follow",
+		"*** Begin Patch\n*** Update File: x\n*** End Patch\n":                       "has no hunks",
+		"*** Begin Patch\n*** Update File: x\n@@\nnot a hunk\n*** End Patch":         "must start with ' ', '+' or '-'",
+		"*** Begin Patch\n*** Add File: g.txt\n*** End of File\n+x\n*** End Patch\n": "after \"*** End of File\"",
+	} {
+		if _, err := parsePatch(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parsePatch(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestApplyEnvelope_Anchors(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.py")
+	src := "class A:\n    def f(self):\n        return 1\n\nclass B:\n    def f(self):\n        return 1  \n"
+	if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resolve := func(p string) (string, error) { return filepath.Join(dir, p), nil }
+	// the anchor picks B's method; its trailing spaces match loosely
+	patch := "*** Begin Patch\n*** Update File: a.py\n@@ class B:\n     def f(self):\n-        return 1\n+        return 2\n*** End Patch\n"
+	changes, err := applyPatch(patch, patchOptions{resolve: resolve, fuzz: 1})
+	if err != nil {
+		t.Fatalf("applyPatch() error = %v", err)
+	}
+	if changes[0].fuzz != 1 {
+		t.Errorf("fuzz = %d, want 1", changes[0].fuzz)
+	}
+	want := "class A:\n    def f(self):\n        return 1\n\nclass B:\n    def f(self):\n        return 2\n"
+	if got, _ := os.ReadFile(file); string(got) != want {
+		t.Fatalf("content = %q, want %q", got, want)
+	}
+
+	patch = "*** Begin Patch\n*** Update File: a.py\n@@ class C:\n-x\n+y\n*** End Patch\n"
+	if _, err := applyPatch(patch, patchOptions{resolve: resolve}); err == nil || !strings.Contains(err.Error(), `context "class C:" not found`) {
+		t.Fatalf("expected a missing anchor error, got %v", err)
+	}
+}
+
+func TestApplyPatch_Fuzz(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.go")
+	src := "func f() {\n\tx := 1  \n\treturn x\n}\n"
+	resolve := func(p string) (string, error) { return filepath.Join(dir, p), nil }
+	cases := []struct {
+		name  string
+		patch string
+		fuzz  int
+		want  int // the fuzz reported, or -1 for an error
+	}{
+		{"exact", "--- a/a.go\n+++ b/a.go\n@@ -3,2 +3,2 @@\n-\treturn x\n+\treturn x + 1\n }\n", 0, 0},
+		{"trailing space", "--- a/a.go\n+++ b/a.go\n@@ -2,2 +2,2 @@\n \tx := 1\n-\treturn x\n+\treturn x + 1\n", 0, -1},
+		{"trailing space at 1", "--- a/a.go\n+++ b/a.go\n@@ -2,2 +2,2 @@\n \tx := 1\n-\treturn x\n+\treturn x + 1\n", 1, 1},
+		{"indentation at 1", "--- a/a.go\n+++ b/a.go\n@@ -2,2 +2,2 @@\n     x := 1\n-    return x\n+\treturn x + 1\n", 1, -1},
+		{"indentation at 2", "--- a/a.go\n+++ b/a.go\n@@ -2,2 +2,2 @@\n     x := 1\n-    return x\n+\treturn x + 1\n", 2, 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			changes, err := applyPatch(c.patch, patchOptions{resolve: resolve, fuzz: c.fuzz})
+			if c.want < 0 {
+				if err == nil || !strings.Contains(err.Error(), "whitespace only") {
+					t.Fatalf("expected a whitespace diagnosis, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPatch() error = %v", err)
+			}
+			if changes[0].fuzz != c.want {
+				t.Errorf("fuzz = %d, want %d", changes[0].fuzz, c.want)
+			}
+			// context lines keep the file's whitespace
+			if got, _ := os.ReadFile(file); !strings.Contains(string(got), "\tx := 1  \n\treturn x + 1\n") {
+				t.Errorf("content = %q", got)
+			}
+		})
+	}
+}
+
+func TestHunkMismatch(t *testing.T) {
+	lines := []string{"package main", "", "func a() {", "\treturn nil", "}", "", "func b() {", "\tlog()", "\treturn err", "}"}
+	err := hunkMismatch(lines, []string{"func b() {", "\tlog()", "\treturn nil", "}"}, 0, 1)
+	for _, want := range []string{
+		"Closest match is lines 7-10 (3 of 4 lines match at fuzz 1)",
+		`  8   "\tlog()"`,
+		`  9 ! "\treturn err"  (hunk: "\treturn nil")`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "whitespace only") {
+		t.Errorf("the mismatch is not whitespace only:\n%v", err)
+	}
+
+	err = hunkMismatch(lines, []string{"func a() {", "    return nil", "}"}, 0, 0)
+	for _, want := range []string{
+		`  4 ! "\treturn nil"  (hunk: "    return nil", whitespace only)`,
+		"The differences are whitespace only; the hunk applies at fuzz 2.",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+
+	if err := hunkMismatch(lines[:2], []string{"a", "b", "c"}, 0, 1); !strings.Contains(err.Error(), "the file has only 2 lines") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dave1010/jorin/internal/shell"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+const (
+	maxProcessOutputBytes = 16_000
+	maxProcessWait        = 60 // seconds
+	// processQuiet is how long output must pause before a wait without
+	// wait_for returns, so a burst of output is read at once.
+	processQuiet = 300 * time.Millisecond
+)
+
+func processStartToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	cmdStr, _ := args["cmd"].(string)
+	if cmdStr == "" {
+		return nil, errors.New("missing cmd")
+	}
+	if p.DryShell {
+		return map[string]any{"dry_run": true, "cmd": cmdStr}, nil
+	}
+	if p.Processes == nil {
+		return map[string]any{"error": "background processes are not available"}, nil
+	}
+	wait, enough, err := waitArgs(args)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	dir, err := fileSystem(p).ShellDir(p.CWD)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	if p.Shell != nil {
+		// start where the persistent shell has cd'd to
+		if d := p.Shell.Dir(); d != "" {
+			dir = d
+		}
+	}
+	proc, err := p.Processes.Start(shell.DefaultRunner, cmdStr, dir)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	res := processOutput(ctx, proc, -1, wait, enough)
+	res["pid"] = proc.PID
+	if name := shell.SandboxName(shell.DefaultRunner); name != "" {
+		res["sandbox"] = name
+	}
+	return res, nil
+}
+
+func processOutputToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	proc, res, err := processArg(args, p)
+	if proc == nil {
+		return res, err
+	}
+	offset, err := intArg(args, "offset", -1, 0, math.MaxInt)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	wait, enough, err := waitArgs(args)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	return processOutput(ctx, proc, int64(offset), wait, enough), nil
+}
+
+func processListToolExec(_ context.Context, _ map[string]any, p *types.Policy) (map[string]any, error) {
+	if p.Processes == nil {
+		return map[string]any{"error": "background processes are not available"}, nil
+	}
+	list := []map[string]any{}
+	for _, proc := range p.Processes.List() {
+		st := proc.State()
+		e := processStatus(proc, st)
+		e["cmd"], e["pid"] = proc.Command, proc.PID
+		e["started"] = proc.Started.Format(time.RFC3339)
+		e["output_bytes"], e["unread_bytes"] = st.Output, st.Unread
+		list = append(list, e)
+	}
+	return map[string]any{"processes": list}, nil
+}
+
+func processKillToolExec(_ context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	proc, res, err := processArg(args, p)
+	if proc == nil {
+		return res, err
+	}
+	wasRunning := proc.State().Running
+	if _, err := p.Processes.Kill(proc.ID); err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	res = processStatus(proc, proc.State())
+	if !wasRunning {
+		res["note"] = "the process had already exited"
+	}
+	return res, nil
+}
+
+// processArg returns the process named by the "id" argument, or the result
+// or error to return instead.
+func processArg(args map[string]any, p *types.Policy) (*shell.Process, map[string]any, error) {
+	id, _ := args["id"].(string)
+	if id == "" {
+		return nil, nil, errors.New("missing id")
+	}
+	if p.Processes == nil {
+		return nil, map[string]any{"error": "background processes are not available"}, nil
+	}
+	proc, err := p.Processes.Get(strings.TrimSpace(id))
+	if err != nil {
+		return nil, map[string]any{"error": err.Error() + "; see process_list"}, nil
+	}
+	return proc, nil, nil
+}
+
+// waitArgs reads the wait and wait_for arguments: how many seconds to wait
+// for output, and the pattern that output must match.
+func waitArgs(args map[string]any) (time.Duration, func([]byte) bool, error) {
+	wait, err := intArg(args, "wait", 0, 0, maxProcessWait)
+	if err != nil {
+		return 0, nil, err
+	}
+	pattern, _ := args["wait_for"].(string)
+	if pattern == "" {
+		return time.Duration(wait) * time.Second, nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, nil, errors.New("invalid wait_for: " + err.Error())
+	}
+	if wait == 0 {
+		wait = maxProcessWait
+	}
+	return time.Duration(wait) * time.Second, re.Match, nil
+}
+
+// processOutput waits as asked and returns the process's status and its
+// output from offset from, or since the last read if from is negative.
+func processOutput(ctx context.Context, proc *shell.Process, from int64, wait time.Duration, enough func([]byte) bool) map[string]any {
+	timedOut := false
+	if wait > 0 {
+		wctx, cancel := context.WithTimeout(ctx, wait)
+		proc.WaitOutput(wctx, from, enough)
+		if enough == nil {
+			// let a burst of output finish
+			for n := int64(-1); n != proc.State().Output && wctx.Err() == nil; {
+				n = proc.State().Output
+				select {
+				case <-time.After(processQuiet):
+				case <-wctx.Done():
+				}
+			}
+		}
+		timedOut = enough != nil && wctx.Err() != nil && proc.State().Running
+		cancel()
+	}
+	c := proc.Read(from, maxProcessOutputBytes)
+	res := processStatus(proc, proc.State())
+	res["output"] = strings.ToValidUTF8(string(c.Data), "�")
+	res["next_offset"] = c.Offset + int64(len(c.Data))
+	if c.More {
+		res["more"] = true
+	}
+	if c.Dropped > 0 {
+		res["dropped_bytes"] = c.Dropped
+	}
+	if timedOut {
+		res["wait_for_matched"] = false
+	}
+	if err := ctx.Err(); err != nil {
+		res["error"] = CancelReason(err)
+	}
+	return res
+}
+
+// processStatus describes whether a process is running or how it ended.
+func processStatus(proc *shell.Process, st shell.ProcessState) map[string]any {
+	res := map[string]any{"id": proc.ID, "running": st.Running}
+	if !st.Running {
+		res["exit_code"] = st.ExitCode
+		if st.Killed {
+			res["killed"] = true
+		}
+	}
+	return res
+}
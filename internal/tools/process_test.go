@@ -0,0 +1,110 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/shell"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestProcessTools(t *testing.T) {
+	r := Registry()
+	procs := shell.NewSupervisor()
+	defer procs.Close()
+	dir := t.TempDir()
+	p := &types.Policy{CWD: dir, Processes: procs}
+	ctx := context.Background()
+
+	// the command goes on only once the go file exists, so nothing follows
+	// "ready" until the start result has been checked
+	out, err := r["process_start"](ctx, map[string]any{"cmd": "echo ready; until [ -e go ]; do sleep 0.05; done; read line; echo got $line", "wait_for": "ready"}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["id"] != "p1" || out["running"] != true || !strings.HasSuffix(out["output"].(string), "ready\n") {
+		t.Fatalf("unexpected start result: %#v", out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// stdin is empty, so read fails and the command exits
+	proc, err := procs.Get("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.Done()
+	out, _ = r["process_output"](ctx, map[string]any{"id": "p1"}, p)
+	if out["output"] != "got\n" || out["running"] != false || out["exit_code"] != 0 {
+		t.Fatalf("unexpected output result: %#v", out)
+	}
+	next := out["next_offset"].(int64)
+	out, _ = r["process_output"](ctx, map[string]any{"id": "p1", "offset": float64(next - 4)}, p)
+	if out["output"] != "got\n" {
+		t.Fatalf("reading from an offset: %#v", out)
+	}
+
+	out, _ = r["process_start"](ctx, map[string]any{"cmd": "echo a; sleep 0.1; echo b; sleep 30", "wait": float64(5), "wait_for": "(?m)^b$"}, p)
+	if o, _ := out["output"].(string); !strings.HasSuffix(o, "a\nb\n") || out["id"] != "p2" {
+		t.Fatalf("wait_for should wait for matching output: %#v", out)
+	}
+	out, _ = r["process_list"](ctx, map[string]any{}, p)
+	list := out["processes"].([]map[string]any)
+	if len(list) != 2 || list[0]["running"] != false || list[1]["running"] != true || list[1]["unread_bytes"] != int64(0) {
+		t.Fatalf("unexpected list: %#v", out)
+	}
+	out, _ = r["process_kill"](ctx, map[string]any{"id": "p2"}, p)
+	if out["killed"] != true || out["running"] != false {
+		t.Fatalf("unexpected kill result: %#v", out)
+	}
+	out, _ = r["process_kill"](ctx, map[string]any{"id": "p9"}, p)
+	if _, ok := out["error"]; !ok {
+		t.Fatalf("expected an error for an unknown handle: %#v", out)
+	}
+	out, _ = r["process_start"](ctx, map[string]any{"cmd": "true", "wait_for": "("}, p)
+	if e, _ := out["error"].(string); !strings.Contains(e, "invalid wait_for") {
+		t.Fatalf("expected an invalid pattern to be refused: %#v", out)
+	}
+}
+
+func TestProcessStartFollowsShellPolicy(t *testing.T) {
+	r := Registry()
+	procs := shell.NewSupervisor()
+	defer procs.Close()
+	ctx := context.Background()
+	args := map[string]any{"cmd": "sleep 30"}
+
+	for name, p := range map[string]*types.Policy{
+		"deny list":      {Deny: []string{"sleep"}},
+		"allow list":     {Allow: []string{"go run"}},
+		"disabled shell": {DisabledTools: []string{"shell"}},
+		"policy rule":    {RuleFiles: []types.PolicyFile{{Path: "p", Rules: []types.PolicyRule{{Tools: []string{"shell"}, Commands: []string{"sleep"}, Decision: types.DecisionDeny}}}}},
+		"approve=shell":  {Approve: types.ApproveShell},
+	} {
+		p.Processes = procs
+		out, err := r["process_start"](ctx, args, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := out["error"]; !ok {
+			t.Errorf("%s: expected process_start to be refused, got %#v", name, out)
+		}
+	}
+	if n := len(procs.List()); n != 0 {
+		t.Fatalf("refused calls started %d processes", n)
+	}
+
+	out, _ := r["process_start"](ctx, args, &types.Policy{DryShell: true, Processes: procs})
+	if out["dry_run"] != true || len(procs.List()) != 0 {
+		t.Fatalf("unexpected dry run: %#v", out)
+	}
+	out, _ = r["process_list"](ctx, map[string]any{}, &types.Policy{})
+	if _, ok := out["error"]; !ok {
+		t.Fatalf("expected an error without a supervisor: %#v", out)
+	}
+}
@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// binarySniffBytes is how much of a file is checked for NUL bytes to tell
+// binary files from text.
+const binarySniffBytes = 8000
+
+// readFileToolExec returns lines offset to offset+limit-1 of a text file,
+// up to maxReadFileBytes, with the range it returned so the model can page
+// through the rest.
+func readFileToolExec(_ context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	name, _ := args["path"].(string)
+	if name == "" {
+		return nil, errors.New("missing path")
+	}
+	offset, limit := 1, 0
+	if v, ok := args["offset"]; ok {
+		if offset, ok = positiveInt(v); !ok {
+			return map[string]any{"error": "offset must be a line number, starting at 1"}, nil
+		}
+	}
+	if v, ok := args["limit"]; ok {
+		if limit, ok = positiveInt(v); !ok {
+			return map[string]any{"error": "limit must be a positive number of lines"}, nil
+		}
+	}
+	numbers, _ := args["line_numbers"].(bool)
+
+	path, err := p.ResolvePath(name, false)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	b, err := fileSystem(p).ReadFile(path)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	text, encoding, ok := decodeText(b)
+	if !ok {
+		return map[string]any{
+			"error":  fmt.Sprintf("%s is a binary file; read_file only returns text", name),
+			"binary": true,
+			"bytes":  len(b),
+		}, nil
+	}
+	res := readLines(text, offset, limit, numbers)
+	res["bytes"] = len(b)
+	if encoding != "" {
+		res["encoding"] = encoding
+	}
+	return res, nil
+}
+
+// readLines returns lines offset to offset+limit-1 of text (all of them
+// when limit is 0) that fit in maxReadFileBytes. A first line too long to
+// fit is cut.
+func readLines(text string, offset, limit int, numbers bool) map[string]any {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	total := len(lines)
+	if offset > total && offset > 1 {
+		return map[string]any{"error": fmt.Sprintf("offset %d is past the end of the file (%d lines)", offset, total), "total_lines": total}
+	}
+	last := total
+	if limit > 0 && offset-1+limit < total {
+		last = offset - 1 + limit
+	}
+	var b strings.Builder
+	end, cut := offset-1, false
+	for i := offset - 1; i < last; i++ {
+		line := lines[i]
+		if numbers {
+			line = fmt.Sprintf("%6d\t%s", i+1, line)
+		}
+		if b.Len()+len(line) > maxReadFileBytes {
+			if i == offset-1 {
+				n := maxReadFileBytes
+				for n > 0 && !utf8.RuneStart(line[n]) {
+					n--
+				}
+				b.WriteString(line[:n])
+				end, cut = i+1, true
+			}
+			break
+		}
+		b.WriteString(line)
+		end = i + 1
+	}
+
+	res := map[string]any{"text": b.String(), "truncated": end < total || cut, "total_lines": total}
+	if end >= offset {
+		res["start_line"], res["end_line"] = offset, end
+	}
+	if end < total {
+		res["next_offset"] = end + 1
+	}
+	if cut {
+		res["line_truncated"] = true
+	}
+	return res
+}
+
+// decodeText returns b as UTF-8 text and the encoding it was converted
+// from, or "" for UTF-8. UTF-16 needs a byte order mark; other text that is
+// not UTF-8 is read as Latin-1, unless it holds UTF-8 characters, when only
+// its invalid bytes are replaced. ok is false for binary data.
+func decodeText(b []byte) (text, encoding string, ok bool) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return decodeUTF16(b[2:], false), "utf-16le", true
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return decodeUTF16(b[2:], true), "utf-16be", true
+	}
+	sniff := b
+	if len(sniff) > binarySniffBytes {
+		sniff = sniff[:binarySniffBytes]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return "", "", false
+	}
+	if utf8.Valid(b) {
+		return string(b), "", true
+	}
+	for rest := b; len(rest) > 0; {
+		r, size := utf8.DecodeRune(rest)
+		if r != utf8.RuneError && size > 1 {
+			return strings.ToValidUTF8(string(b), "\uFFFD"), "utf-8 with invalid bytes replaced by U+FFFD", true
+		}
+		rest = rest[size:]
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes), "latin-1", true
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			units[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// positiveInt returns a JSON number argument as an int of at least 1.
+func positiveInt(v any) (int, bool) {
+	f, ok := v.(float64)
+	if !ok || f != float64(int(f)) || f < 1 {
+		return 0, false
+	}
+	return int(f), true
+}
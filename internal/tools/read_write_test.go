@@ -1,17 +1,22 @@
 package tools
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
+	"github.com/dave1010/jorin/internal/overlay"
 	"github.com/dave1010/jorin/internal/types"
 )
 
 func TestReadFileMissingPath(t *testing.T) {
 	r := Registry()
 
-	if _, err := r["read_file"](map[string]any{}, &types.Policy{}); err == nil {
+	if _, err := r["read_file"](context.Background(), map[string]any{}, &types.Policy{}); err == nil {
 		t.Fatalf("expected error for missing path")
 	}
 }
@@ -25,7 +30,7 @@ func TestReadFileSuccess(t *testing.T) {
 		t.Fatalf("write temp file: %v", err)
 	}
 
-	out, err := r["read_file"](map[string]any{"path": f}, &types.Policy{})
+	out, err := r["read_file"](context.Background(), map[string]any{"path": f}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("read_file failed: %v", err)
 	}
@@ -34,11 +39,113 @@ func TestReadFileSuccess(t *testing.T) {
 	}
 }
 
+func TestReadFileRanges(t *testing.T) {
+	r := Registry()
+	dir := t.TempDir()
+	var text strings.Builder
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&text, "line %d\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "f.txt"), []byte(text.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &types.Policy{CWD: dir}
+	read := func(args map[string]any) map[string]any {
+		t.Helper()
+		args["path"] = "f.txt"
+		out, err := r["read_file"](context.Background(), args, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	out := read(map[string]any{})
+	if out["text"] != text.String() || out["truncated"] != false || out["total_lines"] != 10 || out["bytes"] != text.Len() || out["end_line"] != 10 {
+		t.Fatalf("whole file: %#v", out)
+	}
+	out = read(map[string]any{"offset": float64(3), "limit": float64(2), "line_numbers": true})
+	if out["text"] != "     3\tline 3\n     4\tline 4\n" || out["start_line"] != 3 || out["end_line"] != 4 || out["truncated"] != true || out["next_offset"] != 5 {
+		t.Fatalf("range: %#v", out)
+	}
+	out = read(map[string]any{"offset": float64(9), "limit": float64(5)})
+	if out["text"] != "line 9\nline 10\n" || out["truncated"] != false || out["next_offset"] != nil {
+		t.Fatalf("range to the end: %#v", out)
+	}
+	if out = read(map[string]any{"offset": float64(11)}); !strings.Contains(fmt.Sprint(out["error"]), "past the end of the file (10 lines)") {
+		t.Fatalf("offset past the end: %#v", out)
+	}
+	if out = read(map[string]any{"limit": float64(0)}); out["error"] == nil {
+		t.Fatalf("expected limit 0 to be refused: %#v", out)
+	}
+}
+
+func TestReadFilePagesLargeFiles(t *testing.T) {
+	r := Registry()
+	dir := t.TempDir()
+	line := strings.Repeat("x", 99) + "\n"
+	big := strings.Repeat(line, 3000) // 300,000 bytes
+	if err := os.WriteFile(filepath.Join(dir, "big.log"), []byte(big), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &types.Policy{CWD: dir}
+	out, _ := r["read_file"](context.Background(), map[string]any{"path": "big.log"}, p)
+	if out["end_line"] != 2000 || out["next_offset"] != 2001 || out["truncated"] != true || out["text"] != big[:200_000] {
+		t.Fatalf("first page: end_line %v next_offset %v truncated %v", out["end_line"], out["next_offset"], out["truncated"])
+	}
+	out, _ = r["read_file"](context.Background(), map[string]any{"path": "big.log", "offset": float64(2001)}, p)
+	if out["start_line"] != 2001 || out["end_line"] != 3000 || out["truncated"] != false {
+		t.Fatalf("second page: %v-%v truncated %v", out["start_line"], out["end_line"], out["truncated"])
+	}
+
+	// a single line longer than the limit is cut
+	if err := os.WriteFile(filepath.Join(dir, "min.js"), []byte(strings.Repeat("é", 150_000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = r["read_file"](context.Background(), map[string]any{"path": "min.js"}, p)
+	if text, _ := out["text"].(string); len(text) != 200_000 || out["line_truncated"] != true || out["truncated"] != true {
+		t.Fatalf("long line: %d bytes, %#v", len(text), out["line_truncated"])
+	}
+}
+
+func TestReadFileEncodings(t *testing.T) {
+	r := Registry()
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"bin":    {0x7f, 'E', 'L', 'F', 0, 0, 1},
+		"utf16":  {0xff, 0xfe, 'h', 0, 'i', 0, 0xe9, 0},
+		"latin1": []byte("caf\xe9\n"),
+		"mixed":  []byte("café \xff\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := &types.Policy{CWD: dir}
+	read := func(name string) map[string]any {
+		out, _ := r["read_file"](context.Background(), map[string]any{"path": name}, p)
+		return out
+	}
+	if out := read("bin"); out["binary"] != true || out["bytes"] != 7 || out["text"] != nil {
+		t.Fatalf("binary: %#v", out)
+	}
+	if out := read("utf16"); out["text"] != "hié" || out["encoding"] != "utf-16le" {
+		t.Fatalf("utf-16: %#v", out)
+	}
+	if out := read("latin1"); out["text"] != "café\n" || out["encoding"] != "latin-1" {
+		t.Fatalf("latin-1: %#v", out)
+	}
+	if out := read("mixed"); out["text"] != "café \uFFFD\n" || !strings.HasPrefix(fmt.Sprint(out["encoding"]), "utf-8") {
+		t.Fatalf("invalid utf-8: %#v", out)
+	}
+}
+
 func TestWriteFileReadonly(t *testing.T) {
 	r := Registry()
 
 	tmp := t.TempDir()
-	out, err := r["write_file"](map[string]any{"path": filepath.Join(tmp, "x.txt"), "text": "ok"}, &types.Policy{Readonly: true})
+	out, err := r["write_file"](context.Background(), map[string]any{"path": filepath.Join(tmp, "x.txt"), "text": "ok"}, &types.Policy{Readonly: true})
 	if err != nil {
 		t.Fatalf("write_file returned err: %v", err)
 	}
@@ -51,7 +158,7 @@ func TestWriteFileSuccess(t *testing.T) {
 	r := Registry()
 
 	tmp := t.TempDir()
-	out, err := r["write_file"](map[string]any{"path": filepath.Join(tmp, "x.txt"), "text": "ok"}, &types.Policy{})
+	out, err := r["write_file"](context.Background(), map[string]any{"path": filepath.Join(tmp, "x.txt"), "text": "ok"}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("write_file failed: %v", err)
 	}
@@ -59,3 +166,219 @@ func TestWriteFileSuccess(t *testing.T) {
 		t.Fatalf("expected ok true, got %#v", out)
 	}
 }
+
+func TestEditFile(t *testing.T) {
+	r := Registry()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.go")
+	if err := os.WriteFile(path, []byte("package a\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() int {\n\treturn 1\n}\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p := &types.Policy{CWD: dir}
+	edit := func(args map[string]any) map[string]any {
+		t.Helper()
+		if args["path"] == nil {
+			args["path"] = "a.go"
+		}
+		out, err := r["edit_file"](context.Background(), args, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	for _, c := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"old_string": "return 2", "new_string": "return 3"}, "old_string not found"},
+		{map[string]any{"old_string": "return 1", "new_string": "return 2"}, "old_string matches 2 times"},
+		{map[string]any{"old_string": "", "new_string": "x"}, "old_string is empty"},
+		{map[string]any{"old_string": "A", "new_string": "A"}, "are the same"},
+	} {
+		if out := edit(c.args); !strings.Contains(fmt.Sprint(out["error"]), c.want) {
+			t.Errorf("edit_file %v: got %#v, want an error containing %q", c.args, out, c.want)
+		}
+	}
+
+	out := edit(map[string]any{"old_string": "func B() int {\n\treturn 1", "new_string": "func B() int {\n\treturn 2"})
+	wantDiff := "--- a.go\n+++ a.go\n@@ -5,5 +5,5 @@\n }\n \n func B() int {\n-\treturn 1\n+\treturn 2\n }\n"
+	if out["ok"] != true || out["replacements"] != 1 || out["diff"] != wantDiff {
+		t.Fatalf("edit_file: %#v\nwant diff:\n%s", out, wantDiff)
+	}
+	out = edit(map[string]any{"old_string": "int", "new_string": "int64", "replace_all": true})
+	if out["replacements"] != 2 {
+		t.Fatalf("replace_all: %#v", out)
+	}
+	b, _ := os.ReadFile(path)
+	if string(b) != "package a\n\nfunc A() int64 {\n\treturn 1\n}\n\nfunc B() int64 {\n\treturn 2\n}\n" {
+		t.Fatalf("file after edits: %q", b)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o755 {
+		t.Fatalf("edit_file should keep the mode: %v, %v", info, err)
+	}
+
+	// LF text matches a CRLF file and keeps its line endings
+	if err := os.WriteFile(path, []byte("one\r\ntwo\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out := edit(map[string]any{"old_string": "one\ntwo", "new_string": "one\n2"}); out["ok"] != true {
+		t.Fatalf("edit_file with CRLF: %#v", out)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "one\r\n2\r\n" {
+		t.Fatalf("CRLF file after the edit: %q", b)
+	}
+
+	// a long diff is cut between characters
+	for _, pad := range []string{"", "a"} {
+		wide := pad + strings.Repeat("é", maxToolOutputBytes)
+		if err := os.WriteFile(path, []byte(wide+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out := edit(map[string]any{"old_string": wide, "new_string": "x"})
+		if d, _ := out["diff"].(string); out["diff_truncated"] != true || len(d) > maxToolOutputBytes || !utf8.ValidString(d) {
+			t.Fatalf("truncated diff should be valid UTF-8: %d bytes, valid=%v", len(d), utf8.ValidString(d))
+		}
+	}
+
+	if out, _ := r["edit_file"](context.Background(), map[string]any{"path": "a.go", "old_string": "one", "new_string": "1"}, &types.Policy{CWD: dir, Readonly: true}); out["error"] != "readonly session" {
+		t.Fatalf("expected readonly error, got: %#v", out)
+	}
+	if out := edit(map[string]any{"path": "missing.go", "old_string": "a", "new_string": "b"}); !strings.Contains(fmt.Sprint(out["error"]), "no such file") {
+		t.Fatalf("expected an error for a missing file: %#v", out)
+	}
+}
+
+func TestFileToolsStayInWorkspace(t *testing.T) {
+	r := Registry()
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := &types.Policy{CWD: root, Roots: []string{root}, DenyRead: []string{".env*"}}
+	patch := "--- /dev/null\n+++ " + outside + ".new\n@@ -0,0 +1,1 @@\n+x\n"
+	calls := []struct {
+		tool string
+		args map[string]any
+	}{
+		{"read_file", map[string]any{"path": outside}},
+		{"write_file", map[string]any{"path": "../" + filepath.Base(filepath.Dir(outside)) + "/x.txt", "text": "x"}},
+		{"write_file", map[string]any{"path": ".env", "text": "TOKEN=x"}},
+		{"edit_file", map[string]any{"path": outside, "old_string": "secret", "new_string": "x"}},
+		{"apply_patch", map[string]any{"patch": patch}},
+	}
+	for _, c := range calls {
+		out, err := r[c.tool](context.Background(), c.args, p)
+		if err != nil {
+			t.Fatalf("%s: %v", c.tool, err)
+		}
+		if e, _ := out["error"].(string); e == "" {
+			t.Errorf("%s %v should be refused, got %#v", c.tool, c.args, out)
+		}
+	}
+	if _, err := os.Stat(outside + ".new"); err == nil {
+		t.Fatalf("apply_patch wrote outside the workspace")
+	}
+	// a patch with one file outside the workspace writes none of its files
+	out, _ := r["apply_patch"](context.Background(), map[string]any{"patch": "--- /dev/null\n+++ b/in.txt\n@@ -0,0 +1 @@\n+x\n" + patch}, p)
+	if _, err := os.Stat(filepath.Join(root, "in.txt")); err == nil || out["error"] == nil {
+		t.Fatalf("apply_patch wrote part of a refused patch: %#v", out)
+	}
+
+	out, _ = r["write_file"](context.Background(), map[string]any{"path": "sub/ok.txt", "text": "ok"}, p)
+	if ok, _ := out["ok"].(bool); !ok {
+		t.Fatalf("expected a relative write inside the workspace to succeed: %#v", out)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "sub", "ok.txt")); err != nil || string(b) != "ok" {
+		t.Fatalf("relative paths should be taken from CWD: %q %v", b, err)
+	}
+}
+
+// savedPaths records the paths the file tools checkpoint.
+type savedPaths []string
+
+func (s *savedPaths) Save(paths ...string) error {
+	*s = append(*s, paths...)
+	return nil
+}
+
+func TestFileToolsSaveCheckpoints(t *testing.T) {
+	r := Registry()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var saved savedPaths
+	p := &types.Policy{CWD: dir, Checkpoints: &saved}
+
+	if out, _ := r["write_file"](context.Background(), map[string]any{"path": "new.txt", "text": "x"}, p); out["ok"] != true {
+		t.Fatalf("write_file: %#v", out)
+	}
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n"
+	if out, _ := r["apply_patch"](context.Background(), map[string]any{"patch": patch, "check": true}, p); out["ok"] != true {
+		t.Fatalf("apply_patch check: %#v", out)
+	}
+	if out, _ := r["apply_patch"](context.Background(), map[string]any{"patch": patch}, p); out["ok"] != true {
+		t.Fatalf("apply_patch: %#v", out)
+	}
+	if out, _ := r["edit_file"](context.Background(), map[string]any{"path": "new.txt", "old_string": "y", "new_string": "z"}, p); out["error"] == nil {
+		t.Fatalf("edit_file should fail: %#v", out)
+	}
+	if out, _ := r["edit_file"](context.Background(), map[string]any{"path": "new.txt", "old_string": "x", "new_string": "y"}, p); out["ok"] != true {
+		t.Fatalf("edit_file: %#v", out)
+	}
+	want := []string{filepath.Join(dir, "new.txt"), filepath.Join(dir, "a.txt"), filepath.Join(dir, "new.txt")}
+	if len(saved) != 3 || saved[0] != want[0] || saved[1] != want[1] || saved[2] != want[2] {
+		t.Fatalf("saved %v, want %v (a check or failed edit writes nothing and saves nothing)", saved, want)
+	}
+}
+
+func TestFileToolsUseThePolicyFS(t *testing.T) {
+	r := Registry()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ov, err := overlay.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ov.Close() }()
+	p := &types.Policy{CWD: dir, Roots: []string{dir}, FS: ov}
+	ctx := context.Background()
+
+	if out, _ := r["write_file"](ctx, map[string]any{"path": "new.txt", "text": "x\n"}, p); out["ok"] != true {
+		t.Fatalf("write_file: %#v", out)
+	}
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n"
+	if out, _ := r["apply_patch"](ctx, map[string]any{"patch": patch}, p); out["ok"] != true {
+		t.Fatalf("apply_patch: %#v", out)
+	}
+	if out, _ := r["read_file"](ctx, map[string]any{"path": "a.txt"}, p); out["text"] != "b\n" {
+		t.Fatalf("read_file should see the overlay: %#v", out)
+	}
+	if out, _ := r["shell"](ctx, map[string]any{"cmd": "cat a.txt new.txt && echo y > made.txt"}, p); out["stdout"] != "b\nx\n" {
+		t.Fatalf("shell should run in a copy with the overlay's files: %#v", out)
+	}
+	for _, name := range []string{"new.txt", "made.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Fatalf("%s was written to the workspace", name)
+		}
+	}
+
+	// the overlay's diff applies to the workspace
+	changes, err := ov.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := r["apply_patch"](ctx, map[string]any{"patch": overlay.Diff(changes)}, &types.Policy{CWD: dir}); out["ok"] != true {
+		t.Fatalf("applying the overlay diff: %#v", out)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "made.txt")); string(b) != "y\n" {
+		t.Fatalf("made.txt = %q", b)
+	}
+}
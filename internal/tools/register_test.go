@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+func TestRegisterAddsAndRemovesTool(t *testing.T) {
+	exec := func(context.Context, map[string]any, *types.Policy) (map[string]any, error) {
+		return map[string]any{"ok": true}, nil
+	}
+	Register(types.Tool{Type: "function", Function: types.ToolFunction{Name: "ext_tool"}}, exec)
+	Register(types.Tool{Type: "function", Function: types.ToolFunction{Name: "ext_tool", Description: "v2"}}, exec)
+	// built-in tools cannot be shadowed
+	Register(types.Tool{Type: "function", Function: types.ToolFunction{Name: "shell", Description: "fake"}}, exec)
+	defer Unregister("shell")
+
+	count := 0
+	for _, tl := range ToolsManifest() {
+		switch tl.Function.Name {
+		case "ext_tool":
+			count++
+			if tl.Function.Description != "v2" {
+				t.Fatalf("re-registering should replace the tool, got %+v", tl)
+			}
+		case "shell":
+			if tl.Function.Description == "fake" {
+				t.Fatalf("registered tool shadowed a built-in")
+			}
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expected ext_tool once in manifest, got %d", count)
+	}
+	if out, _ := Registry()["shell"](context.Background(), map[string]any{"cmd": "true"}, &types.Policy{DryShell: true}); out["dry_run"] != true {
+		t.Fatalf("built-in shell should still run, got %#v", out)
+	}
+	if _, ok := Registry()["ext_tool"]; !ok {
+		t.Fatalf("expected ext_tool in registry")
+	}
+
+	Unregister("ext_tool")
+	if _, ok := Registry()["ext_tool"]; ok {
+		t.Fatalf("expected ext_tool to be removed")
+	}
+	for _, tl := range ToolsManifest() {
+		if tl.Function.Name == "ext_tool" {
+			t.Fatalf("expected ext_tool to be removed from manifest")
+		}
+	}
+}
+
+type editingApprover struct{ cmd string }
+
+func (a editingApprover) Approve(_ context.Context, req types.ApprovalRequest) types.ApprovalDecision {
+	return types.ApprovalDecision{Allow: true, Args: map[string]any{"cmd": a.cmd}}
+}
+
+func TestGuardAppliesPolicyRules(t *testing.T) {
+	ran := 0
+	exec := Guard("shell", func(context.Context, map[string]any, *types.Policy) (map[string]any, error) {
+		ran++
+		return map[string]any{"ok": true}, nil
+	})
+	rules := []types.PolicyFile{{Path: "p", Rules: []types.PolicyRule{
+		{Commands: []string{"rm"}, Decision: types.DecisionDeny, Message: "no rm"},
+		{Commands: []string{"git push"}, Decision: types.DecisionAsk, Line: 3},
+	}}}
+
+	out, _ := exec(context.Background(), map[string]any{"cmd": "rm x"}, &types.Policy{RuleFiles: rules})
+	if out["error"] != "no rm" || ran != 0 {
+		t.Fatalf("expected the deny rule to refuse, got %#v (ran %d)", out, ran)
+	}
+	out, _ = exec(context.Background(), map[string]any{"cmd": "git push"}, &types.Policy{RuleFiles: rules})
+	if out["error"] != `approval required ("git push" matches p:3) but there is no terminal to ask` || ran != 0 {
+		t.Fatalf("expected an ask rule without an approver to refuse, got %#v", out)
+	}
+	// edited arguments are checked again
+	out, _ = exec(context.Background(), map[string]any{"cmd": "git push"}, &types.Policy{RuleFiles: rules, Approver: editingApprover{"rm -r ."}})
+	if out["error"] != "no rm" || ran != 0 {
+		t.Fatalf("expected the edited command to be refused, got %#v", out)
+	}
+	out, _ = exec(context.Background(), map[string]any{"cmd": "git push"}, &types.Policy{RuleFiles: rules, Approver: editingApprover{"git push -n"}})
+	if out["ok"] != true || ran != 1 {
+		t.Fatalf("expected the approved call to run, got %#v", out)
+	}
+}
@@ -0,0 +1,384 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dave1010/jorin/internal/types"
+)
+
+const (
+	maxListEntries    = 1000
+	maxGlobResults    = 1000
+	maxSearchResults  = 100
+	maxSearchLimit    = 1000
+	maxSearchContext  = 10
+	maxListDepth      = 10
+	maxMatchLineBytes = 500
+)
+
+// errWalkLimit stops a walk once a tool has collected enough results.
+var errWalkLimit = errors.New("result limit reached")
+
+// walker lists the files under a directory for list_dir, glob and search,
+// through the policy's file system. It skips .git, paths .gitignore files
+// ignore unless told not to, paths DenyRead protects and symbolic links
+// that lead out of the workspace or to directories.
+type walker struct {
+	ctx    context.Context
+	p      *types.Policy
+	fs     types.FileSystem
+	ignore *gitignore // nil includes ignored paths
+	// wsRel is the walk's top relative to the workspace (see
+	// Policy.WorkspacePath), and repoRel relative to the repository the
+	// .gitignore files belong to.
+	wsRel, repoRel string
+}
+
+// newWalker returns a walker of the directory name (relative to the
+// working directory), resolved and checked against the policy, and the
+// resolved directory.
+func newWalker(ctx context.Context, p *types.Policy, name string, includeIgnored bool) (*walker, string, error) {
+	top, err := p.ResolvePath(name, false)
+	if err != nil {
+		return nil, "", err
+	}
+	_, wsRel, _, err := p.WorkspacePath(top)
+	if err != nil {
+		return nil, "", err
+	}
+	w := &walker{ctx: ctx, p: p, fs: fileSystem(p), wsRel: wsRel}
+	if !includeIgnored {
+		w.ignore = &gitignore{}
+		w.loadParentIgnores(top)
+	}
+	return w, top, nil
+}
+
+// loadParentIgnores finds the repository containing top, the nearest
+// directory with a .git inside the workspace, and reads the .gitignore
+// files from there down to top's parent, and .git/info/exclude.
+func (w *walker) loadParentIgnores(top string) {
+	roots := map[string]bool{}
+	for _, r := range w.p.Roots {
+		if real, err := filepath.EvalSymlinks(r); err == nil {
+			roots[real] = true
+		}
+	}
+	repo := ""
+	for dir := top; ; {
+		if _, err := w.fs.Stat(filepath.Join(dir, ".git")); err == nil {
+			repo = dir
+			break
+		}
+		parent := filepath.Dir(dir)
+		if roots[dir] || parent == dir {
+			break
+		}
+		dir = parent
+	}
+	if repo == "" {
+		return
+	}
+	if data, err := w.fs.ReadFile(filepath.Join(repo, ".git", "info", "exclude")); err == nil {
+		w.ignore.add("", data)
+	}
+	rel, _ := filepath.Rel(repo, top)
+	if rel == "." {
+		return
+	}
+	w.repoRel = filepath.ToSlash(rel)
+	dir, relDir := repo, ""
+	for _, elem := range strings.Split(w.repoRel, "/") {
+		if data, err := w.fs.ReadFile(filepath.Join(dir, ".gitignore")); err == nil {
+			w.ignore.add(relDir, data)
+		}
+		dir, relDir = filepath.Join(dir, elem), path.Join(relDir, elem)
+	}
+}
+
+// walk calls fn for each entry under dir, directories before their
+// contents, with its path and its slash-separated path relative to the top
+// of the walk. depth bounds how deep it goes; 0 means no limit. An error
+// from fn other than filepath.SkipDir stops the walk.
+func (w *walker) walk(dir, rel string, depth int, fn func(abs, rel string, d fs.DirEntry) error) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	ents, err := w.fs.ReadDir(dir)
+	if err != nil {
+		if rel == "" {
+			return err
+		}
+		// an unreadable subdirectory is left out
+		return nil
+	}
+	if w.ignore != nil {
+		if data, err := w.fs.ReadFile(filepath.Join(dir, ".gitignore")); err == nil {
+			w.ignore.add(path.Join(w.repoRel, rel), data)
+		}
+	}
+	for _, e := range ents {
+		abs, childRel := filepath.Join(dir, e.Name()), path.Join(rel, e.Name())
+		if e.Name() == ".git" || w.p.ReadDenied(path.Join(w.wsRel, childRel)) != "" {
+			continue
+		}
+		isDir := e.IsDir()
+		if e.Type()&fs.ModeSymlink != 0 {
+			// follow links to files in the workspace, never to directories
+			real, err := w.p.ResolvePath(abs, false)
+			if err != nil {
+				continue
+			}
+			if info, err := w.fs.Stat(real); err != nil || info.IsDir() {
+				continue
+			}
+		}
+		if w.ignore != nil && w.ignore.ignored(path.Join(w.repoRel, childRel), isDir) {
+			continue
+		}
+		err := fn(abs, childRel, e)
+		if errors.Is(err, filepath.SkipDir) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if isDir && (depth == 0 || strings.Count(childRel, "/")+1 < depth) {
+			if err := w.walk(abs, childRel, depth, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkArgs reads the arguments list_dir, glob and search share: the
+// directory (default the working directory) and include_ignored.
+func walkArgs(args map[string]any) (string, bool) {
+	dir, _ := args["path"].(string)
+	if dir == "" {
+		dir = "."
+	}
+	includeIgnored, _ := args["include_ignored"].(bool)
+	return dir, includeIgnored
+}
+
+// intArg returns the integer argument key, def if it is missing, or an
+// error naming the allowed range.
+func intArg(args map[string]any, key string, def, min, max int) (int, error) {
+	v, ok := args[key]
+	if !ok {
+		return def, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f != float64(int(f)) || f < float64(min) || f > float64(max) {
+		return 0, fmt.Errorf("%s must be a whole number from %d to %d", key, min, max)
+	}
+	return int(f), nil
+}
+
+func listDirToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	dir, includeIgnored := walkArgs(args)
+	depth, err := intArg(args, "depth", 1, 1, maxListDepth)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	w, top, err := newWalker(ctx, p, dir, includeIgnored)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	entries := []map[string]any{}
+	err = w.walk(top, "", depth, func(abs, rel string, d fs.DirEntry) error {
+		if len(entries) == maxListEntries {
+			return errWalkLimit
+		}
+		e := map[string]any{"path": rel, "type": "file"}
+		switch {
+		case d.IsDir():
+			e["path"], e["type"] = rel+"/", "dir"
+		case d.Type()&fs.ModeSymlink != 0:
+			e["type"] = "symlink"
+		default:
+			if info, err := d.Info(); err == nil {
+				e["size"] = info.Size()
+			}
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errWalkLimit) {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	return map[string]any{"path": dir, "entries": entries, "truncated": errors.Is(err, errWalkLimit)}, nil
+}
+
+// globMatcher returns a matcher for a glob: with a slash it matches the
+// whole relative path, otherwise the file name at any depth.
+func globMatcher(glob string) (func(rel string) bool, error) {
+	if _, err := path.Match(strings.ReplaceAll(glob, "**", "*"), ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	glob = strings.TrimPrefix(glob, "./")
+	elems := strings.Split(strings.Trim(glob, "/"), "/")
+	if !strings.Contains(glob, "/") {
+		elems = []string{"**", glob}
+	}
+	return func(rel string) bool { return matchElems(elems, strings.Split(rel, "/")) }, nil
+}
+
+func globToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	pattern, _ := args["pattern"].(string)
+	if pattern == "" {
+		return nil, errors.New("missing pattern")
+	}
+	match, err := globMatcher(pattern)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	dir, includeIgnored := walkArgs(args)
+	limit, err := intArg(args, "limit", maxGlobResults, 1, maxGlobResults)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	w, top, err := newWalker(ctx, p, dir, includeIgnored)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	files := []string{}
+	err = w.walk(top, "", 0, func(abs, rel string, d fs.DirEntry) error {
+		if d.IsDir() || !match(rel) {
+			return nil
+		}
+		if len(files) == limit {
+			return errWalkLimit
+		}
+		files = append(files, filepath.Join(dir, filepath.FromSlash(rel)))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errWalkLimit) {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	return map[string]any{"files": files, "count": len(files), "truncated": errors.Is(err, errWalkLimit)}, nil
+}
+
+func searchToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+	pattern, _ := args["pattern"].(string)
+	if pattern == "" {
+		return nil, errors.New("missing pattern")
+	}
+	if literal, _ := args["literal"].(bool); literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase, _ := args["ignore_case"].(bool); ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return map[string]any{"error": "invalid pattern: " + err.Error()}, nil
+	}
+	match := func(string) bool { return true }
+	if glob, _ := args["glob"].(string); glob != "" {
+		if match, err = globMatcher(glob); err != nil {
+			return map[string]any{"error": err.Error()}, nil
+		}
+	}
+	limit, err := intArg(args, "max_results", maxSearchResults, 1, maxSearchLimit)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	contextLines, err := intArg(args, "context", 0, 0, maxSearchContext)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	dir, includeIgnored := walkArgs(args)
+	w, top, err := newWalker(ctx, p, dir, includeIgnored)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+
+	matches := []map[string]any{}
+	searched := 0
+	searchFile := func(abs, name string) error {
+		data, err := w.fs.ReadFile(abs)
+		if err != nil || bytes.IndexByte(data[:minInt(len(data), binarySniffBytes)], 0) >= 0 {
+			// unreadable and binary files are skipped
+			return nil
+		}
+		searched++
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			if len(matches) == limit {
+				return errWalkLimit
+			}
+			m := map[string]any{"path": name, "line": i + 1, "text": cutLine(line)}
+			if contextLines > 0 {
+				m["before"] = cutLines(lines[maxInt(0, i-contextLines):i])
+				m["after"] = cutLines(lines[i+1 : minInt(len(lines), i+1+contextLines)])
+			}
+			matches = append(matches, m)
+		}
+		return nil
+	}
+
+	if info, statErr := w.fs.Stat(top); statErr == nil && !info.IsDir() {
+		err = searchFile(top, dir)
+	} else {
+		err = w.walk(top, "", 0, func(abs, rel string, d fs.DirEntry) error {
+			if d.IsDir() || !match(rel) {
+				return nil
+			}
+			return searchFile(abs, filepath.Join(dir, filepath.FromSlash(rel)))
+		})
+	}
+	if err != nil && !errors.Is(err, errWalkLimit) {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	return map[string]any{"matches": matches, "files_searched": searched, "truncated": errors.Is(err, errWalkLimit)}, nil
+}
+
+// cutLine shortens a matched line to maxMatchLineBytes, so minified files
+// do not flood the result.
+func cutLine(line string) string {
+	if len(line) <= maxMatchLineBytes {
+		return line
+	}
+	n := maxMatchLineBytes
+	for n > 0 && !utf8.RuneStart(line[n]) {
+		n--
+	}
+	return line[:n] + "..."
+}
+
+func cutLines(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = cutLine(l)
+	}
+	return out
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,250 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave1010/jorin/internal/overlay"
+	"github.com/dave1010/jorin/internal/types"
+)
+
+// searchTree creates a small repository:
+//
+//	.git/config
+//	.gitignore        build/ and *.log, except keep.log
+//	.env
+//	README.md
+//	app.log, keep.log
+//	build/out.go
+//	cmd/main.go
+//	cmd/sub/.gitignore   /generated.go
+//	cmd/sub/generated.go, cmd/sub/sub.go, cmd/sub/sub_test.go
+//	pkg/lib.go, pkg/blob.bin
+func searchTree(t *testing.T) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".git/config":          "[core]\n",
+		".gitignore":           "build/\n*.log\n!keep.log\n",
+		".env":                 "TOKEN=secret\n",
+		"README.md":            "# Demo\nfunc in docs\n",
+		"app.log":              "func log\n",
+		"keep.log":             "func kept\n",
+		"build/out.go":         "package build\nfunc Built() {}\n",
+		"cmd/main.go":          "package main\n\nfunc main() {\n\tRun()\n}\n",
+		"cmd/sub/.gitignore":   "/generated.go\n",
+		"cmd/sub/generated.go": "package sub\nfunc Generated() {}\n",
+		"cmd/sub/sub.go":       "package sub\n\n// Run runs.\nfunc Run() {}\n",
+		"cmd/sub/sub_test.go":  "package sub\nfunc TestRun() {}\n",
+		"pkg/lib.go":           "package pkg\nfunc Lib() {}\n",
+		"pkg/blob.bin":         "func\x00binary",
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func searchPolicy(dir string) *types.Policy {
+	return &types.Policy{CWD: dir, Roots: []string{dir}, DenyRead: []string{".env*"}}
+}
+
+func callTool(t *testing.T, name string, args map[string]any, p *types.Policy) map[string]any {
+	t.Helper()
+	out, err := Registry()[name](context.Background(), args, p)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return out
+}
+
+func entryPaths(out map[string]any) string {
+	var paths []string
+	for _, e := range out["entries"].([]map[string]any) {
+		paths = append(paths, e["path"].(string))
+	}
+	return strings.Join(paths, " ")
+}
+
+func TestGitignore(t *testing.T) {
+	var g gitignore
+	g.add("", []byte("# comment\n*.log\n!keep.log\nbuild/\n/only-top.txt\ndocs/**/*.tmp\n\\#hash\n"))
+	g.add("sub", []byte("/local.txt\n"))
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"deep/dir/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"x/build", true, true},
+		{"only-top.txt", false, true},
+		{"x/only-top.txt", false, false},
+		{"docs/a/b/c.tmp", false, true},
+		{"docs/c.tmp", false, true},
+		{"other/c.tmp", false, false},
+		{"#hash", false, true},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/x/local.txt", false, false},
+	}
+	for _, c := range cases {
+		if got := g.ignored(c.rel, c.isDir); got != c.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestListDir(t *testing.T) {
+	dir := searchTree(t)
+	p := searchPolicy(dir)
+
+	out := callTool(t, "list_dir", map[string]any{}, p)
+	if got := entryPaths(out); got != ".gitignore README.md cmd/ keep.log pkg/" {
+		t.Fatalf("list_dir = %q", got)
+	}
+	out = callTool(t, "list_dir", map[string]any{"path": "cmd", "depth": float64(2)}, p)
+	if got := entryPaths(out); got != "main.go sub/ sub/.gitignore sub/sub.go sub/sub_test.go" {
+		t.Fatalf("list_dir depth 2 = %q", got)
+	}
+	if size := out["entries"].([]map[string]any)[0]["size"]; size != int64(len("package main\n\nfunc main() {\n\tRun()\n}\n")) {
+		t.Fatalf("size = %v", size)
+	}
+	out = callTool(t, "list_dir", map[string]any{"include_ignored": true}, p)
+	if got := entryPaths(out); got != ".gitignore README.md app.log build/ cmd/ keep.log pkg/" {
+		t.Fatalf("list_dir include_ignored = %q", got)
+	}
+	if out := callTool(t, "list_dir", map[string]any{"path": ".."}, p); !strings.Contains(fmt.Sprint(out["error"]), "outside the workspace") {
+		t.Fatalf("expected a directory outside the workspace to be refused: %#v", out)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := searchTree(t)
+	p := searchPolicy(dir)
+	cases := map[string]string{
+		"*.go":            "cmd/main.go cmd/sub/sub.go cmd/sub/sub_test.go pkg/lib.go",
+		"cmd/**/*.go":     "cmd/main.go cmd/sub/sub.go cmd/sub/sub_test.go",
+		"*_test.go":       "cmd/sub/sub_test.go",
+		"./pkg/*":         "pkg/blob.bin pkg/lib.go",
+		"*.{go,md}":       "",
+		"README.[mM][dD]": "README.md",
+	}
+	for pattern, want := range cases {
+		out := callTool(t, "glob", map[string]any{"pattern": pattern}, p)
+		if got := strings.Join(out["files"].([]string), " "); got != want {
+			t.Errorf("glob %q = %q, want %q", pattern, got, want)
+		}
+	}
+
+	out := callTool(t, "glob", map[string]any{"pattern": "*.go", "path": "cmd", "limit": float64(2)}, p)
+	if got := strings.Join(out["files"].([]string), " "); got != "cmd/main.go cmd/sub/sub.go" || out["truncated"] != true {
+		t.Fatalf("glob with limit = %q, truncated %v", got, out["truncated"])
+	}
+	if out := callTool(t, "glob", map[string]any{"pattern": "[", "path": "cmd"}, p); out["error"] == nil {
+		t.Fatalf("expected an invalid glob to be refused: %#v", out)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := searchTree(t)
+	p := searchPolicy(dir)
+	matchList := func(out map[string]any) string {
+		var got []string
+		for _, m := range out["matches"].([]map[string]any) {
+			got = append(got, fmt.Sprintf("%s:%d", m["path"], m["line"]))
+		}
+		return strings.Join(got, " ")
+	}
+
+	out := callTool(t, "search", map[string]any{"pattern": `^func \w+\(`}, p)
+	if got := matchList(out); got != "cmd/main.go:3 cmd/sub/sub.go:4 cmd/sub/sub_test.go:2 pkg/lib.go:2" {
+		t.Fatalf("search = %q", got)
+	}
+	// the two .gitignore files count; blob.bin, being binary, does not
+	if out["files_searched"] != 8 || out["truncated"] != false {
+		t.Fatalf("files_searched %v truncated %v", out["files_searched"], out["truncated"])
+	}
+
+	out = callTool(t, "search", map[string]any{"pattern": "run(", "literal": true, "ignore_case": true, "glob": "cmd/*.go", "context": float64(1)}, p)
+	m := out["matches"].([]map[string]any)
+	if matchList(out) != "cmd/main.go:4" || m[0]["text"] != "\tRun()" ||
+		fmt.Sprint(m[0]["before"]) != "[func main() {]" || fmt.Sprint(m[0]["after"]) != "[}]" {
+		t.Fatalf("literal search with context: %#v", m)
+	}
+
+	out = callTool(t, "search", map[string]any{"pattern": "func", "max_results": float64(2)}, p)
+	if out["truncated"] != true || len(out["matches"].([]map[string]any)) != 2 {
+		t.Fatalf("max_results: %#v", out)
+	}
+	out = callTool(t, "search", map[string]any{"pattern": "func", "path": "app.log", "include_ignored": true}, p)
+	if matchList(out) != "app.log:1" {
+		t.Fatalf("searching a file: %#v", out)
+	}
+	if out := callTool(t, "search", map[string]any{"pattern": "TOKEN", "path": ".env"}, p); !strings.Contains(fmt.Sprint(out["error"]), "deny_read") {
+		t.Fatalf("expected a protected file to be refused: %#v", out)
+	}
+	if out := callTool(t, "search", map[string]any{"pattern": "("}, p); !strings.HasPrefix(fmt.Sprint(out["error"]), "invalid pattern") {
+		t.Fatalf("expected an invalid pattern to be refused: %#v", out)
+	}
+}
+
+func TestSearchToolsStayInWorkspace(t *testing.T) {
+	dir := searchTree(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.go"), []byte("func Secret() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.go"), filepath.Join(dir, "pkg", "link.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "pkg", "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+	p := searchPolicy(dir)
+	if out := callTool(t, "glob", map[string]any{"pattern": "*.go", "path": "pkg"}, p); strings.Join(out["files"].([]string), " ") != "pkg/lib.go" {
+		t.Fatalf("links out of the workspace should be skipped: %#v", out)
+	}
+	if out := callTool(t, "search", map[string]any{"pattern": "Secret"}, p); len(out["matches"].([]map[string]any)) != 0 {
+		t.Fatalf("links out of the workspace should not be searched: %#v", out)
+	}
+}
+
+func TestSearchToolsReadThroughTheOverlay(t *testing.T) {
+	dir := searchTree(t)
+	ov, err := overlay.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ov.Close() }()
+	if err := ov.WriteFile(filepath.Join(dir, "pkg", "new.go"), []byte("package pkg\nfunc New() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ov.Remove(filepath.Join(dir, "pkg", "lib.go")); err != nil {
+		t.Fatal(err)
+	}
+	p := searchPolicy(dir)
+	p.FS = ov
+	if out := callTool(t, "list_dir", map[string]any{"path": "pkg"}, p); entryPaths(out) != "blob.bin new.go" {
+		t.Fatalf("list_dir through the overlay = %q", entryPaths(out))
+	}
+	if out := callTool(t, "search", map[string]any{"pattern": "^func", "path": "pkg"}, p); fmt.Sprint(out["matches"].([]map[string]any)[0]["path"]) != "pkg/new.go" {
+		t.Fatalf("search through the overlay: %#v", out)
+	}
+}
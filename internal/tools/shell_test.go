@@ -1,17 +1,21 @@
 package tools
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dave1010/jorin/internal/shell"
 	"github.com/dave1010/jorin/internal/types"
 )
 
 func TestShellDryRun(t *testing.T) {
 	r := Registry()
 
-	out, err := r["shell"](map[string]any{"cmd": "echo hi"}, &types.Policy{DryShell: true})
+	out, err := r["shell"](context.Background(), map[string]any{"cmd": "echo hi"}, &types.Policy{DryShell: true})
 	if err != nil {
 		t.Fatalf("shell dry failed: %v", err)
 	}
@@ -26,7 +30,7 @@ func TestShellDryRun(t *testing.T) {
 func TestShellCommand(t *testing.T) {
 	r := Registry()
 
-	out, err := r["shell"](map[string]any{"cmd": "echo -n OK"}, &types.Policy{})
+	out, err := r["shell"](context.Background(), map[string]any{"cmd": "echo -n OK"}, &types.Policy{})
 	if err != nil {
 		t.Fatalf("shell failed: %v", err)
 	}
@@ -43,7 +47,7 @@ func TestShellCWD(t *testing.T) {
 	if err := os.WriteFile(script, []byte("#!/bin/sh\necho -n $(pwd) > outpwd"), 0o755); err != nil {
 		t.Fatalf("write script: %v", err)
 	}
-	if _, err := r["shell"](map[string]any{"cmd": "./pw.sh"}, &types.Policy{CWD: tmp}); err != nil {
+	if _, err := r["shell"](context.Background(), map[string]any{"cmd": "./pw.sh"}, &types.Policy{CWD: tmp}); err != nil {
 		t.Fatalf("shell CWD failed: %v", err)
 	}
 	b, err := os.ReadFile(filepath.Join(tmp, "outpwd"))
@@ -54,3 +58,163 @@ func TestShellCWD(t *testing.T) {
 		t.Fatalf("expected %q got %q", tmp, string(b))
 	}
 }
+
+func TestShellCancelKillsProcessGroup(t *testing.T) {
+	r := Registry()
+
+	tmp := t.TempDir()
+	marker := filepath.Join(tmp, "late")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	// the backgrounded child would write the marker if it survived the cancel
+	out, err := r["shell"](ctx, map[string]any{"cmd": "(sleep 1 && touch late) & sleep 30"}, &types.Policy{CWD: tmp})
+	if err != nil {
+		t.Fatalf("shell failed: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("shell did not stop after timeout")
+	}
+	if out["error"] != "timed out" {
+		t.Fatalf("expected timed out error, got %#v", out)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatalf("background child survived cancellation")
+	}
+}
+
+type sandboxedRunner struct{ cmd, cwd string }
+
+func (r *sandboxedRunner) Run(_ context.Context, cmd string, cwd string) (string, string, int) {
+	r.cmd, r.cwd = cmd, cwd
+	return "out", "", 3
+}
+
+func (r *sandboxedRunner) Sandbox() string { return "bwrap" }
+
+func TestShellUsesDefaultRunner(t *testing.T) {
+	fake := &sandboxedRunner{}
+	old := shell.DefaultRunner
+	shell.DefaultRunner = fake
+	defer func() { shell.DefaultRunner = old }()
+
+	out, err := Registry()["shell"](context.Background(), map[string]any{"cmd": "make"}, &types.Policy{CWD: "/src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.cmd != "make" || fake.cwd != "/src" {
+		t.Fatalf("runner got %q in %q", fake.cmd, fake.cwd)
+	}
+	if out["returncode"] != 3 || out["stdout"] != "out" || out["sandbox"] != "bwrap" {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+}
+
+func TestShellPersistentSession(t *testing.T) {
+	r := Registry()
+	tmp := t.TempDir()
+	sess := shell.NewSession(shell.DefaultRunner)
+	defer sess.Close()
+	p := &types.Policy{CWD: tmp, Shell: sess}
+	ctx := context.Background()
+
+	out, err := r["shell"](ctx, map[string]any{"cmd": "mkdir sub && cd sub && export MODE=dev"}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(tmp, "sub")
+	if out["cwd"] != sub || out["env"].(map[string]string)["MODE"] != "dev" {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+	out, _ = r["shell"](ctx, map[string]any{"cmd": "echo -n $MODE $PWD"}, p)
+	if out["stdout"] != "dev "+sub || out["returncode"] != 0 {
+		t.Fatalf("state should carry over: %#v", out)
+	}
+	out, _ = r["shell"](ctx, map[string]any{"cmd": "exit 4"}, p)
+	if out["returncode"] != 4 || out["shell_exited"] != true {
+		t.Fatalf("unexpected result after exit: %#v", out)
+	}
+	out, _ = r["shell"](ctx, map[string]any{"cmd": "echo -n $MODE"}, p)
+	if out["stdout"] != "" || out["cwd"] != tmp || out["note"] == nil {
+		t.Fatalf("expected a fresh shell: %#v", out)
+	}
+}
+
+func TestShellStdin(t *testing.T) {
+	r := Registry()
+	ctx := context.Background()
+
+	out, err := r["shell"](ctx, map[string]any{"cmd": "read a; read b; echo -n \"$b $a\"", "stdin": "one\ntwo\n"}, &types.Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["stdout"] != "two one" || out["returncode"] != 0 {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+
+	sess := shell.NewSession(shell.DefaultRunner)
+	defer sess.Close()
+	out, _ = r["shell"](ctx, map[string]any{"cmd": "cat", "stdin": "x"}, &types.Policy{Shell: sess})
+	if out["error"] == nil {
+		t.Fatalf("the persistent shell should refuse stdin: %#v", out)
+	}
+}
+
+func TestShellPTY(t *testing.T) {
+	if !shell.PTYSupported {
+		t.Skip("no PTY support")
+	}
+	r := Registry()
+	p := &types.Policy{CWD: t.TempDir(), PTY: true}
+	ctx := context.Background()
+
+	prompt := "read -p 'Continue? ' ok; [ -t 1 ] && echo \"tty $ok\""
+	out, err := r["shell"](ctx, map[string]any{"cmd": prompt}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["waiting_for_input"] != true || out["error"] == nil {
+		t.Fatalf("expected the prompt to be reported: %#v", out)
+	}
+	out, _ = r["shell"](ctx, map[string]any{"cmd": prompt, "stdin": "y"}, p)
+	if s, _ := out["output"].(string); !strings.HasSuffix(s, "Continue? y\ntty y\n") || out["returncode"] != 0 || out["error"] != nil {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+}
+
+func TestShellDescriptionFollowsMode(t *testing.T) {
+	describe := func(p *types.Policy) types.Tool {
+		for _, tl := range EnabledTools(ToolsManifest(), p) {
+			if tl.Function.Name == "shell" {
+				return tl
+			}
+		}
+		t.Fatal("shell tool not offered")
+		return types.Tool{}
+	}
+
+	plain := describe(&types.Policy{}).Function
+	if strings.Contains(plain.Description, "terminal") || strings.Contains(plain.Description, "persistent") {
+		t.Fatalf("plain description mentions other modes: %q", plain.Description)
+	}
+
+	pty := describe(&types.Policy{PTY: true, PTYIdleTimeout: 30 * time.Second}).Function
+	if !strings.Contains(pty.Description, "waiting_for_input") || !strings.Contains(pty.Description, "30s") || strings.Contains(pty.Description, "persistent") {
+		t.Fatalf("unexpected terminal description: %q", pty.Description)
+	}
+	if noLimit := describe(&types.Policy{PTY: true, PTYIdleTimeout: -1}).Function; strings.Contains(noLimit.Description, "prints nothing") {
+		t.Fatalf("description mentions an idle limit that is off: %q", noLimit.Description)
+	}
+
+	sess := shell.NewSession(shell.DefaultRunner)
+	defer sess.Close()
+	persistent := describe(&types.Policy{Shell: sess}).Function
+	if !strings.Contains(persistent.Description, "persistent") || strings.Contains(persistent.Description, "terminal") {
+		t.Fatalf("unexpected persistent description: %q", persistent.Description)
+	}
+	if strings.Contains(string(persistent.Parameters), "stdin") {
+		t.Fatalf("persistent shell should not offer stdin: %s", persistent.Parameters)
+	}
+}
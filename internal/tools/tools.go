@@ -1,18 +1,18 @@
 package tools
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
-	"net/http"
+	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/dave1010/jorin/internal/policy"
+	"github.com/dave1010/jorin/internal/shell"
 	"github.com/dave1010/jorin/internal/types"
 )
 
@@ -23,165 +23,472 @@ const (
 )
 
 // ToolExec is a function that executes a tool given args and a policy.
-type ToolExec func(args map[string]any, cfg *types.Policy) (map[string]any, error)
+// Implementations must stop promptly once ctx is cancelled.
+type ToolExec func(ctx context.Context, args map[string]any, cfg *types.Policy) (map[string]any, error)
 
 func schema(s string) json.RawMessage { return json.RawMessage([]byte(s)) }
 
+var (
+	extMu    sync.RWMutex
+	extTools []types.Tool
+	extExecs = map[string]ToolExec{}
+)
+
+// Register adds a tool provided outside this package (for example by an MCP
+// server) to the manifest and registry. Registering a name again replaces
+// the earlier definition.
+func Register(t types.Tool, fn ToolExec) {
+	extMu.Lock()
+	defer extMu.Unlock()
+	name := t.Function.Name
+	if _, ok := extExecs[name]; ok {
+		for i := range extTools {
+			if extTools[i].Function.Name == name {
+				extTools = append(extTools[:i], extTools[i+1:]...)
+				break
+			}
+		}
+	}
+	extTools = append(extTools, t)
+	extExecs[name] = fn
+}
+
+// Unregister removes a tool added with Register.
+func Unregister(name string) {
+	extMu.Lock()
+	defer extMu.Unlock()
+	delete(extExecs, name)
+	for i := range extTools {
+		if extTools[i].Function.Name == name {
+			extTools = append(extTools[:i], extTools[i+1:]...)
+			return
+		}
+	}
+}
+
+// ToolsManifest returns the built-in tools followed by registered ones.
+// Registered tools cannot shadow a built-in tool.
 func ToolsManifest() (list []types.Tool) {
+	list = builtinManifest()
+	builtin := map[string]bool{}
+	for _, t := range list {
+		builtin[t.Function.Name] = true
+	}
+	extMu.RLock()
+	defer extMu.RUnlock()
+	for _, t := range extTools {
+		if !builtin[t.Function.Name] {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func builtinManifest() []types.Tool {
 	return []types.Tool{
 		{Type: "function", Function: types.ToolFunction{
 			Name:        "shell",
-			Description: "Execute a shell command; returns stdout/stderr/returncode. Use cautiously if commands may be destructive.",
-			Parameters:  schema(`{"type":"object","properties":{"cmd":{"type":"string"}},"required":["cmd"]}`),
+			Description: "Execute a shell command; returns stdout/stderr/returncode. Use cautiously if commands may be destructive. The command reads stdin, if given, as its standard input, for example the answers to its prompts, one per line.",
+			Parameters:  schema(`{"type":"object","properties":{"cmd":{"type":"string"},"stdin":{"type":"string","description":"Text for the command's standard input."}},"required":["cmd"]}`),
+		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "process_start",
+			Description: "Start a shell command in the background, such as a dev server or a file watcher, and return its handle (id) without waiting for it to finish. Set wait to wait up to that many seconds for output, or wait_for to wait until the output matches a regular expression (for example 'listening on'). Returns the output so far; read more with process_output. Background processes are killed when the session ends. Use shell for commands that finish.",
+			Parameters:  schema(`{"type":"object","properties":{"cmd":{"type":"string"},"wait":{"type":"integer","minimum":0,"maximum":60,"description":"Seconds to wait for output before returning (default 0)."},"wait_for":{"type":"string","description":"Wait until the output matches this regular expression, for up to wait seconds (default 60)."}},"required":["cmd"]}`),
+		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "process_output",
+			Description: "Read a background process's combined stdout and stderr. Returns the output since the previous read, or from offset if set, up to 16,000 bytes; next_offset is where the next read starts and more is true if output is left. Also reports whether the process is running and, once it has exited, its exit_code. Only the last 1 MiB of output is kept; dropped_bytes counts output lost before it was read.",
+			Parameters:  schema(`{"type":"object","properties":{"id":{"type":"string","description":"The handle returned by process_start."},"offset":{"type":"integer","minimum":0,"description":"Byte offset in the output to read from."},"wait":{"type":"integer","minimum":0,"maximum":60,"description":"Seconds to wait for new output if there is none yet."},"wait_for":{"type":"string","description":"Wait until the new output matches this regular expression, for up to wait seconds (default 60)."}},"required":["id"]}`),
+		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "process_list",
+			Description: "List the background processes started in this session, with their handle, command, pid, whether they are running or their exit code, and how much output is unread.",
+			Parameters:  schema(`{"type":"object","properties":{}}`),
+		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "process_kill",
+			Description: "Stop a background process and everything it started: SIGTERM, then SIGKILL if it has not exited after 2 seconds. Its output can still be read afterwards.",
+			Parameters:  schema(`{"type":"object","properties":{"id":{"type":"string","description":"The handle returned by process_start."}},"required":["id"]}`),
 		}},
 		{Type: "function", Function: types.ToolFunction{
 			Name:        "read_file",
-			Description: "Read a UTF-8 text file and return contents. Very long files will be truncated.",
-			Parameters:  schema(`{"type":"object","properties":{"path":{"type":"string"}},"required":["path"]}`),
+			Description: "Read a text file. Returns up to 200,000 bytes of whole lines from offset (1-based, default 1), at most limit lines if set, with start_line, end_line, total_lines and the file's size in bytes. When more lines follow, truncated is true and next_offset is the offset to continue from. Binary files are refused; text that is not UTF-8 is converted and its encoding reported.",
+			Parameters:  schema(`{"type":"object","properties":{"path":{"type":"string"},"offset":{"type":"integer","minimum":1,"description":"First line to return, starting at 1."},"limit":{"type":"integer","minimum":1,"description":"Maximum number of lines to return."},"line_numbers":{"type":"boolean","description":"Prefix each line with its line number and a tab."}},"required":["path"]}`),
+		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "list_dir",
+			Description: "List a directory's files and subdirectories, to the given depth. Skips .git and files ignored by .gitignore. Directories end in '/'; files include their size in bytes.",
+			Parameters:  schema(`{"type":"object","properties":{"path":{"type":"string","description":"Directory to list (default: the working directory)."},"depth":{"type":"integer","minimum":1,"maximum":10,"description":"How many levels to list (default 1)."},"include_ignored":{"type":"boolean","description":"Also list files ignored by .gitignore."}}}`),
+		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "glob",
+			Description: "Find files by name. A pattern without '/' matches file names at any depth ('*.go'); one with '/' matches the path relative to path, where '**' matches any number of directories ('cmd/**/*_test.go'). Skips .git and files ignored by .gitignore. Prefer this to find in the shell.",
+			Parameters:  schema(`{"type":"object","properties":{"pattern":{"type":"string"},"path":{"type":"string","description":"Directory to search (default: the working directory)."},"limit":{"type":"integer","minimum":1,"maximum":1000,"description":"Maximum number of files (default 1000)."},"include_ignored":{"type":"boolean","description":"Also match files ignored by .gitignore."}},"required":["pattern"]}`),
+		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "search",
+			Description: "Search file contents for a regular expression (Go RE2 syntax) and return the matching lines with their path and line number. Searches a file or every text file under a directory, skipping .git, binary files and files ignored by .gitignore. Prefer this to grep in the shell.",
+			Parameters:  schema(`{"type":"object","properties":{"pattern":{"type":"string"},"path":{"type":"string","description":"File or directory to search (default: the working directory)."},"glob":{"type":"string","description":"Only search files matching this glob, as in the glob tool."},"literal":{"type":"boolean","description":"Treat pattern as plain text."},"ignore_case":{"type":"boolean"},"context":{"type":"integer","minimum":0,"maximum":10,"description":"Lines of context to return before and after each match."},"max_results":{"type":"integer","minimum":1,"maximum":1000,"description":"Maximum number of matches (default 100)."},"include_ignored":{"type":"boolean","description":"Also search files ignored by .gitignore."}},"required":["pattern"]}`),
 		}},
 		{Type: "function", Function: types.ToolFunction{
 			Name:        "write_file",
 			Description: "Write UTF-8 text to a file (creates/overwrites).",
 			Parameters:  schema(`{"type":"object","properties":{"path":{"type":"string"},"text":{"type":"string"}},"required":["path","text"]}`),
 		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "edit_file",
+			Description: "Replace old_string with new_string in a file and return a diff of the change. old_string must match the file exactly, including whitespace and indentation, and occur exactly once; include enough surrounding lines to make it unique, or set replace_all to replace every occurrence. Prefer this to write_file and apply_patch for small edits.",
+			Parameters:  schema(`{"type":"object","properties":{"path":{"type":"string"},"old_string":{"type":"string","description":"The exact text to replace."},"new_string":{"type":"string","description":"The text to replace it with."},"replace_all":{"type":"boolean","description":"Replace every occurrence of old_string instead of requiring exactly one."}},"required":["path","old_string","new_string"]}`),
+		}},
 		{Type: "function", Function: types.ToolFunction{
 			Name:        "http_get",
-			Description: "Fetch URL and return body (text).",
+			Description: "Fetch a URL with GET and return its status and body as text. HTML pages are converted to markdown. Use http_request for other methods, headers or a request body.",
 			Parameters:  schema(`{"type":"object","properties":{"url":{"type":"string"}},"required":["url"]}`),
 		}},
+		{Type: "function", Function: types.ToolFunction{
+			Name:        "http_request",
+			Description: "Make an HTTP request and return the status, content type, response headers and body. HTML pages are converted to markdown unless raw is set; bodies over 50,000 bytes are cut and marked truncated, and binary bodies are not returned. Loopback, private and link-local addresses are refused unless the user allows them.",
+			Parameters:  schema(`{"type":"object","properties":{"url":{"type":"string"},"method":{"type":"string","enum":["GET","HEAD","POST","PUT","PATCH","DELETE","OPTIONS"],"description":"Default GET."},"headers":{"type":"object","additionalProperties":{"type":"string"},"description":"Request headers."},"body":{"type":"string","description":"Request body."},"raw":{"type":"boolean","description":"Return HTML as it is instead of converting it to markdown."}},"required":["url"]}`),
+		}},
 		{Type: "function", Function: types.ToolFunction{
 			Name:        "apply_patch",
-			Description: "Apply a patch to a file to create, update, or delete it. The patch must be in a simplified unified diff format. It MUST start with '--- filename' and '+++ filename' (or '/dev/null'). Context lines must start with a space. Example update:\n--- a/README.md\n+++ b/README.md\n@@ -1,1 +1,1 @@\n-Old text\n+New text\n unchanged context",
-			Parameters:  schema(`{"type":"object","properties":{"patch":{"type":"string"}},"required":["patch"]}`),
+			Description: "Apply a patch that creates, updates, renames or deletes one or more files. Either every file applies or none is changed; set check to see the result without writing. Two formats are accepted. A unified diff: each file starts with '--- path' and '+++ path' (or '/dev/null'), optionally after a 'diff --git' header with rename or mode lines; context lines start with a space. Example:\n--- a/README.md\n+++ b/README.md\n@@ -1,1 +1,1 @@\n-Old text\n+New text\n unchanged context\nOr an envelope with '*** Add File: path', '*** Delete File: path', '*** Update File: path' (optionally followed by '*** Move to: path') sections, where '@@ line' anchors a hunk below that line instead of line numbers:\n*** Begin Patch\n*** Update File: README.md\n@@ ## Install\n-Old text\n+New text\n*** End Patch\nIf a hunk does not apply, the error shows the closest region of the file with line numbers; fix the hunk from it rather than rewriting the file.",
+			Parameters:  schema(`{"type":"object","properties":{"patch":{"type":"string"},"check":{"type":"boolean","description":"Validate the patch and return the resulting files without writing them."},"fuzz":{"type":"integer","minimum":0,"maximum":2,"description":"How loosely context lines may match: 0 exactly, 1 ignoring trailing whitespace, 2 also ignoring indentation. Files that needed fuzz report it."}},"required":["patch"]}`),
 		}},
 	}
 }
 
+// EnabledTools returns the tools from list that the policy has not
+// disabled, with the shell tool described as the policy runs it.
+func EnabledTools(list []types.Tool, p *types.Policy) []types.Tool {
+	out := make([]types.Tool, 0, len(list))
+	for _, t := range list {
+		if p.ToolDisabled(t.Function.Name) {
+			continue
+		}
+		if t.Function.Name == "shell" {
+			t = describeShell(t, p)
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// describeShell adapts the shell tool's description to a persistent shell
+// or a terminal, when the policy uses one.
+func describeShell(t types.Tool, p *types.Policy) types.Tool {
+	switch {
+	case p == nil:
+	case p.Shell != nil:
+		t.Function.Description = "Execute a shell command in a persistent shell; returns stdout/stderr/returncode. Use cautiously if commands may be destructive. cd, exported variables and functions carry over to later calls: the result's cwd is the shell's working directory and env lists the variables changed so far. A command that exits the shell or times out resets it. Commands read empty stdin."
+		t.Function.Parameters = schema(`{"type":"object","properties":{"cmd":{"type":"string"}},"required":["cmd"]}`)
+	case p.PTY:
+		t.Function.Description = "Execute a shell command on a terminal; returns its output, stdout and stderr together, and returncode. Use cautiously if commands may be destructive. stdin, if given, is typed in a line at a time as the command asks for input, for example the answers to its prompts. A command that waits for input it was not given is killed and reports waiting_for_input, so run it again with the answers in stdin or with flags that make it non-interactive."
+		idle := p.PTYIdleTimeout
+		if idle == 0 {
+			idle = shell.DefaultIdleTimeout
+		}
+		if idle > 0 {
+			t.Function.Description += fmt.Sprintf(" A command that prints nothing for %s is killed.", idle)
+		}
+	}
+	return t
+}
+
+// Registry returns the executors of the built-in and registered tools, each
+// bounded by the tool timeout and wrapped by Guard.
 func Registry() map[string]ToolExec {
-	return map[string]ToolExec{
-		"shell":       shellToolExec,
-		"read_file":   readFileToolExec,
-		"write_file":  writeFileToolExec,
-		"http_get":    httpGetToolExec,
-		"apply_patch": applyPatchToolExec,
+	reg := map[string]ToolExec{
+		"shell":          shellToolExec,
+		"process_start":  processStartToolExec,
+		"process_output": processOutputToolExec,
+		"process_list":   processListToolExec,
+		"process_kill":   processKillToolExec,
+		"read_file":      readFileToolExec,
+		"list_dir":       listDirToolExec,
+		"glob":           globToolExec,
+		"search":         searchToolExec,
+		"write_file":     writeFileToolExec,
+		"edit_file":      editFileToolExec,
+		"http_get":       httpGetToolExec,
+		"http_request":   httpRequestToolExec,
+		"apply_patch":    applyPatchToolExec,
+	}
+	extMu.RLock()
+	defer extMu.RUnlock()
+	for name, fn := range extExecs {
+		if _, builtin := reg[name]; !builtin {
+			reg[name] = fn
+		}
 	}
+	for name, fn := range reg {
+		reg[name] = Guard(name, WithTimeout(fn))
+	}
+	return reg
 }
 
-func applyPatchToolExec(args map[string]any, p *types.Policy) (map[string]any, error) {
-	if p.Readonly {
-		return map[string]any{"error": "readonly session"}, nil
+// WithTimeout wraps fn so that each call is bounded by the policy's
+// ToolTimeout, if it has one.
+func WithTimeout(fn ToolExec) ToolExec {
+	return func(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+		if p != nil && p.ToolTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.ToolTimeout)
+			defer cancel()
+		}
+		return fn(ctx, args, p)
 	}
+}
+
+// Guard wraps fn so that each call is first checked against the policy
+// rules (see internal/policy). Denied calls return an error result without
+// running, and calls the rules ask about go to the policy's Approver, whose
+// edited arguments are checked again. Wrap fn in WithTimeout rather than the
+// guarded executor, so that the time spent asking is not counted.
+func Guard(name string, fn ToolExec) ToolExec {
+	return func(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
+		if p == nil {
+			return fn(ctx, args, p)
+		}
+		res := policy.CheckAll(p, PolicyCalls(name, args))
+		switch res.Decision {
+		case types.DecisionDeny:
+			return map[string]any{"error": res.Message}, nil
+		case types.DecisionAsk:
+			approved, err := p.RequestApproval(ctx, name, args, res.Message)
+			if err != nil {
+				return map[string]any{"error": err.Error()}, nil
+			}
+			if res := policy.CheckAll(p, PolicyCalls(name, approved)); res.Decision == types.DecisionDeny {
+				return map[string]any{"error": res.Message}, nil
+			}
+			args = approved
+		}
+		return fn(ctx, args, p)
+	}
+}
+
+// PolicyCalls returns the calls the policy rules see: one for each file an
+// apply_patch call touches, otherwise the call itself. A process_start call
+// is also checked as a shell call, so every shell rule applies to it.
+func PolicyCalls(name string, args map[string]any) []policy.Call {
+	c := policy.NewCall(name, args)
+	if name == "process_start" {
+		return []policy.Call{c, {Tool: "shell", Command: c.Command}}
+	}
+	patch, _ := args["patch"].(string)
+	if name != "apply_patch" || patch == "" {
+		return []policy.Call{c}
+	}
+	paths, err := PatchPaths(patch)
+	if err != nil {
+		return []policy.Call{c}
+	}
+	var calls []policy.Call
+	for _, path := range paths {
+		c.Path = path
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+func applyPatchToolExec(_ context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
 	patch, _ := args["patch"].(string)
 	if patch == "" {
 		return nil, errors.New("missing patch")
 	}
-	if err := ApplyPatch(patch); err != nil {
+	check, _ := args["check"].(bool)
+	fuzz := PatchFuzz
+	if v, ok := args["fuzz"].(float64); ok {
+		if v != float64(int(v)) || v < 0 || v > MaxPatchFuzz {
+			return map[string]any{"error": "fuzz must be 0, 1 or 2"}, nil
+		}
+		fuzz = int(v)
+	}
+	opts := patchOptions{
+		resolve: func(path string) (string, error) { return p.ResolvePath(path, true) },
+		check:   check,
+		fs:      fileSystem(p),
+		fuzz:    fuzz,
+	}
+	if p.Checkpoints != nil {
+		opts.save = p.Checkpoints.Save
+	}
+	changes, err := applyPatch(patch, opts)
+	if err != nil {
 		return map[string]any{"error": err.Error()}, nil
 	}
-	return map[string]any{"ok": true}, nil
+	files := make([]map[string]any, 0, len(changes))
+	for _, c := range changes {
+		f := map[string]any{"path": c.path, "op": c.op.String()}
+		if c.from != "" {
+			f["from"] = c.from
+		}
+		if c.fuzz > 0 {
+			f["fuzz"] = c.fuzz
+		}
+		if check && c.op != opDelete {
+			f["text"] = c.text
+			if len(c.text) > maxToolOutputBytes {
+				f["text"] = c.text[:maxToolOutputBytes]
+				f["truncated"] = true
+			}
+		}
+		files = append(files, f)
+	}
+	res := map[string]any{"ok": true, "files": files}
+	if check {
+		res["check"] = true
+	}
+	return res, nil
 }
 
-func shellToolExec(args map[string]any, p *types.Policy) (map[string]any, error) {
+func shellToolExec(ctx context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
 	cmdStr, _ := args["cmd"].(string)
 	if cmdStr == "" {
 		return nil, errors.New("missing cmd")
 	}
-	if allowed, reason := checkShellPolicy(cmdStr, p); !allowed {
-		return map[string]any{"error": reason}, nil
-	}
 	if p.DryShell {
 		return map[string]any{"dry_run": true, "cmd": cmdStr}, nil
 	}
-	cmd := exec.Command("bash", "-lc", cmdStr)
-	cmd.Dir = p.CWD
-	var out bytes.Buffer
-	var errb bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errb
-	runErr := cmd.Run()
-	return map[string]any{
-		"returncode": exitCode(runErr),
-		"stdout":     Tail(out.String(), maxToolOutputBytes),
-		"stderr":     Tail(errb.String(), maxToolOutputBytes),
-	}, nil
-}
-
-func checkShellPolicy(cmdStr string, p *types.Policy) (bool, string) {
-	for _, d := range p.Deny {
-		if strings.Contains(cmdStr, d) {
-			return false, "denied by policy"
+	dir, err := fileSystem(p).ShellDir(p.CWD)
+	if err != nil {
+		return map[string]any{"error": err.Error()}, nil
+	}
+	stdin, _ := args["stdin"].(string)
+	var res map[string]any
+	switch {
+	case p.Shell != nil:
+		if stdin != "" {
+			return map[string]any{"error": "stdin is not supported by the persistent shell; pipe the text into the command instead"}, nil
+		}
+		if res, err = sessionShell(ctx, p.Shell, cmdStr, dir); err != nil {
+			return map[string]any{"error": err.Error()}, nil
+		}
+	case p.PTY:
+		if res, err = ptyShell(ctx, cmdStr, dir, stdin, p.PTYIdleTimeout); err != nil {
+			return map[string]any{"error": err.Error()}, nil
+		}
+	default:
+		var stdout, stderr string
+		var rc int
+		if stdin == "" {
+			stdout, stderr, rc = shell.DefaultRunner.Run(ctx, cmdStr, dir)
+		} else if stdout, stderr, rc, err = shell.RunInput(ctx, shell.DefaultRunner, cmdStr, dir, stdin); err != nil {
+			return map[string]any{"error": err.Error()}, nil
+		}
+		res = map[string]any{
+			"returncode": rc,
+			"stdout":     Tail(stdout, maxToolOutputBytes),
+			"stderr":     Tail(stderr, maxToolOutputBytes),
 		}
 	}
-	if len(p.Allow) == 0 {
-		return true, ""
+	if name := shell.SandboxName(shell.DefaultRunner); name != "" {
+		res["sandbox"] = name
 	}
-	for _, a := range p.Allow {
-		if strings.Contains(cmdStr, a) {
-			return true, ""
-		}
+	if err := ctx.Err(); err != nil {
+		res["error"] = CancelReason(err)
 	}
-	return false, "not allowed by policy"
+	return res, nil
 }
 
-func exitCode(err error) int {
-	if err == nil {
-		return 0
+// sessionShell runs cmd in the persistent shell and reports its working
+// directory and environment changes along with the output.
+func sessionShell(ctx context.Context, sess *shell.Session, cmd, dir string) (map[string]any, error) {
+	r, err := sess.Run(ctx, cmd, dir)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.New(CancelReason(ctx.Err()))
+		}
+		return nil, err
+	}
+	res := map[string]any{
+		"returncode": r.ExitCode,
+		"stdout":     Tail(r.Stdout, maxToolOutputBytes),
+		"stderr":     Tail(r.Stderr, maxToolOutputBytes),
+	}
+	if r.Dir != "" {
+		res["cwd"] = r.Dir
+	}
+	if len(r.Env) > 0 {
+		res["env"] = r.Env
 	}
-	if ee, ok := err.(*exec.ExitError); ok {
-		return ee.ExitCode()
+	if len(r.Unset) > 0 {
+		res["unset_env"] = r.Unset
 	}
-	return 1
+	if r.Restarted {
+		res["note"] = "the previous shell had exited; this command ran in a new one, so the working directory and environment were reset"
+	}
+	if r.TimedOut {
+		res["error"] = "timed out"
+	}
+	if r.Exited {
+		res["shell_exited"] = true
+	}
+	return res, nil
 }
 
-func readFileToolExec(args map[string]any, _ *types.Policy) (map[string]any, error) {
-	path, _ := args["path"].(string)
-	if path == "" {
-		return nil, errors.New("missing path")
+// ptyShell runs cmd on a terminal and reports its output, and whether it
+// was killed for waiting for input or for going quiet.
+func ptyShell(ctx context.Context, cmd, dir, stdin string, idle time.Duration) (map[string]any, error) {
+	if idle == 0 {
+		idle = shell.DefaultIdleTimeout
 	}
-	b, err := os.ReadFile(path)
+	r, err := shell.RunPTY(ctx, shell.DefaultRunner, cmd, dir, shell.PTYOptions{Stdin: stdin, IdleTimeout: idle})
 	if err != nil {
-		return map[string]any{"error": err.Error()}, nil
+		return nil, err
+	}
+	res := map[string]any{
+		"returncode": r.ExitCode,
+		"output":     Tail(r.Output, maxToolOutputBytes),
 	}
-	txt := string(b)
-	if len(txt) > maxReadFileBytes {
-		return map[string]any{"text": txt[:maxReadFileBytes], "truncated": true}, nil
+	switch {
+	case r.WaitingForInput:
+		res["waiting_for_input"] = true
+		res["error"] = "killed while waiting for input; pass the answers in stdin or make the command non-interactive"
+	case r.Idle:
+		res["error"] = fmt.Sprintf("killed after %s without output", idle)
 	}
-	return map[string]any{"text": txt, "truncated": false}, nil
+	return res, nil
 }
 
-func writeFileToolExec(args map[string]any, p *types.Policy) (map[string]any, error) {
-	if p.Readonly {
-		return map[string]any{"error": "readonly session"}, nil
+// CancelReason describes why a tool call was stopped early by its context
+// ending with err: "timed out" or "cancelled".
+func CancelReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timed out"
 	}
+	return "cancelled"
+}
+
+func writeFileToolExec(_ context.Context, args map[string]any, p *types.Policy) (map[string]any, error) {
 	path, _ := args["path"].(string)
 	text, _ := args["text"].(string)
 	if path == "" {
 		return nil, errors.New("missing path")
 	}
-	if err := os.MkdirAll(DirOrDot(path), 0o755); err != nil {
+	path, err := p.ResolvePath(path, true)
+	if err != nil {
 		return map[string]any{"error": err.Error()}, nil
 	}
-	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
-		return map[string]any{"error": err.Error()}, nil
+	if p.Checkpoints != nil {
+		if err := p.Checkpoints.Save(path); err != nil {
+			return map[string]any{"error": "checkpoint: " + err.Error()}, nil
+		}
 	}
-	return map[string]any{"ok": true, "bytes": len(text)}, nil
-}
-
-func httpGetToolExec(args map[string]any, _ *types.Policy) (map[string]any, error) {
-	url, _ := args["url"].(string)
-	if url == "" {
-		return nil, errors.New("missing url")
+	fsys := fileSystem(p)
+	mode := os.FileMode(0o644)
+	if info, err := fsys.Stat(path); err == nil {
+		if info.IsDir() {
+			return map[string]any{"error": path + " is a directory"}, nil
+		}
+		mode = info.Mode().Perm()
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
-	defer cancel()
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	if err := fsys.WriteFile(path, []byte(text), mode); err != nil {
 		return map[string]any{"error": err.Error()}, nil
 	}
-	defer func() { _ = resp.Body.Close() }()
-	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxToolOutputBytes))
-	return map[string]any{"status": resp.StatusCode, "body": string(b)}, nil
+	return map[string]any{"ok": true, "bytes": len(text)}, nil
 }
 
 func DirOrDot(p string) string {
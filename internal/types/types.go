@@ -1,6 +1,18 @@
 package types
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dave1010/jorin/internal/shell"
+)
 
 // Messages and tool types
 
@@ -34,12 +46,19 @@ type ToolFunction struct {
 }
 
 type ChatRequest struct {
-	Model              string      `json:"model"`
-	Messages           []Message   `json:"messages"`
-	Tools              []Tool      `json:"tools,omitempty"`
-	ToolChoice         interface{} `json:"tool_choice,omitempty"` // "auto"
-	Temperature        float32     `json:"temperature,omitempty"`
-	PreviousResponseID string      `json:"previous_response_id,omitempty"`
+	Model              string         `json:"model"`
+	Messages           []Message      `json:"messages"`
+	Tools              []Tool         `json:"tools,omitempty"`
+	ToolChoice         interface{}    `json:"tool_choice,omitempty"` // "auto"
+	Temperature        float32        `json:"temperature,omitempty"`
+	PreviousResponseID string         `json:"previous_response_id,omitempty"`
+	Stream             bool           `json:"stream,omitempty"`
+	StreamOptions      *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions asks a streaming Chat Completions request for extras.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
 }
 
 type Choice struct {
@@ -50,19 +69,358 @@ type Choice struct {
 type ChatResponse struct {
 	ID      string   `json:"id,omitempty"`
 	Choices []Choice `json:"choices"`
+	// Usage is the token count reported for the request, when available.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Usage counts the tokens used by one model request.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Total returns the total token count, adding up the parts when the
+// provider did not report a total. A nil Usage counts as zero.
+func (u *Usage) Total() int {
+	if u == nil {
+		return 0
+	}
+	if u.TotalTokens > 0 {
+		return u.TotalTokens
+	}
+	return u.PromptTokens + u.CompletionTokens
 }
 
 // Policy controls agent/tool behavior
 type Policy struct {
-	Readonly bool
-	DryShell bool
-	Allow    []string
-	Deny     []string
-	CWD      string
+	Readonly bool `json:"readonly,omitempty"`
+	DryShell bool `json:"dry_shell,omitempty"`
+	// Allow and Deny hold shell command rules; see shell.CheckPolicy.
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	CWD   string   `json:"cwd,omitempty"`
+	// Roots confines the file tools (read_file, list_dir, glob, search,
+	// write_file, edit_file and apply_patch) to these directories; empty
+	// means no confinement. DenyRead globs name paths in them the file tools
+	// may neither read nor write, DenyWrite globs paths they may only read
+	// (see ResolvePath).
+	Roots     []string `json:"roots,omitempty"`
+	DenyRead  []string `json:"deny_read,omitempty"`
+	DenyWrite []string `json:"deny_write,omitempty"`
+	// HTTPAllow and HTTPDeny are host globs the HTTP tools may and may not
+	// reach; an empty HTTPAllow allows every host. Loopback, private and
+	// link-local addresses are refused unless HTTPPrivate is set.
+	HTTPAllow   []string `json:"http_allow,omitempty"`
+	HTTPDeny    []string `json:"http_deny,omitempty"`
+	HTTPPrivate bool     `json:"http_private,omitempty"`
+	// HTTPCredentials are headers the HTTP tools add to HTTPS requests to
+	// matching hosts. They are never shown to the model or saved with a
+	// session.
+	HTTPCredentials []HTTPCredential `json:"-"`
+	// DisabledTools lists tools hidden from the model and refused if called.
+	DisabledTools []string `json:"disabled_tools,omitempty"`
+	// ToolTimeout bounds each tool call. Zero means no limit.
+	ToolTimeout time.Duration `json:"tool_timeout,omitempty"`
+	// Approve selects which tool calls need the user's approval (one of the
+	// Approve* modes). Empty means ApproveNever.
+	Approve string `json:"approve,omitempty"`
+	// Approver is asked about calls that need approval. When it is nil those
+	// calls are refused.
+	Approver Approver `json:"-"`
+	// RuleFiles hold the rules of the user and project policy files, which
+	// internal/policy evaluates together with the settings above.
+	RuleFiles []PolicyFile `json:"rule_files,omitempty"`
+	// Checkpoints, if set, records files before the file tools change them
+	// so the changes can be undone.
+	Checkpoints Checkpointer `json:"-"`
+	// FS is the file system the file tools read and write, and that maps
+	// the shell's working directory. Nil means the operating system's.
+	FS FileSystem `json:"-"`
+	// Processes runs the background commands of the process tools. When it
+	// is nil those tools are unavailable.
+	Processes *shell.Supervisor `json:"-"`
+	// Shell, if set, runs the shell tool's commands in one persistent bash,
+	// so the working directory and environment carry over between calls.
+	Shell *shell.Session `json:"-"`
+	// PTY runs the shell tool's commands on a pseudo-terminal when Shell is
+	// nil (see shell.RunPTY). PTYIdleTimeout kills such a command after that
+	// long without output; zero means shell.DefaultIdleTimeout, and a
+	// negative value no limit.
+	PTY            bool          `json:"-"`
+	PTYIdleTimeout time.Duration `json:"-"`
+}
+
+// HTTPCredential is a header added to HTTPS requests to hosts matching
+// Host, a glob such as "api.github.com" or "*.example.com".
+type HTTPCredential struct {
+	Host   string
+	Header string
+	Value  string
+}
+
+// Decisions a policy rule can make.
+const (
+	DecisionAllow = "allow"
+	DecisionAsk   = "ask"
+	DecisionDeny  = "deny"
+)
+
+// PolicyRule matches tool calls and decides whether they run. Each list
+// matches if any entry does; an empty list matches every call.
+type PolicyRule struct {
+	// Tools are tool name globs, such as "shell" or "mcp__github__*".
+	Tools []string `json:"tool,omitempty"`
+	// Commands are shell command rules (see shell.CheckPolicy).
+	Commands []string `json:"command,omitempty"`
+	// Paths are file path globs (see MatchPathGlob).
+	Paths []string `json:"path,omitempty"`
+	// Hosts are URL host globs, such as "*.example.com".
+	Hosts    []string `json:"host,omitempty"`
+	Decision string   `json:"decision"`
+	Message  string   `json:"message,omitempty"`
+	// Line is where the rule starts in its file.
+	Line int `json:"line,omitempty"`
+}
+
+// PolicyFile is an ordered list of rules and the file they came from.
+type PolicyFile struct {
+	Path  string       `json:"path"`
+	Rules []PolicyRule `json:"rules"`
+}
+
+// Approval modes, from least to most prompting. Each mode also asks about
+// everything the previous one does.
+const (
+	ApproveNever  = "never"
+	ApproveShell  = "shell"  // shell commands
+	ApproveWrites = "writes" // shell commands and file writes
+	ApproveAlways = "always" // every tool call
+)
+
+// ApprovalRequest describes a tool call awaiting approval.
+type ApprovalRequest struct {
+	Tool string
+	Args map[string]any
+	// Reason says why the call needs approval, such as a policy rule's
+	// message.
+	Reason string
+	// FS holds the files the call would change (see Policy.FS). Nil means
+	// the operating system's.
+	FS FileSystem
+}
+
+// ApprovalDecision is the user's answer to an ApprovalRequest.
+type ApprovalDecision struct {
+	Allow bool
+	// Reason explains a denial to the model.
+	Reason string
+	// Args replaces the call's arguments when the user edited them.
+	Args map[string]any
+}
+
+// Approver asks the user whether a tool call may run. Implementations must
+// be safe for concurrent use; sub-agents share their parent's Approver.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) ApprovalDecision
+}
+
+// Checkpointer records the state of files before a tool changes them (see
+// internal/checkpoint). Implementations must be safe for concurrent use.
+type Checkpointer interface {
+	// Save records each absolute path's content, or that it does not
+	// exist, unless the current checkpoint already holds it.
+	Save(paths ...string) error
+}
+
+// FileSystem is what the file tools see of the files under the workspace,
+// such as an overlay that keeps a run's changes out of the real tree (see
+// internal/overlay). Paths are absolute and already resolved by
+// ResolvePath. Implementations must be safe for concurrent use.
+type FileSystem interface {
+	ReadFile(path string) ([]byte, error)
+	Stat(path string) (fs.FileInfo, error)
+	// ReadDir lists the directory at path, sorted by name.
+	ReadDir(path string) ([]fs.DirEntry, error)
+	// WriteFile replaces the file at path, creating its directory.
+	WriteFile(path string, data []byte, mode fs.FileMode) error
+	Remove(path string) error
+	// ShellDir returns the directory shell commands for dir run in.
+	ShellDir(dir string) (string, error)
+}
+
+// AsksApproval reports whether any tool call can need approval, through the
+// Approve mode or an "ask" rule.
+func (p *Policy) AsksApproval() bool {
+	if p == nil {
+		return false
+	}
+	if p.Approve != "" && p.Approve != ApproveNever {
+		return true
+	}
+	for _, f := range p.RuleFiles {
+		for _, r := range f.Rules {
+			if r.Decision == DecisionAsk {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Agent is the minimal interface used by the UI to interact with an LLM
 // backend. Implementations (e.g., internal/agent) should satisfy this.
 type Agent interface {
-	ChatSession(model string, msgs []Message, pol *Policy) ([]Message, string, error)
+	ChatSession(ctx context.Context, model string, msgs []Message, pol *Policy) ([]Message, string, error)
+}
+
+// ToolDisabled reports whether the named tool is disabled by the policy.
+func (p *Policy) ToolDisabled(name string) bool {
+	if p == nil {
+		return false
+	}
+	for _, t := range p.DisabledTools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestApproval asks p.Approver about a call that needs approval for
+// reason and returns the arguments to run it with, or an error explaining the
+// refusal. Without an Approver the call is refused, so runs that cannot ask
+// the user fail closed.
+func (p *Policy) RequestApproval(ctx context.Context, tool string, args map[string]any, reason string) (map[string]any, error) {
+	if p.Approver == nil {
+		return nil, fmt.Errorf("approval required (%s) but there is no terminal to ask", reason)
+	}
+	d := p.Approver.Approve(ctx, ApprovalRequest{Tool: tool, Args: args, Reason: reason, FS: p.FS})
+	if !d.Allow {
+		if ctx.Err() != nil {
+			return nil, errors.New("cancelled")
+		}
+		if d.Reason != "" {
+			return nil, errors.New("denied by user: " + d.Reason)
+		}
+		return nil, errors.New("denied by user")
+	}
+	if d.Args != nil {
+		return d.Args, nil
+	}
+	return args, nil
+}
+
+// Narrow returns the policy for a sub-agent that asks for req. The result is
+// never wider than p: readonly and dry-shell stay on once set, deny lists and
+// disabled tools are combined, an allow list can only be tightened, the
+// working directory must lie inside p's and also narrows Roots, and the
+// tool timeout can only get shorter. A request that would widen p is an
+// error.
+func (p Policy) Narrow(req Policy) (Policy, error) {
+	out := p
+	out.Readonly = p.Readonly || req.Readonly
+	out.DryShell = p.DryShell || req.DryShell
+	out.Deny = appendMissing(append([]string(nil), p.Deny...), req.Deny)
+	out.DisabledTools = appendMissing(append([]string(nil), p.DisabledTools...), req.DisabledTools)
+
+	if len(req.Allow) > 0 {
+		// Every command a requested rule allows must also be allowed by a
+		// parent rule.
+		for _, a := range req.Allow {
+			if len(p.Allow) > 0 && !coveredBy(a, p.Allow) {
+				return p, fmt.Errorf("allow %q is wider than the parent allow list", a)
+			}
+		}
+		out.Allow = append([]string(nil), req.Allow...)
+	}
+
+	if req.CWD != "" {
+		base := p.CWD
+		if base == "" {
+			wd, err := os.Getwd()
+			if err != nil {
+				return p, err
+			}
+			base = wd
+		}
+		cwd := req.CWD
+		if !filepath.IsAbs(cwd) {
+			cwd = filepath.Join(base, cwd)
+		}
+		if !within(resolvePath(base), resolvePath(cwd)) {
+			return p, fmt.Errorf("cwd %q is outside the parent working directory %s", req.CWD, base)
+		}
+		out.CWD = filepath.Clean(cwd)
+		if out.Roots = narrowRoots(p.Roots, out.CWD); len(out.Roots) == 0 {
+			return p, fmt.Errorf("cwd %q is outside the workspace (%s)", req.CWD, strings.Join(p.Roots, ", "))
+		}
+	}
+
+	if req.ToolTimeout > 0 && (p.ToolTimeout == 0 || req.ToolTimeout < p.ToolTimeout) {
+		out.ToolTimeout = req.ToolTimeout
+	}
+	return out, nil
+}
+
+// narrowRoots returns the part of the workspace roots that lies in dir: dir
+// itself when a root contains it (or there are no roots), otherwise the
+// roots inside it.
+func narrowRoots(roots []string, dir string) []string {
+	if len(roots) == 0 {
+		return []string{dir}
+	}
+	real := resolvePath(dir)
+	var out []string
+	for _, r := range roots {
+		switch rr := resolvePath(r); {
+		case within(rr, real):
+			return []string{dir}
+		case within(real, rr):
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func appendMissing(list []string, add []string) []string {
+	for _, a := range add {
+		found := false
+		for _, l := range list {
+			if l == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+func coveredBy(rule string, parents []string) bool {
+	for _, p := range parents {
+		if shell.RuleCovers(p, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath makes p absolute and resolves symlinks where it exists.
+func resolvePath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		return real
+	}
+	return filepath.Clean(p)
+}
+
+// within reports whether path is dir or inside it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
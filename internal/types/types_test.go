@@ -0,0 +1,139 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyNarrowNeverWidens(t *testing.T) {
+	dir := t.TempDir()
+	parent := Policy{
+		Allow:         []string{"go ", "git status"},
+		Deny:          []string{"rm -rf"},
+		DisabledTools: []string{"http_get"},
+		CWD:           dir,
+		ToolTimeout:   time.Minute,
+	}
+	child, err := parent.Narrow(Policy{
+		Readonly:    true,
+		Allow:       []string{"go test"},
+		Deny:        []string{"sudo", "rm -rf"},
+		CWD:         "sub",
+		ToolTimeout: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Narrow: %v", err)
+	}
+	if !child.Readonly || child.Allow[0] != "go test" || len(child.Allow) != 1 {
+		t.Fatalf("unexpected readonly/allow: %+v", child)
+	}
+	if len(child.Deny) != 2 || child.DisabledTools[0] != "http_get" {
+		t.Fatalf("deny and disabled tools must be kept: %+v", child)
+	}
+	if child.CWD != filepath.Join(dir, "sub") || child.ToolTimeout != time.Minute {
+		t.Fatalf("unexpected cwd/timeout: %+v", child)
+	}
+	if len(child.Roots) != 1 || child.Roots[0] != child.CWD {
+		t.Fatalf("the file tools should be confined to the cwd: %+v", child.Roots)
+	}
+	if len(parent.Deny) != 1 {
+		t.Fatalf("Narrow must not modify the parent: %+v", parent)
+	}
+
+	// an empty request inherits everything
+	same, err := (Policy{Readonly: true, DryShell: true}).Narrow(Policy{})
+	if err != nil || !same.Readonly || !same.DryShell {
+		t.Fatalf("unexpected inherited policy: %+v %v", same, err)
+	}
+
+	// roots inside the requested cwd are kept, the rest dropped
+	wide := Policy{CWD: dir, Roots: []string{filepath.Join(dir, "a"), filepath.Join(dir, "b", "c")}}
+	narrowed, err := wide.Narrow(Policy{CWD: "b"})
+	if err != nil || len(narrowed.Roots) != 1 || narrowed.Roots[0] != filepath.Join(dir, "b", "c") {
+		t.Fatalf("unexpected roots: %+v %v", narrowed.Roots, err)
+	}
+	if _, err := wide.Narrow(Policy{CWD: "d"}); err == nil {
+		t.Errorf("expected a cwd outside every root to be refused")
+	}
+
+	for _, req := range []Policy{
+		{Allow: []string{"curl"}},
+		{Allow: []string{"g*"}}, // matches more programs than "go"
+		{CWD: filepath.Dir(dir)},
+		{CWD: "../escape"},
+	} {
+		if _, err := parent.Narrow(req); err == nil {
+			t.Errorf("expected %+v to be refused", req)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, d := range []string{"src", ".git"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{"src/escape": outside, "src/key": filepath.Join(root, "id.pem"), "new": filepath.Join(outside, "later.txt")}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	p := Policy{CWD: filepath.Join(root, "src"), Roots: []string{root}, DenyRead: []string{".env*", "*.pem"}, DenyWrite: []string{".git/**"}}
+
+	got, err := p.ResolvePath("main.go", true)
+	if err != nil || got != filepath.Join(resolvePath(root), "src", "main.go") {
+		t.Fatalf("relative paths should resolve from CWD: %q %v", got, err)
+	}
+	if _, err := p.ResolvePath(".git/config", false); err != nil {
+		t.Fatalf(".git may be read: %v", err)
+	}
+	refused := []struct {
+		path  string
+		write bool
+		want  string
+	}{
+		{"../../etc/passwd", false, "outside the workspace"},
+		{filepath.Join(outside, "x"), false, "outside the workspace"},
+		{"escape/x", false, "outside the workspace"},
+		{"../new", true, "outside the workspace"},
+		{"../.env.local", false, `deny_read ".env*"`},
+		{"key", false, `deny_read "*.pem"`},
+		{"../.git/config", true, `deny_write ".git/**"`},
+		{"vendor/x/.git/HEAD", true, `deny_write ".git/**"`},
+	}
+	for _, c := range refused {
+		if _, err := p.ResolvePath(c.path, c.write); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s (write=%v): got %v, want an error containing %q", c.path, c.write, err, c.want)
+		}
+	}
+}
+
+func TestMatchPathGlob(t *testing.T) {
+	cases := []struct {
+		glob, rel string
+		want      bool
+	}{
+		{".env*", ".env", true},
+		{".env*", "config/.env.prod", true},
+		{"*.pem", "certs/server.pem", true},
+		{"*.pem", "pem.txt", false},
+		{".git/**", ".git", true},
+		{".git/**", "sub/.git/objects/ab", true},
+		{"/.git/**", "sub/.git/HEAD", false},
+		{"secrets/*.json", "a/secrets/k.json", true},
+		{"secrets/*.json", "secrets/a/k.json", false},
+		{"**/id_rsa", "home/.ssh/id_rsa", true},
+	}
+	for _, c := range cases {
+		if got := MatchPathGlob(c.glob, c.rel); got != c.want {
+			t.Errorf("MatchPathGlob(%q, %q) = %v, want %v", c.glob, c.rel, got, c.want)
+		}
+	}
+}
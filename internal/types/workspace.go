@@ -0,0 +1,185 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxSymlinks bounds the links followed while resolving a path.
+const maxSymlinks = 40
+
+// ResolvePath returns the absolute path a file tool should use for path.
+// Relative paths are taken from the working directory (CWD, or the process
+// directory) and symlinks are resolved, including a final link that does not
+// exist yet. The result must be inside one of Roots, when there are any, and
+// must not match DenyRead or, when write is set, DenyWrite.
+func (p *Policy) ResolvePath(path string, write bool) (string, error) {
+	real, rel, inside, err := p.WorkspacePath(path)
+	if err != nil {
+		return "", err
+	}
+	if len(p.Roots) > 0 && !inside {
+		return "", fmt.Errorf("%s is outside the workspace (%s)", path, strings.Join(p.Roots, ", "))
+	}
+	if g := p.ReadDenied(rel); g != "" {
+		return "", fmt.Errorf("%s is protected by deny_read %q", path, g)
+	}
+	if write {
+		for _, g := range p.DenyWrite {
+			if MatchPathGlob(g, rel) {
+				return "", fmt.Errorf("%s is protected by deny_write %q", path, g)
+			}
+		}
+	}
+	return real, nil
+}
+
+// ReadDenied returns the DenyRead glob that protects the workspace-relative
+// path rel (see WorkspacePath), or "" if none does.
+func (p *Policy) ReadDenied(rel string) string {
+	for _, g := range p.DenyRead {
+		if MatchPathGlob(g, rel) {
+			return g
+		}
+	}
+	return ""
+}
+
+// WorkspacePath resolves path as ResolvePath does without checking it. rel
+// is the slash-separated path relative to the deepest root containing it
+// (without Roots, the working directory) and inside reports whether there is
+// one; otherwise rel is the absolute path.
+func (p *Policy) WorkspacePath(path string) (abs, rel string, inside bool, err error) {
+	base := p.CWD
+	if base == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", "", false, err
+		}
+		base = wd
+	}
+	abs = path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(base, abs)
+	}
+	if abs, err = resolveLinks(filepath.Clean(abs), 0); err != nil {
+		return "", "", false, err
+	}
+
+	roots := p.Roots
+	if len(roots) == 0 {
+		roots = []string{base}
+	}
+	top := ""
+	for _, r := range roots {
+		r = resolvePath(r)
+		if within(r, abs) && len(r) > len(top) {
+			top = r
+		}
+	}
+	if top == "" {
+		return abs, filepath.ToSlash(abs), false, nil
+	}
+	rel, _ = filepath.Rel(top, abs)
+	return abs, filepath.ToSlash(rel), true, nil
+}
+
+// resolveLinks is filepath.EvalSymlinks for paths that may not exist yet:
+// the existing part is resolved and the rest appended.
+func resolveLinks(path string, depth int) (string, error) {
+	if depth > maxSymlinks {
+		return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real, nil
+	}
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	if dir == path {
+		return path, nil
+	}
+	realDir, err := resolveLinks(dir, depth+1)
+	if err != nil {
+		return "", err
+	}
+	joined := filepath.Join(realDir, name)
+	if st, err := os.Lstat(joined); err == nil && st.Mode()&os.ModeSymlink != 0 {
+		// a dangling link: check where it points, not where it sits
+		target, err := os.Readlink(joined)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(realDir, target)
+		}
+		return resolveLinks(filepath.Clean(target), depth+1)
+	}
+	return joined, nil
+}
+
+// MatchPathGlob reports whether the slash-separated relative path matches a
+// protected-path glob. "*" and "?" stay within one path element and "**"
+// crosses them; "dir/**" also matches dir itself. A glob without a slash
+// matches any element of the path (".env*" matches "config/.env.local"), a
+// glob with one matches at any depth unless it starts with "/", which anchors
+// it at the root.
+func MatchPathGlob(glob, rel string) bool {
+	if rel == "." || rel == "" {
+		return false
+	}
+	if !strings.Contains(glob, "/") {
+		re := globRegexp(glob)
+		for _, el := range strings.Split(rel, "/") {
+			if re.MatchString(el) {
+				return true
+			}
+		}
+		return false
+	}
+	anchored := strings.HasPrefix(glob, "/")
+	glob = strings.TrimPrefix(glob, "/")
+	globs := []string{glob}
+	if strings.HasSuffix(glob, "/**") {
+		globs = append(globs, strings.TrimSuffix(glob, "/**"))
+	}
+	for _, g := range globs {
+		re := globRegexp(g)
+		for s := rel; ; {
+			if re.MatchString(s) {
+				return true
+			}
+			i := strings.IndexByte(s, '/')
+			if anchored || i < 0 {
+				break
+			}
+			s = s[i+1:]
+		}
+	}
+	return false
+}
+
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}